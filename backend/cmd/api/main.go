@@ -1,10 +1,14 @@
 package main
 
 import (
+    "bytes"
+    "errors"
     "log"
     "fmt"
+    "math"
     "net/http"
     "strconv"
+    "strings"
     "time"
     
     "github.com/gin-gonic/gin"
@@ -13,6 +17,7 @@ import (
     "store-navigator/internal/database"
     "store-navigator/internal/models"
     "store-navigator/internal/middleware" 
+    "store-navigator/internal/services"
     "store-navigator/internal/utils"
 )
 
@@ -49,10 +54,193 @@ func loadSubSectorsAndProducts(db *gorm.DB, sector *models.Sector) {
         sector.ID, sector.Name, len(products), len(subSectors))
 }
 
+// Загружает сцену карты этажа (floor_id, по умолчанию все объекты) с необязательным маршрутом
+// (route=x1,y1;x2,y2) и выделенным товаром (product_id). При ошибке сам отвечает клиенту
+func loadMapScene(c *gin.Context, mapRenderService *services.MapRenderService) (*services.MapScene, bool) {
+    scene, err := mapRenderService.LoadScene(utils.StringToUint(c.Param("id")), floorIDParam(c, "floor_id"))
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Магазин не найден"})
+        return nil, false
+    }
+    
+    if route := c.Query("route"); route != "" {
+        points, err := utils.ParsePoints(route)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return nil, false
+        }
+        scene.Route = points
+    }
+    
+    if productID := c.Query("product_id"); productID != "" {
+        if err := mapRenderService.HighlightProduct(scene, utils.StringToUint(productID)); err != nil {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Product not found in this store"})
+            return nil, false
+        }
+    }
+    return scene, true
+}
+
+// Разбирает область просмотра из параметров min_x, min_y, max_x, max_y.
+// Возвращает nil, если область не задана
+func parseViewportArea(c *gin.Context) (*utils.Rect, error) {
+    minX, minY := c.Query("min_x"), c.Query("min_y")
+    maxX, maxY := c.Query("max_x"), c.Query("max_y")
+    if minX == "" && minY == "" && maxX == "" && maxY == "" {
+        return nil, nil
+    }
+    
+    area, err := utils.ParseRect(minX, minY, maxX, maxY)
+    if err != nil {
+        return nil, err
+    }
+    return &area, nil
+}
+
+// parseTimeRange разбирает необязательные параметры from и to в формате RFC 3339
+func parseTimeRange(c *gin.Context) (from, to *time.Time, err error) {
+    for _, param := range []string{"from", "to"} {
+        value := c.Query(param)
+        if value == "" {
+            continue
+        }
+        t, err := time.Parse(time.RFC3339, value)
+        if err != nil {
+            return nil, nil, errors.New(param + " must be an RFC 3339 time")
+        }
+        if param == "from" {
+            from = &t
+        } else {
+            to = &t
+        }
+    }
+    return from, to, nil
+}
+
+// analyticsPeriod возвращает период отчета из параметров from и to, по умолчанию - последние сутки
+func analyticsPeriod(c *gin.Context) (time.Time, time.Time, error) {
+    from, to, err := parseTimeRange(c)
+    if err != nil {
+        return time.Time{}, time.Time{}, err
+    }
+    end := time.Now()
+    if to != nil {
+        end = *to
+    }
+    start := end.Add(-24 * time.Hour)
+    if from != nil {
+        start = *from
+    }
+    if !end.After(start) {
+        return time.Time{}, time.Time{}, errors.New("to must be after from")
+    }
+    return start, end, nil
+}
+
+// journeyQuery разбирает параметры date (YYYY-MM-DD) и level отчетов о путях покупателей
+func journeyQuery(c *gin.Context) (services.JourneyQuery, error) {
+    query := services.JourneyQuery{StoreID: utils.StringToUint(c.Param("id")), Day: time.Now()}
+    if value := c.Query("date"); value != "" {
+        day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+        if err != nil {
+            return query, errors.New("date must be in YYYY-MM-DD format")
+        }
+        query.Day = day
+    }
+    if value := c.Query("level"); value != "" {
+        level, err := strconv.Atoi(value)
+        if err != nil || level < 0 {
+            return query, errors.New("level must be a non-negative integer")
+        }
+        query.Level = level
+    }
+    return query, nil
+}
+
+// floorIDParam разбирает необязательный ID этажа из параметра запроса; nil - этаж не указан
+func floorIDParam(c *gin.Context, name string) *uint {
+    id := utils.StringToUint(c.Query(name))
+    if id == 0 {
+        return nil
+    }
+    return &id
+}
+
+// routeEndpoint разбирает точку маршрута из параметров <prefix>_x, <prefix>_y и <prefix>_floor.
+// Возвращает nil, если координаты не заданы
+func routeEndpoint(c *gin.Context, prefix string) (*services.RouteEndpoint, error) {
+    x, y := c.Query(prefix+"_x"), c.Query(prefix+"_y")
+    if x == "" && y == "" {
+        return nil, nil
+    }
+    px, errX := strconv.ParseFloat(x, 64)
+    py, errY := strconv.ParseFloat(y, 64)
+    if errX != nil || errY != nil || math.IsNaN(px) || math.IsInf(px, 0) || math.IsNaN(py) || math.IsInf(py, 0) {
+        return nil, errors.New(prefix + "_x and " + prefix + "_y must be numbers")
+    }
+    return &services.RouteEndpoint{Point: utils.Point{X: px, Y: py}, FloorID: floorIDParam(c, prefix+"_floor")}, nil
+}
+
 func main() {
     // Инициализация базы данных
     db := initDatabase()
     
+    mapService := services.NewMapService(db)
+    floorPlanService := services.NewFloorPlanService(db, services.NewLocalBlobStore("./uploads"))
+    mapRenderService := services.NewMapRenderService(db)
+    geoJSONService := services.NewGeoJSONService(db)
+    imdfService := services.NewIMDFService(db)
+    dxfImportService := services.NewDXFImportService(db)
+    productImportService := services.NewProductImportService(db)
+    catalogService := services.NewCatalogService(db)
+    barcodeService := services.NewBarcodeService(db)
+    planogramService := services.NewPlanogramService(db)
+    priceService := services.NewPriceService(db)
+    promotionService := services.NewPromotionService(db)
+    proximityService := services.NewProximityService(db)
+    analyticsService := services.NewAnalyticsService(db)
+    journeyService := services.NewJourneyService(db)
+    floorService := services.NewFloorService(db)
+    routeService := services.NewRouteService(db)
+    closureService := services.NewClosureService(db)
+    distanceService := services.NewDistanceService(db)
+    evacuationService := services.NewEvacuationService(db)
+    pickingService := services.NewPickingService(db)
+    shoppingService := services.NewShoppingService(db)
+    coverageService := services.NewCoverageService(db)
+    
+    // Запланированные цены и окончание акций применяются раз в минуту,
+    // там же агрегируются завершенные часы аналитики посещаемости и сутки посещений
+    if db != nil {
+        go func() {
+            for now := range time.Tick(time.Minute) {
+                if n, err := priceService.ApplyDue(now); err != nil {
+                    log.Printf("Failed to apply scheduled prices: %v", err)
+                } else if n > 0 {
+                    log.Printf("Scheduled prices applied to %d products", n)
+                }
+                if _, err := analyticsService.RollupDue(now); err != nil {
+                    log.Printf("Failed to roll up analytics: %v", err)
+                }
+                if _, err := journeyService.BuildDue(now); err != nil {
+                    log.Printf("Failed to build customer journeys: %v", err)
+                }
+            }
+        }()
+        
+        // Матрицы расстояний магазинов с измененной планировкой пересчитываются отдельно,
+        // чтобы расчет для большого магазина не задерживал применение цен
+        go func() {
+            for range time.Tick(time.Minute) {
+                if n, err := distanceService.RefreshDue(); err != nil {
+                    log.Printf("Failed to precompute distance matrices: %v", err)
+                } else if n > 0 {
+                    log.Printf("Distance matrices precomputed for %d stores", n)
+                }
+            }
+        }()
+    }
+    
     r := gin.Default()
 
     r.Use(func(c *gin.Context) {
@@ -218,6 +406,13 @@ func main() {
     if db != nil {
         adminGroup.Use(middleware.AdminMiddleware(db))
     }
+    // Любое успешное изменение через админку может затронуть планировку - кэш графов навигации сбрасывается
+    adminGroup.Use(func(c *gin.Context) {
+        c.Next()
+        if c.Request.Method != http.MethodGet && c.Writer.Status() < http.StatusBadRequest {
+            services.DropNavGraphs()
+        }
+    })
     {
         // Управление магазинами
         adminGroup.POST("/stores", func(c *gin.Context) {
@@ -259,10 +454,24 @@ func main() {
             }
             
             // Каскадное удаление связанных данных
+            db.Where("sector_id IN (?)", db.Model(&models.Sector{}).Select("id").Where("store_id = ?", storeID)).Delete(&models.Product{})
             db.Where("store_id = ?", storeID).Delete(&models.Sector{})
             db.Where("store_id = ?", storeID).Delete(&models.Beacon{})
             db.Where("store_id = ?", storeID).Delete(&models.MapElement{})
             db.Where("store_id = ?", storeID).Delete(&models.Wall{})
+            db.Where("fixture_id IN (?)", db.Model(&models.Fixture{}).Select("id").Where("store_id = ?", storeID)).Delete(&models.ProductPlacement{})
+            db.Where("store_id = ?", storeID).Delete(&models.Fixture{})
+            db.Where("promotion_id IN (?)", db.Model(&models.Promotion{}).Select("id").Where("store_id = ?", storeID)).Delete(&models.PromotionProduct{})
+            db.Where("store_id = ?", storeID).Delete(&models.Promotion{})
+            db.Where("order_id IN (?)", db.Model(&models.Order{}).Select("id").Where("store_id = ?", storeID)).Delete(&models.OrderLine{})
+            db.Where("store_id = ?", storeID).Delete(&models.Order{})
+            db.Where("connector_id IN (?)", db.Model(&models.VerticalConnector{}).Select("id").Where("store_id = ?", storeID)).Delete(&models.ConnectorStop{})
+            for _, model := range []interface{}{&models.VerticalConnector{}, &models.Floor{}, &models.PositionFix{}, &models.DevicePresence{}, &models.GeofenceEvent{}, &models.OfferRule{}, &models.OfferImpression{},
+                &models.AnalyticsWindow{}, &models.SectorOccupancy{}, &models.HeatmapCell{}, &models.CustomerJourney{}, &models.JourneyDay{}, &models.Closure{}, &models.PickingBatch{}} {
+                db.Where("store_id = ?", storeID).Delete(model)
+            }
+            floorPlanService.DeleteAll(store.ID)
+            distanceService.Invalidate(store.ID)
             
             // Удаляем сам магазин
             db.Delete(&store)
@@ -281,6 +490,13 @@ func main() {
             }
             
             sector.StoreID = utils.StringToUint(storeID)
+            if sector.TemperatureZone == "" {
+                sector.TemperatureZone = models.TemperatureAmbient
+            }
+            if !services.IsTemperatureZone(sector.TemperatureZone) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "temperature_zone must be ambient, chilled or frozen"})
+                return
+            }
             db.Create(&sector)
             c.JSON(http.StatusOK, sector)
         })
@@ -298,6 +514,13 @@ func main() {
                 c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sector data"})
                 return
             }
+            if sector.TemperatureZone == "" {
+                sector.TemperatureZone = models.TemperatureAmbient
+            }
+            if !services.IsTemperatureZone(sector.TemperatureZone) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "temperature_zone must be ambient, chilled or frozen"})
+                return
+            }
             
             db.Save(&sector)
             c.JSON(http.StatusOK, sector)
@@ -320,11 +543,12 @@ func main() {
                 return
             }
             
-            // Удаляем связанные товары
-            db.Where("sector_id = ?", sectorID).Delete(&models.Product{})
-            
-            // Удаляем сектор
-            db.Delete(&sector)
+            // Удаляем сектор вместе со стеллажами, товарами и выкладкой
+            if err := services.DeleteSectors(db, []uint{sector.ID}); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sector"})
+                return
+            }
+            distanceService.Invalidate(sector.StoreID)
             
             c.JSON(http.StatusOK, gin.H{"message": "Sector deleted successfully"})
         })
@@ -341,6 +565,9 @@ func main() {
             
             product.SectorID = utils.StringToUint(sectorID)
             db.Create(&product)
+            if err := priceService.RecordChange(&product, nil); err != nil {
+                log.Printf("Failed to record price of product %d: %v", product.ID, err)
+            }
             c.JSON(http.StatusOK, product)
         })
 
@@ -353,12 +580,34 @@ func main() {
                 return
             }
             
-            if err := c.BindJSON(&product); err != nil {
+            // Обычная цена задается полем regular_price. Без него price меняет обычную цену только
+            // вне акции: при действующей акции Product.Price содержит акционную, она в историю не записывается
+            current, err := priceService.Current(&product, time.Now())
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load product price"})
+                return
+            }
+            req := struct {
+                models.Product
+                RegularPrice *float64 `json:"regular_price"`
+            }{Product: product}
+            if err := c.BindJSON(&req); err != nil {
                 c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product data"})
                 return
             }
+            product = req.Product
+            switch {
+            case req.RegularPrice != nil:
+                product.Price = *req.RegularPrice
+            case current.Promo != nil:
+                product.Price = current.RegularPrice
+            }
             
             db.Save(&product)
+            // Цена попадает в историю; при действующей акции в Product.Price остается акционная цена
+            if err := priceService.RecordChange(&product, &current.RegularPrice); err != nil {
+                log.Printf("Failed to record price of product %d: %v", product.ID, err)
+            }
             c.JSON(http.StatusOK, product)
         })
 
@@ -371,6 +620,8 @@ func main() {
                 return
             }
             
+            db.Where("product_id = ?", product.ID).Delete(&models.ProductPlacement{})
+            db.Where("product_id = ?", product.ID).Delete(&models.PromotionProduct{})
             db.Delete(&product)
             c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
         })
@@ -413,12 +664,91 @@ func main() {
             c.JSON(http.StatusOK, beacon)
         })
 
+        // Покрытие этажа маячками (floor_id, по умолчанию нижний) с учетом затухания на стенах: области, где видно
+        // меньше трех маячков, и места для новых маячков. cell_size, threshold (dBm), wall_loss (dB), target (доля 0..1),
+        // suggestions - параметры расчета; format=json (по умолчанию) или svg
+        adminGroup.GET("/stores/:id/beacon-coverage", func(c *gin.Context) {
+            var store models.Store
+            if err := db.First(&store, c.Param("id")).Error; err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+                return
+            }
+            format := c.DefaultQuery("format", "json")
+            if format != "json" && format != "svg" {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json or svg"})
+                return
+            }
+            var options services.CoverageOptions
+            for name, target := range map[string]*float64{"cell_size": &options.CellSize, "threshold": &options.Threshold,
+                "wall_loss": &options.WallLoss, "target": &options.Target} {
+                if value := c.Query(name); value != "" {
+                    parsed, err := strconv.ParseFloat(value, 64)
+                    if err != nil {
+                        c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a number"})
+                        return
+                    }
+                    *target = parsed
+                }
+            }
+            if value := c.Query("suggestions"); value != "" {
+                parsed, err := strconv.Atoi(value)
+                if err != nil {
+                    c.JSON(http.StatusBadRequest, gin.H{"error": "suggestions must be an integer"})
+                    return
+                }
+                options.MaxSuggestions = parsed
+            }
+            
+            coverage, err := coverageService.Coverage(store.ID, floorIDParam(c, "floor_id"), options)
+            switch {
+            case errors.Is(err, services.ErrInvalidCoverageOptions):
+                c.JSON(http.StatusBadRequest, gin.H{"error": "cell_size must be at least 0.25, threshold negative, wall_loss non-negative, target between 0 and 1"})
+                return
+            case errors.Is(err, services.ErrFloorNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+                return
+            case errors.Is(err, services.ErrPointOutsideMap):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Store map is empty"})
+                return
+            case err != nil:
+                log.Printf("Beacon coverage failed for store %d: %v", store.ID, err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute beacon coverage"})
+                return
+            }
+            if format == "json" {
+                c.JSON(http.StatusOK, coverage)
+                return
+            }
+            
+            scene, err := mapRenderService.LoadScene(store.ID, coverage.FloorID)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load map"})
+                return
+            }
+            scene.Closures = nil
+            scene.Coverage = coverage
+            c.Header("Content-Type", "image/svg+xml; charset=utf-8")
+            if err := services.RenderSVG(c.Writer, scene); err != nil {
+                log.Printf("SVG rendering failed for store %d: %v", store.ID, err)
+            }
+        })
+
         // Управление элементами карты
         adminGroup.GET("/stores/:id/map-elements", func(c *gin.Context) {
-            storeID := c.Param("id")
-            var elements []models.MapElement
+            storeID := utils.StringToUint(c.Param("id"))
+            
+            // Необязательная фильтрация по области просмотра и типу элемента
+            area, err := parseViewportArea(c)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
             
-            db.Where("store_id = ?", storeID).Find(&elements)
+            elements, err := mapService.FilterElements(storeID, area, services.SplitList(c.Query("type")))
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load elements"})
+                return
+            }
             c.JSON(http.StatusOK, gin.H{"elements": elements})
         })
 
@@ -505,12 +835,18 @@ func main() {
             c.JSON(http.StatusOK, gin.H{"message": "Wall deleted successfully"})
         })
 
-        // Конфигурация карты магазина
+        // Конфигурация карты магазина; floor_id - конфигурация этажа (если ее нет, отдается общая)
         adminGroup.GET("/stores/:id/map-config", func(c *gin.Context) {
             storeID := c.Param("id")
             var config models.StoreMapConfig
             
-            result := db.Where("store_id = ?", storeID).First(&config)
+            result := db.Where("store_id = ? AND floor_id IS NULL", storeID).First(&config)
+            if floorID := floorIDParam(c, "floor_id"); floorID != nil {
+                var floorConfig models.StoreMapConfig
+                if db.Where("store_id = ? AND floor_id = ?", storeID, *floorID).First(&floorConfig).Error == nil {
+                    config, result.Error = floorConfig, nil
+                }
+            }
             if result.Error != nil {
                 // Возвращаем конфигурацию по умолчанию
                 c.JSON(http.StatusOK, gin.H{
@@ -521,6 +857,7 @@ func main() {
                     "scale": 20.0, // 20 пикселей на метр
                     "origin_x": 0.0,
                     "origin_y": 0.0,
+                    "rotation": 0.0,
                 })
                 return
             }
@@ -538,10 +875,22 @@ func main() {
             }
             
             config.StoreID = utils.StringToUint(storeID)
+            config.FloorID = floorIDParam(c, "floor_id")
             
             // Проверяем существующую конфигурацию
             var existingConfig models.StoreMapConfig
-            result := db.Where("store_id = ?", storeID).First(&existingConfig)
+            query := db.Where("store_id = ?", storeID)
+            if config.FloorID != nil {
+                var floor models.Floor
+                if err := db.Where("id = ? AND store_id = ?", *config.FloorID, storeID).First(&floor).Error; err != nil {
+                    c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+                    return
+                }
+                query = query.Where("floor_id = ?", *config.FloorID)
+            } else {
+                query = query.Where("floor_id IS NULL")
+            }
+            result := query.First(&existingConfig)
             
             if result.Error == nil {
                 // Обновляем существующую
@@ -554,151 +903,1944 @@ func main() {
             
             c.JSON(http.StatusOK, config)
         })
-    }
 
-
-
-r.GET("/api/debug/stores", func(c *gin.Context) {
-    if db == nil {
-        c.JSON(http.StatusOK, gin.H{
-            "message": "Database is nil",
-            "stores": []gin.H{
-                {
-                    "id":      1,
-                    "name":    "Тестовый магазин (без БД)",
-                    "address": "Режим без базы данных",
-                },
-            },
+        // Этажи магазина и вертикальные переходы между ними
+        adminGroup.GET("/stores/:id/floors", func(c *gin.Context) {
+            floors, err := floorService.ListFloors(utils.StringToUint(c.Param("id")))
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load floors"})
+                return
+            }
+            c.JSON(http.StatusOK, floors)
         })
-        return
-    }
-    
-    var stores []models.Store
-    result := db.Find(&stores)
-    
-    c.JSON(http.StatusOK, gin.H{
-        "database_connected": true,
-        "stores_count": len(stores),
-        "stores": stores,
-        "query_error": result.Error != nil,
-        "error_message": fmt.Sprintf("%v", result.Error),
-    })
-})
 
-
-    // Эндпоинт для получения деталей магазина
-    r.GET("/api/stores/:id", func(c *gin.Context) {
-        storeID := c.Param("id")
-        
-        if db != nil {
-            var store models.Store
-            result := db.First(&store, storeID)
-            if result.Error != nil {
-                c.JSON(http.StatusNotFound, gin.H{
-                    "error": "Магазин не найден",
-                })
+        adminGroup.POST("/stores/:id/floors", func(c *gin.Context) {
+            var floor models.Floor
+            if err := c.BindJSON(&floor); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid floor data"})
                 return
             }
             
-            // Загружаем корневые секторы (у которых ParentID = NULL)
-            var rootSectors []models.Sector
-            db.Where("store_id = ? AND parent_id IS NULL", storeID).Find(&rootSectors)
-            
-            // Рекурсивно загружаем подсекторы и товары
-            for i := range rootSectors {
-                loadSubSectorsAndProducts(db, &rootSectors[i])
+            floor.ID = 0
+            floor.StoreID = utils.StringToUint(c.Param("id"))
+            err := floorService.SaveFloor(&floor)
+            var validationErr *services.FloorValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid floor data", "details": validationErr.Errors})
+                return
             }
-            
-            store.Sectors = rootSectors
-            c.JSON(http.StatusOK, store)
-        } else {
-            // Режим без БД - возвращаем тестовые данные с подсекторами
-            id, _ := strconv.ParseInt(storeID, 10, 64)
-            c.JSON(http.StatusOK, gin.H{
-                "id":      id,
-                "name":    "Тестовый магазин " + storeID,
-                "address": "Тестовый адрес для магазина " + storeID,
-                "sectors": []gin.H{
-                    {
-                        "id":          1,
-                        "name":        "Молочные продукты",
-                        "description": "Сектор молочной продукции",
-                        "positionX":   100.0,
-                        "positionY":   100.0,
-                        "width":       200.0,
-                        "height":      150.0,
-                        "level":       0,
-                        "parent_id":   nil,
-                        "products": []gin.H{
-                            {
-                                "id":          1,
-                                "name":        "Молоко",
-                                "description": "Молоко 2.5%",
-                                "price":       75.00,
-                            },
-                        },
-                        "sub_sectors": []gin.H{
-                            {
-                                "id":          2,
-                                "name":        "Мороженое",
-                                "description": "Мороженое и десерты",
-                                "positionX":   110.0,
-                                "positionY":   110.0,
-                                "width":       80.0,
-                                "height":      30.0,
-                                "level":       1,
-                                "parent_id":   1,
-                                "products": []gin.H{
-                                    {
-                                        "id":          2,
-                                        "name":        "Пломбир",
-                                        "description": "Пломбир ванильный",
-                                        "price":       50.00,
-                                    },
-                                },
-                            },
-                            {
-                                "id":          3,
-                                "name":        "Кисломолочные",
-                                "description": "Кефир, йогурты, ряженка",
-                                "positionX":   110.0,
-                                "positionY":   150.0,
-                                "width":       80.0,
-                                "height":      40.0,
-                                "level":       1,
-                                "parent_id":   1,
-                                "products": []gin.H{
-                                    {
-                                        "id":          3,
-                                        "name":        "Кефир",
-                                        "description": "Кефир 2.5%",
-                                        "price":       60.00,
-                                    },
-                                },
-                            },
-                        },
-                    },
-                },
-            })
-        }
-    })
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save floor"})
+                return
+            }
+            c.JSON(http.StatusOK, floor)
+        })
 
-    // Отладочный эндпоинт для создания администратора
-    r.POST("/api/debug/create-admin", func(c *gin.Context) {
-        var adminUser models.User
-        result := db.Where("username = ?", "admin").First(&adminUser)
-        
-        if result.Error != nil {
-            hashedPassword, err := utils.HashPassword("admin123")
+        adminGroup.PUT("/floors/:id", func(c *gin.Context) {
+            floor, err := floorService.GetFloor(utils.StringToUint(c.Param("id")))
             if err != nil {
-                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
                 return
             }
             
-            adminUser = models.User{
-                Username: "admin",
-                Password: hashedPassword,
-                Role:     "admin",
+            id := floor.ID
+            if err := c.BindJSON(floor); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid floor data"})
+                return
+            }
+            floor.ID = id
+            
+            err = floorService.SaveFloor(floor)
+            var validationErr *services.FloorValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid floor data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save floor"})
+                return
+            }
+            c.JSON(http.StatusOK, floor)
+        })
+
+        adminGroup.DELETE("/floors/:id", func(c *gin.Context) {
+            err := floorService.DeleteFloor(utils.StringToUint(c.Param("id")))
+            switch {
+            case errors.Is(err, services.ErrFloorNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+            case errors.Is(err, services.ErrFloorInUse):
+                c.JSON(http.StatusConflict, gin.H{"error": "Floor has map objects, connector stops or a floor plan"})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete floor"})
+            default:
+                c.JSON(http.StatusOK, gin.H{"message": "Floor deleted successfully"})
+            }
+        })
+
+        adminGroup.GET("/stores/:id/connectors", func(c *gin.Context) {
+            connectors, err := floorService.ListConnectors(utils.StringToUint(c.Param("id")))
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load connectors"})
+                return
+            }
+            c.JSON(http.StatusOK, connectors)
+        })
+
+        adminGroup.POST("/stores/:id/connectors", func(c *gin.Context) {
+            connector := models.VerticalConnector{IsActive: true}
+            if err := c.BindJSON(&connector); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connector data"})
+                return
+            }
+            
+            connector.ID = 0
+            connector.StoreID = utils.StringToUint(c.Param("id"))
+            err := floorService.SaveConnector(&connector)
+            var validationErr *services.FloorValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connector data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save connector"})
+                return
+            }
+            c.JSON(http.StatusOK, connector)
+        })
+
+        adminGroup.PUT("/connectors/:id", func(c *gin.Context) {
+            connector, err := floorService.GetConnector(utils.StringToUint(c.Param("id")))
+            if err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Connector not found"})
+                return
+            }
+            
+            id := connector.ID
+            if err := c.BindJSON(connector); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connector data"})
+                return
+            }
+            connector.ID = id
+            
+            err = floorService.SaveConnector(connector)
+            var validationErr *services.FloorValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connector data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save connector"})
+                return
+            }
+            c.JSON(http.StatusOK, connector)
+        })
+
+        adminGroup.DELETE("/connectors/:id", func(c *gin.Context) {
+            err := floorService.DeleteConnector(utils.StringToUint(c.Param("id")))
+            switch {
+            case errors.Is(err, services.ErrConnectorNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Connector not found"})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete connector"})
+            default:
+                c.JSON(http.StatusOK, gin.H{"message": "Connector deleted successfully"})
+            }
+        })
+
+        // Временные закрытия участков и проходов. По умолчанию - действующие и запланированные,
+        // all=true - вместе с завершенными
+        adminGroup.GET("/stores/:id/closures", func(c *gin.Context) {
+            closures, err := closureService.List(utils.StringToUint(c.Param("id")), c.Query("all") == "true", time.Now())
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load closures"})
+                return
+            }
+            c.JSON(http.StatusOK, closures)
+        })
+
+        adminGroup.POST("/stores/:id/closures", func(c *gin.Context) {
+            var closure models.Closure
+            if err := c.BindJSON(&closure); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid closure data"})
+                return
+            }
+            
+            closure.ID = 0
+            closure.StoreID = utils.StringToUint(c.Param("id"))
+            err := closureService.Save(&closure)
+            var validationErr *services.ClosureValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid closure data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save closure"})
+                return
+            }
+            c.JSON(http.StatusOK, closure)
+        })
+
+        adminGroup.PUT("/closures/:id", func(c *gin.Context) {
+            closure, err := closureService.Get(utils.StringToUint(c.Param("id")))
+            if err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Closure not found"})
+                return
+            }
+            
+            id := closure.ID
+            if err := c.BindJSON(closure); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid closure data"})
+                return
+            }
+            closure.ID = id
+            
+            err = closureService.Save(closure)
+            var validationErr *services.ClosureValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid closure data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save closure"})
+                return
+            }
+            c.JSON(http.StatusOK, closure)
+        })
+
+        adminGroup.DELETE("/closures/:id", func(c *gin.Context) {
+            err := closureService.Delete(utils.StringToUint(c.Param("id")))
+            switch {
+            case errors.Is(err, services.ErrClosureNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Closure not found"})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete closure"})
+            default:
+                c.JSON(http.StatusOK, gin.H{"message": "Closure deleted successfully"})
+            }
+        })
+
+        // Матрица кратчайших расстояний между секторами, входами и кассами для анализа планировки.
+        // format=json (по умолчанию) или csv, profile - профиль маршрута
+        adminGroup.GET("/stores/:id/distances", func(c *gin.Context) {
+            var store models.Store
+            if err := db.First(&store, c.Param("id")).Error; err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+                return
+            }
+            format := c.DefaultQuery("format", "json")
+            if format != "json" && format != "csv" {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json or csv"})
+                return
+            }
+            
+            matrix, err := distanceService.Matrix(store.ID, c.Query("profile"))
+            switch {
+            case errors.Is(err, services.ErrUnknownRouteProfile):
+                c.JSON(http.StatusBadRequest, gin.H{"error": "profile must be one of default, wheelchair, stroller, fast"})
+                return
+            case errors.Is(err, services.ErrPointOutsideMap):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Store map is empty"})
+                return
+            case err != nil:
+                log.Printf("Distance matrix failed for store %d: %v", store.ID, err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute distances"})
+                return
+            }
+            
+            if format == "json" {
+                c.JSON(http.StatusOK, matrix)
+                return
+            }
+            var buf bytes.Buffer
+            if err := services.WriteDistancesCSV(&buf, matrix); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export distances"})
+                return
+            }
+            c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="store-%d-distances.csv"`, store.ID))
+            c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+        })
+
+        // План эвакуации этажа (floor_id, по умолчанию нижний): ближайший выход для каждой точки, пути из секторов
+        // и зоны дальше max_distance метров от выхода. format=json (по умолчанию), svg или pdf - для печати
+        adminGroup.GET("/stores/:id/evacuation", func(c *gin.Context) {
+            var store models.Store
+            if err := db.First(&store, c.Param("id")).Error; err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+                return
+            }
+            format := c.DefaultQuery("format", "json")
+            if format != "json" && format != "svg" && format != "pdf" {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json, svg or pdf"})
+                return
+            }
+            maxDistance := 0.0
+            if value := c.Query("max_distance"); value != "" {
+                parsed, err := strconv.ParseFloat(value, 64)
+                if err != nil || parsed <= 0 {
+                    c.JSON(http.StatusBadRequest, gin.H{"error": "max_distance must be a positive number"})
+                    return
+                }
+                maxDistance = parsed
+            }
+            
+            plan, err := evacuationService.Plan(store.ID, floorIDParam(c, "floor_id"), maxDistance)
+            switch {
+            case errors.Is(err, services.ErrFloorNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+                return
+            case errors.Is(err, services.ErrNoExits):
+                c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Floor has no exits or stairs"})
+                return
+            case err != nil:
+                log.Printf("Evacuation planning failed for store %d: %v", store.ID, err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute evacuation plan"})
+                return
+            }
+            if format == "json" {
+                c.JSON(http.StatusOK, plan)
+                return
+            }
+            
+            scene, err := mapRenderService.LoadScene(store.ID, plan.FloorID)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load map"})
+                return
+            }
+            scene.Closures = nil
+            scene.Evacuation = plan
+            if format == "svg" {
+                c.Header("Content-Type", "image/svg+xml; charset=utf-8")
+                if err := services.RenderSVG(c.Writer, scene); err != nil {
+                    log.Printf("SVG rendering failed for store %d: %v", store.ID, err)
+                }
+                return
+            }
+            var buf bytes.Buffer
+            if err := services.RenderPDF(&buf, scene, nil, services.PDFOptions{PageSize: strings.ToUpper(c.DefaultQuery("size", "A4"))}); err != nil {
+                log.Printf("PDF rendering failed for store %d: %v", store.ID, err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render evacuation plan"})
+                return
+            }
+            c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="store-%d-evacuation.pdf"`, store.ID))
+            c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+        })
+
+        // Заказы с самовывозом: строки - товары магазина и количество
+        adminGroup.POST("/stores/:id/orders", func(c *gin.Context) {
+            var order models.Order
+            if err := c.BindJSON(&order); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order data"})
+                return
+            }
+            
+            order.ID = 0
+            order.StoreID = utils.StringToUint(c.Param("id"))
+            err := pickingService.CreateOrder(&order)
+            var validationErr *services.OrderValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save order"})
+                return
+            }
+            c.JSON(http.StatusOK, order)
+        })
+
+        adminGroup.GET("/stores/:id/orders", func(c *gin.Context) {
+            orders, err := pickingService.ListOrders(utils.StringToUint(c.Param("id")), c.Query("status"))
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load orders"})
+                return
+            }
+            c.JSON(http.StatusOK, orders)
+        })
+
+        adminGroup.GET("/orders/:id", func(c *gin.Context) {
+            order, err := pickingService.GetOrder(utils.StringToUint(c.Param("id")))
+            switch {
+            case errors.Is(err, services.ErrOrderNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load order"})
+            default:
+                c.JSON(http.StatusOK, order)
+            }
+        })
+
+        adminGroup.POST("/orders/:id/cancel", func(c *gin.Context) {
+            order, err := pickingService.CancelOrder(utils.StringToUint(c.Param("id")))
+            switch {
+            case errors.Is(err, services.ErrOrderNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+            case errors.Is(err, services.ErrOrderInPicking):
+                c.JSON(http.StatusConflict, gin.H{"error": "Order is already being picked"})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+            default:
+                c.JSON(http.StatusOK, order)
+            }
+        })
+
+        // Сборка: несколько новых заказов собираются за один обход магазина. picker по умолчанию - текущий пользователь
+        adminGroup.POST("/stores/:id/picking", func(c *gin.Context) {
+            var req struct {
+                OrderIDs []uint `json:"order_ids"`
+                Picker   string `json:"picker"`
+            }
+            if err := c.BindJSON(&req); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid picking data"})
+                return
+            }
+            if req.Picker == "" {
+                if user, ok := c.Get("user"); ok {
+                    req.Picker = user.(models.User).Username
+                }
+            }
+            
+            batch, err := pickingService.CreateBatch(utils.StringToUint(c.Param("id")), req.OrderIDs, req.Picker)
+            var validationErr *services.OrderValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid picking data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create picking batch"})
+                return
+            }
+            c.JSON(http.StatusOK, batch)
+        })
+
+        // Лист сборки: товары в порядке обхода (замороженные - в конце) и маршрут.
+        // start_x, start_y, start_floor - место старта, по умолчанию вход магазина
+        adminGroup.GET("/picking/:id", func(c *gin.Context) {
+            start, err := routeEndpoint(c, "start")
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
+            
+            list, err := pickingService.PickList(utils.StringToUint(c.Param("id")), start)
+            switch {
+            case errors.Is(err, services.ErrPickingNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Picking batch not found"})
+            case errors.Is(err, services.ErrFloorNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+            case err != nil:
+                log.Printf("Pick list failed for batch %s: %v", c.Param("id"), err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build pick list"})
+            default:
+                c.JSON(http.StatusOK, list)
+            }
+        })
+
+        // Отметка строки: status - picked, out_of_stock или pending (отмена отметки),
+        // picked_quantity - сколько собрано при нехватке
+        adminGroup.POST("/picking/:id/lines/:line_id", func(c *gin.Context) {
+            var req struct {
+                Status         string `json:"status"`
+                PickedQuantity *int   `json:"picked_quantity"`
+            }
+            if err := c.BindJSON(&req); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid line data"})
+                return
+            }
+            
+            order, err := pickingService.MarkLine(utils.StringToUint(c.Param("id")), utils.StringToUint(c.Param("line_id")), req.Status, req.PickedQuantity)
+            var validationErr *services.OrderValidationError
+            switch {
+            case errors.As(err, &validationErr):
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid line data", "details": validationErr.Errors})
+            case errors.Is(err, services.ErrPickingNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Picking batch not found"})
+            case errors.Is(err, services.ErrOrderLineNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Order line not found in picking batch"})
+            case errors.Is(err, services.ErrPickingClosed):
+                c.JSON(http.StatusConflict, gin.H{"error": "Picking batch is completed"})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order line"})
+            default:
+                c.JSON(http.StatusOK, order)
+            }
+        })
+
+        // План этажа (подложка карты); floor_id - план этажа, без него - план магазина
+        adminGroup.POST("/stores/:id/floor-plan", func(c *gin.Context) {
+            storeID := utils.StringToUint(c.Param("id"))
+            
+            fileHeader, err := c.FormFile("file")
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+                return
+            }
+            
+            file, err := fileHeader.Open()
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+                return
+            }
+            defer file.Close()
+            
+            plan, err := floorPlanService.Upload(storeID, floorIDParam(c, "floor_id"), fileHeader.Filename, file)
+            if errors.Is(err, services.ErrFloorNotFound) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+                return
+            }
+            if errors.Is(err, services.ErrUnsupportedFileType) || errors.Is(err, services.ErrFileTooLarge) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
+            if err != nil {
+                log.Printf("Floor plan upload failed for store %d: %v", storeID, err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save floor plan"})
+                return
+            }
+            c.JSON(http.StatusOK, plan)
+        })
+
+        adminGroup.GET("/stores/:id/floor-plan", func(c *gin.Context) {
+            plan, err := floorPlanService.Get(utils.StringToUint(c.Param("id")), floorIDParam(c, "floor_id"))
+            if err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor plan not found"})
+                return
+            }
+            c.JSON(http.StatusOK, plan)
+        })
+
+        adminGroup.DELETE("/stores/:id/floor-plan", func(c *gin.Context) {
+            if err := floorPlanService.Delete(utils.StringToUint(c.Param("id")), floorIDParam(c, "floor_id")); err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor plan not found"})
+                return
+            }
+            c.JSON(http.StatusOK, gin.H{"message": "Floor plan deleted successfully"})
+        })
+
+        // Калибровка плана по контрольным точкам (пиксели <-> метры)
+        adminGroup.POST("/stores/:id/floor-plan/calibration", func(c *gin.Context) {
+            var request struct {
+                Points []services.ControlPoint `json:"points"`
+            }
+            if err := c.BindJSON(&request); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid calibration data"})
+                return
+            }
+            
+            result, err := floorPlanService.Calibrate(utils.StringToUint(c.Param("id")), floorIDParam(c, "floor_id"), request.Points)
+            if errors.Is(err, services.ErrFloorNotFound) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+                return
+            }
+            if errors.Is(err, services.ErrInvalidCalibration) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "At least two distinct control points are required"})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save calibration"})
+                return
+            }
+            c.JSON(http.StatusOK, result)
+        })
+
+        // Обмен планировкой с ГИС (QGIS) в формате GeoJSON, координаты в метрах магазина
+        adminGroup.GET("/stores/:id/geojson", func(c *gin.Context) {
+            storeID := utils.StringToUint(c.Param("id"))
+            collection, err := geoJSONService.Export(storeID, floorIDParam(c, "floor_id"))
+            if errors.Is(err, services.ErrFloorNotFound) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+                return
+            }
+            
+            c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="store-%d.geojson"`, storeID))
+            c.Header("Content-Type", "application/geo+json")
+            c.JSON(http.StatusOK, collection)
+        })
+
+        adminGroup.POST("/stores/:id/geojson", func(c *gin.Context) {
+            var store models.Store
+            if err := db.First(&store, c.Param("id")).Error; err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+                return
+            }
+            
+            var collection services.GeoJSONFeatureCollection
+            if err := c.ShouldBindJSON(&collection); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid GeoJSON data"})
+                return
+            }
+            
+            result, err := geoJSONService.Import(store.ID, floorIDParam(c, "floor_id"), &collection)
+            if errors.Is(err, services.ErrFloorNotFound) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+                return
+            }
+            var validationErr *services.GeoJSONValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid GeoJSON data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                log.Printf("GeoJSON import failed for store %d: %v", store.ID, err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import layout"})
+                return
+            }
+            c.JSON(http.StatusOK, result)
+        })
+
+        // Единый каталог товаров сети
+        adminGroup.GET("/catalog", func(c *gin.Context) {
+            page, _ := strconv.Atoi(c.Query("page"))
+            limit, _ := strconv.Atoi(c.Query("limit"))
+            result, err := catalogService.List(services.CatalogQuery{Search: c.Query("q"), Page: page, Limit: limit})
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load catalog"})
+                return
+            }
+            c.JSON(http.StatusOK, result)
+        })
+
+        adminGroup.POST("/catalog", func(c *gin.Context) {
+            var item models.CatalogItem
+            if err := c.BindJSON(&item); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid catalog item data"})
+                return
+            }
+            
+            err := catalogService.Create(&item)
+            var validationErr *services.CatalogValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid catalog item data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create catalog item"})
+                return
+            }
+            c.JSON(http.StatusOK, item)
+        })
+
+        adminGroup.GET("/catalog/:id", func(c *gin.Context) {
+            item, err := catalogService.Get(utils.StringToUint(c.Param("id")))
+            if err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Catalog item not found"})
+                return
+            }
+            c.JSON(http.StatusOK, item)
+        })
+
+        adminGroup.PUT("/catalog/:id", func(c *gin.Context) {
+            var item models.CatalogItem
+            if err := c.BindJSON(&item); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid catalog item data"})
+                return
+            }
+            
+            err := catalogService.Update(utils.StringToUint(c.Param("id")), &item)
+            var validationErr *services.CatalogValidationError
+            switch {
+            case errors.Is(err, services.ErrCatalogItemNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Catalog item not found"})
+            case errors.As(err, &validationErr):
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid catalog item data", "details": validationErr.Errors})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update catalog item"})
+            default:
+                c.JSON(http.StatusOK, item)
+            }
+        })
+
+        adminGroup.DELETE("/catalog/:id", func(c *gin.Context) {
+            err := catalogService.Delete(utils.StringToUint(c.Param("id")))
+            switch {
+            case errors.Is(err, services.ErrCatalogItemNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Catalog item not found"})
+            case errors.Is(err, services.ErrCatalogItemInUse):
+                c.JSON(http.StatusConflict, gin.H{"error": "Catalog item is in store assortment"})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete catalog item"})
+            default:
+                c.JSON(http.StatusOK, gin.H{"message": "Catalog item deleted successfully"})
+            }
+        })
+
+        // Ассортимент магазина: размещение товаров каталога по секторам с ценой магазина
+        adminGroup.GET("/stores/:id/assortment", func(c *gin.Context) {
+            products, err := catalogService.Assortment(utils.StringToUint(c.Param("id")))
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load assortment"})
+                return
+            }
+            c.JSON(http.StatusOK, products)
+        })
+
+        adminGroup.POST("/stores/:id/assortment", func(c *gin.Context) {
+            var input services.AssortmentInput
+            if err := c.BindJSON(&input); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assortment data"})
+                return
+            }
+            
+            product, err := catalogService.Place(utils.StringToUint(c.Param("id")), input)
+            var validationErr *services.CatalogValidationError
+            switch {
+            case errors.Is(err, services.ErrCatalogItemNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Catalog item not found"})
+            case errors.Is(err, services.ErrSectorNotInStore):
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Sector does not belong to the store"})
+            case errors.As(err, &validationErr):
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assortment data", "details": validationErr.Errors})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save assortment"})
+            default:
+                c.JSON(http.StatusOK, product)
+            }
+        })
+
+        adminGroup.DELETE("/stores/:id/assortment/:itemId", func(c *gin.Context) {
+            err := catalogService.Remove(utils.StringToUint(c.Param("id")), utils.StringToUint(c.Param("itemId")))
+            if errors.Is(err, services.ErrCatalogItemNotFound) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Product is not in store assortment"})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assortment"})
+                return
+            }
+            c.JSON(http.StatusOK, gin.H{"message": "Product removed from assortment"})
+        })
+
+        // Цены товара: история, запланированные и акционные цены
+        adminGroup.GET("/products/:id/prices", func(c *gin.Context) {
+            info, err := priceService.Info(utils.StringToUint(c.Param("id")), time.Now())
+            if errors.Is(err, services.ErrProductNotFound) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load prices"})
+                return
+            }
+            c.JSON(http.StatusOK, info)
+        })
+
+        adminGroup.POST("/products/:id/prices", func(c *gin.Context) {
+            var input services.PriceScheduleInput
+            if err := c.BindJSON(&input); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price data"})
+                return
+            }
+            
+            price, err := priceService.Schedule(utils.StringToUint(c.Param("id")), input, time.Now())
+            var validationErr *services.PriceValidationError
+            switch {
+            case errors.Is(err, services.ErrProductNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+            case errors.As(err, &validationErr):
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price data", "details": validationErr.Errors})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule price"})
+            default:
+                c.JSON(http.StatusOK, price)
+            }
+        })
+
+        adminGroup.DELETE("/prices/:id", func(c *gin.Context) {
+            err := priceService.Cancel(utils.StringToUint(c.Param("id")), time.Now())
+            switch {
+            case errors.Is(err, services.ErrPriceNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Price not found"})
+            case errors.Is(err, services.ErrPriceNotCancellable):
+                c.JSON(http.StatusConflict, gin.H{"error": "Price is already in effect"})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel price"})
+            default:
+                c.JSON(http.StatusOK, gin.H{"message": "Price cancelled successfully"})
+            }
+        })
+
+        // Акции магазина и промо-зоны на карте
+        adminGroup.GET("/stores/:id/promotions", func(c *gin.Context) {
+            promotions, err := promotionService.List(utils.StringToUint(c.Param("id")))
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load promotions"})
+                return
+            }
+            c.JSON(http.StatusOK, promotions)
+        })
+
+        adminGroup.POST("/stores/:id/promotions", func(c *gin.Context) {
+            var promotion models.Promotion
+            if err := c.BindJSON(&promotion); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion data"})
+                return
+            }
+            
+            promotion.ID = 0
+            promotion.StoreID = utils.StringToUint(c.Param("id"))
+            err := promotionService.Save(&promotion)
+            var validationErr *services.PromotionValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save promotion"})
+                return
+            }
+            c.JSON(http.StatusOK, promotion)
+        })
+
+        adminGroup.PUT("/promotions/:id", func(c *gin.Context) {
+            promotion, err := promotionService.Get(utils.StringToUint(c.Param("id")))
+            if err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+                return
+            }
+            
+            id, storeID := promotion.ID, promotion.StoreID
+            if err := c.BindJSON(promotion); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion data"})
+                return
+            }
+            promotion.ID, promotion.StoreID = id, storeID
+            
+            err = promotionService.Save(promotion)
+            var validationErr *services.PromotionValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save promotion"})
+                return
+            }
+            c.JSON(http.StatusOK, promotion)
+        })
+
+        adminGroup.DELETE("/promotions/:id", func(c *gin.Context) {
+            err := promotionService.Delete(utils.StringToUint(c.Param("id")))
+            switch {
+            case errors.Is(err, services.ErrPromotionNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete promotion"})
+            default:
+                c.JSON(http.StatusOK, gin.H{"message": "Promotion deleted successfully"})
+            }
+        })
+
+        // Правила предложений по событиям в секторах и журнал показов
+        adminGroup.GET("/stores/:id/offer-rules", func(c *gin.Context) {
+            rules, err := proximityService.ListRules(utils.StringToUint(c.Param("id")))
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load offer rules"})
+                return
+            }
+            c.JSON(http.StatusOK, rules)
+        })
+
+        adminGroup.POST("/stores/:id/offer-rules", func(c *gin.Context) {
+            var rule models.OfferRule
+            if err := c.BindJSON(&rule); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offer rule data"})
+                return
+            }
+            
+            rule.ID = 0
+            rule.StoreID = utils.StringToUint(c.Param("id"))
+            err := proximityService.SaveRule(&rule)
+            var validationErr *services.OfferRuleValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offer rule data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save offer rule"})
+                return
+            }
+            c.JSON(http.StatusOK, rule)
+        })
+
+        adminGroup.PUT("/offer-rules/:id", func(c *gin.Context) {
+            rule, err := proximityService.GetRule(utils.StringToUint(c.Param("id")))
+            if err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Offer rule not found"})
+                return
+            }
+            
+            id, storeID := rule.ID, rule.StoreID
+            if err := c.BindJSON(rule); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offer rule data"})
+                return
+            }
+            rule.ID, rule.StoreID = id, storeID
+            
+            err = proximityService.SaveRule(rule)
+            var validationErr *services.OfferRuleValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offer rule data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save offer rule"})
+                return
+            }
+            c.JSON(http.StatusOK, rule)
+        })
+
+        adminGroup.DELETE("/offer-rules/:id", func(c *gin.Context) {
+            err := proximityService.DeleteRule(utils.StringToUint(c.Param("id")))
+            switch {
+            case errors.Is(err, services.ErrOfferRuleNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Offer rule not found"})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete offer rule"})
+            default:
+                c.JSON(http.StatusOK, gin.H{"message": "Offer rule deleted successfully"})
+            }
+        })
+
+        // Журнал показанных предложений: device_id, rule_id, from и to (RFC 3339), limit
+        adminGroup.GET("/stores/:id/offer-impressions", func(c *gin.Context) {
+            query := services.ImpressionQuery{
+                DeviceID: c.Query("device_id"),
+                RuleID:   utils.StringToUint(c.Query("rule_id")),
+            }
+            query.Limit, _ = strconv.Atoi(c.Query("limit"))
+            var err error
+            if query.From, query.To, err = parseTimeRange(c); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
+            
+            impressions, err := proximityService.Impressions(utils.StringToUint(c.Param("id")), query)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load offer impressions"})
+                return
+            }
+            c.JSON(http.StatusOK, impressions)
+        })
+
+        // Посещаемость секторов и тепловая карта по агрегированным часам: from и to (RFC 3339), по умолчанию последние сутки
+        adminGroup.GET("/stores/:id/analytics/occupancy", func(c *gin.Context) {
+            from, to, err := analyticsPeriod(c)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
+            report, err := analyticsService.Occupancy(utils.StringToUint(c.Param("id")), from, to)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load occupancy"})
+                return
+            }
+            c.JSON(http.StatusOK, report)
+        })
+
+        adminGroup.GET("/stores/:id/analytics/heatmap", func(c *gin.Context) {
+            from, to, err := analyticsPeriod(c)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
+            cellSize, _ := strconv.ParseFloat(c.Query("cell_size"), 64)
+            grid, err := analyticsService.Heatmap(utils.StringToUint(c.Param("id")), floorIDParam(c, "floor_id"), from, to, cellSize)
+            if errors.Is(err, services.ErrFloorNotFound) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load heatmap"})
+                return
+            }
+            c.JSON(http.StatusOK, grid)
+        })
+
+        // Изображение тепловой карты того же размера, что и map.png; with_map=true - вместе с картой,
+        // floor_id - этаж (по умолчанию нижний)
+        adminGroup.GET("/stores/:id/analytics/heatmap.png", func(c *gin.Context) {
+            from, to, err := analyticsPeriod(c)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
+            dpi := services.DefaultPNGDPI
+            if value := c.Query("dpi"); value != "" {
+                parsed, err := strconv.Atoi(value)
+                if err != nil || parsed < services.MinPNGDPI || parsed > services.MaxPNGDPI {
+                    c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("dpi must be between %d and %d", services.MinPNGDPI, services.MaxPNGDPI)})
+                    return
+                }
+                dpi = parsed
+            }
+            
+            scene, ok := loadMapScene(c, mapRenderService)
+            if !ok {
+                return
+            }
+            cellSize, _ := strconv.ParseFloat(c.Query("cell_size"), 64)
+            grid, err := analyticsService.Heatmap(scene.Store.ID, scene.FloorID, from, to, cellSize)
+            if errors.Is(err, services.ErrFloorNotFound) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load heatmap"})
+                return
+            }
+            
+            var buf bytes.Buffer
+            if err := services.RenderHeatmapPNG(&buf, scene, grid, dpi, c.Query("with_map") == "true"); err != nil {
+                if errors.Is(err, services.ErrImageTooLarge) {
+                    c.JSON(http.StatusBadRequest, gin.H{"error": "Image is too large, reduce dpi"})
+                    return
+                }
+                log.Printf("Heatmap rendering failed for store %d: %v", scene.Store.ID, err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render heatmap"})
+                return
+            }
+            c.Data(http.StatusOK, "image/png", buf.Bytes())
+        })
+
+        // Пути покупателей за сутки: date (YYYY-MM-DD, по умолчанию сегодня), level - уровень секторов (0 - верхний)
+        adminGroup.GET("/stores/:id/analytics/journeys", func(c *gin.Context) {
+            query, err := journeyQuery(c)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
+            limit, _ := strconv.Atoi(c.Query("limit"))
+            summary, err := journeyService.Summary(query, limit,
+                utils.StringToUint(c.Query("from_sector")), utils.StringToUint(c.Query("to_sector")))
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load journeys"})
+                return
+            }
+            c.JSON(http.StatusOK, summary)
+        })
+
+        adminGroup.GET("/stores/:id/analytics/transitions", func(c *gin.Context) {
+            query, err := journeyQuery(c)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
+            matrix, err := journeyService.Transitions(query)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load transitions"})
+                return
+            }
+            c.JSON(http.StatusOK, matrix)
+        })
+
+        // Воронка по секторам: sectors=1,4,7 - сколько покупателей дошло до каждого сектора по порядку
+        adminGroup.GET("/stores/:id/analytics/funnel", func(c *gin.Context) {
+            query, err := journeyQuery(c)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
+            var steps []uint
+            for _, id := range services.SplitList(c.Query("sectors")) {
+                steps = append(steps, utils.StringToUint(id))
+            }
+            if len(steps) == 0 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "sectors is required"})
+                return
+            }
+            
+            funnel, err := journeyService.Funnel(query, steps)
+            if errors.Is(err, services.ErrSectorNotInStore) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Sector does not belong to the store"})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load funnel"})
+                return
+            }
+            c.JSON(http.StatusOK, gin.H{"day": services.StartOfDay(query.Day), "steps": funnel})
+        })
+
+        // Торговое оборудование и планограммы (секция, полка, позиция товара)
+        adminGroup.GET("/stores/:id/fixtures", func(c *gin.Context) {
+            fixtures, err := planogramService.ListFixtures(utils.StringToUint(c.Param("id")))
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load fixtures"})
+                return
+            }
+            c.JSON(http.StatusOK, fixtures)
+        })
+
+        adminGroup.POST("/stores/:id/fixtures", func(c *gin.Context) {
+            var fixture models.Fixture
+            if err := c.BindJSON(&fixture); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fixture data"})
+                return
+            }
+            
+            fixture.ID = 0
+            fixture.StoreID = utils.StringToUint(c.Param("id"))
+            err := planogramService.SaveFixture(&fixture)
+            var validationErr *services.PlanogramValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fixture data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save fixture"})
+                return
+            }
+            c.JSON(http.StatusOK, fixture)
+        })
+
+        adminGroup.PUT("/fixtures/:id", func(c *gin.Context) {
+            fixture, err := planogramService.GetFixture(utils.StringToUint(c.Param("id")))
+            if err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Fixture not found"})
+                return
+            }
+            
+            id, storeID := fixture.ID, fixture.StoreID
+            if err := c.BindJSON(fixture); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fixture data"})
+                return
+            }
+            fixture.ID, fixture.StoreID = id, storeID
+            
+            err = planogramService.SaveFixture(fixture)
+            var validationErr *services.PlanogramValidationError
+            if errors.As(err, &validationErr) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fixture data", "details": validationErr.Errors})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save fixture"})
+                return
+            }
+            c.JSON(http.StatusOK, fixture)
+        })
+
+        adminGroup.DELETE("/fixtures/:id", func(c *gin.Context) {
+            if err := planogramService.DeleteFixture(utils.StringToUint(c.Param("id"))); err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Fixture not found"})
+                return
+            }
+            c.JSON(http.StatusOK, gin.H{"message": "Fixture deleted successfully"})
+        })
+
+        adminGroup.GET("/fixtures/:id/planogram", func(c *gin.Context) {
+            placements, err := planogramService.Planogram(utils.StringToUint(c.Param("id")))
+            if errors.Is(err, services.ErrFixtureNotFound) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Fixture not found"})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load planogram"})
+                return
+            }
+            c.JSON(http.StatusOK, placements)
+        })
+
+        adminGroup.PUT("/fixtures/:id/planogram", func(c *gin.Context) {
+            var placements []models.ProductPlacement
+            if err := c.BindJSON(&placements); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid planogram data"})
+                return
+            }
+            
+            saved, err := planogramService.SetPlanogram(utils.StringToUint(c.Param("id")), placements)
+            var validationErr *services.PlanogramValidationError
+            switch {
+            case errors.Is(err, services.ErrFixtureNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Fixture not found"})
+            case errors.As(err, &validationErr):
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid planogram data", "details": validationErr.Errors})
+            case err != nil:
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save planogram"})
+            default:
+                c.JSON(http.StatusOK, saved)
+            }
+        })
+
+        // Массовая загрузка и выгрузка товаров магазина (CSV/XLSX), обновление по артикулу
+        adminGroup.POST("/stores/:id/products/import", func(c *gin.Context) {
+            var store models.Store
+            if err := db.First(&store, c.Param("id")).Error; err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+                return
+            }
+            
+            fileHeader, err := c.FormFile("file")
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+                return
+            }
+            file, err := fileHeader.Open()
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+                return
+            }
+            defer file.Close()
+            
+            result, err := productImportService.Import(store.ID, file)
+            if errors.Is(err, services.ErrInvalidProductFile) || errors.Is(err, services.ErrFileTooLarge) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
+            if err != nil {
+                log.Printf("Product import failed for store %d: %v", store.ID, err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import products"})
+                return
+            }
+            c.JSON(http.StatusOK, result)
+        })
+
+        adminGroup.GET("/stores/:id/products/export", func(c *gin.Context) {
+            var store models.Store
+            if err := db.First(&store, c.Param("id")).Error; err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+                return
+            }
+            
+            format := c.DefaultQuery("format", services.ProductFileCSV)
+            contentType := "text/csv; charset=utf-8"
+            switch format {
+            case services.ProductFileCSV:
+            case services.ProductFileXLSX:
+                contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+            default:
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv or xlsx"})
+                return
+            }
+            
+            var buf bytes.Buffer
+            if err := productImportService.Export(store.ID, format, &buf); err != nil {
+                log.Printf("Product export failed for store %d: %v", store.ID, err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export products"})
+                return
+            }
+            c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="store-%d-products.%s"`, store.ID, format))
+            c.Data(http.StatusOK, contentType, buf.Bytes())
+        })
+
+        // Импорт стен и конструктивных элементов из чертежа DXF, dry_run=true - только предпросмотр
+        adminGroup.POST("/stores/:id/dxf", func(c *gin.Context) {
+            var store models.Store
+            if err := db.First(&store, c.Param("id")).Error; err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+                return
+            }
+            
+            fileHeader, err := c.FormFile("file")
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+                return
+            }
+            file, err := fileHeader.Open()
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+                return
+            }
+            defer file.Close()
+            
+            opts := services.DXFImportOptions{
+                WallLayers: services.SplitList(c.PostForm("wall_layers")),
+                Blocks:     services.ParseBlockTypes(c.PostForm("blocks")),
+                Units:      c.PostForm("units"),
+                Replace:    c.PostForm("replace") == "true",
+                DryRun:     c.PostForm("dry_run") == "true",
+            }
+            if floorID := utils.StringToUint(c.PostForm("floor_id")); floorID != 0 {
+                opts.FloorID = &floorID
+            }
+            for name, target := range map[string]*float64{"wall_thickness": &opts.WallThickness, "origin_x": &opts.OriginX, "origin_y": &opts.OriginY} {
+                if value := c.PostForm(name); value != "" {
+                    parsed, err := strconv.ParseFloat(value, 64)
+                    if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+                        c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a number"})
+                        return
+                    }
+                    *target = parsed
+                }
+            }
+            
+            result, err := dxfImportService.Import(store.ID, file, opts)
+            if errors.Is(err, services.ErrFloorNotFound) {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+                return
+            }
+            if errors.Is(err, services.ErrBinaryDXF) || errors.Is(err, services.ErrMalformedDXF) || errors.Is(err, services.ErrUnsupportedUnits) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
+            if err != nil {
+                log.Printf("DXF import failed for store %d: %v", store.ID, err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import drawing"})
+                return
+            }
+            c.JSON(http.StatusOK, result)
+        })
+
+        // Экспорт в Indoor Mapping Data Format (IMDF) для партнеров
+        adminGroup.GET("/stores/:id/imdf/validate", func(c *gin.Context) {
+            storeID := utils.StringToUint(c.Param("id"))
+            report, err := imdfService.Validate(storeID)
+            switch {
+            case errors.Is(err, gorm.ErrRecordNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+            case err != nil:
+                log.Printf("IMDF validation failed for store %d: %v", storeID, err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate store data"})
+            default:
+                c.JSON(http.StatusOK, report)
+            }
+        })
+
+        adminGroup.GET("/stores/:id/imdf", func(c *gin.Context) {
+            storeID := utils.StringToUint(c.Param("id"))
+            
+            var buf bytes.Buffer
+            report, err := imdfService.Export(storeID, &buf, c.Query("force") == "true")
+            switch {
+            case errors.Is(err, gorm.ErrRecordNotFound):
+                c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+                return
+            case err != nil:
+                log.Printf("IMDF export failed for store %d: %v", storeID, err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export IMDF"})
+                return
+            case buf.Len() == 0:
+                c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Store data is incomplete for IMDF", "details": report.Issues})
+                return
+            }
+            
+            c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="store-%d-imdf.zip"`, storeID))
+            c.Data(http.StatusOK, "application/zip", buf.Bytes())
+        })
+    }
+
+
+
+r.GET("/api/debug/stores", func(c *gin.Context) {
+    if db == nil {
+        c.JSON(http.StatusOK, gin.H{
+            "message": "Database is nil",
+            "stores": []gin.H{
+                {
+                    "id":      1,
+                    "name":    "Тестовый магазин (без БД)",
+                    "address": "Режим без базы данных",
+                },
+            },
+        })
+        return
+    }
+    
+    var stores []models.Store
+    result := db.Find(&stores)
+    
+    c.JSON(http.StatusOK, gin.H{
+        "database_connected": true,
+        "stores_count": len(stores),
+        "stores": stores,
+        "query_error": result.Error != nil,
+        "error_message": fmt.Sprintf("%v", result.Error),
+    })
+})
+
+
+    // Эндпоинт для получения деталей магазина
+    r.GET("/api/stores/:id", func(c *gin.Context) {
+        storeID := c.Param("id")
+        
+        if db != nil {
+            var store models.Store
+            result := db.First(&store, storeID)
+            if result.Error != nil {
+                c.JSON(http.StatusNotFound, gin.H{
+                    "error": "Магазин не найден",
+                })
+                return
+            }
+            
+            // Загружаем корневые секторы (у которых ParentID = NULL)
+            var rootSectors []models.Sector
+            db.Where("store_id = ? AND parent_id IS NULL", storeID).Find(&rootSectors)
+            
+            // Рекурсивно загружаем подсекторы и товары
+            for i := range rootSectors {
+                loadSubSectorsAndProducts(db, &rootSectors[i])
+            }
+            
+            store.Sectors = rootSectors
+            c.JSON(http.StatusOK, store)
+        } else {
+            // Режим без БД - возвращаем тестовые данные с подсекторами
+            id, _ := strconv.ParseInt(storeID, 10, 64)
+            c.JSON(http.StatusOK, gin.H{
+                "id":      id,
+                "name":    "Тестовый магазин " + storeID,
+                "address": "Тестовый адрес для магазина " + storeID,
+                "sectors": []gin.H{
+                    {
+                        "id":          1,
+                        "name":        "Молочные продукты",
+                        "description": "Сектор молочной продукции",
+                        "positionX":   100.0,
+                        "positionY":   100.0,
+                        "width":       200.0,
+                        "height":      150.0,
+                        "level":       0,
+                        "parent_id":   nil,
+                        "products": []gin.H{
+                            {
+                                "id":          1,
+                                "name":        "Молоко",
+                                "description": "Молоко 2.5%",
+                                "price":       75.00,
+                            },
+                        },
+                        "sub_sectors": []gin.H{
+                            {
+                                "id":          2,
+                                "name":        "Мороженое",
+                                "description": "Мороженое и десерты",
+                                "positionX":   110.0,
+                                "positionY":   110.0,
+                                "width":       80.0,
+                                "height":      30.0,
+                                "level":       1,
+                                "parent_id":   1,
+                                "products": []gin.H{
+                                    {
+                                        "id":          2,
+                                        "name":        "Пломбир",
+                                        "description": "Пломбир ванильный",
+                                        "price":       50.00,
+                                    },
+                                },
+                            },
+                            {
+                                "id":          3,
+                                "name":        "Кисломолочные",
+                                "description": "Кефир, йогурты, ряженка",
+                                "positionX":   110.0,
+                                "positionY":   150.0,
+                                "width":       80.0,
+                                "height":      40.0,
+                                "level":       1,
+                                "parent_id":   1,
+                                "products": []gin.H{
+                                    {
+                                        "id":          3,
+                                        "name":        "Кефир",
+                                        "description": "Кефир 2.5%",
+                                        "price":       60.00,
+                                    },
+                                },
+                            },
+                        },
+                    },
+                },
+            })
+        }
+    })
+
+    // Объекты карты в области просмотра (для больших магазинов и мобильных клиентов)
+    r.GET("/api/stores/:id/viewport", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        area, err := parseViewportArea(c)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if area == nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "min_x, min_y, max_x and max_y are required"})
+            return
+        }
+        
+        layers := services.SplitList(c.Query("layers"))
+        for _, layer := range layers {
+            valid := false
+            for _, known := range services.AllMapLayers {
+                valid = valid || layer == known
+            }
+            if !valid {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown layer: " + layer})
+                return
+            }
+        }
+        
+        viewport, err := mapService.GetViewport(services.ViewportQuery{
+            StoreID: utils.StringToUint(c.Param("id")),
+            FloorID: floorIDParam(c, "floor_id"),
+            Area:    *area,
+            Types:   services.SplitList(c.Query("type")),
+            Layers:  layers,
+        })
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load map objects"})
+            return
+        }
+        c.JSON(http.StatusOK, viewport)
+    })
+
+    // Поиск товара по штрихкоду (EAN-13, EAN-8, UPC-A): цена и место в магазине
+    r.GET("/api/stores/:id/barcode/:code", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        result, err := barcodeService.Lookup(utils.StringToUint(c.Param("id")), c.Param("code"))
+        switch {
+        case errors.Is(err, services.ErrInvalidBarcode):
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid barcode"})
+        case errors.Is(err, services.ErrBarcodeNotFound):
+            c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+        case errors.Is(err, services.ErrProductNotInStore):
+            c.JSON(http.StatusNotFound, gin.H{"error": "Product is not sold in this store"})
+        case err != nil:
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up barcode"})
+        default:
+            c.JSON(http.StatusOK, result)
+        }
+    })
+
+    // Точное место товара: полка по планограмме или центр сектора
+    r.GET("/api/stores/:id/products/:productId/location", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        location, err := planogramService.LocateProduct(utils.StringToUint(c.Param("id")), utils.StringToUint(c.Param("productId")))
+        if errors.Is(err, services.ErrProductNotInStore) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+            return
+        }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to locate product"})
+            return
+        }
+        c.JSON(http.StatusOK, location)
+    })
+
+    // Действующая цена товара и история за 90 дней
+    r.GET("/api/stores/:id/products/:productId/price", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        var product models.Product
+        err := db.Joins("JOIN sectors ON sectors.id = products.sector_id").
+            Where("products.id = ? AND sectors.store_id = ?", c.Param("productId"), c.Param("id")).First(&product).Error
+        if err != nil {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+            return
+        }
+        
+        info, err := priceService.Info(product.ID, time.Now())
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load prices"})
+            return
+        }
+        // Запланированные изменения покупателям не показываем
+        c.JSON(http.StatusOK, gin.H{"product_id": info.ProductID, "current": info.Current, "history": info.History})
+    })
+
+    // Действующие акции магазина
+    r.GET("/api/stores/:id/promotions", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        promotions, err := promotionService.Active(utils.StringToUint(c.Param("id")), time.Now())
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load promotions"})
+            return
+        }
+        c.JSON(http.StatusOK, promotions)
+    })
+
+    // Действующие акции рядом с покупателем: x, y в метрах, radius в метрах (по умолчанию 10)
+    r.GET("/api/stores/:id/promotions/nearby", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        x, errX := strconv.ParseFloat(c.Query("x"), 64)
+        y, errY := strconv.ParseFloat(c.Query("y"), 64)
+        if errX != nil || errY != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "x and y are required"})
+            return
+        }
+        radius := 10.0
+        if value := c.Query("radius"); value != "" {
+            parsed, err := strconv.ParseFloat(value, 64)
+            if err != nil || parsed <= 0 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "radius must be a positive number"})
+                return
+            }
+            radius = parsed
+        }
+        
+        nearby, err := promotionService.Nearby(utils.StringToUint(c.Param("id")), utils.Point{X: x, Y: y}, radius, time.Now())
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load promotions"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"promotions": nearby})
+    })
+
+    // Действующие сейчас временные закрытия магазина - для отметки на карте покупателя
+    r.GET("/api/stores/:id/closures", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        closures, err := closureService.Active(utils.StringToUint(c.Param("id")), time.Now())
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load closures"})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"closures": closures})
+    })
+
+    // Путь до ближайшего эвакуационного выхода от точки from_x, from_y (этаж from_floor)
+    // с учетом действующих временных закрытий
+    r.GET("/api/stores/:id/evacuation/route", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        from, err := routeEndpoint(c, "from")
+        if err == nil && from == nil {
+            err = errors.New("from_x and from_y are required")
+        }
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        
+        route, exits, err := evacuationService.RouteFrom(utils.StringToUint(c.Param("id")), *from)
+        switch {
+        case errors.Is(err, services.ErrFloorNotFound):
+            c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+        case errors.Is(err, services.ErrNoExits):
+            c.JSON(http.StatusNotFound, gin.H{"error": "Floor has no exits"})
+        case errors.Is(err, services.ErrPointOutsideMap), errors.Is(err, services.ErrNoRoute):
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No way to an exit from this point"})
+        case err != nil:
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build evacuation route"})
+        default:
+            c.JSON(http.StatusOK, gin.H{"route": route, "exit": exits[route.Exit]})
+        }
+    })
+
+    // Маршрут по магазину, в том числе между этажами: from_x, from_y, from_floor и цель -
+    // to_x, to_y, to_floor, product_id или sector_id. profile - default, wheelchair, stroller или fast,
+    // avoid_crowds=true - обходить секторы, где сейчас много покупателей. lang=ru или en добавляет
+    // пошаговые подсказки, format=text - только подсказки текстом для печати
+    r.GET("/api/stores/:id/route", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        options := services.RouteOptions{Profile: c.Query("profile"), AvoidCrowds: c.Query("avoid_crowds") == "true"}
+        if _, err := services.GetRouteProfile(options.Profile); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "profile must be one of default, wheelchair, stroller, fast"})
+            return
+        }
+        
+        storeID := utils.StringToUint(c.Param("id"))
+        from, err := routeEndpoint(c, "from")
+        if err == nil && from == nil {
+            err = errors.New("from_x and from_y are required")
+        }
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        to, err := routeEndpoint(c, "to")
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        switch {
+        case to != nil:
+        case c.Query("product_id") != "":
+            if to, err = routeService.ProductEndpoint(storeID, utils.StringToUint(c.Query("product_id"))); err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Product not found in this store"})
+                return
+            }
+        case c.Query("sector_id") != "":
+            if to, err = routeService.SectorEndpoint(storeID, utils.StringToUint(c.Query("sector_id"))); err != nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Sector not found in this store"})
+                return
+            }
+        default:
+            c.JSON(http.StatusBadRequest, gin.H{"error": "to_x and to_y, product_id or sector_id is required"})
+            return
+        }
+        
+        route, err := routeService.Route(storeID, *from, *to, options)
+        switch {
+        case errors.Is(err, services.ErrFloorNotFound):
+            c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+        case errors.Is(err, services.ErrPointOutsideMap):
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Route point is not in a walkable area"})
+        case errors.Is(err, services.ErrNoRoute):
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No route between points"})
+        case err != nil:
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build route"})
+        default:
+            lang := c.Query("lang")
+            if lang == "" && c.Query("format") != "text" {
+                c.JSON(http.StatusOK, route)
+                return
+            }
+            route.Directions, err = routeService.Directions(storeID, route, lang)
+            if errors.Is(err, services.ErrUnknownLanguage) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "lang must be ru or en"})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build directions"})
+                return
+            }
+            if c.Query("format") == "text" {
+                c.String(http.StatusOK, services.FormatDirections(route.Directions))
+                return
+            }
+            c.JSON(http.StatusOK, route)
+        }
+    })
+
+    // Маршрут по списку покупок: products - ID товаров через запятую, from_x, from_y, from_floor -
+    // место старта (по умолчанию вход). Тяжелые товары - в начале, замороженные - в конце, финиш - у ближайшей кассы
+    r.GET("/api/stores/:id/shopping-route", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        var productIDs []uint
+        for _, value := range strings.Split(c.Query("products"), ",") {
+            if value = strings.TrimSpace(value); value == "" {
+                continue
+            }
+            id, err := strconv.ParseUint(value, 10, 64)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "products must be a comma-separated list of product IDs"})
+                return
+            }
+            productIDs = append(productIDs, uint(id))
+        }
+        from, err := routeEndpoint(c, "from")
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        
+        route, err := shoppingService.Plan(utils.StringToUint(c.Param("id")), productIDs, from, c.Query("profile"))
+        switch {
+        case errors.Is(err, services.ErrEmptyShoppingList):
+            c.JSON(http.StatusBadRequest, gin.H{"error": "products is required"})
+        case errors.Is(err, services.ErrShoppingListTooLong):
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("products must not list more than %d items", services.MaxShoppingListSize)})
+        case errors.Is(err, services.ErrUnknownRouteProfile):
+            c.JSON(http.StatusBadRequest, gin.H{"error": "profile must be one of default, wheelchair, stroller, fast"})
+        case errors.Is(err, services.ErrFloorNotFound):
+            c.JSON(http.StatusNotFound, gin.H{"error": "Floor not found"})
+        case errors.Is(err, services.ErrPointOutsideMap):
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Route point is not in a walkable area"})
+        case err != nil:
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build shopping route"})
+        default:
+            c.JSON(http.StatusOK, route)
+        }
+    })
+
+    // Положение устройства по маячкам: события входа, выхода и задержки в секторах и предложения
+    r.POST("/api/stores/:id/proximity", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        var report services.PositionReport
+        if err := c.BindJSON(&report); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid position report"})
+            return
+        }
+        
+        result, err := proximityService.Report(utils.StringToUint(c.Param("id")), report, time.Now())
+        switch {
+        case errors.Is(err, services.ErrDeviceRequired):
+            c.JSON(http.StatusBadRequest, gin.H{"error": "device_id is required"})
+        case errors.Is(err, services.ErrPositionOutsideMap):
+            c.JSON(http.StatusBadRequest, gin.H{"error": "x and y must be within the store map"})
+        case errors.Is(err, services.ErrNoKnownBeacons):
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No known beacons in readings"})
+        case err != nil:
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process position"})
+        default:
+            c.JSON(http.StatusOK, result)
+        }
+    })
+
+    // Изображение плана магазина (floor_id - плана этажа) с заголовками кэширования
+    r.GET("/api/stores/:id/floor-plan", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        plan, err := floorPlanService.Get(utils.StringToUint(c.Param("id")), floorIDParam(c, "floor_id"))
+        if err != nil {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Floor plan not found"})
+            return
+        }
+        
+        file, info, err := floorPlanService.Open(plan)
+        if err != nil {
+            log.Printf("Floor plan file for store %d is unavailable: %v", plan.StoreID, err)
+            c.JSON(http.StatusNotFound, gin.H{"error": "Floor plan file not found"})
+            return
+        }
+        defer file.Close()
+        
+        // ServeContent сам обрабатывает If-None-Match, If-Modified-Since и Range
+        c.Header("Content-Type", plan.ContentType)
+        c.Header("ETag", `"`+plan.Checksum+`"`)
+        c.Header("Cache-Control", "public, max-age=3600")
+        http.ServeContent(c.Writer, c.Request, plan.FileName, info.ModTime, file)
+    })
+
+    // Карта магазина в формате SVG (печать, email, киоски)
+    r.GET("/api/stores/:id/map.svg", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        scene, ok := loadMapScene(c, mapRenderService)
+        if !ok {
+            return
+        }
+        
+        c.Header("Content-Type", "image/svg+xml; charset=utf-8")
+        if err := services.RenderSVG(c.Writer, scene); err != nil {
+            log.Printf("SVG rendering failed for store %d: %v", scene.Store.ID, err)
+        }
+    })
+
+    // Растровая карта в PNG с заданным разрешением
+    r.GET("/api/stores/:id/map.png", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        dpi := services.DefaultPNGDPI
+        if value := c.Query("dpi"); value != "" {
+            parsed, err := strconv.Atoi(value)
+            if err != nil || parsed < services.MinPNGDPI || parsed > services.MaxPNGDPI {
+                c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("dpi must be between %d and %d", services.MinPNGDPI, services.MaxPNGDPI)})
+                return
+            }
+            dpi = parsed
+        }
+        
+        scene, ok := loadMapScene(c, mapRenderService)
+        if !ok {
+            return
+        }
+        
+        var buf bytes.Buffer
+        if err := services.RenderPNG(&buf, scene, dpi); err != nil {
+            if errors.Is(err, services.ErrImageTooLarge) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Image is too large, reduce dpi"})
+                return
+            }
+            log.Printf("PNG rendering failed for store %d: %v", scene.Store.ID, err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render map"})
+            return
+        }
+        c.Data(http.StatusOK, "image/png", buf.Bytes())
+    })
+
+    // Печатная карта A4/A3 с легендой и указателем товаров
+    r.GET("/api/stores/:id/map.pdf", func(c *gin.Context) {
+        if db == nil {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+            return
+        }
+        
+        options := services.PDFOptions{
+            PageSize:    strings.ToUpper(c.DefaultQuery("size", "A4")),
+            Orientation: c.Query("orientation"),
+        }
+        if options.PageSize != "A4" && options.PageSize != "A3" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "size must be A4 or A3"})
+            return
+        }
+        if options.Orientation != "" && options.Orientation != "portrait" && options.Orientation != "landscape" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "orientation must be portrait or landscape"})
+            return
+        }
+        
+        scene, ok := loadMapScene(c, mapRenderService)
+        if !ok {
+            return
+        }
+        
+        index, err := mapRenderService.LoadProductIndex(scene)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load products"})
+            return
+        }
+        
+        var buf bytes.Buffer
+        if err := services.RenderPDF(&buf, scene, index, options); err != nil {
+            log.Printf("PDF rendering failed for store %d: %v", scene.Store.ID, err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render map"})
+            return
+        }
+        c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="store-%d-map.pdf"`, scene.Store.ID))
+        c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+    })
+
+    // Отладочный эндпоинт для создания администратора
+    r.POST("/api/debug/create-admin", func(c *gin.Context) {
+        var adminUser models.User
+        result := db.Where("username = ?", "admin").First(&adminUser)
+        
+        if result.Error != nil {
+            hashedPassword, err := utils.HashPassword("admin123")
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+                return
+            }
+            
+            adminUser = models.User{
+                Username: "admin",
+                Password: hashedPassword,
+                Role:     "admin",
             }
             db.Create(&adminUser)
             
@@ -743,12 +2885,50 @@ func initDatabase() *gorm.DB {
         &models.MapElement{},  // Добавляем
         &models.Wall{},        // Добавляем
         &models.StoreMapConfig{}, // Добавляем
+        &models.FloorPlan{},
+        &models.CatalogItem{},
+        &models.CatalogBarcode{},
+        &models.Fixture{},
+        &models.ProductPlacement{},
+        &models.ProductPrice{},
+        &models.Promotion{},
+        &models.PromotionProduct{},
+        &models.PositionFix{},
+        &models.DevicePresence{},
+        &models.GeofenceEvent{},
+        &models.OfferRule{},
+        &models.OfferImpression{},
+        &models.AnalyticsWindow{},
+        &models.SectorOccupancy{},
+        &models.HeatmapCell{},
+        &models.CustomerJourney{},
+        &models.JourneyDay{},
+        &models.Floor{},
+        &models.VerticalConnector{},
+        &models.ConnectorStop{},
+        &models.Closure{},
+        &models.Order{},
+        &models.OrderLine{},
+        &models.PickingBatch{},
     )
     if err != nil {
         log.Printf("⚠️  Database migration failed: %v", err)
         return nil
     }
     
+    // Конфигурация карты теперь уникальна для пары магазин + этаж
+    if db.Migrator().HasIndex(&models.StoreMapConfig{}, "idx_store_map_configs_store_id") {
+        if err := db.Migrator().DropIndex(&models.StoreMapConfig{}, "idx_store_map_configs_store_id"); err != nil {
+            log.Printf("⚠️  Failed to drop old map config index: %v", err)
+        }
+    }
+    // План этажа тоже уникален для пары магазин + этаж
+    if db.Migrator().HasIndex(&models.FloorPlan{}, "idx_floor_plans_store_id") {
+        if err := db.Migrator().DropIndex(&models.FloorPlan{}, "idx_floor_plans_store_id"); err != nil {
+            log.Printf("⚠️  Failed to drop old floor plan index: %v", err)
+        }
+    }
+    
     // Добавляем тестовые данные
     seedTestData(db)
     
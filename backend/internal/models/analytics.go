@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// AnalyticsWindow - отметка о том, что данные позиционирования магазина за час WindowStart агрегированы
+type AnalyticsWindow struct {
+    ID          uint      `json:"id" gorm:"primaryKey"`
+    StoreID     uint      `json:"store_id" gorm:"uniqueIndex:idx_analytics_window"`
+    WindowStart time.Time `json:"window_start" gorm:"uniqueIndex:idx_analytics_window"`
+    Fixes       int       `json:"fixes"`    // Количество точек позиционирования
+    Visitors    int       `json:"visitors"` // Количество разных устройств
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// SectorOccupancy - посещаемость сектора за час (с учетом вложенных секторов)
+type SectorOccupancy struct {
+    ID          uint      `json:"id" gorm:"primaryKey"`
+    StoreID     uint      `json:"store_id" gorm:"index:idx_sector_occupancy_window"`
+    WindowStart time.Time `json:"window_start" gorm:"index:idx_sector_occupancy_window"`
+    SectorID    uint      `json:"sector_id"`
+    FloorID     *uint     `json:"floor_id"` // Этаж сектора
+    Visitors    int       `json:"visitors"` // Разных устройств в секторе
+    Visits      int       `json:"visits"`   // Входов в сектор
+    Dwell       float64   `json:"dwell"`    // Суммарное время в секторе в секундах
+}
+
+// HeatmapCell - время, проведенное покупателями в ячейке сетки карты за час.
+// Ячейка (CellX, CellY) покрывает квадрат со стороной HeatmapCellSize метров
+type HeatmapCell struct {
+    ID          uint      `json:"id" gorm:"primaryKey"`
+    StoreID     uint      `json:"store_id" gorm:"index:idx_heatmap_cell_window"`
+    WindowStart time.Time `json:"window_start" gorm:"index:idx_heatmap_cell_window"`
+    CellX       int       `json:"cell_x"` // Номер столбца сетки
+    CellY       int       `json:"cell_y"` // Номер строки сетки
+    FloorID     *uint     `json:"floor_id"` // Этаж, nil - магазин без этажей
+    Seconds     float64   `json:"seconds"`
+    Visitors    int       `json:"visitors"`
+}
+
+// CustomerJourney - посещение магазина одним устройством: последовательность секторов
+// от первой до последней точки без перерывов дольше PresenceTimeout
+type CustomerJourney struct {
+    ID        uint      `json:"id" gorm:"primaryKey"`
+    StoreID   uint      `json:"store_id" gorm:"index:idx_customer_journey_day"`
+    Day       time.Time `json:"day" gorm:"index:idx_customer_journey_day"` // Начало суток, в которые началось посещение
+    DeviceID  string    `json:"device_id"`
+    StartedAt time.Time `json:"started_at"`
+    EndedAt   time.Time `json:"ended_at"`
+    Path      string    `json:"path"` // ID самых вложенных секторов через запятую в порядке посещения
+}
+
+// JourneyDay - отметка о том, что посещения магазина за сутки Day построены
+type JourneyDay struct {
+    ID        uint      `json:"id" gorm:"primaryKey"`
+    StoreID   uint      `json:"store_id" gorm:"uniqueIndex:idx_journey_day"`
+    Day       time.Time `json:"day" gorm:"uniqueIndex:idx_journey_day"`
+    Journeys  int       `json:"journeys"`
+    CreatedAt time.Time `json:"created_at"`
+}
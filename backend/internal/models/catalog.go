@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// CatalogItem - товар единого каталога сети, общий для всех магазинов
+type CatalogItem struct {
+    ID          uint             `json:"id" gorm:"primaryKey"`
+    SKU         string           `json:"sku" gorm:"uniqueIndex"` // Артикул сети
+    Name        string           `json:"name"`
+    Description string           `json:"description"`
+    Brand       string           `json:"brand"`
+    Barcodes    []CatalogBarcode `json:"barcodes" gorm:"foreignKey:CatalogItemID"`
+    CreatedAt   time.Time        `json:"created_at"`
+    UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// CatalogBarcode - штрихкод товара каталога в виде GTIN-13 (EAN-8 и UPC-A дополняются нулями слева)
+type CatalogBarcode struct {
+    ID            uint   `json:"-" gorm:"primaryKey"`
+    CatalogItemID uint   `json:"-" gorm:"index"`
+    Code          string `json:"code" gorm:"uniqueIndex"`
+}
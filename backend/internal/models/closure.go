@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Причины временного закрытия участка
+const (
+    ClosureSpill      = "spill"
+    ClosureRestocking = "restocking"
+    ClosureRenovation = "renovation"
+    ClosureOther      = "other"
+)
+
+// ClosurePoint - вершина многоугольника закрытого участка в метрах
+type ClosurePoint struct {
+    X float64 `json:"x"`
+    Y float64 `json:"y"`
+}
+
+// Closure - временно закрытый участок магазина: многоугольник или проход (MapElement типа passage).
+// С StartsAt до EndsAt маршруты обходят участок, а на карте покупателя он отмечается как закрытый
+type Closure struct {
+    ID        uint           `json:"id" gorm:"primaryKey"`
+    StoreID   uint           `json:"store_id" gorm:"index:idx_closure_store_period"`
+    FloorID   *uint          `json:"floor_id"`   // Для прохода - этаж элемента
+    ElementID *uint          `json:"element_id"` // Закрытый проход, nil - участок задан многоугольником
+    Polygon   string         `json:"-" gorm:"type:json;default:'[]'"`
+    Points    []ClosurePoint `json:"points" gorm:"-"` // Для прохода - углы элемента
+    Reason    string         `json:"reason"`
+    Comment   string         `json:"comment"`
+    StartsAt  time.Time      `json:"starts_at"`
+    EndsAt    time.Time      `json:"ends_at" gorm:"index:idx_closure_store_period"`
+    CreatedAt time.Time      `json:"created_at"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Типы вертикальных переходов между этажами
+const (
+    ConnectorStairs     = "stairs"
+    ConnectorEscalator  = "escalator"
+    ConnectorElevator   = "elevator"
+    ConnectorTravelator = "travelator" // Наклонный траволатор
+)
+
+// Направление движения по переходу относительно номеров этажей
+const (
+    ConnectorBoth = "both"
+    ConnectorUp   = "up"
+    ConnectorDown = "down"
+)
+
+// Floor - этаж магазина. Объекты без FloorID относятся к нижнему этажу (с наименьшим Number),
+// поэтому одноэтажным магазинам этажи заводить не нужно
+type Floor struct {
+    ID        uint      `json:"id" gorm:"primaryKey"`
+    StoreID   uint      `json:"store_id" gorm:"index"`
+    Number    int       `json:"number"` // Порядок этажей снизу вверх, может быть отрицательным
+    Name      string    `json:"name"`
+    Elevation float64   `json:"elevation"` // Высота пола над нижним этажом в метрах
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// VerticalConnector - лестница, эскалатор, лифт или траволатор между этажами.
+// Остановки задают место перехода на каждом этаже
+type VerticalConnector struct {
+    ID        uint            `json:"id" gorm:"primaryKey"`
+    StoreID   uint            `json:"store_id" gorm:"index"`
+    Type      string          `json:"type"`
+    Name      string          `json:"name"`
+    Direction string          `json:"direction" gorm:"default:both"`
+    Cost      float64         `json:"cost"`      // Время перехода на соседний этаж в секундах, 0 - по типу
+    WaitTime  float64         `json:"wait_time"` // Ожидание перед переходом в секундах (лифт)
+    IsActive  bool            `json:"is_active" gorm:"default:true"`
+    Stops     []ConnectorStop `json:"stops" gorm:"foreignKey:ConnectorID"`
+}
+
+// ConnectorStop - вход на вертикальный переход на этаже
+type ConnectorStop struct {
+    ID          uint    `json:"id" gorm:"primaryKey"`
+    ConnectorID uint    `json:"connector_id" gorm:"index"`
+    FloorID     uint    `json:"floor_id"`
+    X           float64 `json:"x"` // В метрах
+    Y           float64 `json:"y"`
+}
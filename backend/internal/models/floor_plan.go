@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// FloorPlan - загруженное изображение плана магазина (PNG, JPEG или PDF), по одному на этаж
+type FloorPlan struct {
+    ID          uint      `json:"id" gorm:"primaryKey"`
+    StoreID     uint      `json:"store_id" gorm:"uniqueIndex:idx_floor_plan_floor;uniqueIndex:idx_floor_plan_store,where:floor_id IS NULL"`
+    FloorID     *uint     `json:"floor_id" gorm:"uniqueIndex:idx_floor_plan_floor"` // nil - план магазина без этажей (нижний этаж)
+    FileName    string    `json:"file_name"`
+    ContentType string    `json:"content_type"`
+    StorageKey  string    `json:"-"`
+    Size        int64     `json:"size"`
+    Checksum    string    `json:"checksum"`    // SHA-256, используется как ETag
+    PixelWidth  int       `json:"pixel_width"` // Размер изображения в пикселях (0 для PDF)
+    PixelHeight int       `json:"pixel_height"`
+    Calibration string    `json:"calibration" gorm:"type:json;default:'[]'"` // Контрольные точки последней калибровки
+    UpdatedAt   time.Time `json:"updated_at"`
+}
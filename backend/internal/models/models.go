@@ -7,14 +7,30 @@ type Store struct {
     Name    string   `json:"name"`
     Address string   `json:"address"`
     Sectors []Sector `json:"sectors" gorm:"foreignKey:StoreID"`
-}
-
 
+    // Структурированный адрес и привязка карты к местности (для экспорта IMDF)
+    Locality   string   `json:"locality"` // Город
+    Province   string   `json:"province"` // Код региона ISO 3166-2, например RU-MOW
+    Country    string   `json:"country"`  // Код страны ISO 3166-1 alpha-2, например RU
+    PostalCode string   `json:"postal_code"`
+    Latitude   *float64 `json:"latitude"`  // Широта точки (0, 0) карты магазина
+    Longitude  *float64 `json:"longitude"` // Долгота точки (0, 0) карты магазина
+    Bearing    float64  `json:"bearing"`   // Поворот плана по часовой стрелке относительно севера в градусах
+}
 
+// Product - товар в ассортименте магазина: размещение в секторе и цена этого магазина.
+// Название и описание товаров из каталога копируются из CatalogItem
 type Product struct {
     gorm.Model
-    Name        string  `json:"name"`
-    Description string  `json:"description"`
-    Price       float64 `json:"price"`
-    SectorID    uint    `json:"sector_id"`
-}
\ No newline at end of file
+    SKU           string  `json:"sku" gorm:"index"` // Артикул сети, ключ для массовой загрузки
+    Name          string  `json:"name"`
+    Description   string  `json:"description"`
+    Price         float64 `json:"price"`
+    SectorID      uint    `json:"sector_id"`
+    CatalogItemID *uint   `json:"catalog_item_id" gorm:"index"`
+
+    // Особенности обращения: учитываются при порядке обхода списка покупок и сборки заказов
+    Fragile bool `json:"fragile"` // Хрупкий - кладется сверху
+    Heavy   bool `json:"heavy"`   // Тяжелый - собирается первым
+    Bulky   bool `json:"bulky"`   // Крупногабаритный - может понадобиться тележка
+}
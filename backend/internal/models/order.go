@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Статусы заказа
+const (
+    OrderNew       = "new"       // Ожидает сборки
+    OrderPicking   = "picking"   // Включен в сборку
+    OrderReady     = "ready"     // Собран, ожидает выдачи
+    OrderCancelled = "cancelled" // Отменен до сборки
+)
+
+// Статусы строки заказа при сборке
+const (
+    OrderLinePending    = "pending"
+    OrderLinePicked     = "picked"
+    OrderLineOutOfStock = "out_of_stock" // Товара не хватило, PickedQuantity - сколько собрано
+)
+
+// Статусы сборки
+const (
+    PickingOpen = "open"
+    PickingDone = "done"
+)
+
+// Order - заказ интернет-магазина с самовывозом из магазина
+type Order struct {
+    ID             uint        `json:"id" gorm:"primaryKey"`
+    StoreID        uint        `json:"store_id" gorm:"index"`
+    Number         string      `json:"number" gorm:"index"` // Номер заказа во внешней системе
+    CustomerName   string      `json:"customer_name"`
+    CustomerPhone  string      `json:"customer_phone"`
+    Status         string      `json:"status" gorm:"default:new"`
+    PickingBatchID *uint       `json:"picking_batch_id" gorm:"index"`
+    PickupAt       *time.Time  `json:"pickup_at"` // Желаемое время выдачи
+    Lines          []OrderLine `json:"lines" gorm:"foreignKey:OrderID"`
+    CreatedAt      time.Time   `json:"created_at"`
+    UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+// OrderLine - строка заказа: товар магазина и количество
+type OrderLine struct {
+    ID             uint   `json:"id" gorm:"primaryKey"`
+    OrderID        uint   `json:"order_id" gorm:"index"`
+    ProductID      uint   `json:"product_id" gorm:"index"`
+    ProductName    string `json:"product_name"` // Название на момент заказа
+    Quantity       int    `json:"quantity"`
+    PickedQuantity int    `json:"picked_quantity"`
+    Status         string `json:"status" gorm:"default:pending"`
+}
+
+// PickingBatch - сборка: один обход магазина сборщиком по нескольким заказам
+type PickingBatch struct {
+    ID          uint       `json:"id" gorm:"primaryKey"`
+    StoreID     uint       `json:"store_id" gorm:"index"`
+    Picker      string     `json:"picker"`
+    Status      string     `json:"status" gorm:"default:open"`
+    CreatedAt   time.Time  `json:"created_at"`
+    CompletedAt *time.Time `json:"completed_at"`
+}
@@ -0,0 +1,46 @@
+package models
+
+// Стороны торгового оборудования для размещения товара
+const (
+    FixtureSideFront = "front"
+    FixtureSideBack  = "back"
+)
+
+// Температурные зоны секторов и торгового оборудования
+const (
+    TemperatureAmbient = "ambient"
+    TemperatureChilled = "chilled" // Холодильники
+    TemperatureFrozen  = "frozen"  // Морозильники
+)
+
+// Fixture - торговое оборудование (стеллаж, холодильник) внутри сектора.
+// Лицевая сторона при нулевом повороте - нижняя длинная сторона (y = PositionY + Depth)
+type Fixture struct {
+    ID           uint    `json:"id" gorm:"primaryKey"`
+    StoreID      uint    `json:"store_id" gorm:"index"`
+    SectorID     uint    `json:"sector_id" gorm:"index"`
+    Code         string  `json:"code"`       // Обозначение на планограмме, например A3-2
+    Type         string  `json:"type"`       // gondola, rack, fridge, freezer, pallet
+    PositionX    float64 `json:"position_x"` // Левый верхний угол в метрах
+    PositionY    float64 `json:"position_y"`
+    Width        float64 `json:"width"` // Длина вдоль лицевой стороны в метрах
+    Depth        float64 `json:"depth"`
+    Rotation     float64 `json:"rotation"`                   // Поворот в градусах вокруг центра
+    BayCount     int     `json:"bay_count" gorm:"default:1"` // Количество секций одинаковой ширины
+    ShelfCount   int     `json:"shelf_count" gorm:"default:1"`
+    BaseHeight   float64 `json:"base_height"`                       // Высота нижней полки в метрах, 0 - на полу
+    ShelfSpacing float64 `json:"shelf_spacing" gorm:"default:0.35"` // Расстояние между полками в метрах
+    DoubleSided  bool    `json:"double_sided"`                      // Товар выкладывается с обеих сторон
+}
+
+// ProductPlacement - место товара на планограмме: секция, полка и позиция на полке
+type ProductPlacement struct {
+    ID        uint   `json:"id" gorm:"primaryKey"`
+    ProductID uint   `json:"product_id" gorm:"index"`
+    FixtureID uint   `json:"fixture_id" gorm:"index"`
+    Side      string `json:"side" gorm:"default:front"`
+    Bay       int    `json:"bay"`                      // Номер секции слева направо, с 1
+    Shelf     int    `json:"shelf"`                    // Номер полки снизу вверх, с 1
+    Slot      int    `json:"slot"`                     // Порядок на полке слева направо
+    Facings   int    `json:"facings" gorm:"default:1"` // Количество фейсингов
+}
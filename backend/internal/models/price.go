@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Виды цен товара
+const (
+    PriceKindRegular = "regular"
+    PriceKindPromo   = "promo"
+)
+
+// Состояния записи о цене
+const (
+    PriceStatusScheduled = "scheduled"
+    PriceStatusActive    = "active"
+    PriceStatusExpired   = "expired"
+)
+
+// ProductPrice - запись истории цен товара. Обычная цена действует с ValidFrom до следующей обычной цены,
+// акционная - с ValidFrom до ValidTo и на это время заменяет обычную
+type ProductPrice struct {
+    ID        uint       `json:"id" gorm:"primaryKey"`
+    ProductID uint       `json:"product_id" gorm:"index"`
+    Kind      string     `json:"kind"`
+    Price     float64    `json:"price"`
+    ValidFrom time.Time  `json:"valid_from" gorm:"index"`
+    ValidTo   *time.Time `json:"valid_to"`
+    Status    string     `json:"status" gorm:"index"`
+    Source    string     `json:"source"` // manual, import, assortment, schedule
+    CreatedAt time.Time  `json:"created_at"`
+}
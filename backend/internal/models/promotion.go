@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Виды акций
+const (
+    PromotionTypeDiscount = "discount" // Скидка в процентах на каждый товар
+    PromotionTypeBundle   = "bundle"   // N товаров за фиксированную цену
+)
+
+// Promotion - акция магазина на товары с периодом действия.
+// Промо-зона (MapElement типа promo) показывается на карте только в период действия акции
+type Promotion struct {
+    ID              uint      `json:"id" gorm:"primaryKey"`
+    StoreID         uint      `json:"store_id" gorm:"index"`
+    Title           string    `json:"title"`
+    Description     string    `json:"description"`
+    Type            string    `json:"type"`
+    DiscountPercent float64   `json:"discount_percent"` // Для discount
+    BundleQuantity  int       `json:"bundle_quantity"`  // Для bundle: количество товаров
+    BundlePrice     float64   `json:"bundle_price"`     // Для bundle: цена за набор
+    ValidFrom       time.Time `json:"valid_from" gorm:"index"`
+    ValidTo         time.Time `json:"valid_to" gorm:"index"`
+    ZoneID          *uint     `json:"zone_id"`              // Промо-зона на карте
+    ProductIDs      []uint    `json:"product_ids" gorm:"-"` // Товары акции, хранятся в PromotionProduct
+    Products        []Product `json:"products,omitempty" gorm:"-"`
+    CreatedAt       time.Time `json:"created_at"`
+}
+
+// PromotionProduct - товар, участвующий в акции
+type PromotionProduct struct {
+    ID          uint `json:"id" gorm:"primaryKey"`
+    PromotionID uint `json:"promotion_id" gorm:"index"`
+    ProductID   uint `json:"product_id" gorm:"index"`
+}
@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+// Типы событий геозоны сектора
+const (
+    GeofenceEnter = "enter"
+    GeofenceExit  = "exit"
+    GeofenceDwell = "dwell"
+)
+
+// PositionFix - местоположение устройства покупателя, определенное по маячкам.
+// DeviceID - анонимный идентификатор, который генерирует клиент
+type PositionFix struct {
+    ID        uint      `json:"id" gorm:"primaryKey"`
+    StoreID   uint      `json:"store_id" gorm:"index:idx_position_fix_store_time"`
+    DeviceID  string    `json:"device_id" gorm:"index"`
+    X         float64   `json:"x"` // В метрах
+    Y         float64   `json:"y"`
+    Accuracy  float64   `json:"accuracy"`  // Оценка погрешности в метрах
+    SectorID  *uint     `json:"sector_id"` // Самый вложенный сектор, в котором находится точка
+    FloorID   *uint     `json:"floor_id"`
+    CreatedAt time.Time `json:"created_at" gorm:"index:idx_position_fix_store_time"`
+}
+
+// DevicePresence - текущее нахождение устройства в секторе (с учетом вложенности секторов)
+type DevicePresence struct {
+    ID           uint      `json:"id" gorm:"primaryKey"`
+    StoreID      uint      `json:"store_id"`
+    DeviceID     string    `json:"device_id" gorm:"index"`
+    SectorID     uint      `json:"sector_id"`
+    EnteredAt    time.Time `json:"entered_at"`
+    LastSeenAt   time.Time `json:"last_seen_at"`
+    DwellHandled float64   `json:"dwell_handled"` // Время в секундах, до которого правила dwell уже проверены
+}
+
+// GeofenceEvent - вход в сектор, выход из него или задержка в нем
+type GeofenceEvent struct {
+    ID        uint      `json:"id" gorm:"primaryKey"`
+    StoreID   uint      `json:"store_id" gorm:"index"`
+    DeviceID  string    `json:"device_id" gorm:"index"`
+    SectorID  uint      `json:"sector_id"`
+    Type      string    `json:"type"`
+    Dwell     float64   `json:"dwell"` // Время в секторе в секундах на момент события
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// OfferRule - правило показа предложения: событие в секторе (например, задержка дольше MinDwell секунд)
+type OfferRule struct {
+    ID          uint       `json:"id" gorm:"primaryKey"`
+    StoreID     uint       `json:"store_id" gorm:"index"`
+    Name        string     `json:"name"`
+    SectorID    uint       `json:"sector_id"`
+    Trigger     string     `json:"trigger" gorm:"column:trigger_type"` // enter, exit, dwell
+    MinDwell    float64    `json:"min_dwell"`                          // Для dwell и exit: минимальное время в секторе в секундах
+    Title       string     `json:"title"`
+    Message     string     `json:"message"`
+    ProductID   *uint      `json:"product_id"`   // Товар, на который делается предложение
+    PromotionID *uint      `json:"promotion_id"` // Акция, о которой сообщается
+    Cooldown    int        `json:"cooldown"`     // Не чаще раза в Cooldown секунд на устройство, 0 - один раз в сутки
+    IsActive    bool       `json:"is_active" gorm:"default:true"`
+    ValidFrom   *time.Time `json:"valid_from"`
+    ValidTo     *time.Time `json:"valid_to"`
+}
+
+// OfferImpression - журнал показанных предложений
+type OfferImpression struct {
+    ID        uint      `json:"id" gorm:"primaryKey"`
+    StoreID   uint      `json:"store_id" gorm:"index"`
+    RuleID    uint      `json:"rule_id" gorm:"index"`
+    DeviceID  string    `json:"device_id" gorm:"index"`
+    EventID   uint      `json:"event_id"`
+    CreatedAt time.Time `json:"created_at"`
+}
@@ -1,6 +1,6 @@
 package models
 
-
+import "time"
 
 type StoreLayout struct {
     ID          uint    `json:"id" gorm:"primaryKey"`
@@ -22,12 +22,16 @@ type Sector struct {
     Height      float64 `json:"height"`     // В метрах
     Level       int     `json:"level"`
     ParentID    *uint   `json:"parent_id"`
+    FloorID     *uint   `json:"floor_id"` // Этаж, nil - нижний этаж
+    // Температурная зона: ambient, chilled или frozen
+    TemperatureZone string `json:"temperature_zone" gorm:"default:ambient"`
     Products    []Product `json:"products" gorm:"foreignKey:SectorID"`
     SubSectors  []Sector  `json:"sub_sectors" gorm:"foreignKey:ParentID"`
 }
 type StoreMapConfig struct {
     ID          uint    `json:"id" gorm:"primaryKey"`
-    StoreID     uint    `json:"store_id" gorm:"uniqueIndex"`
+    StoreID     uint    `json:"store_id" gorm:"uniqueIndex:idx_store_map_config_floor;uniqueIndex:idx_store_map_config_store,where:floor_id IS NULL"`
+    FloorID     *uint   `json:"floor_id" gorm:"uniqueIndex:idx_store_map_config_floor"` // nil - общая настройка магазина
     RealWidth   float64 `json:"real_width"`  // Реальная ширина магазина в метрах
     RealHeight  float64 `json:"real_height"` // Реальная высота магазина в метрах
     MapWidth    float64 `json:"map_width"`   // Ширина карты в пикселях
@@ -35,6 +39,7 @@ type StoreMapConfig struct {
     Scale       float64 `json:"scale"`       // Масштаб (пикселей на метр)
     OriginX     float64 `json:"origin_x"`    // Смещение начала координат X
     OriginY     float64 `json:"origin_y"`    // Смещение начала координат Y
+    Rotation    float64 `json:"rotation"`    // Поворот плана относительно координат магазина в градусах
 }
 
 type StructuralElement struct {
@@ -49,6 +54,7 @@ type StructuralElement struct {
     Height    float64 `json:"height"`  // Высота элемента
     Rotation  float64 `json:"rotation"` // Поворот в градусах
     Metadata  string  `json:"metadata" gorm:"type:json"` // Дополнительные данные
+    FloorID   *uint   `json:"floor_id"`
 }
 
 type Beacon struct {
@@ -64,12 +70,15 @@ type Beacon struct {
     Minor     uint16  `json:"minor"`
     TxPower   int8    `json:"tx_power"`
     IsActive  bool    `json:"is_active" gorm:"default:true"`
+    FloorID   *uint   `json:"floor_id"`
 }
 
+// MapElement - объект на карте магазина. Элементы с периодом показа (промо-зоны)
+// видны покупателям только с VisibleFrom до VisibleTo
 type MapElement struct {
     ID        uint    `json:"id" gorm:"primaryKey"`
     StoreID   uint    `json:"store_id"`
-    Type      string  `json:"type"` // sector, wall, cashier, beacon, entrance, exit, passage
+    Type      string  `json:"type"` // sector, wall, cashier, beacon, entrance, exit, passage, promo
     Name      string  `json:"name"`
     PositionX float64 `json:"position_x"`
     PositionY float64 `json:"position_y"`
@@ -79,9 +88,14 @@ type MapElement struct {
     Color     string  `json:"color"`
     Metadata  string  `json:"metadata" gorm:"type:json"` // Дополнительные данные
     
+    // Период показа на карте (промо-зоны); nil - без ограничения
+    VisibleFrom *time.Time `json:"visible_from"`
+    VisibleTo   *time.Time `json:"visible_to"`
+    
     // Ссылки на другие модели
     SectorID  *uint  `json:"sector_id"`
     BeaconID  *uint  `json:"beacon_id"`
+    FloorID   *uint  `json:"floor_id"`
 }
 
 type Wall struct {
@@ -92,4 +106,5 @@ type Wall struct {
     EndX      float64 `json:"end_x"`
     EndY      float64 `json:"end_y"`
     Thickness float64 `json:"thickness" gorm:"default:0.1"`
+    FloorID   *uint   `json:"floor_id"`
 }
\ No newline at end of file
@@ -0,0 +1,415 @@
+package services
+
+import (
+    "bytes"
+    "errors"
+    "image"
+    "image/color"
+    "image/draw"
+    "image/png"
+    "io"
+    "math"
+    "sort"
+    "time"
+
+    "golang.org/x/image/font"
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+const (
+    // HeatmapCellSize - сторона ячейки сетки тепловой карты в метрах
+    HeatmapCellSize = 1.0
+    // AnalyticsWindowSize - длительность окна агрегации
+    AnalyticsWindowSize = time.Hour
+    // maxFixInterval - дольше этого времени между точками устройство не считается стоявшим на месте
+    maxFixInterval = 30 * time.Second
+    // maxRollupWindows - сколько окон агрегируется за один вызов RollupDue
+    maxRollupWindows = 24 * 7
+)
+
+// SectorOccupancyStat - посещаемость сектора за период
+type SectorOccupancyStat struct {
+    SectorID     uint    `json:"sector_id"`
+    Name         string  `json:"name"`
+    Visitors     int     `json:"visitors"`      // Сумма посетителей по часам
+    PeakVisitors int     `json:"peak_visitors"` // Наибольшее количество посетителей за час
+    Visits       int     `json:"visits"`
+    Dwell        float64 `json:"dwell"`     // Суммарное время в секундах
+    AvgDwell     float64 `json:"avg_dwell"` // Среднее время одного посетителя за час в секундах
+}
+
+// OccupancyReport - посещаемость секторов за период с почасовой разбивкой
+type OccupancyReport struct {
+    From    time.Time                `json:"from"`
+    To      time.Time                `json:"to"`
+    Sectors []SectorOccupancyStat    `json:"sectors"`
+    Hourly  []models.SectorOccupancy `json:"hourly"`
+}
+
+// HeatmapGrid - тепловая карта: Values[row][col] - время в секундах в ячейке со стороной CellSize метров.
+// Ячейка (0, 0) начинается в точке (0, 0) карты магазина
+type HeatmapGrid struct {
+    From     time.Time   `json:"from"`
+    To       time.Time   `json:"to"`
+    CellSize float64     `json:"cell_size"`
+    Cols     int         `json:"cols"`
+    Rows     int         `json:"rows"`
+    Max      float64     `json:"max"`
+    Values   [][]float64 `json:"values"`
+}
+
+type AnalyticsService struct {
+    db *gorm.DB
+}
+
+func NewAnalyticsService(db *gorm.DB) *AnalyticsService {
+    return &AnalyticsService{db: db}
+}
+
+// RollupDue агрегирует завершенные часовые окна всех магазинов, по которым есть данные позиционирования.
+// Возвращает количество агрегированных окон
+func (s *AnalyticsService) RollupDue(now time.Time) (int, error) {
+    var storeIDs []uint
+    if err := s.db.Model(&models.PositionFix{}).Distinct("store_id").Pluck("store_id", &storeIDs).Error; err != nil {
+        return 0, err
+    }
+    current := now.Truncate(AnalyticsWindowSize)
+
+    rolled := 0
+    for _, storeID := range storeIDs {
+        var last models.AnalyticsWindow
+        err := s.db.Where("store_id = ?", storeID).Order("window_start DESC").First(&last).Error
+        var start time.Time
+        switch {
+        case err == nil:
+            start = last.WindowStart.Add(AnalyticsWindowSize)
+        case errors.Is(err, gorm.ErrRecordNotFound):
+            var first models.PositionFix
+            if err := s.db.Where("store_id = ?", storeID).Order("created_at").First(&first).Error; err != nil {
+                return rolled, err
+            }
+            start = first.CreatedAt.Truncate(AnalyticsWindowSize)
+        default:
+            return rolled, err
+        }
+
+        for i := 0; i < maxRollupWindows && start.Before(current); i++ {
+            if err := s.Rollup(storeID, start); err != nil {
+                return rolled, err
+            }
+            rolled++
+            start = start.Add(AnalyticsWindowSize)
+        }
+    }
+    return rolled, nil
+}
+
+// Rollup пересчитывает посещаемость секторов и тепловую карту магазина за час, начинающийся в windowStart.
+// Время точки - интервал до следующей точки того же устройства, но не больше maxFixInterval
+func (s *AnalyticsService) Rollup(storeID uint, windowStart time.Time) error {
+    windowStart = windowStart.Truncate(AnalyticsWindowSize)
+    windowEnd := windowStart.Add(AnalyticsWindowSize)
+
+    var fixes []models.PositionFix
+    if err := s.db.Where("store_id = ? AND created_at >= ? AND created_at < ?", storeID, windowStart, windowEnd).
+        Order("device_id, created_at, id").Find(&fixes).Error; err != nil {
+        return err
+    }
+    var sectors []models.Sector
+    if err := s.db.Where("store_id = ?", storeID).Find(&sectors).Error; err != nil {
+        return err
+    }
+    parents := make(map[uint]*uint, len(sectors))
+    sectorFloors := make(map[uint]*uint, len(sectors))
+    for _, sector := range sectors {
+        parents[sector.ID] = sector.ParentID
+        sectorFloors[sector.ID] = sector.FloorID
+    }
+    lowest, err := defaultFloor(s.db, storeID)
+    if err != nil {
+        return err
+    }
+
+    // Точки за пределами карты этажа не попадают в тепловую карту, чтобы ошибки позиционирования не раздували сетку
+    type floorArea struct {
+        rect utils.Rect
+        ok   bool
+    }
+    areas := make(map[uint]floorArea)
+
+    type cellKey struct{ floor, col, row uint }
+    occupancy := make(map[uint]*models.SectorOccupancy)
+    sectorDevices := make(map[uint]map[string]bool)
+    cells := make(map[cellKey]*models.HeatmapCell)
+    cellDevices := make(map[cellKey]map[string]bool)
+    devices := make(map[string]bool)
+
+    for i, fix := range fixes {
+        devices[fix.DeviceID] = true
+        var seconds float64
+        if i+1 < len(fixes) && fixes[i+1].DeviceID == fix.DeviceID {
+            seconds = math.Min(fixes[i+1].CreatedAt.Sub(fix.CreatedAt).Seconds(), maxFixInterval.Seconds())
+        }
+
+        // Время в секторе засчитывается и всем его родительским секторам
+        for id := fix.SectorID; id != nil; id = parents[*id] {
+            o, ok := occupancy[*id]
+            if !ok {
+                o = &models.SectorOccupancy{StoreID: storeID, WindowStart: windowStart, SectorID: *id, FloorID: sectorFloors[*id]}
+                occupancy[*id] = o
+                sectorDevices[*id] = make(map[string]bool)
+            }
+            o.Dwell += seconds
+            sectorDevices[*id][fix.DeviceID] = true
+        }
+
+        // Точки без этажа относятся к нижнему этажу
+        floorID := fix.FloorID
+        if floorID == nil && lowest != nil {
+            floorID = &lowest.ID
+        }
+        var floorKey uint
+        if floorID != nil {
+            floorKey = *floorID
+        }
+        area, ok := areas[floorKey]
+        if !ok {
+            if area.rect, area.ok, err = floorExtents(s.db, storeID, floorID); err != nil {
+                return err
+            }
+            areas[floorKey] = area
+        }
+        if fix.X < 0 || fix.Y < 0 || !area.ok || !area.rect.Contains(fix.X, fix.Y) {
+            continue
+        }
+        key := cellKey{floorKey, uint(fix.X / HeatmapCellSize), uint(fix.Y / HeatmapCellSize)}
+        cell, ok := cells[key]
+        if !ok {
+            cell = &models.HeatmapCell{StoreID: storeID, WindowStart: windowStart, CellX: int(key.col), CellY: int(key.row), FloorID: floorID}
+            cells[key] = cell
+            cellDevices[key] = make(map[string]bool)
+        }
+        cell.Seconds += seconds
+        cellDevices[key][fix.DeviceID] = true
+    }
+
+    var enters []struct {
+        SectorID uint
+        Count    int
+    }
+    if err := s.db.Model(&models.GeofenceEvent{}).Select("sector_id, COUNT(*) AS count").
+        Where("store_id = ? AND type = ? AND created_at >= ? AND created_at < ?", storeID, models.GeofenceEnter, windowStart, windowEnd).
+        Group("sector_id").Scan(&enters).Error; err != nil {
+        return err
+    }
+    for _, e := range enters {
+        if o, ok := occupancy[e.SectorID]; ok {
+            o.Visits = e.Count
+        }
+    }
+
+    rows := make([]models.SectorOccupancy, 0, len(occupancy))
+    for id, o := range occupancy {
+        o.Visitors = len(sectorDevices[id])
+        o.Dwell = round3(o.Dwell)
+        rows = append(rows, *o)
+    }
+    sort.Slice(rows, func(i, j int) bool { return rows[i].SectorID < rows[j].SectorID })
+    grid := make([]models.HeatmapCell, 0, len(cells))
+    for key, cell := range cells {
+        cell.Visitors = len(cellDevices[key])
+        cell.Seconds = round3(cell.Seconds)
+        grid = append(grid, *cell)
+    }
+
+    return s.db.Transaction(func(tx *gorm.DB) error {
+        for _, model := range []interface{}{&models.SectorOccupancy{}, &models.HeatmapCell{}, &models.AnalyticsWindow{}} {
+            if err := tx.Where("store_id = ? AND window_start = ?", storeID, windowStart).Delete(model).Error; err != nil {
+                return err
+            }
+        }
+        if len(rows) > 0 {
+            if err := tx.Create(&rows).Error; err != nil {
+                return err
+            }
+        }
+        if len(grid) > 0 {
+            if err := tx.CreateInBatches(&grid, 500).Error; err != nil {
+                return err
+            }
+        }
+        return tx.Create(&models.AnalyticsWindow{StoreID: storeID, WindowStart: windowStart, Fixes: len(fixes), Visitors: len(devices)}).Error
+    })
+}
+
+// Occupancy возвращает посещаемость секторов по агрегированным часам в периоде [from, to)
+func (s *AnalyticsService) Occupancy(storeID uint, from, to time.Time) (*OccupancyReport, error) {
+    report := &OccupancyReport{From: from, To: to, Sectors: []SectorOccupancyStat{}, Hourly: []models.SectorOccupancy{}}
+    if err := s.db.Where("store_id = ? AND window_start >= ? AND window_start < ?", storeID, from, to).
+        Order("window_start, sector_id").Find(&report.Hourly).Error; err != nil {
+        return nil, err
+    }
+
+    var sectors []models.Sector
+    if err := s.db.Where("store_id = ?", storeID).Order("level, id").Find(&sectors).Error; err != nil {
+        return nil, err
+    }
+    stats := make(map[uint]*SectorOccupancyStat, len(sectors))
+    for _, sector := range sectors {
+        report.Sectors = append(report.Sectors, SectorOccupancyStat{SectorID: sector.ID, Name: sector.Name})
+    }
+    for i := range report.Sectors {
+        stats[report.Sectors[i].SectorID] = &report.Sectors[i]
+    }
+    for _, h := range report.Hourly {
+        stat, ok := stats[h.SectorID]
+        if !ok {
+            continue // Сектор удален
+        }
+        stat.Visitors += h.Visitors
+        stat.Visits += h.Visits
+        stat.Dwell += h.Dwell
+        if h.Visitors > stat.PeakVisitors {
+            stat.PeakVisitors = h.Visitors
+        }
+    }
+    for i := range report.Sectors {
+        stat := &report.Sectors[i]
+        stat.Dwell = round3(stat.Dwell)
+        if stat.Visitors > 0 {
+            stat.AvgDwell = round3(stat.Dwell / float64(stat.Visitors))
+        }
+    }
+    sort.SliceStable(report.Sectors, func(i, j int) bool { return report.Sectors[i].Dwell > report.Sectors[j].Dwell })
+    return report, nil
+}
+
+// Heatmap суммирует тепловую карту за период [from, to) в сетку с ячейками cellSize метров
+// (округляется до кратного HeatmapCellSize) для этажа floorID, nil - нижнего этажа. Размер сетки - по StoreMapConfig
+// или по границам схемы этажа, ячейки за ее пределами отбрасываются
+func (s *AnalyticsService) Heatmap(storeID uint, floorID *uint, from, to time.Time, cellSize float64) (*HeatmapGrid, error) {
+    if err := checkStoreFloor(s.db, storeID, floorID); err != nil {
+        return nil, err
+    }
+    if floorID == nil {
+        lowest, err := defaultFloor(s.db, storeID)
+        if err != nil {
+            return nil, err
+        }
+        if lowest != nil {
+            floorID = &lowest.ID
+        }
+    }
+    floor, err := onFloor(s.db, storeID, floorID)
+    if err != nil {
+        return nil, err
+    }
+
+    factor := int(math.Round(cellSize / HeatmapCellSize))
+    if factor < 1 {
+        factor = 1
+    }
+    grid := &HeatmapGrid{From: from, To: to, CellSize: float64(factor) * HeatmapCellSize}
+
+    var cells []struct {
+        CellX   int
+        CellY   int
+        Seconds float64
+    }
+    if err := s.db.Model(&models.HeatmapCell{}).Scopes(floor).Select("cell_x, cell_y, SUM(seconds) AS seconds").
+        Where("store_id = ? AND window_start >= ? AND window_start < ?", storeID, from, to).
+        Group("cell_x, cell_y").Scan(&cells).Error; err != nil {
+        return nil, err
+    }
+
+    extents, ok, err := floorExtents(s.db, storeID, floorID)
+    if err != nil {
+        return nil, err
+    }
+    if ok {
+        grid.Cols = max(int(math.Ceil(extents.MaxX/grid.CellSize)), 0)
+        grid.Rows = max(int(math.Ceil(extents.MaxY/grid.CellSize)), 0)
+    }
+
+    grid.Values = make([][]float64, grid.Rows)
+    for row := range grid.Values {
+        grid.Values[row] = make([]float64, grid.Cols)
+    }
+    for _, c := range cells {
+        col, row := c.CellX/factor, c.CellY/factor
+        if col < 0 || row < 0 || col >= grid.Cols || row >= grid.Rows {
+            continue
+        }
+        grid.Values[row][col] += c.Seconds
+    }
+    for _, row := range grid.Values {
+        for col := range row {
+            row[col] = round3(row[col])
+            grid.Max = math.Max(grid.Max, row[col])
+        }
+    }
+    return grid, nil
+}
+
+// RenderHeatmapPNG рисует тепловую карту в тех же размерах и координатах, что и RenderPNG,
+// чтобы изображение можно было наложить на карту. При withMap карта рисуется под тепловой картой
+func RenderHeatmapPNG(w io.Writer, scene *MapScene, grid *HeatmapGrid, dpi int, withMap bool) error {
+    width, height, t := scene.Canvas()
+    k := float64(dpi) / 96
+    iw, ih, err := pngSize(width*k, height*k)
+    if err != nil {
+        return err
+    }
+    t.Scale *= k
+    t.OriginX *= k
+    t.OriginY *= k
+
+    img := image.NewRGBA(image.Rect(0, 0, iw, ih))
+    painter := &rasterPainter{img: img, t: t, faces: make(map[int]font.Face)}
+    if withMap {
+        fnt, err := loadFonts()
+        if err != nil {
+            return err
+        }
+        painter.font = fnt
+        draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+        paintScene(painter, scene)
+        for _, face := range painter.faces {
+            face.Close()
+        }
+    }
+
+    if grid.Max > 0 {
+        for row, values := range grid.Values {
+            for col, v := range values {
+                if v <= 0 {
+                    continue
+                }
+                x, y := float64(col)*grid.CellSize, float64(row)*grid.CellSize
+                cell := []utils.Point{{X: x, Y: y}, {X: x + grid.CellSize, Y: y}, {X: x + grid.CellSize, Y: y + grid.CellSize}, {X: x, Y: y + grid.CellSize}}
+                painter.fill(painter.toPixels(cell), heatColor(v/grid.Max))
+            }
+        }
+    }
+
+    var buf bytes.Buffer
+    if err := png.Encode(&buf, img); err != nil {
+        return err
+    }
+    return writePNGWithDPI(w, buf.Bytes(), dpi)
+}
+
+// heatColor возвращает цвет ячейки для доли v от максимума: от синего через зеленый и желтый к красному
+func heatColor(v float64) color.NRGBA {
+    v = math.Max(0, math.Min(1, v))
+    stops := []color.NRGBA{{0x21, 0x96, 0xf3, 0}, {0x4c, 0xaf, 0x50, 0}, {0xff, 0xeb, 0x3b, 0}, {0xf4, 0x43, 0x36, 0}}
+    pos := v * float64(len(stops)-1)
+    i := int(math.Min(pos, float64(len(stops)-2)))
+    f := pos - float64(i)
+    lerp := func(a, b uint8) uint8 { return uint8(float64(a) + (float64(b)-float64(a))*f) }
+    a, b := stops[i], stops[i+1]
+    return color.NRGBA{R: lerp(a.R, b.R), G: lerp(a.G, b.G), B: lerp(a.B, b.B), A: uint8(90 + 110*v)}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+    "errors"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+var (
+    ErrInvalidBarcode    = errors.New("invalid barcode")
+    ErrBarcodeNotFound   = errors.New("barcode not found in catalog")
+    ErrProductNotInStore = errors.New("product is not sold in this store")
+)
+
+// SectorRef - звено пути сектора от корня
+type SectorRef struct {
+    ID   uint   `json:"id"`
+    Name string `json:"name"`
+}
+
+// BarcodeLookup - товар по штрихкоду с ценой и местом в магазине
+type BarcodeLookup struct {
+    Barcode     string             `json:"barcode"` // Код в виде GTIN-13
+    Format      string             `json:"format"`  // EAN-13, EAN-8 или UPC-A
+    CatalogItem models.CatalogItem `json:"catalog_item"`
+    Product     models.Product     `json:"product"`
+    SectorPath  []SectorRef        `json:"sector_path"`
+    Location    ProductLocation    `json:"location"`     // Место на полке или центр сектора, в метрах
+    MapLocation utils.Point        `json:"map_location"` // Та же точка в пикселях карты
+}
+
+type BarcodeService struct {
+    db *gorm.DB
+}
+
+func NewBarcodeService(db *gorm.DB) *BarcodeService {
+    return &BarcodeService{db: db}
+}
+
+// Lookup находит товар магазина по отсканированному штрихкоду
+func (s *BarcodeService) Lookup(storeID uint, code string) (*BarcodeLookup, error) {
+    gtin, format, ok := utils.NormalizeBarcode(code)
+    if !ok {
+        return nil, ErrInvalidBarcode
+    }
+    result := &BarcodeLookup{Barcode: gtin, Format: format}
+
+    var barcode models.CatalogBarcode
+    if err := s.db.Where("code = ?", gtin).First(&barcode).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrBarcodeNotFound
+        }
+        return nil, err
+    }
+    if err := s.db.Preload("Barcodes").First(&result.CatalogItem, barcode.CatalogItemID).Error; err != nil {
+        return nil, err
+    }
+
+    err := s.db.Joins("JOIN sectors ON sectors.id = products.sector_id").
+        Where("sectors.store_id = ? AND products.catalog_item_id = ?", storeID, barcode.CatalogItemID).
+        First(&result.Product).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, ErrProductNotInStore
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    var sectors []models.Sector
+    if err := s.db.Where("store_id = ?", storeID).Find(&sectors).Error; err != nil {
+        return nil, err
+    }
+    byID := make(map[uint]models.Sector, len(sectors))
+    for _, sector := range sectors {
+        byID[sector.ID] = sector
+    }
+    // Поднимаемся от сектора товара к корню; ограничение глубины защищает от циклов в ParentID
+    for id, depth := result.Product.SectorID, 0; depth < len(sectors); depth++ {
+        sector, ok := byID[id]
+        if !ok {
+            break
+        }
+        result.SectorPath = append([]SectorRef{{ID: sector.ID, Name: sector.Name}}, result.SectorPath...)
+        if sector.ParentID == nil {
+            break
+        }
+        id = *sector.ParentID
+    }
+
+    location, err := locateProduct(s.db, &result.Product)
+    if err != nil {
+        return nil, err
+    }
+    result.Location = *location
+    // Конфигурация не обязательна - без нее используется масштаб по умолчанию
+    config, _ := storeMapConfig(s.db, storeID, location.FloorID)
+    result.MapLocation.X, result.MapLocation.Y = NewMapTransform(config).ToPixels(location.Point.X, location.Point.Y)
+    return result, nil
+}
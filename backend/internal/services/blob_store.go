@@ -0,0 +1,109 @@
+package services
+
+import (
+    "errors"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobInfo - метаданные сохраненного файла
+type BlobInfo struct {
+    Key     string
+    Size    int64
+    ModTime time.Time
+}
+
+// BlobStore - хранилище двоичных файлов (планы этажей, экспорт и т.п.)
+type BlobStore interface {
+    Put(key string, r io.Reader) (BlobInfo, error)
+    Open(key string) (io.ReadSeekCloser, BlobInfo, error)
+    Delete(key string) error
+}
+
+// LocalBlobStore хранит файлы в каталоге локальной файловой системы
+type LocalBlobStore struct {
+    root string
+}
+
+func NewLocalBlobStore(root string) *LocalBlobStore {
+    return &LocalBlobStore{root: root}
+}
+
+// path проверяет ключ и возвращает путь к файлу внутри корневого каталога
+func (s *LocalBlobStore) path(key string) (string, error) {
+    clean := filepath.Clean("/" + key)
+    if key == "" || strings.Contains(key, "..") || clean == "/" {
+        return "", errors.New("invalid blob key")
+    }
+    return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalBlobStore) Put(key string, r io.Reader) (BlobInfo, error) {
+    path, err := s.path(key)
+    if err != nil {
+        return BlobInfo{}, err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return BlobInfo{}, err
+    }
+
+    // Пишем во временный файл и переименовываем, чтобы читатели не увидели недописанный файл
+    tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+    if err != nil {
+        return BlobInfo{}, err
+    }
+    defer os.Remove(tmp.Name())
+
+    if _, err := io.Copy(tmp, r); err != nil {
+        tmp.Close()
+        return BlobInfo{}, err
+    }
+    if err := tmp.Close(); err != nil {
+        return BlobInfo{}, err
+    }
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        return BlobInfo{}, err
+    }
+
+    stat, err := os.Stat(path)
+    if err != nil {
+        return BlobInfo{}, err
+    }
+    return BlobInfo{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (s *LocalBlobStore) Open(key string) (io.ReadSeekCloser, BlobInfo, error) {
+    path, err := s.path(key)
+    if err != nil {
+        return nil, BlobInfo{}, err
+    }
+    f, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, BlobInfo{}, ErrBlobNotFound
+    }
+    if err != nil {
+        return nil, BlobInfo{}, err
+    }
+    stat, err := f.Stat()
+    if err != nil {
+        f.Close()
+        return nil, BlobInfo{}, err
+    }
+    return f, BlobInfo{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (s *LocalBlobStore) Delete(key string) error {
+    path, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+        return err
+    }
+    return nil
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+var (
+    ErrCatalogItemNotFound = errors.New("catalog item not found")
+    ErrCatalogItemInUse    = errors.New("catalog item is in store assortment")
+    ErrSectorNotInStore    = errors.New("sector does not belong to the store")
+)
+
+// CatalogValidationError перечисляет ошибки в данных товара каталога
+type CatalogValidationError struct {
+    Errors []string
+}
+
+func (e *CatalogValidationError) Error() string {
+    return "invalid catalog item: " + strings.Join(e.Errors, "; ")
+}
+
+// CatalogQuery - поиск по каталогу с постраничным выводом
+type CatalogQuery struct {
+    Search string
+    Page   int
+    Limit  int
+}
+
+type CatalogPage struct {
+    Items []models.CatalogItem `json:"items"`
+    Total int64                `json:"total"`
+    Page  int                  `json:"page"`
+    Limit int                  `json:"limit"`
+}
+
+// AssortmentInput - размещение товара каталога в магазине
+type AssortmentInput struct {
+    CatalogItemID uint    `json:"catalog_item_id"`
+    SectorID      uint    `json:"sector_id"`
+    Price         float64 `json:"price"`
+}
+
+type CatalogService struct {
+    db *gorm.DB
+}
+
+func NewCatalogService(db *gorm.DB) *CatalogService {
+    return &CatalogService{db: db}
+}
+
+func (s *CatalogService) List(q CatalogQuery) (*CatalogPage, error) {
+    if q.Page < 1 {
+        q.Page = 1
+    }
+    if q.Limit < 1 || q.Limit > 200 {
+        q.Limit = 50
+    }
+
+    query := s.db.Model(&models.CatalogItem{})
+    if search := strings.TrimSpace(q.Search); search != "" {
+        like := "%" + strings.ToLower(search) + "%"
+        query = query.Where("LOWER(name) LIKE ? OR sku = ? OR id IN (?)", like, search,
+            s.db.Model(&models.CatalogBarcode{}).Select("catalog_item_id").Where("code = ?", search))
+    }
+
+    query = query.Session(&gorm.Session{})
+
+    page := &CatalogPage{Page: q.Page, Limit: q.Limit}
+    if err := query.Count(&page.Total).Error; err != nil {
+        return nil, err
+    }
+    err := query.Preload("Barcodes").Order("sku").Offset((q.Page - 1) * q.Limit).Limit(q.Limit).Find(&page.Items).Error
+    return page, err
+}
+
+func (s *CatalogService) Get(id uint) (*models.CatalogItem, error) {
+    var item models.CatalogItem
+    err := s.db.Preload("Barcodes").First(&item, id).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, ErrCatalogItemNotFound
+    }
+    return &item, err
+}
+
+// Create добавляет товар в каталог после проверки артикула и штрихкодов
+func (s *CatalogService) Create(item *models.CatalogItem) error {
+    item.ID = 0
+    if err := s.validate(item); err != nil {
+        return err
+    }
+    return s.db.Create(item).Error
+}
+
+// Update заменяет данные и штрихкоды товара и обновляет название в ассортименте магазинов
+func (s *CatalogService) Update(id uint, item *models.CatalogItem) error {
+    if _, err := s.Get(id); err != nil {
+        return err
+    }
+    item.ID = id
+    if err := s.validate(item); err != nil {
+        return err
+    }
+
+    return s.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Model(&models.CatalogItem{ID: id}).Updates(map[string]interface{}{
+            "sku": item.SKU, "name": item.Name, "description": item.Description, "brand": item.Brand,
+        }).Error; err != nil {
+            return err
+        }
+        if err := tx.Where("catalog_item_id = ?", id).Delete(&models.CatalogBarcode{}).Error; err != nil {
+            return err
+        }
+        for i := range item.Barcodes {
+            item.Barcodes[i].ID = 0
+            item.Barcodes[i].CatalogItemID = id
+        }
+        if len(item.Barcodes) > 0 {
+            if err := tx.Create(&item.Barcodes).Error; err != nil {
+                return err
+            }
+        }
+        return tx.Model(&models.Product{}).Where("catalog_item_id = ?", id).
+            Updates(map[string]interface{}{"sku": item.SKU, "name": item.Name, "description": item.Description}).Error
+    })
+}
+
+// Delete удаляет товар, если он не стоит в ассортименте ни одного магазина
+func (s *CatalogService) Delete(id uint) error {
+    if _, err := s.Get(id); err != nil {
+        return err
+    }
+    var placements int64
+    if err := s.db.Model(&models.Product{}).Where("catalog_item_id = ?", id).Count(&placements).Error; err != nil {
+        return err
+    }
+    if placements > 0 {
+        return ErrCatalogItemInUse
+    }
+    return s.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("catalog_item_id = ?", id).Delete(&models.CatalogBarcode{}).Error; err != nil {
+            return err
+        }
+        return tx.Delete(&models.CatalogItem{}, id).Error
+    })
+}
+
+// validate нормализует поля и штрихкоды, проверяет уникальность артикула и контрольные цифры
+func (s *CatalogService) validate(item *models.CatalogItem) error {
+    var problems []string
+    item.SKU = strings.TrimSpace(item.SKU)
+    item.Name = strings.TrimSpace(item.Name)
+    if item.SKU == "" {
+        problems = append(problems, "sku is required")
+    }
+    if item.Name == "" {
+        problems = append(problems, "name is required")
+    }
+    if item.SKU != "" {
+        var count int64
+        if err := s.db.Model(&models.CatalogItem{}).Where("sku = ? AND id <> ?", item.SKU, item.ID).Count(&count).Error; err != nil {
+            return err
+        }
+        if count > 0 {
+            problems = append(problems, fmt.Sprintf("sku %s is already in the catalog", item.SKU))
+        }
+    }
+
+    seen := make(map[string]bool)
+    var codes []string
+    for i := range item.Barcodes {
+        code, _, ok := utils.NormalizeBarcode(item.Barcodes[i].Code)
+        switch {
+        case !ok:
+            problems = append(problems, fmt.Sprintf("barcode %q is not a valid EAN-13, EAN-8 or UPC-A", item.Barcodes[i].Code))
+        case seen[code]:
+            problems = append(problems, fmt.Sprintf("barcode %s is listed twice", code))
+        default:
+            item.Barcodes[i].Code = code
+            seen[code] = true
+            codes = append(codes, code)
+        }
+    }
+    if len(codes) > 0 {
+        var taken []string
+        if err := s.db.Model(&models.CatalogBarcode{}).Where("code IN ? AND catalog_item_id <> ?", codes, item.ID).
+            Pluck("code", &taken).Error; err != nil {
+            return err
+        }
+        for _, code := range taken {
+            problems = append(problems, fmt.Sprintf("barcode %s belongs to another item", code))
+        }
+    }
+
+    if len(problems) > 0 {
+        return &CatalogValidationError{Errors: problems}
+    }
+    return nil
+}
+
+// Assortment возвращает товары каталога, размещенные в магазине
+func (s *CatalogService) Assortment(storeID uint) ([]models.Product, error) {
+    var products []models.Product
+    err := s.db.Joins("JOIN sectors ON sectors.id = products.sector_id").
+        Where("sectors.store_id = ? AND products.catalog_item_id IS NOT NULL", storeID).
+        Order("products.sku").Find(&products).Error
+    return products, err
+}
+
+// Place добавляет товар каталога в ассортимент магазина или меняет его сектор и цену
+func (s *CatalogService) Place(storeID uint, input AssortmentInput) (*models.Product, error) {
+    item, err := s.Get(input.CatalogItemID)
+    if err != nil {
+        return nil, err
+    }
+    if input.Price < 0 {
+        return nil, &CatalogValidationError{Errors: []string{"price must not be negative"}}
+    }
+    var sector models.Sector
+    if err := s.db.Where("id = ? AND store_id = ?", input.SectorID, storeID).First(&sector).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrSectorNotInStore
+        }
+        return nil, err
+    }
+
+    product, err := s.placement(storeID, item.ID)
+    if err != nil {
+        return nil, err
+    }
+    var previous *float64
+    if product == nil {
+        product = &models.Product{CatalogItemID: &item.ID}
+    } else {
+        price := product.Price
+        previous = &price
+    }
+    product.SKU = item.SKU
+    product.Name = item.Name
+    product.Description = item.Description
+    product.SectorID = sector.ID
+    product.Price = input.Price
+    err = s.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Save(product).Error; err != nil {
+            return err
+        }
+        return recordPriceChange(tx, product, previous, "assortment", time.Now())
+    })
+    if err != nil {
+        return nil, err
+    }
+    return product, nil
+}
+
+// Remove убирает товар каталога из ассортимента магазина
+func (s *CatalogService) Remove(storeID, catalogItemID uint) error {
+    product, err := s.placement(storeID, catalogItemID)
+    if err != nil {
+        return err
+    }
+    if product == nil {
+        return ErrCatalogItemNotFound
+    }
+    return s.db.Delete(product).Error
+}
+
+// placement находит размещение товара каталога в магазине; nil - товара нет в ассортименте
+func (s *CatalogService) placement(storeID, catalogItemID uint) (*models.Product, error) {
+    var product models.Product
+    err := s.db.Joins("JOIN sectors ON sectors.id = products.sector_id").
+        Where("sectors.store_id = ? AND products.catalog_item_id = ?", storeID, catalogItemID).
+        First(&product).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &product, nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+    "encoding/json"
+    "errors"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+var ErrClosureNotFound = errors.New("closure not found")
+
+// ClosureValidationError перечисляет ошибки в описании закрытого участка
+type ClosureValidationError struct {
+    Errors []string
+}
+
+func (e *ClosureValidationError) Error() string {
+    return "invalid closure: " + strings.Join(e.Errors, "; ")
+}
+
+type ClosureService struct {
+    db *gorm.DB
+}
+
+func NewClosureService(db *gorm.DB) *ClosureService {
+    return &ClosureService{db: db}
+}
+
+// List возвращает действующие и запланированные закрытия магазина, а с includeExpired - и завершенные
+func (s *ClosureService) List(storeID uint, includeExpired bool, now time.Time) ([]models.Closure, error) {
+    query := s.db.Where("store_id = ?", storeID)
+    if !includeExpired {
+        query = query.Where("ends_at > ?", now)
+    }
+    var closures []models.Closure
+    if err := query.Order("starts_at, id").Find(&closures).Error; err != nil {
+        return nil, err
+    }
+    return closures, resolveClosures(s.db, closures)
+}
+
+// Active возвращает закрытия магазина, действующие в момент now
+func (s *ClosureService) Active(storeID uint, now time.Time) ([]models.Closure, error) {
+    return activeClosures(s.db, storeID, nil, now)
+}
+
+func (s *ClosureService) Get(id uint) (*models.Closure, error) {
+    var closure models.Closure
+    if err := s.db.First(&closure, id).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrClosureNotFound
+        }
+        return nil, err
+    }
+    closures := []models.Closure{closure}
+    if err := resolveClosures(s.db, closures); err != nil {
+        return nil, err
+    }
+    return &closures[0], nil
+}
+
+// Save создает закрытие (ID = 0) или обновляет существующее. Для прохода этаж берется из элемента
+func (s *ClosureService) Save(closure *models.Closure) error {
+    if closure.ID != 0 {
+        existing, err := s.Get(closure.ID)
+        if err != nil {
+            return err
+        }
+        closure.StoreID, closure.CreatedAt = existing.StoreID, existing.CreatedAt
+    }
+    if closure.StartsAt.IsZero() {
+        closure.StartsAt = time.Now()
+    }
+    if closure.Reason == "" {
+        closure.Reason = models.ClosureOther
+    }
+    closure.Comment = strings.TrimSpace(closure.Comment)
+
+    var errs []string
+    switch closure.Reason {
+    case models.ClosureSpill, models.ClosureRestocking, models.ClosureRenovation, models.ClosureOther:
+    default:
+        errs = append(errs, "reason must be one of spill, restocking, renovation, other")
+    }
+    if !closure.EndsAt.After(closure.StartsAt) {
+        errs = append(errs, "ends_at must be after starts_at")
+    }
+
+    closure.Polygon = "[]"
+    if closure.ElementID != nil {
+        var element models.MapElement
+        err := s.db.Where("id = ? AND store_id = ?", *closure.ElementID, closure.StoreID).First(&element).Error
+        switch {
+        case errors.Is(err, gorm.ErrRecordNotFound):
+            errs = append(errs, "element does not belong to the store")
+        case err != nil:
+            return err
+        case element.Type != "passage":
+            errs = append(errs, "element must be a passage")
+        default:
+            closure.FloorID = element.FloorID
+        }
+    } else if len(closure.Points) < 3 {
+        errs = append(errs, "element_id or a polygon of at least three points is required")
+    } else {
+        polygon, _ := json.Marshal(closure.Points)
+        closure.Polygon = string(polygon)
+    }
+    if closure.ElementID == nil && closure.FloorID != nil {
+        var count int64
+        if err := s.db.Model(&models.Floor{}).Where("id = ? AND store_id = ?", *closure.FloorID, closure.StoreID).Count(&count).Error; err != nil {
+            return err
+        }
+        if count == 0 {
+            errs = append(errs, "floor does not belong to the store")
+        }
+    }
+    if len(errs) > 0 {
+        return &ClosureValidationError{Errors: errs}
+    }
+
+    if err := s.db.Save(closure).Error; err != nil {
+        return err
+    }
+    saved, err := s.Get(closure.ID)
+    if err != nil {
+        return err
+    }
+    *closure = *saved
+    return nil
+}
+
+func (s *ClosureService) Delete(id uint) error {
+    if _, err := s.Get(id); err != nil {
+        return err
+    }
+    return s.db.Delete(&models.Closure{}, id).Error
+}
+
+// activeClosures возвращает закрытия, действующие в момент now, на этаже floorID (nil - на всех этажах)
+func activeClosures(db *gorm.DB, storeID uint, floorID *uint, now time.Time) ([]models.Closure, error) {
+    floor, err := onFloor(db, storeID, floorID)
+    if err != nil {
+        return nil, err
+    }
+    var closures []models.Closure
+    if err := db.Scopes(floor).Where("store_id = ? AND starts_at <= ? AND ends_at > ?", storeID, now, now).
+        Order("id").Find(&closures).Error; err != nil {
+        return nil, err
+    }
+    return closures, resolveClosures(db, closures)
+}
+
+// resolveClosures заполняет вершины закрытых участков; для прохода - по текущему положению элемента
+func resolveClosures(db *gorm.DB, closures []models.Closure) error {
+    var elementIDs []uint
+    for i := range closures {
+        closures[i].Points = []models.ClosurePoint{}
+        if closures[i].ElementID != nil {
+            elementIDs = append(elementIDs, *closures[i].ElementID)
+        } else if closures[i].Polygon != "" {
+            json.Unmarshal([]byte(closures[i].Polygon), &closures[i].Points)
+        }
+    }
+    if len(elementIDs) == 0 {
+        return nil
+    }
+
+    var elements []models.MapElement
+    if err := db.Where("id IN ?", elementIDs).Find(&elements).Error; err != nil {
+        return err
+    }
+    byID := make(map[uint]models.MapElement, len(elements))
+    for _, e := range elements {
+        byID[e.ID] = e
+    }
+    for i := range closures {
+        if closures[i].ElementID == nil {
+            continue
+        }
+        e, ok := byID[*closures[i].ElementID]
+        if !ok {
+            continue
+        }
+        for _, corner := range utils.RectCorners(e.PositionX, e.PositionY, e.Width, e.Height, e.Rotation) {
+            closures[i].Points = append(closures[i].Points, models.ClosurePoint{X: round3(corner.X), Y: round3(corner.Y)})
+        }
+    }
+    return nil
+}
+
+// closurePolygon переводит вершины закрытого участка в точки карты
+func closurePolygon(closure models.Closure) []utils.Point {
+    points := make([]utils.Point, len(closure.Points))
+    for i, p := range closure.Points {
+        points[i] = utils.Point{X: p.X, Y: p.Y}
+    }
+    return points
+}
@@ -0,0 +1,487 @@
+package services
+
+import (
+    "errors"
+    "math"
+    "sort"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+// Параметры карты покрытия по умолчанию
+const (
+    DefaultCoverageCell      = 1.0   // Размер ячейки в метрах
+    DefaultCoverageThreshold = -90.0 // Порог чувствительности телефона в dBm
+    DefaultCoverageTarget    = 0.95  // Доля площади зала, где видно не меньше трех маячков
+    DefaultWallAttenuation   = 6.0   // Затухание сигнала на одной стене в dB
+    DefaultMaxSuggestions    = 10
+)
+
+// Для определения положения по сигналам нужно не меньше трех маячков
+const coverageMinBeacons = 3
+
+const (
+    coverageDeviceHeight  = 1.2   // Высота телефона в руке, м
+    coverageMountHeight   = 2.5   // Высота установки предлагаемых маячков, м
+    coverageMinSpacing    = 5.0   // Минимальное расстояние между маячками, м
+    maxCoverageCandidates = 400   // Ограничение числа мест-кандидатов при подборе новых маячков
+    maxCoverageCells      = 20000 // При большем числе ячеек размер ячейки увеличивается
+)
+
+// Цвета карты покрытия по числу видимых маячков
+const (
+    coverageGoodColor       = "#43a04766"
+    coveragePartialColor    = "#fb8c0066"
+    coverageNoneColor       = "#e5393566"
+    coverageBeaconColor     = "#1565c0"
+    coverageSuggestionColor = "#6a1b9a"
+)
+
+var ErrInvalidCoverageOptions = errors.New("invalid coverage options")
+
+// CoverageOptions - параметры расчета, нулевые значения заменяются значениями по умолчанию
+type CoverageOptions struct {
+    CellSize       float64 // В метрах
+    Threshold      float64 // Минимальный принимаемый уровень сигнала в dBm
+    WallLoss       float64 // Затухание на стене в dB
+    Target         float64 // Целевая доля покрытия от 0 до 1
+    MaxSuggestions int
+}
+
+// BeaconCoverage - установленный маячок и площадь, где его сигнал выше порога
+type BeaconCoverage struct {
+    ID      uint        `json:"id"`
+    MAC     string      `json:"mac"`
+    Point   utils.Point `json:"point"`
+    TxPower int         `json:"tx_power"`
+    Area    float64     `json:"area"` // В квадратных метрах
+}
+
+// BeaconSuggestion - предлагаемое место нового маячка
+type BeaconSuggestion struct {
+    Point    utils.Point `json:"point"`
+    Height   float64     `json:"height"` // Высота установки в метрах
+    TxPower  int         `json:"tx_power"`
+    Gain     float64     `json:"gain"`     // Площадь с недостатком маячков, где будет виден новый маячок, м²
+    Coverage float64     `json:"coverage"` // Доля покрытия после установки этого и предыдущих маячков
+}
+
+// CoverageZone - связная область, где видно меньше трех маячков
+type CoverageZone struct {
+    Bounds     utils.Rect  `json:"bounds"`
+    Center     utils.Point `json:"center"`
+    Area       float64     `json:"area"`        // В квадратных метрах
+    MinVisible int         `json:"min_visible"` // Наименьшее число видимых маячков в области
+}
+
+// CoverageMap - число маячков, видимых в каждой ячейке этажа, с учетом затухания сигнала на стенах
+type CoverageMap struct {
+    StoreID           uint               `json:"store_id"`
+    FloorID           *uint              `json:"floor_id"`
+    CellSize          float64            `json:"cell_size"`
+    Threshold         float64            `json:"threshold"`
+    WallLoss          float64            `json:"wall_loss"`
+    MinBeacons        int                `json:"min_beacons"`
+    Origin            utils.Point        `json:"origin"` // Левый верхний угол сетки
+    Columns           int                `json:"columns"`
+    Rows              int                `json:"rows"`
+    Visible           [][]int            `json:"visible"`  // Visible[row][col], -1 - вне торгового зала
+    Area              float64            `json:"area"`     // Площадь торгового зала, м²
+    Coverage          float64            `json:"coverage"` // Доля зала, где видно не меньше MinBeacons маячков
+    Target            float64            `json:"target"`
+    ProjectedCoverage float64            `json:"projected_coverage"` // После установки предложенных маячков
+    TargetReached     bool               `json:"target_reached"`
+    Beacons           []BeaconCoverage   `json:"beacons"`
+    Zones             []CoverageZone     `json:"zones"`
+    Suggestions       []BeaconSuggestion `json:"suggestions"`
+}
+
+type CoverageService struct {
+    db *gorm.DB
+}
+
+func NewCoverageService(db *gorm.DB) *CoverageService {
+    return &CoverageService{db: db}
+}
+
+// coverageGrid - сетка этажа для расчета покрытия
+type coverageGrid struct {
+    origin     utils.Point
+    cell       float64
+    cols, rows int
+    inArea     []bool
+    walls      [][2]utils.Point
+}
+
+func (g *coverageGrid) center(i int) utils.Point {
+    return utils.Point{X: g.origin.X + (float64(i%g.cols)+0.5)*g.cell, Y: g.origin.Y + (float64(i/g.cols)+0.5)*g.cell}
+}
+
+// signal оценивает уровень сигнала маячка в точке: логарифмическая модель затухания, как при определении
+// положения, плюс wallLoss за каждую стену на пути
+func (g *coverageGrid) signal(from utils.Point, height float64, txPower int, to utils.Point, wallLoss float64) float64 {
+    d := math.Hypot(math.Hypot(to.X-from.X, to.Y-from.Y), height-coverageDeviceHeight)
+    rssi := float64(txPower) - 10*pathLossExponent*math.Log10(math.Max(d, 1))
+    for _, wall := range g.walls {
+        if utils.SegmentsIntersect(from, to, wall[0], wall[1]) {
+            rssi -= wallLoss
+        }
+    }
+    return rssi
+}
+
+// visibleCells возвращает ячейки зала, в которых сигнал маячка не ниже порога
+func (g *coverageGrid) visibleCells(from utils.Point, height float64, txPower int, threshold, wallLoss float64) []int {
+    // Дальше этого расстояния сигнал ниже порога даже без стен
+    reach := math.Pow(10, (float64(txPower)-threshold)/(10*pathLossExponent))
+    var cells []int
+    for i, in := range g.inArea {
+        if !in {
+            continue
+        }
+        p := g.center(i)
+        if math.Hypot(p.X-from.X, p.Y-from.Y) > reach {
+            continue
+        }
+        if g.signal(from, height, txPower, p, wallLoss) >= threshold {
+            cells = append(cells, i)
+        }
+    }
+    return cells
+}
+
+// Coverage строит карту покрытия этажа floorID (nil - нижний этаж) по активным маячкам, находит области,
+// где видно меньше трех маячков, и предлагает места новых маячков, пока не будет достигнута целевая доля покрытия
+func (s *CoverageService) Coverage(storeID uint, floorID *uint, options CoverageOptions) (*CoverageMap, error) {
+    if options.CellSize == 0 {
+        options.CellSize = DefaultCoverageCell
+    }
+    if options.Threshold == 0 {
+        options.Threshold = DefaultCoverageThreshold
+    }
+    if options.WallLoss == 0 {
+        options.WallLoss = DefaultWallAttenuation
+    }
+    if options.Target == 0 {
+        options.Target = DefaultCoverageTarget
+    }
+    if options.MaxSuggestions == 0 {
+        options.MaxSuggestions = DefaultMaxSuggestions
+    }
+    for _, v := range []float64{options.CellSize, options.Threshold, options.WallLoss, options.Target} {
+        if math.IsNaN(v) || math.IsInf(v, 0) {
+            return nil, ErrInvalidCoverageOptions
+        }
+    }
+    if options.CellSize < 0.25 || options.Threshold > 0 || options.WallLoss < 0 || options.Target < 0 || options.Target > 1 || options.MaxSuggestions < 0 {
+        return nil, ErrInvalidCoverageOptions
+    }
+
+    var floor models.Floor
+    if floorID != nil {
+        if err := s.db.Where("id = ? AND store_id = ?", *floorID, storeID).First(&floor).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return nil, ErrFloorNotFound
+            }
+            return nil, err
+        }
+    } else {
+        lowest, err := defaultFloor(s.db, storeID)
+        if err != nil {
+            return nil, err
+        }
+        if lowest != nil {
+            floor = *lowest
+        }
+    }
+    if floor.ID != 0 {
+        floorID = &floor.ID
+    }
+    scope, err := onFloor(s.db, storeID, floorID)
+    if err != nil {
+        return nil, err
+    }
+
+    grid, err := loadCoverageGrid(s.db, storeID, floorID, scope, options.CellSize)
+    if err != nil {
+        return nil, err
+    }
+    var beacons []models.Beacon
+    if err := s.db.Scopes(scope).Where("store_id = ? AND is_active = ?", storeID, true).Order("id").Find(&beacons).Error; err != nil {
+        return nil, err
+    }
+
+    result := &CoverageMap{StoreID: storeID, FloorID: floorID, CellSize: grid.cell, Threshold: options.Threshold,
+        WallLoss: options.WallLoss, MinBeacons: coverageMinBeacons, Origin: grid.origin, Columns: grid.cols, Rows: grid.rows,
+        Target: options.Target, Beacons: []BeaconCoverage{}, Zones: []CoverageZone{}, Suggestions: []BeaconSuggestion{}}
+    cellArea := grid.cell * grid.cell
+    visible := make([]int, len(grid.inArea))
+    areaCells := 0
+    for _, in := range grid.inArea {
+        if in {
+            areaCells++
+        }
+    }
+    result.Area = round3(float64(areaCells) * cellArea)
+
+    var placed []utils.Point
+    var powers []int
+    for _, b := range beacons {
+        txPower := int(b.TxPower)
+        if txPower == 0 {
+            txPower = defaultTxPower
+        }
+        point := utils.Point{X: b.PositionX, Y: b.PositionY}
+        cells := grid.visibleCells(point, b.PositionZ, txPower, options.Threshold, options.WallLoss)
+        for _, i := range cells {
+            visible[i]++
+        }
+        placed = append(placed, point)
+        powers = append(powers, txPower)
+        result.Beacons = append(result.Beacons, BeaconCoverage{ID: b.ID, MAC: b.MAC, Point: point, TxPower: txPower,
+            Area: round3(float64(len(cells)) * cellArea)})
+    }
+
+    coverage := func() float64 {
+        if areaCells == 0 {
+            return 1
+        }
+        covered := 0
+        for i, in := range grid.inArea {
+            if in && visible[i] >= coverageMinBeacons {
+                covered++
+            }
+        }
+        return round3(float64(covered) / float64(areaCells))
+    }
+    result.Coverage = coverage()
+    result.Visible = make([][]int, grid.rows)
+    for row := range result.Visible {
+        result.Visible[row] = make([]int, grid.cols)
+        for col := range result.Visible[row] {
+            i := row*grid.cols + col
+            result.Visible[row][col] = -1
+            if grid.inArea[i] {
+                result.Visible[row][col] = visible[i]
+            }
+        }
+    }
+    result.Zones = coverageZones(grid, visible)
+
+    // Новые маячки - той же мощности, что и большинство установленных
+    txPower := defaultTxPower
+    if len(powers) > 0 {
+        sort.Ints(powers)
+        txPower = powers[len(powers)/2]
+    }
+    projected := result.Coverage
+    candidates := coverageCandidates(grid, areaCells)
+    reach := make(map[int][]int)
+    used := make(map[int]bool)
+    for len(result.Suggestions) < options.MaxSuggestions && projected < options.Target {
+        best, bestGain := -1, 0
+        for _, c := range candidates {
+            if used[c] || tooClose(grid.center(c), placed) {
+                continue
+            }
+            cells, ok := reach[c]
+            if !ok {
+                cells = grid.visibleCells(grid.center(c), coverageMountHeight, txPower, options.Threshold, options.WallLoss)
+                reach[c] = cells
+            }
+            gain := 0
+            for _, i := range cells {
+                if visible[i] < coverageMinBeacons {
+                    gain++
+                }
+            }
+            if gain > bestGain {
+                best, bestGain = c, gain
+            }
+        }
+        if best < 0 {
+            break
+        }
+        used[best] = true
+        for _, i := range reach[best] {
+            visible[i]++
+        }
+        point := grid.center(best)
+        placed = append(placed, point)
+        projected = coverage()
+        result.Suggestions = append(result.Suggestions, BeaconSuggestion{Point: utils.Point{X: round3(point.X), Y: round3(point.Y)},
+            Height: coverageMountHeight, TxPower: txPower, Gain: round3(float64(bestGain) * cellArea), Coverage: projected})
+    }
+    result.ProjectedCoverage = projected
+    result.TargetReached = projected >= options.Target
+    return result, nil
+}
+
+// loadCoverageGrid строит сетку по размерам карты этажа (или по секторам, если размеры не заданы).
+// Торговый зал - ячейки внутри секторов, а если секторов нет - вся карта
+func loadCoverageGrid(db *gorm.DB, storeID uint, floorID *uint, scope func(*gorm.DB) *gorm.DB, cell float64) (*coverageGrid, error) {
+    var sectors []models.Sector
+    if err := db.Scopes(scope).Where("store_id = ?", storeID).Find(&sectors).Error; err != nil {
+        return nil, err
+    }
+    var walls []models.Wall
+    if err := db.Scopes(scope).Where("store_id = ?", storeID).Find(&walls).Error; err != nil {
+        return nil, err
+    }
+
+    var bounds utils.Rect
+    config, err := storeMapConfig(db, storeID, floorID)
+    switch {
+    case err == nil && config.RealWidth > 0 && config.RealHeight > 0:
+        bounds = utils.Rect{MaxX: config.RealWidth, MaxY: config.RealHeight}
+    case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+        return nil, err
+    default:
+        for i, sector := range sectors {
+            r := utils.Rect{MinX: sector.PositionX, MinY: sector.PositionY, MaxX: sector.PositionX + sector.Width, MaxY: sector.PositionY + sector.Height}
+            if i == 0 {
+                bounds = r
+                continue
+            }
+            bounds = utils.Rect{MinX: math.Min(bounds.MinX, r.MinX), MinY: math.Min(bounds.MinY, r.MinY),
+                MaxX: math.Max(bounds.MaxX, r.MaxX), MaxY: math.Max(bounds.MaxY, r.MaxY)}
+        }
+    }
+    if bounds.MaxX <= bounds.MinX || bounds.MaxY <= bounds.MinY {
+        return nil, ErrPointOutsideMap
+    }
+
+    if cells := (bounds.MaxX - bounds.MinX) * (bounds.MaxY - bounds.MinY) / (cell * cell); cells > maxCoverageCells {
+        cell *= math.Sqrt(cells / maxCoverageCells)
+    }
+    grid := &coverageGrid{origin: utils.Point{X: bounds.MinX, Y: bounds.MinY}, cell: cell,
+        cols: int(math.Ceil((bounds.MaxX - bounds.MinX) / cell)), rows: int(math.Ceil((bounds.MaxY - bounds.MinY) / cell))}
+    grid.inArea = make([]bool, grid.cols*grid.rows)
+    for i := range grid.inArea {
+        p := grid.center(i)
+        grid.inArea[i] = len(sectors) == 0
+        for _, sector := range sectors {
+            if p.X >= sector.PositionX && p.X <= sector.PositionX+sector.Width && p.Y >= sector.PositionY && p.Y <= sector.PositionY+sector.Height {
+                grid.inArea[i] = true
+                break
+            }
+        }
+    }
+    for _, w := range walls {
+        grid.walls = append(grid.walls, [2]utils.Point{{X: w.StartX, Y: w.StartY}, {X: w.EndX, Y: w.EndY}})
+    }
+    return grid, nil
+}
+
+// coverageCandidates возвращает ячейки зала - возможные места новых маячков, прореженные так,
+// чтобы их было не больше maxCoverageCandidates
+func coverageCandidates(grid *coverageGrid, areaCells int) []int {
+    step := int(math.Ceil(math.Sqrt(float64(areaCells) / maxCoverageCandidates)))
+    if step < 1 {
+        step = 1
+    }
+    var candidates []int
+    for row := step / 2; row < grid.rows; row += step {
+        for col := step / 2; col < grid.cols; col += step {
+            if i := row*grid.cols + col; grid.inArea[i] {
+                candidates = append(candidates, i)
+            }
+        }
+    }
+    return candidates
+}
+
+func tooClose(p utils.Point, placed []utils.Point) bool {
+    for _, q := range placed {
+        if math.Hypot(p.X-q.X, p.Y-q.Y) < coverageMinSpacing {
+            return true
+        }
+    }
+    return false
+}
+
+// coverageZones объединяет соседние ячейки зала, где видно меньше трех маячков, в области
+func coverageZones(grid *coverageGrid, visible []int) []CoverageZone {
+    zones := []CoverageZone{}
+    seen := make([]bool, len(visible))
+    for start := range visible {
+        if seen[start] || !grid.inArea[start] || visible[start] >= coverageMinBeacons {
+            continue
+        }
+        zone := CoverageZone{MinVisible: visible[start]}
+        var cx, cy float64
+        count := 0
+        first := true
+        queue := []int{start}
+        seen[start] = true
+        for len(queue) > 0 {
+            i := queue[0]
+            queue = queue[1:]
+            col, row := i%grid.cols, i/grid.cols
+            r := utils.Rect{MinX: grid.origin.X + float64(col)*grid.cell, MinY: grid.origin.Y + float64(row)*grid.cell}
+            r.MaxX, r.MaxY = r.MinX+grid.cell, r.MinY+grid.cell
+            if first {
+                zone.Bounds, first = r, false
+            } else {
+                zone.Bounds = utils.Rect{MinX: math.Min(zone.Bounds.MinX, r.MinX), MinY: math.Min(zone.Bounds.MinY, r.MinY),
+                    MaxX: math.Max(zone.Bounds.MaxX, r.MaxX), MaxY: math.Max(zone.Bounds.MaxY, r.MaxY)}
+            }
+            p := grid.center(i)
+            cx, cy, count = cx+p.X, cy+p.Y, count+1
+            if visible[i] < zone.MinVisible {
+                zone.MinVisible = visible[i]
+            }
+            for _, n := range [][2]int{{col - 1, row}, {col + 1, row}, {col, row - 1}, {col, row + 1}} {
+                if n[0] < 0 || n[1] < 0 || n[0] >= grid.cols || n[1] >= grid.rows {
+                    continue
+                }
+                j := n[1]*grid.cols + n[0]
+                if !seen[j] && grid.inArea[j] && visible[j] < coverageMinBeacons {
+                    seen[j] = true
+                    queue = append(queue, j)
+                }
+            }
+        }
+        zone.Center = utils.Point{X: round3(cx / float64(count)), Y: round3(cy / float64(count))}
+        zone.Area = round3(float64(count) * grid.cell * grid.cell)
+        zones = append(zones, zone)
+    }
+    sort.SliceStable(zones, func(i, j int) bool { return zones[i].Area > zones[j].Area })
+    return zones
+}
+
+// bands возвращает полосы ячеек для отрисовки карты покрытия по числу видимых маячков
+func (m *CoverageMap) bands() []mapBand {
+    colorOf := func(n int) string {
+        switch {
+        case n < 0:
+            return ""
+        case n >= m.MinBeacons:
+            return coverageGoodColor
+        case n > 0:
+            return coveragePartialColor
+        }
+        return coverageNoneColor
+    }
+    var bands []mapBand
+    for row, counts := range m.Visible {
+        y := m.Origin.Y + float64(row)*m.CellSize
+        for col := 0; col < len(counts); {
+            color := colorOf(counts[col])
+            end := col + 1
+            for end < len(counts) && colorOf(counts[end]) == color {
+                end++
+            }
+            if color != "" {
+                x1, x2 := m.Origin.X+float64(col)*m.CellSize, m.Origin.X+float64(end)*m.CellSize
+                bands = append(bands, mapBand{color: color,
+                    points: []utils.Point{{X: x1, Y: y}, {X: x2, Y: y}, {X: x2, Y: y + m.CellSize}, {X: x1, Y: y + m.CellSize}}})
+            }
+            col = end
+        }
+    }
+    return bands
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+    "context"
+    "crypto/sha1"
+    "encoding/csv"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "time"
+
+    "github.com/redis/go-redis/v9"
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+// Типы узлов матрицы расстояний
+const (
+    DistanceNodeSector   = "sector"
+    DistanceNodeEntrance = "entrance"
+    DistanceNodeCheckout = "checkout"
+)
+
+// Матрица хранится, пока не изменится планировка; срок - чтобы не копились матрицы удаленных магазинов
+const distanceCacheTTL = 7 * 24 * time.Hour
+
+// DistanceNode - узел матрицы расстояний: центр сектора, вход или касса
+type DistanceNode struct {
+    Type    string      `json:"type"`
+    ID      uint        `json:"id"` // ID сектора или элемента карты
+    Name    string      `json:"name"`
+    FloorID *uint       `json:"floor_id"`
+    Point   utils.Point `json:"point"`
+}
+
+// DistanceMatrix - кратчайшие маршруты между всеми узлами магазина по постоянной планировке
+// (без временных закрытий и загруженности). Недостижимые пары отмечены -1
+type DistanceMatrix struct {
+    StoreID    uint           `json:"store_id"`
+    Profile    string         `json:"profile"`
+    Layout     string         `json:"layout"` // Отпечаток планировки, по которой посчитана матрица
+    ComputedAt time.Time      `json:"computed_at"`
+    Nodes      []DistanceNode `json:"nodes"`
+    Distances  [][]float64    `json:"distances"` // Distances[i][j] - от узла i до узла j в метрах
+    Durations  [][]float64    `json:"durations"` // В секундах, с учетом переходов между этажами
+}
+
+type DistanceService struct {
+    db    *gorm.DB
+    cache *redis.Client
+}
+
+func NewDistanceService(db *gorm.DB) *DistanceService {
+    return &DistanceService{db: db, cache: newRedisClient()}
+}
+
+// Matrix возвращает матрицу расстояний из кэша, а если планировка изменилась - пересчитывает ее.
+// Без Redis матрица считается при каждом запросе
+func (s *DistanceService) Matrix(storeID uint, profileName string) (*DistanceMatrix, error) {
+    profile, err := GetRouteProfile(profileName)
+    if err != nil {
+        return nil, err
+    }
+    layout, err := layoutFingerprint(s.db, storeID)
+    if err != nil {
+        return nil, err
+    }
+    if matrix := s.cached(storeID, profile.Name); matrix != nil && matrix.Layout == layout {
+        return matrix, nil
+    }
+
+    matrix, err := computeDistances(s.db, storeID, profile)
+    if err != nil {
+        return nil, err
+    }
+    matrix.Layout = layout
+    if data, err := json.Marshal(matrix); err == nil {
+        s.cache.Set(context.Background(), distanceCacheKey(storeID, profile.Name), data, distanceCacheTTL)
+    }
+    return matrix, nil
+}
+
+// RefreshDue заранее пересчитывает матрицы профиля по умолчанию для магазинов, планировка которых
+// изменилась. Возвращает количество пересчитанных матриц
+func (s *DistanceService) RefreshDue() (int, error) {
+    ctx := context.Background()
+    // Без Redis сохранить результат негде - матрицы посчитаются по запросу
+    if err := s.cache.Ping(ctx).Err(); err != nil {
+        return 0, nil
+    }
+
+    var storeIDs []uint
+    if err := s.db.Model(&models.Sector{}).Distinct("store_id").Pluck("store_id", &storeIDs).Error; err != nil {
+        return 0, err
+    }
+    refreshed := 0
+    for _, storeID := range storeIDs {
+        layout, err := layoutFingerprint(s.db, storeID)
+        if err != nil {
+            return refreshed, err
+        }
+        if matrix := s.cached(storeID, RouteProfileDefault); matrix != nil && matrix.Layout == layout {
+            continue
+        }
+        if _, err := s.Matrix(storeID, RouteProfileDefault); err != nil && !errors.Is(err, ErrPointOutsideMap) {
+            return refreshed, err
+        }
+        refreshed++
+    }
+    return refreshed, nil
+}
+
+// Invalidate удаляет матрицы и графы навигации магазина из кэша
+func (s *DistanceService) Invalidate(storeID uint) error {
+    DropNavGraphs()
+    ctx := context.Background()
+    keys := make([]string, 0, len(RouteProfiles))
+    for name := range RouteProfiles {
+        keys = append(keys, distanceCacheKey(storeID, name))
+    }
+    return s.cache.Del(ctx, keys...).Err()
+}
+
+func (s *DistanceService) cached(storeID uint, profile string) *DistanceMatrix {
+    data, err := s.cache.Get(context.Background(), distanceCacheKey(storeID, profile)).Bytes()
+    if err != nil {
+        return nil
+    }
+    var matrix DistanceMatrix
+    if err := json.Unmarshal(data, &matrix); err != nil {
+        return nil
+    }
+    return &matrix
+}
+
+func distanceCacheKey(storeID uint, profile string) string {
+    return fmt.Sprintf("store:%d:distances:%s", storeID, profile)
+}
+
+// layoutFingerprint вычисляет отпечаток планировки магазина: этажи, конфигурация карты, стены,
+// секторы, элементы карты, стеллажи, конструктивные элементы и вертикальные переходы.
+// Любое изменение этих объектов меняет отпечаток и делает кэшированную матрицу устаревшей
+func layoutFingerprint(db *gorm.DB, storeID uint) (string, error) {
+    hash := sha1.New()
+    encoder := json.NewEncoder(hash)
+    queries := []struct {
+        query *gorm.DB
+        rows  interface{}
+    }{
+        {db.Where("store_id = ?", storeID), &[]models.Floor{}},
+        {db.Where("store_id = ?", storeID), &[]models.StoreMapConfig{}},
+        {db.Where("store_id = ?", storeID), &[]models.Wall{}},
+        {db.Where("store_id = ?", storeID), &[]models.Sector{}},
+        {db.Where("store_id = ?", storeID), &[]models.MapElement{}},
+        {db.Where("store_id = ?", storeID), &[]models.Fixture{}},
+        {db.Where("layout_id IN (?)", db.Model(&models.StoreLayout{}).Select("id").Where("store_id = ?", storeID)), &[]models.StructuralElement{}},
+        {db.Preload("Stops", func(q *gorm.DB) *gorm.DB { return q.Order("id") }).Where("store_id = ?", storeID), &[]models.VerticalConnector{}},
+    }
+    for _, q := range queries {
+        if err := q.query.Order("id").Find(q.rows).Error; err != nil {
+            return "", err
+        }
+        if err := encoder.Encode(q.rows); err != nil {
+            return "", err
+        }
+    }
+    return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// distanceNodes возвращает узлы матрицы: центры секторов, входы и кассы
+func distanceNodes(db *gorm.DB, storeID uint) ([]DistanceNode, error) {
+    var sectors []models.Sector
+    if err := db.Where("store_id = ?", storeID).Order("id").Find(&sectors).Error; err != nil {
+        return nil, err
+    }
+    nodes := make([]DistanceNode, 0, len(sectors))
+    for _, sector := range sectors {
+        nodes = append(nodes, DistanceNode{
+            Type:    DistanceNodeSector,
+            ID:      sector.ID,
+            Name:    sector.Name,
+            FloorID: sector.FloorID,
+            Point:   utils.Point{X: sector.PositionX + sector.Width/2, Y: sector.PositionY + sector.Height/2},
+        })
+    }
+
+    var elements []models.MapElement
+    if err := db.Where("store_id = ? AND type IN ?", storeID, []string{"entrance", "cashier"}).Order("type DESC, id").
+        Find(&elements).Error; err != nil {
+        return nil, err
+    }
+    for _, e := range elements {
+        kind := DistanceNodeEntrance
+        if e.Type == "cashier" {
+            kind = DistanceNodeCheckout
+        }
+        nodes = append(nodes, DistanceNode{
+            Type:    kind,
+            ID:      e.ID,
+            Name:    e.Name,
+            FloorID: e.FloorID,
+            Point:   utils.Point{X: e.PositionX + e.Width/2, Y: e.PositionY + e.Height/2},
+        })
+    }
+    return nodes, nil
+}
+
+// computeDistances строит граф навигации один раз и находит маршруты из каждого узла до всех остальных
+func computeDistances(db *gorm.DB, storeID uint, profile RouteProfile) (*DistanceMatrix, error) {
+    nodes, err := distanceNodes(db, storeID)
+    if err != nil {
+        return nil, err
+    }
+    matrix := &DistanceMatrix{StoreID: storeID, Profile: profile.Name, ComputedAt: time.Now(), Nodes: nodes,
+        Distances: make([][]float64, len(nodes)), Durations: make([][]float64, len(nodes))}
+    for i := range nodes {
+        matrix.Distances[i] = make([]float64, len(nodes))
+        matrix.Durations[i] = make([]float64, len(nodes))
+        for j := range nodes {
+            if i != j {
+                matrix.Distances[i][j], matrix.Durations[i][j] = -1, -1
+            }
+        }
+    }
+    if len(nodes) == 0 {
+        return matrix, nil
+    }
+
+    endpoints := make([]RouteEndpoint, len(nodes))
+    for i, n := range nodes {
+        endpoints[i] = RouteEndpoint{Point: n.Point, FloorID: n.FloorID, Label: n.Name}
+    }
+    graph, err := loadNavGraph(db, storeID, profile, time.Time{})
+    if err != nil {
+        return nil, err
+    }
+    // Узлы, которые не удалось привязать к свободной ячейке, остаются недостижимыми
+    graphNodes := make([]int, len(nodes))
+    for i, endpoint := range endpoints {
+        if graphNodes[i], err = graph.node(endpoint); err != nil {
+            graphNodes[i] = -1
+        }
+    }
+
+    for i, from := range graphNodes {
+        if from < 0 {
+            continue
+        }
+        dist, prev := graph.shortest(from, -1)
+        for j, to := range graphNodes {
+            if i == j || to < 0 {
+                continue
+            }
+            path := graph.path(from, to, dist, prev)
+            if path == nil {
+                continue
+            }
+            route := graph.build(endpoints[i], endpoints[j], path, dist)
+            matrix.Distances[i][j], matrix.Durations[i][j] = route.Distance, route.Duration
+        }
+    }
+    return matrix, nil
+}
+
+// WriteDistancesCSV выводит матрицу построчно: одна строка на пару узлов, недостижимые пары пропускаются
+func WriteDistancesCSV(w io.Writer, matrix *DistanceMatrix) error {
+    cw := csv.NewWriter(w)
+    cw.Write([]string{"from_type", "from_id", "from_name", "to_type", "to_id", "to_name", "distance_m", "duration_s"})
+    for i, from := range matrix.Nodes {
+        for j, to := range matrix.Nodes {
+            if i == j || matrix.Distances[i][j] < 0 {
+                continue
+            }
+            cw.Write([]string{
+                from.Type, strconv.FormatUint(uint64(from.ID), 10), from.Name,
+                to.Type, strconv.FormatUint(uint64(to.ID), 10), to.Name,
+                strconv.FormatFloat(matrix.Distances[i][j], 'f', -1, 64),
+                strconv.FormatFloat(matrix.Durations[i][j], 'f', -1, 64),
+            })
+        }
+    }
+    cw.Flush()
+    return cw.Error()
+}
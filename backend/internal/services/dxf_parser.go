@@ -0,0 +1,292 @@
+package services
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "strconv"
+    "strings"
+)
+
+var (
+    ErrBinaryDXF    = errors.New("binary DXF is not supported, save the drawing as ASCII DXF")
+    ErrMalformedDXF = errors.New("malformed DXF")
+)
+
+// dxfGroup - пара "код группы - значение" из файла DXF
+type dxfGroup struct {
+    code  int
+    value string
+}
+
+// DXFEntity - графический объект чертежа с исходными группами
+type DXFEntity struct {
+    Type   string
+    Layer  string
+    groups []dxfGroup
+}
+
+// DXFBlock - определение блока (колонны, кассы и т.п.)
+type DXFBlock struct {
+    Name     string
+    BaseX    float64
+    BaseY    float64
+    Entities []DXFEntity
+}
+
+// DXFDrawing - разобранный чертеж: единицы, блоки и объекты пространства модели
+type DXFDrawing struct {
+    InsUnits int // Значение $INSUNITS из заголовка, 0 - не задано
+    Blocks   map[string]*DXFBlock
+    Entities []DXFEntity
+
+    extents map[string]*dxfExtents // Габариты блоков, посчитанные blockExtents; nil - блок еще считается
+}
+
+func (e DXFEntity) float(code int) float64 {
+    for _, g := range e.groups {
+        if g.code == code {
+            v, _ := strconv.ParseFloat(g.value, 64)
+            return v
+        }
+    }
+    return 0
+}
+
+func (e DXFEntity) floatOr(code int, def float64) float64 {
+    for _, g := range e.groups {
+        if g.code == code {
+            if v, err := strconv.ParseFloat(g.value, 64); err == nil {
+                return v
+            }
+        }
+    }
+    return def
+}
+
+func (e DXFEntity) str(code int) string {
+    for _, g := range e.groups {
+        if g.code == code {
+            return g.value
+        }
+    }
+    return ""
+}
+
+// DXFVertex - вершина полилинии; Bulge != 0 означает дуговой сегмент
+type DXFVertex struct {
+    X, Y  float64
+    Bulge float64
+}
+
+// Vertices возвращает вершины LWPOLYLINE в порядке следования
+func (e DXFEntity) Vertices() []DXFVertex {
+    var vertices []DXFVertex
+    for _, g := range e.groups {
+        v, _ := strconv.ParseFloat(g.value, 64)
+        switch g.code {
+        case 10:
+            vertices = append(vertices, DXFVertex{X: v})
+        case 20:
+            if len(vertices) > 0 {
+                vertices[len(vertices)-1].Y = v
+            }
+        case 42:
+            if len(vertices) > 0 {
+                vertices[len(vertices)-1].Bulge = v
+            }
+        }
+    }
+    return vertices
+}
+
+// Closed сообщает, замкнута ли полилиния (флаг 1 в группе 70)
+func (e DXFEntity) Closed() bool {
+    flags, _ := strconv.Atoi(e.str(70))
+    return flags&1 == 1
+}
+
+// dxfFloatCode сообщает, что группа с кодом code хранит вещественное число
+func dxfFloatCode(code int) bool {
+    return code >= 10 && code <= 59 || code >= 110 && code <= 149 || code >= 210 && code <= 239 || code >= 1010 && code <= 1059
+}
+
+// ParseDXF читает ASCII DXF: заголовок, блоки и объекты
+func ParseDXF(r io.Reader) (*DXFDrawing, error) {
+    br := bufio.NewReader(r)
+    if head, _ := br.Peek(22); strings.HasPrefix(string(head), "AutoCAD Binary DXF") {
+        return nil, ErrBinaryDXF
+    }
+
+    var groups []dxfGroup
+    scanner := bufio.NewScanner(br)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    for scanner.Scan() {
+        codeLine := strings.TrimSpace(scanner.Text())
+        if !scanner.Scan() {
+            break
+        }
+        code, err := strconv.Atoi(codeLine)
+        if err != nil {
+            return nil, fmt.Errorf("%w: invalid group code %q", ErrMalformedDXF, codeLine)
+        }
+        value := strings.TrimSpace(scanner.Text())
+        // Координаты, размеры и углы должны быть конечными, иначе габариты чертежа теряют смысл
+        if dxfFloatCode(code) {
+            if v, _ := strconv.ParseFloat(value, 64); math.IsNaN(v) || math.IsInf(v, 0) {
+                return nil, fmt.Errorf("%w: group %d has non-finite value %q", ErrMalformedDXF, code, value)
+            }
+        }
+        groups = append(groups, dxfGroup{code: code, value: value})
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+    if len(groups) == 0 {
+        return nil, fmt.Errorf("%w: file is empty", ErrMalformedDXF)
+    }
+
+    drawing := &DXFDrawing{Blocks: make(map[string]*DXFBlock)}
+    section := ""
+    var block *DXFBlock
+
+    for i := 0; i < len(groups); i++ {
+        g := groups[i]
+        if g.code != 0 {
+            if section == "HEADER" && g.code == 9 && g.value == "$INSUNITS" && i+1 < len(groups) {
+                drawing.InsUnits, _ = strconv.Atoi(groups[i+1].value)
+            }
+            continue
+        }
+
+        switch g.value {
+        case "SECTION":
+            if i+1 < len(groups) && groups[i+1].code == 2 {
+                section = groups[i+1].value
+            }
+            continue
+        case "ENDSEC":
+            section = ""
+            continue
+        case "EOF":
+            return drawing, nil
+        }
+
+        // Собираем группы объекта до следующей группы с кодом 0
+        entity := DXFEntity{Type: g.value}
+        for i+1 < len(groups) && groups[i+1].code != 0 {
+            i++
+            entity.groups = append(entity.groups, groups[i])
+            if groups[i].code == 8 {
+                entity.Layer = groups[i].value
+            }
+        }
+
+        switch section {
+        case "BLOCKS":
+            switch entity.Type {
+            case "BLOCK":
+                block = &DXFBlock{Name: entity.str(2), BaseX: entity.float(10), BaseY: entity.float(20)}
+            case "ENDBLK":
+                if block != nil && block.Name != "" {
+                    drawing.Blocks[block.Name] = block
+                }
+                block = nil
+            default:
+                if block != nil {
+                    block.Entities = append(block.Entities, entity)
+                }
+            }
+        case "ENTITIES":
+            drawing.Entities = append(drawing.Entities, entity)
+        }
+    }
+    return drawing, nil
+}
+
+// dxfExtents - габариты в единицах чертежа
+type dxfExtents struct {
+    minX, minY, maxX, maxY float64
+    empty                  bool
+}
+
+func newExtents() dxfExtents {
+    return dxfExtents{minX: math.Inf(1), minY: math.Inf(1), maxX: math.Inf(-1), maxY: math.Inf(-1), empty: true}
+}
+
+func (e *dxfExtents) add(x, y float64) {
+    e.minX, e.minY = math.Min(e.minX, x), math.Min(e.minY, y)
+    e.maxX, e.maxY = math.Max(e.maxX, x), math.Max(e.maxY, y)
+    e.empty = false
+}
+
+// insertTransform переводит координаты блока в координаты чертежа для INSERT
+type insertTransform struct {
+    baseX, baseY   float64
+    x, y           float64
+    scaleX, scaleY float64
+    rotation       float64 // В градусах, против часовой стрелки
+}
+
+func newInsertTransform(insert DXFEntity, block *DXFBlock) insertTransform {
+    return insertTransform{
+        baseX: block.BaseX, baseY: block.BaseY,
+        x: insert.float(10), y: insert.float(20),
+        scaleX: insert.floatOr(41, 1), scaleY: insert.floatOr(42, 1),
+        rotation: insert.float(50),
+    }
+}
+
+func (t insertTransform) apply(x, y float64) (float64, float64) {
+    sin, cos := math.Sincos(t.rotation * math.Pi / 180)
+    lx, ly := (x-t.baseX)*t.scaleX, (y-t.baseY)*t.scaleY
+    return t.x + lx*cos - ly*sin, t.y + lx*sin + ly*cos
+}
+
+// blockExtents вычисляет габариты блока в его собственных координатах. Габариты каждого блока
+// считаются один раз, вложенные блоки учитываются углами своих габаритов; рекурсивные вставки пропускаются
+func (d *DXFDrawing) blockExtents(name string) (dxfExtents, bool) {
+    if d.extents == nil {
+        d.extents = make(map[string]*dxfExtents)
+    }
+    if ext, seen := d.extents[name]; seen {
+        if ext == nil {
+            return newExtents(), false
+        }
+        return *ext, !ext.empty
+    }
+    ext := newExtents()
+    block, ok := d.Blocks[name]
+    if !ok {
+        return ext, false
+    }
+    d.extents[name] = nil
+    for _, e := range block.Entities {
+        switch e.Type {
+        case "LINE":
+            ext.add(e.float(10), e.float(20))
+            ext.add(e.float(11), e.float(21))
+        case "LWPOLYLINE":
+            for _, v := range e.Vertices() {
+                ext.add(v.X, v.Y)
+            }
+        case "CIRCLE", "ARC":
+            cx, cy, r := e.float(10), e.float(20), e.float(40)
+            ext.add(cx-r, cy-r)
+            ext.add(cx+r, cy+r)
+        case "INSERT":
+            inner, ok := d.blockExtents(e.str(2))
+            if !ok {
+                continue
+            }
+            t := newInsertTransform(e, d.Blocks[e.str(2)])
+            for _, c := range [][2]float64{{inner.minX, inner.minY}, {inner.maxX, inner.minY}, {inner.maxX, inner.maxY}, {inner.minX, inner.maxY}} {
+                ext.add(t.apply(c[0], c[1]))
+            }
+        }
+    }
+    d.extents[name] = &ext
+    return ext, !ext.empty
+}
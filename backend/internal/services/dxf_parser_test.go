@@ -0,0 +1,118 @@
+package services
+
+import (
+    "errors"
+    "strings"
+    "testing"
+)
+
+// dxf собирает текст DXF из пар "код группы - значение"
+func dxf(pairs ...string) string {
+    return strings.Join(pairs, "\n") + "\n"
+}
+
+func TestParseDXF(t *testing.T) {
+    drawing := dxf(
+        "0", "SECTION", "2", "HEADER",
+        "9", "$INSUNITS", "70", "6",
+        "0", "ENDSEC",
+        "0", "SECTION", "2", "BLOCKS",
+        "0", "BLOCK", "2", "COLUMN", "10", "0.5", "20", "0.5",
+        "0", "CIRCLE", "8", "0", "10", "0.5", "20", "0.5", "40", "0.5",
+        "0", "ENDBLK",
+        "0", "ENDSEC",
+        "0", "SECTION", "2", "ENTITIES",
+        "0", "LINE", "8", "WALLS", "10", "0", "20", "0", "11", "12.5", "21", "0",
+        "0", "LWPOLYLINE", "8", "WALLS", "70", "1", "10", "0", "20", "0", "10", "4", "20", "0", "42", "1", "10", "4", "20", "3",
+        "0", "INSERT", "8", "COLUMNS", "2", "COLUMN", "10", "6", "20", "6",
+        "0", "ENDSEC",
+        "0", "EOF",
+    )
+
+    tests := []struct {
+        name         string
+        input        string
+        wantErr      error
+        wantUnits    int
+        wantBlocks   []string
+        wantEntities []string
+    }{
+        {"drawing", drawing, nil, 6, []string{"COLUMN"}, []string{"LINE", "LWPOLYLINE", "INSERT"}},
+        {"entities only, windows line endings", strings.ReplaceAll(dxf(
+            "0", "SECTION", "2", "ENTITIES", "0", "LINE", "8", "A", "0", "ENDSEC", "0", "EOF"), "\n", "\r\n"),
+            nil, 0, nil, []string{"LINE"}},
+        {"missing EOF", dxf("0", "SECTION", "2", "ENTITIES", "0", "LINE", "0", "ENDSEC"), nil, 0, nil, []string{"LINE"}},
+        {"binary", "AutoCAD Binary DXF\r\n\x1a\x00", ErrBinaryDXF, 0, nil, nil},
+        {"empty", "", ErrMalformedDXF, 0, nil, nil},
+        {"bad group code", dxf("0", "SECTION", "x", "ENTITIES"), ErrMalformedDXF, 0, nil, nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := ParseDXF(strings.NewReader(tt.input))
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("ParseDXF() error = %v, want %v", err, tt.wantErr)
+            }
+            if err != nil {
+                return
+            }
+            if got.InsUnits != tt.wantUnits {
+                t.Errorf("InsUnits = %d, want %d", got.InsUnits, tt.wantUnits)
+            }
+            if len(got.Blocks) != len(tt.wantBlocks) {
+                t.Errorf("Blocks = %v, want %v", got.Blocks, tt.wantBlocks)
+            }
+            for _, name := range tt.wantBlocks {
+                if got.Blocks[name] == nil {
+                    t.Errorf("block %q is missing", name)
+                }
+            }
+            var types []string
+            for _, e := range got.Entities {
+                types = append(types, e.Type)
+            }
+            if strings.Join(types, ",") != strings.Join(tt.wantEntities, ",") {
+                t.Errorf("Entities = %v, want %v", types, tt.wantEntities)
+            }
+        })
+    }
+}
+
+func TestParseDXFEntities(t *testing.T) {
+    got, err := ParseDXF(strings.NewReader(dxf(
+        "0", "SECTION", "2", "BLOCKS",
+        "0", "BLOCK", "2", "COLUMN", "10", "0.5", "20", "0.25",
+        "0", "CIRCLE", "8", "0", "10", "0.5", "20", "0.5", "40", "0.5",
+        "0", "ENDBLK",
+        "0", "ENDSEC",
+        "0", "SECTION", "2", "ENTITIES",
+        "0", "LINE", "8", "WALLS", "10", "1", "20", "2", "11", "12.5", "21", "2",
+        "0", "LWPOLYLINE", "8", "WALLS", "70", "1", "10", "0", "20", "0", "10", "4", "20", "0", "42", "1", "10", "4", "20", "3",
+        "0", "ENDSEC",
+        "0", "EOF",
+    )))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    block := got.Blocks["COLUMN"]
+    if block.BaseX != 0.5 || block.BaseY != 0.25 || len(block.Entities) != 1 || block.Entities[0].Type != "CIRCLE" {
+        t.Errorf("COLUMN block = %+v", block)
+    }
+
+    line := got.Entities[0]
+    if line.Layer != "WALLS" || line.float(10) != 1 || line.float(21) != 2 || line.float(11) != 12.5 {
+        t.Errorf("LINE = %+v", line)
+    }
+
+    polyline := got.Entities[1]
+    want := []DXFVertex{{X: 0, Y: 0}, {X: 4, Y: 0, Bulge: 1}, {X: 4, Y: 3}}
+    vertices := polyline.Vertices()
+    if !polyline.Closed() || len(vertices) != len(want) {
+        t.Fatalf("LWPOLYLINE closed = %v, vertices = %+v", polyline.Closed(), vertices)
+    }
+    for i := range want {
+        if vertices[i] != want[i] {
+            t.Errorf("vertex %d = %+v, want %+v", i, vertices[i], want[i])
+        }
+    }
+}
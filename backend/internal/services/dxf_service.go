@@ -0,0 +1,314 @@
+package services
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "strings"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+var ErrUnsupportedUnits = errors.New("unsupported units, expected one of mm, cm, m, in, ft")
+
+// dxfUnits - множители перевода единиц чертежа в метры
+var dxfUnits = map[string]float64{
+    "mm": 0.001,
+    "cm": 0.01,
+    "m":  1,
+    "in": 0.0254,
+    "ft": 0.3048,
+}
+
+// dxfInsUnits - соответствие кодов $INSUNITS единицам
+var dxfInsUnits = map[int]string{1: "in", 2: "ft", 4: "mm", 5: "cm", 6: "m"}
+
+// dxfBlockKeywords - типы по умолчанию для блоков по подстроке имени, если сопоставление не задано
+var dxfBlockKeywords = []struct {
+    keyword string
+    typ     string
+}{
+    {"COLUMN", "column"},
+    {"КОЛОНН", "column"},
+    {"CASH", "cashier"},
+    {"KASSA", "cashier"},
+    {"КАСС", "cashier"},
+    {"ENTRANCE", "entrance"},
+    {"ВХОД", "entrance"},
+}
+
+// DXFImportOptions - параметры импорта чертежа
+type DXFImportOptions struct {
+    WallLayers    []string          // Слои со стенами, пусто - все слои
+    WallThickness float64           // Толщина стен в метрах
+    Blocks        map[string]string // Имя блока -> тип конструктивного элемента
+    Units         string            // mm, cm, m, in, ft; пусто - из заголовка чертежа
+    OriginX       float64           // Положение левого верхнего угла чертежа в координатах магазина
+    OriginY       float64
+    FloorID       *uint             // Этаж чертежа, nil - нижний этаж
+    Replace       bool              // Удалить существующие стены и конструктивные элементы этажа
+    DryRun        bool              // Только предпросмотр, без записи в базу
+}
+
+// DXFImportResult - что создано (или будет создано при DryRun) из чертежа
+type DXFImportResult struct {
+    DryRun             bool                       `json:"dry_run"`
+    Units              string                     `json:"units"`
+    Bounds             utils.Rect                 `json:"bounds"`
+    Layers             map[string]int             `json:"layers"` // Количество объектов по слоям чертежа
+    Blocks             map[string]int             `json:"blocks"` // Количество вставок по блокам
+    Walls              []models.Wall              `json:"walls"`
+    StructuralElements []models.StructuralElement `json:"structural_elements"`
+    Skipped            int                        `json:"skipped"`
+    Warnings           []string                   `json:"warnings"`
+}
+
+type DXFImportService struct {
+    db *gorm.DB
+}
+
+func NewDXFImportService(db *gorm.DB) *DXFImportService {
+    return &DXFImportService{db: db}
+}
+
+// dxfInsert - вставка блока, распознанная как конструктивный элемент
+type dxfInsert struct {
+    typ     string
+    block   string
+    layer   string
+    corners []utils.Point // Контур блока в единицах чертежа, пусто - точечный элемент
+    x, y    float64
+}
+
+// Import разбирает чертеж и создает стены и конструктивные элементы магазина
+func (s *DXFImportService) Import(storeID uint, r io.Reader, opts DXFImportOptions) (*DXFImportResult, error) {
+    if err := checkStoreFloor(s.db, storeID, opts.FloorID); err != nil {
+        return nil, err
+    }
+    drawing, err := ParseDXF(r)
+    if err != nil {
+        return nil, err
+    }
+
+    result := &DXFImportResult{
+        DryRun:             opts.DryRun,
+        Layers:             make(map[string]int),
+        Blocks:             make(map[string]int),
+        Walls:              []models.Wall{},
+        StructuralElements: []models.StructuralElement{},
+        Warnings:           []string{},
+    }
+
+    units := strings.ToLower(strings.TrimSpace(opts.Units))
+    if units == "" {
+        units = dxfInsUnits[drawing.InsUnits]
+        if units == "" {
+            units = "mm"
+            result.Warnings = append(result.Warnings, "drawing units are not set, assuming millimeters")
+        }
+    }
+    factor, ok := dxfUnits[units]
+    if !ok {
+        return nil, ErrUnsupportedUnits
+    }
+    result.Units = units
+
+    thickness := opts.WallThickness
+    if thickness <= 0 {
+        thickness = 0.1
+    }
+
+    wallLayers := make(map[string]bool)
+    for _, layer := range opts.WallLayers {
+        wallLayers[strings.ToUpper(layer)] = true
+    }
+    blockTypes := make(map[string]string)
+    for name, typ := range opts.Blocks {
+        blockTypes[strings.ToUpper(name)] = typ
+    }
+
+    // Собираем отрезки стен и вставки в координатах чертежа
+    var segments [][2]utils.Point
+    var inserts []dxfInsert
+    arcs := 0
+    for _, e := range drawing.Entities {
+        result.Layers[e.Layer]++
+        switch e.Type {
+        case "LINE", "LWPOLYLINE":
+            if len(wallLayers) > 0 && !wallLayers[strings.ToUpper(e.Layer)] {
+                result.Skipped++
+                continue
+            }
+            if e.Type == "LINE" {
+                segments = append(segments, [2]utils.Point{{X: e.float(10), Y: e.float(20)}, {X: e.float(11), Y: e.float(21)}})
+                continue
+            }
+            vertices := e.Vertices()
+            count := len(vertices) - 1
+            if e.Closed() && len(vertices) > 2 {
+                count = len(vertices)
+            }
+            for i := 0; i < count; i++ {
+                next := vertices[(i+1)%len(vertices)]
+                if vertices[i].Bulge != 0 {
+                    arcs++
+                }
+                segments = append(segments, [2]utils.Point{{X: vertices[i].X, Y: vertices[i].Y}, {X: next.X, Y: next.Y}})
+            }
+        case "INSERT":
+            name := e.str(2)
+            result.Blocks[name]++
+            typ := dxfBlockType(name, blockTypes)
+            if typ == "" {
+                result.Skipped++
+                continue
+            }
+            insert := dxfInsert{typ: typ, block: name, layer: e.Layer, x: e.float(10), y: e.float(20)}
+            if ext, ok := drawing.blockExtents(name); ok {
+                t := newInsertTransform(e, drawing.Blocks[name])
+                // Углы в порядке обхода, который после отражения оси Y дает ЛВ, ПВ, ПН, ЛН
+                for _, c := range [][2]float64{{ext.minX, ext.maxY}, {ext.maxX, ext.maxY}, {ext.maxX, ext.minY}, {ext.minX, ext.minY}} {
+                    x, y := t.apply(c[0], c[1])
+                    insert.corners = append(insert.corners, utils.Point{X: x, Y: y})
+                }
+            }
+            inserts = append(inserts, insert)
+        default:
+            result.Skipped++
+        }
+    }
+    if arcs > 0 {
+        result.Warnings = append(result.Warnings, fmt.Sprintf("%d arc segments were imported as straight walls", arcs))
+    }
+
+    // Габариты импортируемой геометрии, левый верхний угол переносится в OriginX/OriginY
+    ext := newExtents()
+    for _, seg := range segments {
+        ext.add(seg[0].X, seg[0].Y)
+        ext.add(seg[1].X, seg[1].Y)
+    }
+    for _, insert := range inserts {
+        ext.add(insert.x, insert.y)
+        for _, p := range insert.corners {
+            ext.add(p.X, p.Y)
+        }
+    }
+    if ext.empty {
+        result.Warnings = append(result.Warnings, "no walls or known blocks found in the drawing")
+        return result, nil
+    }
+    // Ось Y в DXF направлена вверх, в магазине - вниз
+    toStore := func(p utils.Point) utils.Point {
+        return utils.Point{X: (p.X-ext.minX)*factor + opts.OriginX, Y: (ext.maxY-p.Y)*factor + opts.OriginY}
+    }
+    result.Bounds = utils.Rect{
+        MinX: opts.OriginX, MinY: opts.OriginY,
+        MaxX: opts.OriginX + (ext.maxX-ext.minX)*factor, MaxY: opts.OriginY + (ext.maxY-ext.minY)*factor,
+    }
+
+    for _, seg := range segments {
+        a, b := toStore(seg[0]), toStore(seg[1])
+        if math.Hypot(b.X-a.X, b.Y-a.Y) < 1e-3 {
+            continue
+        }
+        result.Walls = append(result.Walls, models.Wall{
+            StoreID: storeID, StartX: round3(a.X), StartY: round3(a.Y), EndX: round3(b.X), EndY: round3(b.Y), Thickness: thickness,
+            FloorID: opts.FloorID,
+        })
+    }
+    for _, insert := range inserts {
+        metadata, _ := json.Marshal(map[string]string{"source": "dxf", "block": insert.block, "layer": insert.layer})
+        element := models.StructuralElement{Type: insert.typ, Metadata: string(metadata), FloorID: opts.FloorID}
+        if len(insert.corners) == 4 {
+            corners := make([]utils.Point, len(insert.corners))
+            for i, p := range insert.corners {
+                corners[i] = toStore(p)
+            }
+            x, y, w, h, rotation := utils.RectFromCorners(corners)
+            element.StartX, element.StartY, element.Width, element.Height, element.Rotation = round3(x), round3(y), round3(w), round3(h), round3(rotation)
+        } else {
+            p := toStore(utils.Point{X: insert.x, Y: insert.y})
+            element.StartX, element.StartY = round3(p.X), round3(p.Y)
+        }
+        result.StructuralElements = append(result.StructuralElements, element)
+    }
+
+    if opts.DryRun {
+        return result, nil
+    }
+
+    err = s.db.Transaction(func(tx *gorm.DB) error {
+        if opts.Replace {
+            // Заменяются только стены и элементы этажа чертежа, другие этажи не затрагиваются
+            floor, err := onFloorOrLowest(tx, storeID, opts.FloorID)
+            if err != nil {
+                return err
+            }
+            if err := tx.Scopes(floor).Where("store_id = ?", storeID).Delete(&models.Wall{}).Error; err != nil {
+                return err
+            }
+            if err := tx.Scopes(floor).Where("layout_id IN (?)", tx.Model(&models.StoreLayout{}).Select("id").Where("store_id = ?", storeID)).
+                Delete(&models.StructuralElement{}).Error; err != nil {
+                return err
+            }
+        }
+        if len(result.Walls) > 0 {
+            if err := tx.Create(&result.Walls).Error; err != nil {
+                return err
+            }
+        }
+        if len(result.StructuralElements) > 0 {
+            layoutID, err := storeLayoutID(tx, storeID, "Импорт DXF")
+            if err != nil {
+                return err
+            }
+            for i := range result.StructuralElements {
+                result.StructuralElements[i].LayoutID = layoutID
+            }
+            if err := tx.Create(&result.StructuralElements).Error; err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result, nil
+}
+
+// dxfBlockType определяет тип конструктивного элемента для блока; пустая строка - блок не импортируется
+func dxfBlockType(name string, blockTypes map[string]string) string {
+    upper := strings.ToUpper(name)
+    if len(blockTypes) > 0 {
+        return blockTypes[upper]
+    }
+    for _, k := range dxfBlockKeywords {
+        if strings.Contains(upper, k.keyword) {
+            return k.typ
+        }
+    }
+    return ""
+}
+
+// ParseBlockTypes разбирает сопоставление блоков вида "COL_500=column,KASSA=cashier"
+func ParseBlockTypes(s string) map[string]string {
+    blocks := make(map[string]string)
+    for _, item := range SplitList(s) {
+        name, typ, ok := strings.Cut(item, "=")
+        if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(typ) == "" {
+            continue
+        }
+        blocks[strings.TrimSpace(name)] = strings.TrimSpace(typ)
+    }
+    return blocks
+}
+
+func round3(v float64) float64 {
+    return math.Round(v*1000) / 1000
+}
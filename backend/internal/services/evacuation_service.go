@@ -0,0 +1,457 @@
+package services
+
+import (
+    "container/heap"
+    "errors"
+    "math"
+    "sort"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+// DefaultEvacuationDistance - допустимое расстояние до ближайшего эвакуационного выхода в метрах
+const DefaultEvacuationDistance = 50.0
+
+// Типы эвакуационных выходов
+const (
+    EvacuationExitDoor   = "exit"   // Выход или вход магазина (MapElement типа exit или entrance)
+    EvacuationExitStairs = "stairs" // Лестница на другой этаж
+)
+
+var ErrNoExits = errors.New("floor has no exits")
+
+// EvacuationExit - эвакуационный выход этажа
+type EvacuationExit struct {
+    Type  string      `json:"type"`
+    ID    uint        `json:"id"` // ID элемента карты или вертикального перехода
+    Name  string      `json:"name"`
+    Point utils.Point `json:"point"`
+    Area  float64     `json:"area"` // Площадь, ближайшим выходом для которой является этот, м²
+}
+
+// EvacuationRoute - путь от точки до ближайшего выхода
+type EvacuationRoute struct {
+    SectorID *uint         `json:"sector_id,omitempty"` // Для путей из секторов на плане эвакуации
+    Name     string        `json:"name,omitempty"`
+    Exit     int           `json:"exit"` // Индекс в EvacuationPlan.Exits
+    Distance float64       `json:"distance"`
+    Points   []utils.Point `json:"points"`
+}
+
+// EvacuationZone - связный участок, откуда до выхода дальше допустимого или выхода нет
+type EvacuationZone struct {
+    Area        float64     `json:"area"` // м²
+    Bounds      utils.Rect  `json:"bounds"`
+    Distance    float64     `json:"distance"`    // Наибольшее расстояние до выхода в зоне, -1 - выход недостижим
+    Unreachable bool        `json:"unreachable"` // В зоне есть точки, откуда выход недостижим
+    Farthest    utils.Point `json:"farthest"`    // Самая удаленная от выхода точка зоны
+}
+
+// EvacuationPlan - расстояния до ближайших выходов по всей площади этажа
+type EvacuationPlan struct {
+    StoreID     uint              `json:"store_id"`
+    FloorID     *uint             `json:"floor_id"`
+    MaxDistance float64           `json:"max_distance"`
+    Area        float64           `json:"area"`     // Площадь торгового зала (секторов), м²
+    Farthest    float64           `json:"farthest"` // Наибольшее расстояние до выхода, -1 - есть точки без выхода
+    Compliant   bool              `json:"compliant"`
+    Exits       []EvacuationExit  `json:"exits"`
+    Routes      []EvacuationRoute `json:"routes"`
+    Zones       []EvacuationZone  `json:"zones"`
+    field       *evacuationField
+}
+
+// evacuationField - поле расстояний до ближайшего выхода по ячейкам сетки этажа
+type evacuationField struct {
+    nav     *navFloor
+    dist    []float64 // В метрах, +Inf - выход недостижим
+    exit    []int32   // Индекс ближайшего выхода
+    next    []int32   // Следующая ячейка на пути к выходу, -1 - ячейка выхода
+    inPlan  []bool    // Ячейка относится к торговому залу
+    targets []int     // Ячейки выходов
+}
+
+type EvacuationService struct {
+    db *gorm.DB
+}
+
+func NewEvacuationService(db *gorm.DB) *EvacuationService {
+    return &EvacuationService{db: db}
+}
+
+// Plan рассчитывает план эвакуации этажа по постоянной планировке: ближайший выход для каждой точки,
+// пути из секторов и зоны, откуда до выхода дальше maxDistance (0 - DefaultEvacuationDistance)
+func (s *EvacuationService) Plan(storeID uint, floorID *uint, maxDistance float64) (*EvacuationPlan, error) {
+    if maxDistance <= 0 {
+        maxDistance = DefaultEvacuationDistance
+    }
+    field, exits, err := loadEvacuationField(s.db, storeID, floorID, time.Time{})
+    if err != nil {
+        return nil, err
+    }
+    nav := field.nav
+    plan := &EvacuationPlan{StoreID: storeID, FloorID: nav.floorID(), MaxDistance: maxDistance, Exits: exits,
+        Routes: []EvacuationRoute{}, Zones: []EvacuationZone{}, field: field}
+
+    cellArea := nav.cell * nav.cell
+    violating := make([]bool, len(field.dist))
+    for i, in := range field.inPlan {
+        if !in {
+            continue
+        }
+        plan.Area += cellArea
+        d := field.dist[i]
+        if math.IsInf(d, 1) {
+            plan.Farthest = -1
+        } else {
+            plan.Exits[field.exit[i]].Area += cellArea
+            if plan.Farthest >= 0 {
+                plan.Farthest = math.Max(plan.Farthest, d)
+            }
+        }
+        violating[i] = math.IsInf(d, 1) || d > maxDistance
+    }
+    plan.Zones = evacuationZones(field, violating)
+    plan.Compliant = len(plan.Zones) == 0
+
+    var sectors []models.Sector
+    scope, err := onFloor(s.db, storeID, plan.FloorID)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.db.Scopes(scope).Where("store_id = ?", storeID).Order("level, id").Find(&sectors).Error; err != nil {
+        return nil, err
+    }
+    for _, sector := range sectors {
+        center := utils.Point{X: sector.PositionX + sector.Width/2, Y: sector.PositionY + sector.Height/2}
+        route, err := field.route(center, exits)
+        if err != nil {
+            continue
+        }
+        id := sector.ID
+        route.SectorID, route.Name = &id, sector.Name
+        plan.Routes = append(plan.Routes, *route)
+    }
+
+    plan.Area, plan.Farthest = round3(plan.Area), round3(plan.Farthest)
+    for i := range plan.Exits {
+        plan.Exits[i].Area = round3(plan.Exits[i].Area)
+    }
+    return plan, nil
+}
+
+// RouteFrom возвращает путь от точки до ближайшего выхода с учетом действующих временных закрытий
+func (s *EvacuationService) RouteFrom(storeID uint, from RouteEndpoint) (*EvacuationRoute, []EvacuationExit, error) {
+    field, exits, err := loadEvacuationField(s.db, storeID, from.FloorID, time.Now())
+    if err != nil {
+        return nil, nil, err
+    }
+    route, err := field.route(from.Point, exits)
+    if err != nil {
+        return nil, nil, err
+    }
+    return route, exits, nil
+}
+
+// evacuationExits возвращает выходы этажа: выходы и входы магазина. На этажах без собственных
+// выходов (верхние этажи, подвал) эвакуационными выходами считаются лестницы
+func evacuationExits(db *gorm.DB, storeID uint, floor models.Floor, scope func(*gorm.DB) *gorm.DB) ([]EvacuationExit, error) {
+    var elements []models.MapElement
+    if err := db.Scopes(scope).Where("store_id = ? AND type IN ?", storeID, []string{"exit", "entrance"}).
+        Order("id").Find(&elements).Error; err != nil {
+        return nil, err
+    }
+    exits := make([]EvacuationExit, 0, len(elements))
+    for _, e := range elements {
+        exits = append(exits, EvacuationExit{Type: EvacuationExitDoor, ID: e.ID, Name: e.Name,
+            Point: utils.Point{X: e.PositionX + e.Width/2, Y: e.PositionY + e.Height/2}})
+    }
+
+    if floor.ID == 0 || len(exits) > 0 {
+        return exits, nil
+    }
+    var stops []struct {
+        ConnectorID uint
+        Name        string
+        X, Y        float64
+    }
+    if err := db.Model(&models.ConnectorStop{}).Select("connector_stops.connector_id, vertical_connectors.name, connector_stops.x, connector_stops.y").
+        Joins("JOIN vertical_connectors ON vertical_connectors.id = connector_stops.connector_id").
+        Where("vertical_connectors.store_id = ? AND vertical_connectors.type = ? AND connector_stops.floor_id = ?", storeID, models.ConnectorStairs, floor.ID).
+        Order("connector_stops.connector_id").Scan(&stops).Error; err != nil {
+        return nil, err
+    }
+    for _, stop := range stops {
+        exits = append(exits, EvacuationExit{Type: EvacuationExitStairs, ID: stop.ConnectorID, Name: stop.Name,
+            Point: utils.Point{X: stop.X, Y: stop.Y}})
+    }
+    return exits, nil
+}
+
+// loadEvacuationField строит сетку этажа floorID (nil - нижний этаж) и расстояния от каждой ячейки
+// до ближайшего выхода. at - момент для временных закрытий, нулевой - только постоянная планировка
+func loadEvacuationField(db *gorm.DB, storeID uint, floorID *uint, at time.Time) (*evacuationField, []EvacuationExit, error) {
+    var floor models.Floor
+    if floorID != nil {
+        if err := db.Where("id = ? AND store_id = ?", *floorID, storeID).First(&floor).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return nil, nil, ErrFloorNotFound
+            }
+            return nil, nil, err
+        }
+    } else {
+        lowest, err := defaultFloor(db, storeID)
+        if err != nil {
+            return nil, nil, err
+        }
+        if lowest != nil {
+            floor = *lowest
+        }
+    }
+    var scopeFloor *uint
+    if floor.ID != 0 {
+        scopeFloor = &floor.ID
+    }
+    scope, err := onFloor(db, storeID, scopeFloor)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    exits, err := evacuationExits(db, storeID, floor, scope)
+    if err != nil {
+        return nil, nil, err
+    }
+    if len(exits) == 0 {
+        return nil, nil, ErrNoExits
+    }
+    points := make([]utils.Point, len(exits))
+    for i, exit := range exits {
+        points[i] = exit.Point
+    }
+    nav, err := loadNavFloor(db, storeID, floor, points, RouteProfiles[RouteProfileDefault], at)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    field := &evacuationField{nav: nav, inPlan: make([]bool, len(nav.blocked))}
+    for _, p := range points {
+        cell, ok := nav.snap(p)
+        if !ok {
+            cell = -1
+        }
+        field.targets = append(field.targets, cell)
+    }
+    field.compute()
+
+    // Торговый зал - свободные ячейки секторов; без секторов - вся свободная площадь
+    var sectors []models.Sector
+    if err := db.Scopes(scope).Where("store_id = ?", storeID).Find(&sectors).Error; err != nil {
+        return nil, nil, err
+    }
+    for i := range field.inPlan {
+        if nav.blocked[i] {
+            continue
+        }
+        center := nav.center(i)
+        field.inPlan[i] = len(sectors) == 0
+        for _, sector := range sectors {
+            if center.X >= sector.PositionX && center.X <= sector.PositionX+sector.Width &&
+                center.Y >= sector.PositionY && center.Y <= sector.PositionY+sector.Height {
+                field.inPlan[i] = true
+                break
+            }
+        }
+    }
+    return field, exits, nil
+}
+
+// compute находит расстояния до ближайшего выхода алгоритмом Дейкстры от всех выходов сразу
+func (f *evacuationField) compute() {
+    nav := f.nav
+    f.dist = make([]float64, len(nav.blocked))
+    f.exit = make([]int32, len(nav.blocked))
+    f.next = make([]int32, len(nav.blocked))
+    for i := range f.dist {
+        f.dist[i], f.exit[i], f.next[i] = math.Inf(1), -1, -1
+    }
+    queue := &navQueue{}
+    for exit, cell := range f.targets {
+        if cell < 0 || f.dist[cell] == 0 {
+            continue
+        }
+        f.dist[cell], f.exit[cell] = 0, int32(exit)
+        heap.Push(queue, navItem{node: cell})
+    }
+
+    for queue.Len() > 0 {
+        item := heap.Pop(queue).(navItem)
+        if item.dist > f.dist[item.node] {
+            continue
+        }
+        col, row := item.node%nav.cols, item.node/nav.cols
+        for _, m := range navMoves {
+            c, r := col+m[0], row+m[1]
+            if c < 0 || r < 0 || c >= nav.cols || r >= nav.rows || nav.blocked[r*nav.cols+c] {
+                continue
+            }
+            if m[0] != 0 && m[1] != 0 && (nav.blocked[row*nav.cols+c] || nav.blocked[r*nav.cols+col]) {
+                continue
+            }
+            next := r*nav.cols + c
+            if d := item.dist + nav.cell*math.Hypot(float64(m[0]), float64(m[1])); d < f.dist[next] {
+                f.dist[next], f.exit[next], f.next[next] = d, f.exit[item.node], int32(item.node)
+                heap.Push(queue, navItem{node: next, dist: d})
+            }
+        }
+    }
+}
+
+// route строит путь от точки до ближайшего к ней выхода по полю расстояний
+func (f *evacuationField) route(from utils.Point, exits []EvacuationExit) (*EvacuationRoute, error) {
+    nav := f.nav
+    cell, ok := nav.snap(from)
+    if !ok {
+        return nil, ErrPointOutsideMap
+    }
+    if math.IsInf(f.dist[cell], 1) {
+        return nil, ErrNoRoute
+    }
+    exit := f.exit[cell]
+    points := []utils.Point{from}
+    for node := int32(cell); node >= 0; node = f.next[node] {
+        points = append(points, nav.center(int(node)))
+    }
+    points = nav.smooth(append(points, exits[exit].Point))
+
+    route := &EvacuationRoute{Exit: int(exit), Points: points}
+    for i := 1; i < len(points); i++ {
+        route.Distance += math.Hypot(points[i].X-points[i-1].X, points[i].Y-points[i-1].Y)
+    }
+    route.Distance = round3(route.Distance)
+    return route, nil
+}
+
+// evacuationZones объединяет соседние ячейки с нарушением в зоны, от больших к меньшим
+func evacuationZones(f *evacuationField, violating []bool) []EvacuationZone {
+    nav := f.nav
+    zones := []EvacuationZone{}
+    seen := make([]bool, len(violating))
+    for start, v := range violating {
+        if !v || seen[start] {
+            continue
+        }
+        zone := EvacuationZone{Bounds: utils.Rect{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}}
+        farthest := -1
+        stack := []int{start}
+        seen[start] = true
+        for len(stack) > 0 {
+            i := stack[len(stack)-1]
+            stack = stack[:len(stack)-1]
+
+            zone.Area += nav.cell * nav.cell
+            c := nav.center(i)
+            zone.Bounds = utils.Rect{MinX: math.Min(zone.Bounds.MinX, c.X-nav.cell/2), MinY: math.Min(zone.Bounds.MinY, c.Y-nav.cell/2),
+                MaxX: math.Max(zone.Bounds.MaxX, c.X+nav.cell/2), MaxY: math.Max(zone.Bounds.MaxY, c.Y+nav.cell/2)}
+            if math.IsInf(f.dist[i], 1) {
+                zone.Unreachable = true
+                farthest = i
+            } else if !zone.Unreachable && (farthest < 0 || f.dist[i] > f.dist[farthest]) {
+                farthest = i
+            }
+
+            col, row := i%nav.cols, i/nav.cols
+            for _, m := range navMoves[:4] {
+                c, r := col+m[0], row+m[1]
+                if c < 0 || r < 0 || c >= nav.cols || r >= nav.rows {
+                    continue
+                }
+                if next := r*nav.cols + c; violating[next] && !seen[next] {
+                    seen[next] = true
+                    stack = append(stack, next)
+                }
+            }
+        }
+
+        zone.Distance = -1
+        if !zone.Unreachable {
+            zone.Distance = round3(f.dist[farthest])
+        }
+        zone.Farthest = nav.center(farthest)
+        zone.Area = round3(zone.Area)
+        zones = append(zones, zone)
+    }
+    sort.SliceStable(zones, func(i, j int) bool { return zones[i].Area > zones[j].Area })
+    return zones
+}
+
+// mapBand - полоса ячеек одного ряда с одинаковым цветом заливки (план эвакуации, карта покрытия)
+type mapBand struct {
+    points []utils.Point
+    color  string
+}
+
+// Цвета оценки расстояния до выхода на плане эвакуации
+const (
+    evacuationNearColor        = "#66bb6a59" // Не дальше половины допустимого
+    evacuationFarColor         = "#ffee5873" // Не дальше допустимого
+    evacuationViolationColor   = "#ef535080" // Дальше допустимого
+    evacuationUnreachableColor = "#8e24aa80" // Выход недостижим
+    evacuationRouteColor       = "#2e7d32"
+)
+
+// bands разбивает торговый зал на горизонтальные полосы по оценке расстояния до выхода
+func (p *EvacuationPlan) bands() []mapBand {
+    if p.field == nil {
+        return nil
+    }
+    nav := p.field.nav
+    colorOf := func(i int) string {
+        switch d := p.field.dist[i]; {
+        case !p.field.inPlan[i]:
+            return ""
+        case math.IsInf(d, 1):
+            return evacuationUnreachableColor
+        case d > p.MaxDistance:
+            return evacuationViolationColor
+        case d > p.MaxDistance/2:
+            return evacuationFarColor
+        default:
+            return evacuationNearColor
+        }
+    }
+
+    var bands []mapBand
+    for row := 0; row < nav.rows; row++ {
+        y := nav.origin.Y + float64(row)*nav.cell
+        for col := 0; col < nav.cols; {
+            color := colorOf(row*nav.cols + col)
+            end := col + 1
+            for end < nav.cols && colorOf(row*nav.cols+end) == color {
+                end++
+            }
+            if color != "" {
+                x1, x2 := nav.origin.X+float64(col)*nav.cell, nav.origin.X+float64(end)*nav.cell
+                bands = append(bands, mapBand{color: color,
+                    points: []utils.Point{{X: x1, Y: y}, {X: x2, Y: y}, {X: x2, Y: y + nav.cell}, {X: x1, Y: y + nav.cell}}})
+            }
+            col = end
+        }
+    }
+    return bands
+}
+
+// evacuationExitLabel возвращает подпись выхода на плане эвакуации
+func evacuationExitLabel(exit EvacuationExit) string {
+    label := "Выход"
+    if exit.Type == EvacuationExitStairs {
+        label = "Лестница"
+    }
+    if exit.Name != "" {
+        label += " «" + exit.Name + "»"
+    }
+    return label
+}
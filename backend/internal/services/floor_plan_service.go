@@ -0,0 +1,319 @@
+package services
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "image"
+    _ "image/jpeg"
+    _ "image/png"
+    "io"
+    "math"
+    "net/http"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+)
+
+// MaxFloorPlanSize - максимальный размер загружаемого плана
+const MaxFloorPlanSize = 20 << 20
+
+var (
+    ErrUnsupportedFileType = errors.New("unsupported file type, expected PNG, JPEG or PDF")
+    ErrFileTooLarge        = errors.New("file is too large")
+    ErrInvalidCalibration  = errors.New("invalid calibration points")
+)
+
+// Поддерживаемые форматы плана и расширения файлов в хранилище
+var floorPlanTypes = map[string]string{
+    "image/png":       "png",
+    "image/jpeg":      "jpg",
+    "application/pdf": "pdf",
+}
+
+type FloorPlanService struct {
+    db    *gorm.DB
+    blobs BlobStore
+}
+
+func NewFloorPlanService(db *gorm.DB, blobs BlobStore) *FloorPlanService {
+    return &FloorPlanService{db: db, blobs: blobs}
+}
+
+// floorScope выбирает план или конфигурацию карты этажа floorID, nil - общие для магазина
+func floorScope(floorID *uint) func(*gorm.DB) *gorm.DB {
+    return func(q *gorm.DB) *gorm.DB {
+        if floorID == nil {
+            return q.Where("floor_id IS NULL")
+        }
+        return q.Where("floor_id = ?", *floorID)
+    }
+}
+
+// Upload сохраняет план этажа floorID (nil - план магазина), заменяя предыдущий. Если предыдущий план
+// был откалиброван, масштаб, поворот и смещение карты этажа сбрасываются - новый план нужно откалибровать заново
+func (s *FloorPlanService) Upload(storeID uint, floorID *uint, fileName string, r io.Reader) (*models.FloorPlan, error) {
+    if err := checkStoreFloor(s.db, storeID, floorID); err != nil {
+        return nil, err
+    }
+    data, err := io.ReadAll(io.LimitReader(r, MaxFloorPlanSize+1))
+    if err != nil {
+        return nil, err
+    }
+    if len(data) > MaxFloorPlanSize {
+        return nil, ErrFileTooLarge
+    }
+
+    contentType := http.DetectContentType(data)
+    ext, ok := floorPlanTypes[contentType]
+    if !ok {
+        return nil, ErrUnsupportedFileType
+    }
+
+    var width, height int
+    if contentType != "application/pdf" {
+        cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+        if err != nil {
+            return nil, ErrUnsupportedFileType
+        }
+        width, height = cfg.Width, cfg.Height
+    }
+
+    sum := sha256.Sum256(data)
+    checksum := hex.EncodeToString(sum[:])
+    key := fmt.Sprintf("floor-plans/%d/%s.%s", storeID, checksum, ext)
+    if floorID != nil {
+        key = fmt.Sprintf("floor-plans/%d/%d/%s.%s", storeID, *floorID, checksum, ext)
+    }
+    if _, err := s.blobs.Put(key, bytes.NewReader(data)); err != nil {
+        return nil, err
+    }
+
+    var plan models.FloorPlan
+    result := s.db.Scopes(floorScope(floorID)).Where("store_id = ?", storeID).First(&plan)
+    oldKey := plan.StorageKey
+    // Преобразование в конфигурации карты получено по старому изображению и к новому не подходит
+    staleTransform := result.Error == nil && plan.Calibration != "" && plan.Calibration != "[]"
+
+    plan.StoreID = storeID
+    plan.FloorID = floorID
+    plan.FileName = fileName
+    plan.ContentType = contentType
+    plan.StorageKey = key
+    plan.Size = int64(len(data))
+    plan.Checksum = checksum
+    plan.PixelWidth = width
+    plan.PixelHeight = height
+    plan.Calibration = "[]"
+
+    err = s.db.Transaction(func(tx *gorm.DB) error {
+        if result.Error == nil {
+            if err := tx.Save(&plan).Error; err != nil {
+                return err
+            }
+        } else if err := tx.Create(&plan).Error; err != nil {
+            return err
+        }
+        if !staleTransform {
+            return nil
+        }
+        return tx.Model(&models.StoreMapConfig{}).Scopes(floorScope(floorID)).Where("store_id = ?", storeID).
+            Updates(map[string]interface{}{"scale": 0, "rotation": 0, "origin_x": 0, "origin_y": 0,
+                "map_width": float64(width), "map_height": float64(height)}).Error
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    if oldKey != "" && oldKey != key {
+        s.blobs.Delete(oldKey)
+    }
+    return &plan, nil
+}
+
+// Get возвращает сведения о плане этажа floorID, nil - о плане магазина
+func (s *FloorPlanService) Get(storeID uint, floorID *uint) (*models.FloorPlan, error) {
+    var plan models.FloorPlan
+    if err := s.db.Scopes(floorScope(floorID)).Where("store_id = ?", storeID).First(&plan).Error; err != nil {
+        return nil, err
+    }
+    return &plan, nil
+}
+
+// Open открывает файл плана для чтения
+func (s *FloorPlanService) Open(plan *models.FloorPlan) (io.ReadSeekCloser, BlobInfo, error) {
+    return s.blobs.Open(plan.StorageKey)
+}
+
+// Delete удаляет план этажа floorID (nil - план магазина) вместе с файлом
+func (s *FloorPlanService) Delete(storeID uint, floorID *uint) error {
+    plan, err := s.Get(storeID, floorID)
+    if err != nil {
+        return err
+    }
+    if err := s.db.Delete(plan).Error; err != nil {
+        return err
+    }
+    return s.blobs.Delete(plan.StorageKey)
+}
+
+// DeleteAll удаляет планы всех этажей магазина вместе с файлами
+func (s *FloorPlanService) DeleteAll(storeID uint) error {
+    var plans []models.FloorPlan
+    if err := s.db.Where("store_id = ?", storeID).Find(&plans).Error; err != nil {
+        return err
+    }
+    for _, plan := range plans {
+        if err := s.db.Delete(&plan).Error; err != nil {
+            return err
+        }
+        s.blobs.Delete(plan.StorageKey)
+    }
+    return nil
+}
+
+// ControlPoint связывает точку на изображении плана (в пикселях) с координатами магазина (в метрах)
+type ControlPoint struct {
+    PixelX float64 `json:"pixel_x"`
+    PixelY float64 `json:"pixel_y"`
+    X      float64 `json:"x"`
+    Y      float64 `json:"y"`
+}
+
+// CalibrationResult - итог калибровки плана
+type CalibrationResult struct {
+    Config    models.StoreMapConfig `json:"config"`
+    Residuals []float64             `json:"residuals"` // Отклонение каждой точки в пикселях
+    RMSError  float64               `json:"rms_error"`
+}
+
+// MapTransform переводит координаты магазина (метры) в координаты плана (пиксели):
+// pixel = origin + scale * R(rotation) * meters
+type MapTransform struct {
+    Scale    float64
+    Rotation float64 // В градусах
+    OriginX  float64
+    OriginY  float64
+}
+
+func NewMapTransform(config models.StoreMapConfig) MapTransform {
+    scale := config.Scale
+    if scale <= 0 {
+        scale = 20.0 // Масштаб по умолчанию, как в GET /map-config
+    }
+    return MapTransform{Scale: scale, Rotation: config.Rotation, OriginX: config.OriginX, OriginY: config.OriginY}
+}
+
+func (t MapTransform) ToPixels(x, y float64) (float64, float64) {
+    sin, cos := math.Sincos(t.Rotation * math.Pi / 180)
+    return t.OriginX + t.Scale*(cos*x-sin*y), t.OriginY + t.Scale*(sin*x+cos*y)
+}
+
+func (t MapTransform) ToMeters(px, py float64) (float64, float64) {
+    sin, cos := math.Sincos(t.Rotation * math.Pi / 180)
+    dx, dy := (px-t.OriginX)/t.Scale, (py-t.OriginY)/t.Scale
+    return cos*dx + sin*dy, -sin*dx + cos*dy
+}
+
+// FitMapTransform подбирает масштаб, поворот и смещение по контрольным точкам
+// методом наименьших квадратов (подобие без отражения)
+func FitMapTransform(points []ControlPoint) (MapTransform, error) {
+    if len(points) < 2 {
+        return MapTransform{}, ErrInvalidCalibration
+    }
+
+    var mx, my, px, py float64
+    for _, p := range points {
+        mx += p.X
+        my += p.Y
+        px += p.PixelX
+        py += p.PixelY
+    }
+    n := float64(len(points))
+    mx, my, px, py = mx/n, my/n, px/n, py/n
+
+    var a, b, norm float64
+    for _, p := range points {
+        x, y := p.X-mx, p.Y-my
+        u, v := p.PixelX-px, p.PixelY-py
+        a += x*u + y*v
+        b += x*v - y*u
+        norm += x*x + y*y
+    }
+    if norm < 1e-9 || math.Hypot(a, b) < 1e-9 {
+        return MapTransform{}, ErrInvalidCalibration
+    }
+
+    scaleCos, scaleSin := a/norm, b/norm
+    t := MapTransform{
+        Scale:    math.Hypot(scaleCos, scaleSin),
+        Rotation: math.Atan2(scaleSin, scaleCos) * 180 / math.Pi,
+    }
+    t.OriginX = px - (scaleCos*mx - scaleSin*my)
+    t.OriginY = py - (scaleSin*mx + scaleCos*my)
+    return t, nil
+}
+
+// Calibrate вычисляет преобразование по контрольным точкам плана этажа floorID (nil - плана магазина)
+// и сохраняет его в StoreMapConfig этажа
+func (s *FloorPlanService) Calibrate(storeID uint, floorID *uint, points []ControlPoint) (*CalibrationResult, error) {
+    if err := checkStoreFloor(s.db, storeID, floorID); err != nil {
+        return nil, err
+    }
+    transform, err := FitMapTransform(points)
+    if err != nil {
+        return nil, err
+    }
+
+    result := &CalibrationResult{Residuals: make([]float64, len(points))}
+    var sumSq float64
+    for i, p := range points {
+        x, y := transform.ToPixels(p.X, p.Y)
+        result.Residuals[i] = math.Hypot(x-p.PixelX, y-p.PixelY)
+        sumSq += result.Residuals[i] * result.Residuals[i]
+    }
+    result.RMSError = math.Sqrt(sumSq / float64(len(points)))
+
+    var config models.StoreMapConfig
+    existing := s.db.Scopes(floorScope(floorID)).Where("store_id = ?", storeID).First(&config)
+    config.StoreID = storeID
+    config.FloorID = floorID
+    config.Scale = transform.Scale
+    config.Rotation = transform.Rotation
+    config.OriginX = transform.OriginX
+    config.OriginY = transform.OriginY
+
+    plan, planErr := s.Get(storeID, floorID)
+    if planErr == nil && plan.PixelWidth > 0 {
+        config.MapWidth = float64(plan.PixelWidth)
+        config.MapHeight = float64(plan.PixelHeight)
+        config.RealWidth = config.MapWidth / transform.Scale
+        config.RealHeight = config.MapHeight / transform.Scale
+    }
+
+    err = s.db.Transaction(func(tx *gorm.DB) error {
+        if existing.Error == nil {
+            if err := tx.Save(&config).Error; err != nil {
+                return err
+            }
+        } else if err := tx.Create(&config).Error; err != nil {
+            return err
+        }
+
+        if planErr == nil {
+            calibration, _ := json.Marshal(points)
+            return tx.Model(plan).Update("calibration", string(calibration)).Error
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    result.Config = config
+    return result, nil
+}
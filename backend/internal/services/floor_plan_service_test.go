@@ -0,0 +1,53 @@
+package services
+
+import (
+    "errors"
+    "math"
+    "testing"
+)
+
+func TestFitMapTransform(t *testing.T) {
+    controlPoints := func(transform MapTransform, meters ...[2]float64) []ControlPoint {
+        points := make([]ControlPoint, len(meters))
+        for i, m := range meters {
+            px, py := transform.ToPixels(m[0], m[1])
+            points[i] = ControlPoint{PixelX: px, PixelY: py, X: m[0], Y: m[1]}
+        }
+        return points
+    }
+    corners := [][2]float64{{0, 0}, {40, 0}, {40, 25}, {0, 25}}
+
+    tests := []struct {
+        name    string
+        points  []ControlPoint
+        want    MapTransform
+        wantErr error
+    }{
+        {"scale only", controlPoints(MapTransform{Scale: 20}, corners...), MapTransform{Scale: 20}, nil},
+        {"offset", controlPoints(MapTransform{Scale: 12.5, OriginX: 100, OriginY: -40}, corners...),
+            MapTransform{Scale: 12.5, OriginX: 100, OriginY: -40}, nil},
+        {"rotated", controlPoints(MapTransform{Scale: 8, Rotation: 90, OriginX: 500, OriginY: 20}, corners...),
+            MapTransform{Scale: 8, Rotation: 90, OriginX: 500, OriginY: 20}, nil},
+        {"two points", controlPoints(MapTransform{Scale: 15, Rotation: -30, OriginX: 7, OriginY: 3}, corners[0], corners[2]),
+            MapTransform{Scale: 15, Rotation: -30, OriginX: 7, OriginY: 3}, nil},
+        {"single point", controlPoints(MapTransform{Scale: 20}, corners[0]), MapTransform{}, ErrInvalidCalibration},
+        {"coincident points", controlPoints(MapTransform{Scale: 20}, corners[1], corners[1]), MapTransform{}, ErrInvalidCalibration},
+        {"no points", nil, MapTransform{}, ErrInvalidCalibration},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := FitMapTransform(tt.points)
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("FitMapTransform() error = %v, want %v", err, tt.wantErr)
+            }
+            if err != nil {
+                return
+            }
+            const eps = 1e-6
+            if math.Abs(got.Scale-tt.want.Scale) > eps || math.Abs(got.Rotation-tt.want.Rotation) > eps ||
+                math.Abs(got.OriginX-tt.want.OriginX) > eps || math.Abs(got.OriginY-tt.want.OriginY) > eps {
+                t.Errorf("FitMapTransform() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
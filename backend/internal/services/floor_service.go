@@ -0,0 +1,350 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "strings"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+var (
+    ErrFloorNotFound     = errors.New("floor not found")
+    ErrFloorInUse        = errors.New("floor has map objects, connector stops or a floor plan")
+    ErrConnectorNotFound = errors.New("connector not found")
+)
+
+// FloorValidationError перечисляет ошибки в описании этажа или вертикального перехода
+type FloorValidationError struct {
+    Errors []string
+}
+
+func (e *FloorValidationError) Error() string {
+    return "invalid floor data: " + strings.Join(e.Errors, "; ")
+}
+
+// Объекты карты, привязанные к этажу
+var floorObjects = []interface{}{&models.Sector{}, &models.Wall{}, &models.MapElement{}, &models.Beacon{}, &models.StructuralElement{}}
+
+type FloorService struct {
+    db *gorm.DB
+}
+
+func NewFloorService(db *gorm.DB) *FloorService {
+    return &FloorService{db: db}
+}
+
+// ListFloors возвращает этажи магазина снизу вверх
+func (s *FloorService) ListFloors(storeID uint) ([]models.Floor, error) {
+    var floors []models.Floor
+    err := s.db.Where("store_id = ?", storeID).Order("number, id").Find(&floors).Error
+    return floors, err
+}
+
+func (s *FloorService) GetFloor(id uint) (*models.Floor, error) {
+    var floor models.Floor
+    if err := s.db.First(&floor, id).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrFloorNotFound
+        }
+        return nil, err
+    }
+    return &floor, nil
+}
+
+// SaveFloor создает этаж (ID = 0) или обновляет существующий. Номера этажей в магазине не повторяются
+func (s *FloorService) SaveFloor(floor *models.Floor) error {
+    if floor.ID != 0 {
+        existing, err := s.GetFloor(floor.ID)
+        if err != nil {
+            return err
+        }
+        floor.StoreID, floor.CreatedAt = existing.StoreID, existing.CreatedAt
+    }
+
+    var errs []string
+    if strings.TrimSpace(floor.Name) == "" {
+        errs = append(errs, "name is required")
+    }
+    var duplicates int64
+    if err := s.db.Model(&models.Floor{}).Where("store_id = ? AND number = ? AND id <> ?", floor.StoreID, floor.Number, floor.ID).
+        Count(&duplicates).Error; err != nil {
+        return err
+    }
+    if duplicates > 0 {
+        errs = append(errs, fmt.Sprintf("floor number %d already exists", floor.Number))
+    }
+    if len(errs) > 0 {
+        return &FloorValidationError{Errors: errs}
+    }
+    return s.db.Save(floor).Error
+}
+
+// DeleteFloor удаляет этаж, если к нему не привязаны объекты карты, переходы и план этажа
+func (s *FloorService) DeleteFloor(id uint) error {
+    floor, err := s.GetFloor(id)
+    if err != nil {
+        return err
+    }
+    for _, model := range append(floorObjects, &models.ConnectorStop{}, &models.FloorPlan{}) {
+        var count int64
+        if err := s.db.Model(model).Where("floor_id = ?", floor.ID).Count(&count).Error; err != nil {
+            return err
+        }
+        if count > 0 {
+            return ErrFloorInUse
+        }
+    }
+    return s.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("floor_id = ?", floor.ID).Delete(&models.StoreMapConfig{}).Error; err != nil {
+            return err
+        }
+        return tx.Delete(floor).Error
+    })
+}
+
+// ListConnectors возвращает вертикальные переходы магазина с остановками
+func (s *FloorService) ListConnectors(storeID uint) ([]models.VerticalConnector, error) {
+    var connectors []models.VerticalConnector
+    err := s.db.Preload("Stops").Where("store_id = ?", storeID).Order("id").Find(&connectors).Error
+    return connectors, err
+}
+
+func (s *FloorService) GetConnector(id uint) (*models.VerticalConnector, error) {
+    var connector models.VerticalConnector
+    if err := s.db.Preload("Stops").First(&connector, id).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrConnectorNotFound
+        }
+        return nil, err
+    }
+    return &connector, nil
+}
+
+// SaveConnector создает переход (ID = 0) или обновляет существующий, заменяя остановки
+func (s *FloorService) SaveConnector(connector *models.VerticalConnector) error {
+    if connector.ID != 0 {
+        existing, err := s.GetConnector(connector.ID)
+        if err != nil {
+            return err
+        }
+        connector.StoreID = existing.StoreID
+    }
+    if connector.Direction == "" {
+        connector.Direction = models.ConnectorBoth
+    }
+    if err := s.validateConnector(connector); err != nil {
+        return err
+    }
+
+    stops := connector.Stops
+    err := s.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Omit("Stops").Save(connector).Error; err != nil {
+            return err
+        }
+        // IsActive = false не сохраняется при создании из-за default:true
+        if err := tx.Model(connector).Update("is_active", connector.IsActive).Error; err != nil {
+            return err
+        }
+        if err := tx.Where("connector_id = ?", connector.ID).Delete(&models.ConnectorStop{}).Error; err != nil {
+            return err
+        }
+        for i := range stops {
+            stops[i].ID = 0
+            stops[i].ConnectorID = connector.ID
+        }
+        return tx.Create(&stops).Error
+    })
+    if err != nil {
+        return err
+    }
+    saved, err := s.GetConnector(connector.ID)
+    if err != nil {
+        return err
+    }
+    *connector = *saved
+    return nil
+}
+
+func (s *FloorService) DeleteConnector(id uint) error {
+    if _, err := s.GetConnector(id); err != nil {
+        return err
+    }
+    return s.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("connector_id = ?", id).Delete(&models.ConnectorStop{}).Error; err != nil {
+            return err
+        }
+        return tx.Delete(&models.VerticalConnector{}, id).Error
+    })
+}
+
+func (s *FloorService) validateConnector(connector *models.VerticalConnector) error {
+    var errs []string
+    switch connector.Type {
+    case models.ConnectorStairs, models.ConnectorEscalator, models.ConnectorElevator, models.ConnectorTravelator:
+    default:
+        errs = append(errs, "type must be one of stairs, escalator, elevator, travelator")
+    }
+    switch connector.Direction {
+    case models.ConnectorBoth, models.ConnectorUp, models.ConnectorDown:
+    default:
+        errs = append(errs, "direction must be one of both, up, down")
+    }
+    if connector.Cost < 0 || connector.WaitTime < 0 {
+        errs = append(errs, "cost and wait_time must not be negative")
+    }
+    if len(connector.Stops) < 2 {
+        errs = append(errs, "at least two stops are required")
+    }
+
+    floors, err := s.ListFloors(connector.StoreID)
+    if err != nil {
+        return err
+    }
+    known := make(map[uint]bool, len(floors))
+    for _, floor := range floors {
+        known[floor.ID] = true
+    }
+    seen := make(map[uint]bool)
+    for i, stop := range connector.Stops {
+        if !known[stop.FloorID] {
+            errs = append(errs, fmt.Sprintf("stop %d: floor %d does not belong to the store", i+1, stop.FloorID))
+        } else if seen[stop.FloorID] {
+            errs = append(errs, fmt.Sprintf("stop %d: duplicate floor %d", i+1, stop.FloorID))
+        }
+        seen[stop.FloorID] = true
+    }
+    if len(errs) > 0 {
+        return &FloorValidationError{Errors: errs}
+    }
+    return nil
+}
+
+// defaultFloor возвращает нижний этаж магазина, к которому относятся объекты без этажа.
+// nil - этажи не заведены
+func defaultFloor(db *gorm.DB, storeID uint) (*models.Floor, error) {
+    var floor models.Floor
+    err := db.Where("store_id = ?", storeID).Order("number, id").First(&floor).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &floor, nil
+}
+
+// onFloor оставляет объекты этажа floorID (nil - все этажи).
+// Для нижнего этажа в выборку попадают и объекты без этажа
+func onFloor(db *gorm.DB, storeID uint, floorID *uint) (func(*gorm.DB) *gorm.DB, error) {
+    if floorID == nil {
+        return func(q *gorm.DB) *gorm.DB { return q }, nil
+    }
+    lowest, err := defaultFloor(db, storeID)
+    if err != nil {
+        return nil, err
+    }
+    id := *floorID
+    if lowest != nil && lowest.ID == id {
+        return func(q *gorm.DB) *gorm.DB { return q.Where("(floor_id = ? OR floor_id IS NULL)", id) }, nil
+    }
+    return func(q *gorm.DB) *gorm.DB { return q.Where("floor_id = ?", id) }, nil
+}
+
+// onFloorOrLowest оставляет объекты этажа floorID, а при nil - объекты нижнего этажа (и без этажа),
+// куда попадают объекты, созданные без этажа
+func onFloorOrLowest(db *gorm.DB, storeID uint, floorID *uint) (func(*gorm.DB) *gorm.DB, error) {
+    if floorID == nil {
+        lowest, err := defaultFloor(db, storeID)
+        if err != nil {
+            return nil, err
+        }
+        if lowest != nil {
+            floorID = &lowest.ID
+        }
+    }
+    return onFloor(db, storeID, floorID)
+}
+
+// checkStoreFloor проверяет, что этаж floorID принадлежит магазину; nil - без этажа
+func checkStoreFloor(db *gorm.DB, storeID uint, floorID *uint) error {
+    if floorID == nil {
+        return nil
+    }
+    var count int64
+    if err := db.Model(&models.Floor{}).Where("id = ? AND store_id = ?", *floorID, storeID).Count(&count).Error; err != nil {
+        return err
+    }
+    if count == 0 {
+        return ErrFloorNotFound
+    }
+    return nil
+}
+
+// storeMapConfig возвращает конфигурацию карты этажа, а если ее нет - общую конфигурацию магазина
+func storeMapConfig(db *gorm.DB, storeID uint, floorID *uint) (models.StoreMapConfig, error) {
+    var config models.StoreMapConfig
+    if floorID != nil {
+        err := db.Where("store_id = ? AND floor_id = ?", storeID, *floorID).First(&config).Error
+        if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+            return config, err
+        }
+    }
+    err := db.Where("store_id = ? AND floor_id IS NULL", storeID).First(&config).Error
+    return config, err
+}
+
+// floorExtents возвращает габариты этажа в метрах: размеры из конфигурации карты, а без нее - границы
+// секторов, стен и объектов этажа. false - размеры неизвестны
+func floorExtents(db *gorm.DB, storeID uint, floorID *uint) (utils.Rect, bool, error) {
+    config, err := storeMapConfig(db, storeID, floorID)
+    if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+        return utils.Rect{}, false, err
+    }
+    if config.RealWidth > 0 && config.RealHeight > 0 {
+        return utils.Rect{MaxX: config.RealWidth, MaxY: config.RealHeight}, true, nil
+    }
+
+    scope, err := onFloor(db, storeID, floorID)
+    if err != nil {
+        return utils.Rect{}, false, err
+    }
+    var sectors []models.Sector
+    if err := db.Scopes(scope).Where("store_id = ?", storeID).Find(&sectors).Error; err != nil {
+        return utils.Rect{}, false, err
+    }
+    var walls []models.Wall
+    if err := db.Scopes(scope).Where("store_id = ?", storeID).Find(&walls).Error; err != nil {
+        return utils.Rect{}, false, err
+    }
+    var elements []models.MapElement
+    if err := db.Scopes(scope).Where("store_id = ?", storeID).Find(&elements).Error; err != nil {
+        return utils.Rect{}, false, err
+    }
+
+    var bounds []utils.Rect
+    for _, sector := range sectors {
+        bounds = append(bounds, utils.Rect{MinX: sector.PositionX, MinY: sector.PositionY,
+            MaxX: sector.PositionX + sector.Width, MaxY: sector.PositionY + sector.Height})
+    }
+    for _, w := range walls {
+        bounds = append(bounds, utils.Rect{MinX: math.Min(w.StartX, w.EndX), MinY: math.Min(w.StartY, w.EndY),
+            MaxX: math.Max(w.StartX, w.EndX), MaxY: math.Max(w.StartY, w.EndY)})
+    }
+    for _, e := range elements {
+        bounds = append(bounds, utils.RotatedBounds(e.PositionX, e.PositionY, e.Width, e.Height, e.Rotation))
+    }
+    if len(bounds) == 0 {
+        return utils.Rect{}, false, nil
+    }
+    area := bounds[0]
+    for _, b := range bounds[1:] {
+        area = utils.Rect{MinX: math.Min(area.MinX, b.MinX), MinY: math.Min(area.MinY, b.MinY),
+            MaxX: math.Max(area.MaxX, b.MaxX), MaxY: math.Max(area.MaxY, b.MaxY)}
+    }
+    return area, true, nil
+}
@@ -0,0 +1,765 @@
+package services
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+// Виды объектов магазина в свойстве "kind" объектов GeoJSON
+const (
+    FeatureKindWall              = "wall"
+    FeatureKindSector            = "sector"
+    FeatureKindMapElement        = "map_element"
+    FeatureKindStructuralElement = "structural_element"
+    FeatureKindBeacon            = "beacon"
+)
+
+// GeoJSONGeometry - геометрия в локальных координатах магазина (метры, ось Y направлена вниз, как в редакторе)
+type GeoJSONGeometry struct {
+    Type        string          `json:"type"`
+    Coordinates json.RawMessage `json:"coordinates"`
+}
+
+type GeoJSONFeature struct {
+    Type       string                 `json:"type"`
+    ID         string                 `json:"id,omitempty"`
+    Geometry   *GeoJSONGeometry       `json:"geometry"`
+    Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoJSONFeatureCollection struct {
+    Type       string                 `json:"type"`
+    Properties map[string]interface{} `json:"properties,omitempty"`
+    Features   []GeoJSONFeature       `json:"features"`
+}
+
+// GeoJSONValidationError перечисляет ошибки в импортируемом файле
+type GeoJSONValidationError struct {
+    Errors []string
+}
+
+func (e *GeoJSONValidationError) Error() string {
+    return "invalid GeoJSON: " + strings.Join(e.Errors, "; ")
+}
+
+// GeoJSONImportResult - количество созданных, обновленных и удаленных объектов
+type GeoJSONImportResult struct {
+    Walls              int `json:"walls"`
+    SectorsCreated     int `json:"sectors_created"`
+    SectorsUpdated     int `json:"sectors_updated"`
+    SectorsDeleted     int `json:"sectors_deleted"`
+    MapElements        int `json:"map_elements"`
+    StructuralElements int `json:"structural_elements"`
+    Beacons            int `json:"beacons"`
+}
+
+type GeoJSONService struct {
+    db *gorm.DB
+}
+
+func NewGeoJSONService(db *gorm.DB) *GeoJSONService {
+    return &GeoJSONService{db: db}
+}
+
+func newGeometry(geometryType string, coordinates interface{}) *GeoJSONGeometry {
+    raw, _ := json.Marshal(coordinates)
+    return &GeoJSONGeometry{Type: geometryType, Coordinates: raw}
+}
+
+func polygonGeometry(corners []utils.Point) *GeoJSONGeometry {
+    ring := make([][2]float64, 0, len(corners)+1)
+    for _, p := range corners {
+        ring = append(ring, [2]float64{p.X, p.Y})
+    }
+    ring = append(ring, ring[0])
+    return newGeometry("Polygon", [][][2]float64{ring})
+}
+
+// Export выгружает объекты этажа floorID (nil - всего магазина) в FeatureCollection
+func (s *GeoJSONService) Export(storeID uint, floorID *uint) (*GeoJSONFeatureCollection, error) {
+    var store models.Store
+    if err := s.db.First(&store, storeID).Error; err != nil {
+        return nil, err
+    }
+    if err := checkStoreFloor(s.db, storeID, floorID); err != nil {
+        return nil, err
+    }
+    floor, err := onFloor(s.db, storeID, floorID)
+    if err != nil {
+        return nil, err
+    }
+
+    fc := &GeoJSONFeatureCollection{
+        Type: "FeatureCollection",
+        Properties: map[string]interface{}{
+            "store_id": store.ID,
+            "name":     store.Name,
+            "address":  store.Address,
+            "units":    "meters",
+            "floor_id": floorID,
+        },
+        Features: []GeoJSONFeature{},
+    }
+    add := func(kind string, id uint, geometry *GeoJSONGeometry, props map[string]interface{}) {
+        props["kind"] = kind
+        props["id"] = id
+        fc.Features = append(fc.Features, GeoJSONFeature{
+            Type:       "Feature",
+            ID:         fmt.Sprintf("%s-%d", kind, id),
+            Geometry:   geometry,
+            Properties: props,
+        })
+    }
+
+    var walls []models.Wall
+    if err := s.db.Scopes(floor).Where("store_id = ?", storeID).Order("id").Find(&walls).Error; err != nil {
+        return nil, err
+    }
+    for _, w := range walls {
+        add(FeatureKindWall, w.ID, newGeometry("LineString", [][2]float64{{w.StartX, w.StartY}, {w.EndX, w.EndY}}),
+            map[string]interface{}{"thickness": w.Thickness, "floor_id": w.FloorID})
+    }
+
+    var sectors []models.Sector
+    if err := s.db.Scopes(floor).Where("store_id = ?", storeID).Order("level, id").Find(&sectors).Error; err != nil {
+        return nil, err
+    }
+    for _, sector := range sectors {
+        add(FeatureKindSector, sector.ID, polygonGeometry(utils.RectCorners(sector.PositionX, sector.PositionY, sector.Width, sector.Height, 0)),
+            map[string]interface{}{
+                "name":             sector.Name,
+                "description":      sector.Description,
+                "level":            sector.Level,
+                "parent_id":        sector.ParentID,
+                "temperature_zone": sector.TemperatureZone,
+                "floor_id":         sector.FloorID,
+            })
+    }
+
+    var elements []models.MapElement
+    if err := s.db.Scopes(floor).Where("store_id = ?", storeID).Order("id").Find(&elements).Error; err != nil {
+        return nil, err
+    }
+    for _, e := range elements {
+        add(FeatureKindMapElement, e.ID, polygonGeometry(utils.RectCorners(e.PositionX, e.PositionY, e.Width, e.Height, e.Rotation)),
+            map[string]interface{}{
+                "type":         e.Type,
+                "name":         e.Name,
+                "color":        e.Color,
+                "metadata":     e.Metadata,
+                "visible_from": e.VisibleFrom,
+                "visible_to":   e.VisibleTo,
+                "sector_id":    e.SectorID,
+                "beacon_id":    e.BeaconID,
+                "floor_id":     e.FloorID,
+            })
+    }
+
+    var structural []models.StructuralElement
+    if err := s.db.Scopes(floor).Where("layout_id IN (?)", s.db.Model(&models.StoreLayout{}).Select("id").Where("store_id = ?", storeID)).
+        Order("id").Find(&structural).Error; err != nil {
+        return nil, err
+    }
+    for _, e := range structural {
+        props := map[string]interface{}{
+            "type":      e.Type,
+            "layout_id": e.LayoutID,
+            "metadata":  e.Metadata,
+            "floor_id":  e.FloorID,
+        }
+        switch {
+        case e.Type == "wall" || e.EndX != 0 || e.EndY != 0:
+            props["width"] = e.Width
+            add(FeatureKindStructuralElement, e.ID, newGeometry("LineString", [][2]float64{{e.StartX, e.StartY}, {e.EndX, e.EndY}}), props)
+        case e.Width > 0 && e.Height > 0:
+            add(FeatureKindStructuralElement, e.ID, polygonGeometry(utils.RectCorners(e.StartX, e.StartY, e.Width, e.Height, e.Rotation)), props)
+        default:
+            props["rotation"] = e.Rotation
+            add(FeatureKindStructuralElement, e.ID, newGeometry("Point", [2]float64{e.StartX, e.StartY}), props)
+        }
+    }
+
+    var beacons []models.Beacon
+    if err := s.db.Scopes(floor).Where("store_id = ?", storeID).Order("id").Find(&beacons).Error; err != nil {
+        return nil, err
+    }
+    for _, b := range beacons {
+        add(FeatureKindBeacon, b.ID, newGeometry("Point", [2]float64{b.PositionX, b.PositionY}),
+            map[string]interface{}{
+                "mac":        b.MAC,
+                "position_z": b.PositionZ,
+                "type":       b.Type,
+                "uuid":       b.UUID,
+                "major":      b.Major,
+                "minor":      b.Minor,
+                "tx_power":   b.TxPower,
+                "is_active":  b.IsActive,
+                "floor_id":   b.FloorID,
+            })
+    }
+
+    return fc, nil
+}
+
+// featureReader разбирает свойства и геометрию объекта, накапливая ошибки
+type featureReader struct {
+    index  int
+    props  map[string]interface{}
+    errors *[]string
+}
+
+func (r featureReader) fail(format string, args ...interface{}) {
+    *r.errors = append(*r.errors, fmt.Sprintf("feature %d: ", r.index)+fmt.Sprintf(format, args...))
+}
+
+func (r featureReader) str(key string) string {
+    switch v := r.props[key].(type) {
+    case nil:
+        return ""
+    case string:
+        return v
+    default:
+        // Метаданные могут прийти объектом, сохраняем их как JSON
+        raw, _ := json.Marshal(v)
+        return string(raw)
+    }
+}
+
+func (r featureReader) num(key string, def float64) float64 {
+    switch v := r.props[key].(type) {
+    case nil:
+        return def
+    case float64:
+        return v
+    default:
+        r.fail("property %q must be a number", key)
+        return def
+    }
+}
+
+// id возвращает идентификатор из свойства, nil если он не задан
+func (r featureReader) id(key string) *uint {
+    v, ok := r.props[key].(float64)
+    if !ok || v <= 0 || v != math.Trunc(v) {
+        if r.props[key] != nil {
+            r.fail("property %q must be a positive integer", key)
+        }
+        return nil
+    }
+    id := uint(v)
+    return &id
+}
+
+// time возвращает момент времени в формате RFC 3339, nil если он не задан
+func (r featureReader) time(key string) *time.Time {
+    v, ok := r.props[key].(string)
+    if !ok {
+        if r.props[key] != nil {
+            r.fail("property %q must be an RFC 3339 time", key)
+        }
+        return nil
+    }
+    t, err := time.Parse(time.RFC3339, v)
+    if err != nil {
+        r.fail("property %q must be an RFC 3339 time", key)
+        return nil
+    }
+    return &t
+}
+
+func (r featureReader) boolean(key string, def bool) bool {
+    if v, ok := r.props[key].(bool); ok {
+        return v
+    }
+    return def
+}
+
+func (r featureReader) point(g *GeoJSONGeometry) (utils.Point, bool) {
+    var coords []float64
+    if g.Type != "Point" || json.Unmarshal(g.Coordinates, &coords) != nil || len(coords) < 2 {
+        r.fail("expected Point geometry")
+        return utils.Point{}, false
+    }
+    return utils.Point{X: coords[0], Y: coords[1]}, true
+}
+
+// lines возвращает отрезки LineString или MultiLineString
+func (r featureReader) lines(g *GeoJSONGeometry) [][2]utils.Point {
+    var lineStrings [][][]float64
+    switch g.Type {
+    case "LineString":
+        var line [][]float64
+        if json.Unmarshal(g.Coordinates, &line) == nil {
+            lineStrings = [][][]float64{line}
+        }
+    case "MultiLineString":
+        json.Unmarshal(g.Coordinates, &lineStrings)
+    }
+
+    var segments [][2]utils.Point
+    for _, line := range lineStrings {
+        for i := 1; i < len(line); i++ {
+            if len(line[i-1]) < 2 || len(line[i]) < 2 {
+                continue
+            }
+            segments = append(segments, [2]utils.Point{{X: line[i-1][0], Y: line[i-1][1]}, {X: line[i][0], Y: line[i][1]}})
+        }
+    }
+    if len(segments) == 0 {
+        r.fail("expected LineString or MultiLineString geometry with at least two points")
+    }
+    return segments
+}
+
+// ring возвращает внешний контур Polygon
+func (r featureReader) ring(g *GeoJSONGeometry) ([]utils.Point, bool) {
+    var rings [][][]float64
+    if g.Type != "Polygon" || json.Unmarshal(g.Coordinates, &rings) != nil || len(rings) == 0 || len(rings[0]) < 4 {
+        r.fail("expected Polygon geometry")
+        return nil, false
+    }
+    points := make([]utils.Point, 0, len(rings[0]))
+    for _, c := range rings[0] {
+        if len(c) < 2 {
+            r.fail("invalid polygon coordinate")
+            return nil, false
+        }
+        points = append(points, utils.Point{X: c[0], Y: c[1]})
+    }
+    return points, true
+}
+
+// importedSector - сектор из файла до разрешения иерархии
+type importedSector struct {
+    sourceID *uint
+    parentID *uint
+    sector   models.Sector
+}
+
+// Import заменяет геометрию этажа floorID (nil - всего магазина) содержимым FeatureCollection
+// в одной транзакции. Секторы, чей id совпадает с существующим сектором магазина, обновляются
+// на месте (товары сохраняются), остальные секторы этажа удаляются вместе с товарами.
+// Объекты без floor_id относятся к этажу floorID
+func (s *GeoJSONService) Import(storeID uint, floorID *uint, fc *GeoJSONFeatureCollection) (*GeoJSONImportResult, error) {
+    if err := checkStoreFloor(s.db, storeID, floorID); err != nil {
+        return nil, err
+    }
+    var floorIDs []uint
+    if err := s.db.Model(&models.Floor{}).Where("store_id = ?", storeID).Pluck("id", &floorIDs).Error; err != nil {
+        return nil, err
+    }
+    storeFloors := make(map[uint]bool, len(floorIDs))
+    for _, id := range floorIDs {
+        storeFloors[id] = true
+    }
+
+    var validation []string
+    if fc.Type != "FeatureCollection" {
+        validation = append(validation, "root object must be a FeatureCollection")
+    }
+    featureFloor := func(r featureReader) *uint {
+        id := r.id("floor_id")
+        switch {
+        case id == nil:
+            return floorID
+        case !storeFloors[*id]:
+            r.fail("floor_id %d is not a floor of the store", *id)
+        case floorID != nil && *id != *floorID:
+            r.fail("floor_id must match the imported floor %d", *floorID)
+        }
+        return id
+    }
+
+    // Стены, элементы карты и маячки с id из файла обновляются на месте, чтобы ссылки
+    // на них (промо-акции, закрытия, привязка маячков) оставались действительными
+    var (
+        walls       []models.Wall
+        wallRefs    []*uint
+        sectors     []importedSector
+        elements    []models.MapElement
+        elementRefs []*uint
+        structural  []models.StructuralElement
+        beacons     []models.Beacon
+        beaconRefs  []*uint // Исходные id маячков для перепривязки элементов карты
+    )
+
+    for i, feature := range fc.Features {
+        r := featureReader{index: i, props: feature.Properties, errors: &validation}
+        if feature.Geometry == nil {
+            r.fail("geometry is required")
+            continue
+        }
+
+        switch kind := r.str("kind"); kind {
+        case FeatureKindWall:
+            // id из файла получает первый отрезок, остальные отрезки MultiLineString создаются заново
+            ref := r.id("id")
+            for _, seg := range r.lines(feature.Geometry) {
+                walls = append(walls, models.Wall{
+                    StoreID: storeID, StartX: seg[0].X, StartY: seg[0].Y, EndX: seg[1].X, EndY: seg[1].Y,
+                    Thickness: r.num("thickness", 0.1), FloorID: featureFloor(r),
+                })
+                wallRefs = append(wallRefs, ref)
+                ref = nil
+            }
+
+        case FeatureKindSector:
+            ring, ok := r.ring(feature.Geometry)
+            if !ok {
+                continue
+            }
+            x, y, w, h, _ := utils.RectFromCorners(ring)
+            if r.str("name") == "" {
+                r.fail("sector name is required")
+            }
+            zone := r.str("temperature_zone")
+            if zone == "" {
+                zone = models.TemperatureAmbient
+            }
+            if !IsTemperatureZone(zone) {
+                r.fail("temperature_zone must be ambient, chilled or frozen")
+            }
+            sectors = append(sectors, importedSector{
+                sourceID: r.id("id"),
+                parentID: r.id("parent_id"),
+                sector: models.Sector{
+                    StoreID: storeID, Name: r.str("name"), Description: r.str("description"),
+                    PositionX: x, PositionY: y, Width: w, Height: h, TemperatureZone: zone,
+                    FloorID: featureFloor(r),
+                },
+            })
+
+        case FeatureKindMapElement:
+            ring, ok := r.ring(feature.Geometry)
+            if !ok {
+                continue
+            }
+            x, y, w, h, rotation := utils.RectFromCorners(ring)
+            elements = append(elements, models.MapElement{
+                StoreID: storeID, Type: r.str("type"), Name: r.str("name"), Color: r.str("color"),
+                Metadata:  defaultJSON(r.str("metadata")),
+                PositionX: x, PositionY: y, Width: w, Height: h, Rotation: rotation,
+                VisibleFrom: r.time("visible_from"), VisibleTo: r.time("visible_to"),
+                SectorID: r.id("sector_id"), BeaconID: r.id("beacon_id"), FloorID: featureFloor(r),
+            })
+            elementRefs = append(elementRefs, r.id("id"))
+
+        case FeatureKindStructuralElement:
+            element := models.StructuralElement{Type: r.str("type"), Metadata: defaultJSON(r.str("metadata")), FloorID: featureFloor(r)}
+            switch feature.Geometry.Type {
+            case "LineString", "MultiLineString":
+                segments := r.lines(feature.Geometry)
+                if len(segments) == 0 {
+                    continue
+                }
+                element.StartX, element.StartY = segments[0][0].X, segments[0][0].Y
+                element.EndX, element.EndY = segments[len(segments)-1][1].X, segments[len(segments)-1][1].Y
+                element.Width = r.num("width", 0)
+            case "Polygon":
+                ring, ok := r.ring(feature.Geometry)
+                if !ok {
+                    continue
+                }
+                element.StartX, element.StartY, element.Width, element.Height, element.Rotation = utils.RectFromCorners(ring)
+            default:
+                p, ok := r.point(feature.Geometry)
+                if !ok {
+                    continue
+                }
+                element.StartX, element.StartY = p.X, p.Y
+                element.Rotation = r.num("rotation", 0)
+            }
+            structural = append(structural, element)
+
+        case FeatureKindBeacon:
+            p, ok := r.point(feature.Geometry)
+            if !ok {
+                continue
+            }
+            if r.str("mac") == "" {
+                r.fail("beacon mac is required")
+            }
+            beacons = append(beacons, models.Beacon{
+                StoreID: storeID, MAC: r.str("mac"), Type: r.str("type"), UUID: r.str("uuid"),
+                PositionX: p.X, PositionY: p.Y, PositionZ: r.num("position_z", 0),
+                Major: uint16(r.num("major", 0)), Minor: uint16(r.num("minor", 0)), TxPower: int8(r.num("tx_power", 0)),
+                IsActive: r.boolean("is_active", true), FloorID: featureFloor(r),
+            })
+            beaconRefs = append(beaconRefs, r.id("id"))
+
+        default:
+            r.fail("unknown kind %q", kind)
+        }
+    }
+
+    if len(validation) > 0 {
+        return nil, &GeoJSONValidationError{Errors: validation}
+    }
+
+    result := &GeoJSONImportResult{}
+    err := s.db.Transaction(func(tx *gorm.DB) error {
+        // Обновить на месте можно любой объект магазина, а удаляются только объекты импортируемого этажа
+        floor, err := onFloor(tx, storeID, floorID)
+        if err != nil {
+            return err
+        }
+        var existing, replaced []uint
+        if err := tx.Model(&models.Sector{}).Where("store_id = ?", storeID).Pluck("id", &existing).Error; err != nil {
+            return err
+        }
+        if err := tx.Model(&models.Sector{}).Scopes(floor).Where("store_id = ?", storeID).Pluck("id", &replaced).Error; err != nil {
+            return err
+        }
+        existingIDs := make(map[uint]bool, len(existing))
+        for _, id := range existing {
+            existingIDs[id] = true
+        }
+
+        sectorIDs, err := s.saveSectors(tx, sectors, existingIDs, result)
+        if err != nil {
+            return err
+        }
+
+        // Удаляем секторы, которых нет в файле, вместе с их товарами, стеллажами и всем, что ссылается на товары
+        var stale []uint
+        kept := make(map[uint]bool)
+        for _, item := range sectors {
+            kept[item.sector.ID] = true
+        }
+        for _, id := range replaced {
+            if !kept[id] {
+                stale = append(stale, id)
+            }
+        }
+        if len(stale) > 0 {
+            if err := DeleteSectors(tx, stale); err != nil {
+                return err
+            }
+            result.SectorsDeleted = len(stale)
+        }
+
+        var existingBeacons []models.Beacon
+        if err := tx.Where("store_id = ?", storeID).Find(&existingBeacons).Error; err != nil {
+            return err
+        }
+        beaconsByMAC := make(map[string]uint, len(existingBeacons))
+        for _, b := range existingBeacons {
+            beaconsByMAC[b.MAC] = b.ID
+        }
+
+        // Объекты с известным id обновляются, маячки без id сопоставляются по MAC,
+        // объекты магазина, которых нет в файле, удаляются до создания новых
+        wallIDs, err := claimIDs(tx, &models.Wall{}, storeID, wallRefs, func(i int) *uint { return &walls[i].ID }, nil)
+        if err != nil {
+            return err
+        }
+        elementIDs, err := claimIDs(tx, &models.MapElement{}, storeID, elementRefs, func(i int) *uint { return &elements[i].ID }, nil)
+        if err != nil {
+            return err
+        }
+        beaconIDs, err := claimIDs(tx, &models.Beacon{}, storeID, beaconRefs, func(i int) *uint { return &beacons[i].ID },
+            func(i int) uint { return beaconsByMAC[beacons[i].MAC] })
+        if err != nil {
+            return err
+        }
+        for _, kind := range []struct {
+            model interface{}
+            kept  map[uint]bool
+        }{{&models.Wall{}, wallIDs}, {&models.MapElement{}, elementIDs}, {&models.Beacon{}, beaconIDs}} {
+            if err := deleteUnclaimed(tx.Scopes(floor), kind.model, storeID, kind.kept); err != nil {
+                return err
+            }
+        }
+
+        for i := range walls {
+            if err := saveByID(tx, &walls[i], walls[i].ID, "start_x", "start_y", "end_x", "end_y", "thickness", "floor_id"); err != nil {
+                return err
+            }
+        }
+        result.Walls = len(walls)
+
+        sourceBeacons := make(map[uint]uint)
+        for i := range beacons {
+            if err := saveByID(tx, &beacons[i], beacons[i].ID,
+                "mac", "position_x", "position_y", "position_z", "type", "uuid", "major", "minor", "tx_power", "is_active", "floor_id"); err != nil {
+                return err
+            }
+            if beaconRefs[i] != nil {
+                sourceBeacons[*beaconRefs[i]] = beacons[i].ID
+            }
+        }
+        result.Beacons = len(beacons)
+
+        for i := range elements {
+            elements[i].SectorID = remapID(elements[i].SectorID, sectorIDs)
+            elements[i].BeaconID = remapID(elements[i].BeaconID, sourceBeacons)
+            if err := saveByID(tx, &elements[i], elements[i].ID, "type", "name", "position_x", "position_y", "width", "height",
+                "rotation", "color", "metadata", "visible_from", "visible_to", "sector_id", "beacon_id", "floor_id"); err != nil {
+                return err
+            }
+        }
+        result.MapElements = len(elements)
+
+        if err := tx.Scopes(floor).Where("layout_id IN (?)", tx.Model(&models.StoreLayout{}).Select("id").Where("store_id = ?", storeID)).
+            Delete(&models.StructuralElement{}).Error; err != nil {
+            return err
+        }
+        if len(structural) > 0 {
+            layoutID, err := storeLayoutID(tx, storeID, "Импорт GeoJSON")
+            if err != nil {
+                return err
+            }
+            for i := range structural {
+                structural[i].LayoutID = layoutID
+                if err := tx.Create(&structural[i]).Error; err != nil {
+                    return err
+                }
+            }
+        }
+        result.StructuralElements = len(structural)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result, nil
+}
+
+// saveSectors создает и обновляет секторы от корней к листьям, вычисляя Level по глубине.
+// Сохраненные id записываются в sectors, возвращается соответствие id из файла идентификаторам в базе
+func (s *GeoJSONService) saveSectors(tx *gorm.DB, sectors []importedSector, existingIDs map[uint]bool, result *GeoJSONImportResult) (map[uint]uint, error) {
+    ids := make(map[uint]uint)
+    levels := make(map[uint]int)
+    done := make([]bool, len(sectors))
+
+    for remaining := len(sectors); remaining > 0; {
+        progress := false
+        for i := range sectors {
+            item := &sectors[i]
+            if done[i] {
+                continue
+            }
+            if item.parentID != nil {
+                if _, ok := ids[*item.parentID]; !ok {
+                    continue // Родитель еще не сохранен
+                }
+                parent := ids[*item.parentID]
+                item.sector.ParentID = &parent
+                item.sector.Level = levels[parent] + 1
+            }
+
+            if item.sourceID != nil && existingIDs[*item.sourceID] {
+                item.sector.ID = *item.sourceID
+                if err := tx.Model(&models.Sector{ID: item.sector.ID}).Select("name", "description", "position_x", "position_y", "width", "height", "level", "parent_id", "floor_id", "temperature_zone").
+                    Updates(&item.sector).Error; err != nil {
+                    return nil, err
+                }
+                result.SectorsUpdated++
+            } else {
+                if err := tx.Create(&item.sector).Error; err != nil {
+                    return nil, err
+                }
+                result.SectorsCreated++
+            }
+
+            if item.sourceID != nil {
+                ids[*item.sourceID] = item.sector.ID
+            }
+            levels[item.sector.ID] = item.sector.Level
+            done[i] = true
+            remaining--
+            progress = true
+        }
+        if !progress {
+            return nil, &GeoJSONValidationError{Errors: []string{"sector parent_id references a missing sector or forms a cycle"}}
+        }
+    }
+    return ids, nil
+}
+
+// claimIDs назначает импортируемым объектам id существующих объектов магазина: по ссылке из файла
+// или, если задан match, по совпадению с ним. Каждый id достается одному объекту.
+// Возвращает множество занятых id
+func claimIDs(tx *gorm.DB, model interface{}, storeID uint, refs []*uint, target func(i int) *uint, match func(i int) uint) (map[uint]bool, error) {
+    var ids []uint
+    if err := tx.Model(model).Where("store_id = ?", storeID).Pluck("id", &ids).Error; err != nil {
+        return nil, err
+    }
+    existing := make(map[uint]bool, len(ids))
+    for _, id := range ids {
+        existing[id] = true
+    }
+    claimed := make(map[uint]bool)
+    for i, ref := range refs {
+        id := uint(0)
+        if ref != nil {
+            id = *ref
+        }
+        if (!existing[id] || claimed[id]) && match != nil {
+            id = match(i)
+        }
+        if existing[id] && !claimed[id] {
+            *target(i) = id
+            claimed[id] = true
+        }
+    }
+    return claimed, nil
+}
+
+// deleteUnclaimed удаляет объекты магазина, id которых не заняты импортом
+func deleteUnclaimed(tx *gorm.DB, model interface{}, storeID uint, kept map[uint]bool) error {
+    query := tx.Where("store_id = ?", storeID)
+    if len(kept) > 0 {
+        ids := make([]uint, 0, len(kept))
+        for id := range kept {
+            ids = append(ids, id)
+        }
+        query = query.Where("id NOT IN ?", ids)
+    }
+    return query.Delete(model).Error
+}
+
+// saveByID обновляет колонки columns объекта с ненулевым id или создает новый объект
+func saveByID(tx *gorm.DB, value interface{}, id uint, columns ...string) error {
+    if id == 0 {
+        return tx.Create(value).Error
+    }
+    return tx.Model(value).Select(columns).Updates(value).Error
+}
+
+// storeLayoutID возвращает макет магазина для конструктивных элементов, создавая его с именем name при необходимости
+func storeLayoutID(tx *gorm.DB, storeID uint, name string) (uint, error) {
+    var layout models.StoreLayout
+    err := tx.Where("store_id = ?", storeID).Order("id").First(&layout).Error
+    if err == gorm.ErrRecordNotFound {
+        layout = models.StoreLayout{StoreID: storeID, Name: name}
+        err = tx.Create(&layout).Error
+    }
+    return layout.ID, err
+}
+
+func remapID(id *uint, ids map[uint]uint) *uint {
+    if id == nil {
+        return nil
+    }
+    if mapped, ok := ids[*id]; ok {
+        return &mapped
+    }
+    return nil
+}
+
+// defaultJSON подставляет пустой объект для колонок типа json
+func defaultJSON(s string) string {
+    if strings.TrimSpace(s) == "" {
+        return "{}"
+    }
+    return s
+}
@@ -0,0 +1,496 @@
+package services
+
+import (
+    "archive/zip"
+    "crypto/sha1"
+    "encoding/json"
+    "fmt"
+    "io"
+    "math"
+    "regexp"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+const (
+    imdfVersion     = "1.0.0"
+    imdfLanguage    = "ru-RU"
+    imdfNameKey     = "ru"
+    earthRadius     = 6378137.0 // Экваториальный радиус WGS84 в метрах
+    imdfCoordDigits = 1e7
+)
+
+// Порядок файлов в архиве IMDF
+var imdfFiles = []string{"address", "venue", "building", "footprint", "level", "unit", "section", "opening", "anchor"}
+
+var (
+    countryCodePattern  = regexp.MustCompile(`^[A-Z]{2}$`)
+    provinceCodePattern = regexp.MustCompile(`^[A-Z]{2}-[A-Z0-9]{1,3}$`)
+)
+
+// IMDFIssue - отсутствующий или некорректный обязательный атрибут
+type IMDFIssue struct {
+    FeatureType string `json:"feature_type"`
+    FeatureID   string `json:"feature_id,omitempty"`
+    Property    string `json:"property"`
+    Message     string `json:"message"`
+}
+
+// IMDFReport - результат проверки магазина перед экспортом
+type IMDFReport struct {
+    Valid  bool        `json:"valid"`
+    Issues []IMDFIssue `json:"issues"`
+}
+
+type imdfFeature struct {
+    ID          string                 `json:"id"`
+    Type        string                 `json:"type"`
+    FeatureType string                 `json:"feature_type"`
+    Geometry    *GeoJSONGeometry       `json:"geometry"`
+    Properties  map[string]interface{} `json:"properties"`
+}
+
+// imdfArchive накапливает объекты по файлам и найденные проблемы
+type imdfArchive struct {
+    features map[string][]imdfFeature
+    issues   []IMDFIssue
+}
+
+func (a *imdfArchive) add(featureType, id string, geometry *GeoJSONGeometry, props map[string]interface{}) {
+    a.features[featureType] = append(a.features[featureType], imdfFeature{
+        ID: id, Type: "Feature", FeatureType: featureType, Geometry: geometry, Properties: props,
+    })
+}
+
+func (a *imdfArchive) issue(featureType, id, property, message string) {
+    a.issues = append(a.issues, IMDFIssue{FeatureType: featureType, FeatureID: id, Property: property, Message: message})
+}
+
+// geoReference переводит локальные координаты магазина (метры, Y вниз) в WGS84
+type geoReference struct {
+    lat, lon float64
+    bearing  float64
+}
+
+func (g geoReference) lonLat(p utils.Point) [2]float64 {
+    sin, cos := math.Sincos(g.bearing * math.Pi / 180)
+    east := p.X*cos - p.Y*sin
+    north := -p.X*sin - p.Y*cos
+    lat := g.lat + north/earthRadius*180/math.Pi
+    lon := g.lon + east/(earthRadius*math.Cos(g.lat*math.Pi/180))*180/math.Pi
+    return [2]float64{math.Round(lon*imdfCoordDigits) / imdfCoordDigits, math.Round(lat*imdfCoordDigits) / imdfCoordDigits}
+}
+
+func (g geoReference) point(p utils.Point) *GeoJSONGeometry {
+    return newGeometry("Point", g.lonLat(p))
+}
+
+func (g geoReference) line(points ...utils.Point) *GeoJSONGeometry {
+    coords := make([][2]float64, len(points))
+    for i, p := range points {
+        coords[i] = g.lonLat(p)
+    }
+    return newGeometry("LineString", coords)
+}
+
+// polygon строит контур против часовой стрелки, как требует RFC 7946
+func (g geoReference) polygon(corners []utils.Point) *GeoJSONGeometry {
+    ring := make([][2]float64, 0, len(corners)+1)
+    for _, p := range corners {
+        ring = append(ring, g.lonLat(p))
+    }
+    var area float64
+    for i := range ring {
+        next := ring[(i+1)%len(ring)]
+        area += ring[i][0]*next[1] - next[0]*ring[i][1]
+    }
+    if area < 0 {
+        for i, j := 0, len(ring)-1; i < j; i, j = i+1, j-1 {
+            ring[i], ring[j] = ring[j], ring[i]
+        }
+    }
+    ring = append(ring, ring[0])
+    return newGeometry("Polygon", [][][2]float64{ring})
+}
+
+// imdfID возвращает стабильный UUID (вариант 5) для объекта магазина,
+// чтобы повторный экспорт сохранял идентификаторы
+func imdfID(storeID uint, kind string, id uint) string {
+    sum := sha1.Sum([]byte(fmt.Sprintf("store-navigator/%d/%s/%d", storeID, kind, id)))
+    sum[6] = sum[6]&0x0f | 0x50
+    sum[8] = sum[8]&0x3f | 0x80
+    return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func imdfName(name string) map[string]string {
+    if name == "" {
+        return nil
+    }
+    return map[string]string{imdfNameKey: name}
+}
+
+func rectCenter(x, y, width, height float64) utils.Point {
+    return utils.Point{X: x + width/2, Y: y + height/2}
+}
+
+type IMDFService struct {
+    db *gorm.DB
+}
+
+func NewIMDFService(db *gorm.DB) *IMDFService {
+    return &IMDFService{db: db}
+}
+
+// build собирает объекты IMDF: Store -> address/venue/building/footprint/level,
+// корневые Sector -> unit, вложенные Sector -> section, входы и выходы -> opening,
+// Beacon -> anchor в помещении, где установлен маячок
+func (s *IMDFService) build(storeID uint) (*imdfArchive, error) {
+    scene, err := NewMapRenderService(s.db).LoadScene(storeID, nil)
+    if err != nil {
+        return nil, err
+    }
+    var beacons []models.Beacon
+    if err := s.db.Where("store_id = ?", storeID).Order("id").Find(&beacons).Error; err != nil {
+        return nil, err
+    }
+
+    archive := &imdfArchive{features: make(map[string][]imdfFeature)}
+    store := scene.Store
+
+    geo := geoReference{bearing: store.Bearing}
+    if store.Latitude == nil || store.Longitude == nil {
+        archive.issue("venue", "", "latitude/longitude", "store location is required to convert map coordinates to WGS84")
+    } else {
+        geo.lat, geo.lon = *store.Latitude, *store.Longitude
+        if math.Abs(geo.lat) > 85 || math.Abs(geo.lon) > 180 {
+            archive.issue("venue", "", "latitude/longitude", "store location is out of range")
+        }
+    }
+
+    // Адрес
+    addressID := imdfID(storeID, "address", storeID)
+    if strings.TrimSpace(store.Address) == "" {
+        archive.issue("address", addressID, "address", "street address is required")
+    }
+    if strings.TrimSpace(store.Locality) == "" {
+        archive.issue("address", addressID, "locality", "locality (city) is required")
+    }
+    if !countryCodePattern.MatchString(store.Country) {
+        archive.issue("address", addressID, "country", "ISO 3166-1 alpha-2 country code is required")
+    }
+    var province interface{}
+    if store.Province != "" {
+        if !provinceCodePattern.MatchString(store.Province) {
+            archive.issue("address", addressID, "province", "province must be an ISO 3166-2 code")
+        }
+        province = store.Province
+    }
+    var postalCode interface{}
+    if store.PostalCode != "" {
+        postalCode = store.PostalCode
+    }
+    archive.add("address", addressID, nil, map[string]interface{}{
+        "address":            store.Address,
+        "unit":               nil,
+        "locality":           store.Locality,
+        "province":           province,
+        "country":            store.Country,
+        "postal_code":        postalCode,
+        "postal_code_ext":    nil,
+        "postal_code_vanity": nil,
+    })
+
+    // Площадка, здание, контур и этаж строятся по габаритам карты
+    bounds := scene.Bounds()
+    if len(scene.Walls) == 0 && len(scene.Sectors) == 0 {
+        archive.issue("level", "", "geometry", "store map is empty, walls or sectors are required")
+    }
+    outline := utils.RectCorners(bounds.MinX, bounds.MinY, bounds.MaxX-bounds.MinX, bounds.MaxY-bounds.MinY, 0)
+    center := rectCenter(bounds.MinX, bounds.MinY, bounds.MaxX-bounds.MinX, bounds.MaxY-bounds.MinY)
+
+    venueID := imdfID(storeID, "venue", storeID)
+    if store.Name == "" {
+        archive.issue("venue", venueID, "name", "venue name is required")
+    }
+    archive.add("venue", venueID, geo.polygon(outline), map[string]interface{}{
+        "category":      "retailstore",
+        "restriction":   nil,
+        "name":          imdfName(store.Name),
+        "alt_name":      nil,
+        "hours":         nil,
+        "phone":         nil,
+        "website":       nil,
+        "display_point": geo.point(center),
+        "address_id":    addressID,
+    })
+
+    buildingID := imdfID(storeID, "building", storeID)
+    archive.add("building", buildingID, nil, map[string]interface{}{
+        "name":          imdfName(store.Name),
+        "alt_name":      nil,
+        "category":      "unspecified",
+        "restriction":   nil,
+        "display_point": geo.point(center),
+        "address_id":    addressID,
+    })
+    archive.add("footprint", imdfID(storeID, "footprint", storeID), geo.polygon(outline), map[string]interface{}{
+        "category":     "ground",
+        "name":         nil,
+        "building_ids": []string{buildingID},
+    })
+
+    // Уровни: по одному на этаж, в магазине без этажей - один уровень со всеми объектами
+    floors, err := NewFloorService(s.db).ListFloors(storeID)
+    if err != nil {
+        return nil, err
+    }
+    levels := []imdfLevel{{id: imdfID(storeID, "level", storeID), name: "Торговый зал", shortName: "1", scene: scene, beacons: beacons}}
+    if len(floors) > 0 {
+        levels = levels[:0]
+    }
+    for _, floor := range floors {
+        floorScene, err := NewMapRenderService(s.db).LoadScene(storeID, &floor.ID)
+        if err != nil {
+            return nil, err
+        }
+        scope, err := onFloor(s.db, storeID, &floor.ID)
+        if err != nil {
+            return nil, err
+        }
+        var floorBeacons []models.Beacon
+        if err := s.db.Scopes(scope).Where("store_id = ?", storeID).Order("id").Find(&floorBeacons).Error; err != nil {
+            return nil, err
+        }
+        name := floor.Name
+        if name == "" {
+            name = fmt.Sprintf("Этаж %d", floor.Number)
+        }
+        levels = append(levels, imdfLevel{id: imdfID(storeID, "level", floor.ID), ordinal: floor.Number, name: name,
+            shortName: fmt.Sprint(floor.Number), scene: floorScene, beacons: floorBeacons})
+    }
+
+    units := 0
+    for _, level := range levels {
+        // Пустой этаж получает контур здания
+        levelOutline, levelCenter := outline, center
+        if len(level.scene.Walls) > 0 || len(level.scene.Sectors) > 0 {
+            b := level.scene.Bounds()
+            levelOutline = utils.RectCorners(b.MinX, b.MinY, b.MaxX-b.MinX, b.MaxY-b.MinY, 0)
+            levelCenter = rectCenter(b.MinX, b.MinY, b.MaxX-b.MinX, b.MaxY-b.MinY)
+        }
+        archive.add("level", level.id, geo.polygon(levelOutline), map[string]interface{}{
+            "category":      "unspecified",
+            "restriction":   nil,
+            "outdoor":       false,
+            "ordinal":       level.ordinal,
+            "name":          imdfName(level.name),
+            "short_name":    imdfName(level.shortName),
+            "display_point": geo.point(levelCenter),
+            "address_id":    nil,
+            "building_ids":  []string{buildingID},
+        })
+        units += addIMDFLevel(archive, geo, storeID, level)
+    }
+    if units == 0 {
+        archive.issue("unit", "", "geometry", "at least one root sector is required")
+    }
+
+    return archive, nil
+}
+
+// imdfLevel - уровень IMDF: этаж магазина с его объектами
+type imdfLevel struct {
+    id        string
+    ordinal   int
+    name      string
+    shortName string
+    scene     *MapScene
+    beacons   []models.Beacon
+}
+
+// addIMDFLevel добавляет помещения, разделы, проемы и якоря уровня. Возвращает количество помещений
+func addIMDFLevel(archive *imdfArchive, geo geoReference, storeID uint, level imdfLevel) int {
+    levelID := level.id
+    // Секторы: корневые - помещения (unit), вложенные - разделы (section)
+    type unitArea struct {
+        id   string
+        area utils.Rect
+    }
+    var units []unitArea
+    var sectorFeatures func(list []models.Sector, parentSection *string)
+    sectorFeatures = func(list []models.Sector, parentSection *string) {
+        for _, sector := range list {
+            corners := utils.RectCorners(sector.PositionX, sector.PositionY, sector.Width, sector.Height, 0)
+            props := map[string]interface{}{
+                "restriction":   nil,
+                "accessibility": nil,
+                "name":          imdfName(sector.Name),
+                "alt_name":      nil,
+                "display_point": geo.point(rectCenter(sector.PositionX, sector.PositionY, sector.Width, sector.Height)),
+                "level_id":      levelID,
+            }
+
+            featureType, kind := "section", "section"
+            if sector.ParentID == nil {
+                featureType, kind = "unit", "unit"
+            }
+            id := imdfID(storeID, kind, sector.ID)
+            if sector.Width <= 0 || sector.Height <= 0 {
+                archive.issue(featureType, id, "geometry", fmt.Sprintf("sector %q has no area", sector.Name))
+            }
+            if sector.Name == "" {
+                archive.issue(featureType, id, "name", fmt.Sprintf("sector %d has no name", sector.ID))
+            }
+
+            var childParent *string
+            if featureType == "unit" {
+                props["category"] = "room"
+                units = append(units, unitArea{id: id, area: utils.Rect{MinX: sector.PositionX, MinY: sector.PositionY, MaxX: sector.PositionX + sector.Width, MaxY: sector.PositionY + sector.Height}})
+            } else {
+                props["category"] = "retail"
+                props["address_id"] = nil
+                props["correlation_id"] = nil
+                if parentSection != nil {
+                    props["parents"] = []string{*parentSection}
+                } else {
+                    props["parents"] = nil
+                }
+                childParent = &id
+            }
+            archive.add(featureType, id, geo.polygon(corners), props)
+            sectorFeatures(sector.SubSectors, childParent)
+        }
+    }
+    sectorFeatures(level.scene.Sectors, nil)
+
+    // Входы и выходы - проемы по длинной оси элемента
+    for _, e := range level.scene.Elements {
+        if e.Type != "entrance" && e.Type != "exit" {
+            continue
+        }
+        corners := utils.RectCorners(e.PositionX, e.PositionY, e.Width, e.Height, e.Rotation)
+        a, b := corners[0], corners[1]
+        if e.Height > e.Width {
+            a, b = corners[1], corners[2]
+        }
+        // Проем проходит через центр элемента параллельно длинной стороне
+        c := rectCenter(e.PositionX, e.PositionY, e.Width, e.Height)
+        mid := utils.Point{X: (a.X + b.X) / 2, Y: (a.Y + b.Y) / 2}
+        shift := utils.Point{X: c.X - mid.X, Y: c.Y - mid.Y}
+        start := utils.Point{X: a.X + shift.X, Y: a.Y + shift.Y}
+        end := utils.Point{X: b.X + shift.X, Y: b.Y + shift.Y}
+
+        category := "pedestrian"
+        if e.Type == "entrance" {
+            category = "pedestrian.principal"
+        }
+        id := imdfID(storeID, "opening", e.ID)
+        if math.Hypot(end.X-start.X, end.Y-start.Y) == 0 {
+            archive.issue("opening", id, "geometry", fmt.Sprintf("%s element %d has zero width", e.Type, e.ID))
+        }
+        archive.add("opening", id, geo.line(start, end), map[string]interface{}{
+            "category":       category,
+            "accessibility":  nil,
+            "access_control": nil,
+            "door":           nil,
+            "name":           imdfName(e.Name),
+            "alt_name":       nil,
+            "display_point":  geo.point(c),
+            "level_id":       levelID,
+        })
+    }
+
+    // Маячки - якоря в помещении, где они установлены
+    for _, b := range level.beacons {
+        id := imdfID(storeID, "anchor", b.ID)
+        var unitID interface{}
+        for _, u := range units {
+            if u.area.Contains(b.PositionX, b.PositionY) {
+                unitID = u.id
+                break
+            }
+        }
+        if unitID == nil {
+            archive.issue("anchor", id, "unit_id", fmt.Sprintf("beacon %s is not inside any root sector", b.MAC))
+        }
+        archive.add("anchor", id, geo.point(utils.Point{X: b.PositionX, Y: b.PositionY}), map[string]interface{}{
+            "address_id": nil,
+            "unit_id":    unitID,
+        })
+    }
+
+    return len(units)
+}
+
+func (a *imdfArchive) report() *IMDFReport {
+    issues := a.issues
+    if issues == nil {
+        issues = []IMDFIssue{}
+    }
+    return &IMDFReport{Valid: len(issues) == 0, Issues: issues}
+}
+
+// Validate проверяет, достаточно ли данных магазина для корректного архива IMDF
+func (s *IMDFService) Validate(storeID uint) (*IMDFReport, error) {
+    archive, err := s.build(storeID)
+    if err != nil {
+        return nil, err
+    }
+    return archive.report(), nil
+}
+
+// Export записывает архив IMDF. Если проверка не пройдена и force не задан,
+// архив не формируется и возвращается только отчет
+func (s *IMDFService) Export(storeID uint, w io.Writer, force bool) (*IMDFReport, error) {
+    archive, err := s.build(storeID)
+    if err != nil {
+        return nil, err
+    }
+    report := archive.report()
+    if !report.Valid && !force {
+        return report, nil
+    }
+
+    zw := zip.NewWriter(w)
+    manifest := map[string]interface{}{
+        "version":      imdfVersion,
+        "created":      time.Now().UTC().Format(time.RFC3339),
+        "generated_by": "store-navigator",
+        "language":     imdfLanguage,
+        "extensions":   nil,
+    }
+    files := map[string]interface{}{"manifest.json": manifest}
+    names := []string{"manifest.json"}
+    for _, featureType := range imdfFiles {
+        features := archive.features[featureType]
+        if features == nil {
+            features = []imdfFeature{}
+        }
+        name := featureType + ".geojson"
+        names = append(names, name)
+        files[name] = map[string]interface{}{
+            "type":     "FeatureCollection",
+            "name":     featureType,
+            "features": features,
+        }
+    }
+
+    for _, name := range names {
+        fw, err := zw.Create(name)
+        if err != nil {
+            return nil, err
+        }
+        if err := json.NewEncoder(fw).Encode(files[name]); err != nil {
+            return nil, err
+        }
+    }
+    if err := zw.Close(); err != nil {
+        return nil, err
+    }
+    return report, nil
+}
@@ -0,0 +1,439 @@
+package services
+
+import (
+    "errors"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+)
+
+// journeyMinStay - более короткое нахождение в секторе считается проходом мимо и в путь не попадает
+const journeyMinStay = 5 * time.Second
+
+// maxJourneyDays - сколько суток строится за один вызов BuildDue
+const maxJourneyDays = 31
+
+// JourneyQuery - выборка посещений за сутки. Level - уровень секторов, до которого укрупняется путь
+// (вложенные секторы заменяются родителем этого уровня)
+type JourneyQuery struct {
+    StoreID uint
+    Day     time.Time
+    Level   int
+}
+
+// PathStat - путь по секторам и число посещений с таким путем
+type PathStat struct {
+    Sectors []SectorRef `json:"sectors"`
+    Count   int         `json:"count"`
+    Share   float64     `json:"share"` // Доля от всех посещений с путем
+}
+
+// JourneySummary - посещения за сутки и самые частые пути
+type JourneySummary struct {
+    Day         time.Time  `json:"day"`
+    Journeys    int        `json:"journeys"`
+    AvgDuration float64    `json:"avg_duration"` // Средняя длительность посещения в секундах
+    AvgSectors  float64    `json:"avg_sectors"`  // Среднее количество секторов в пути
+    TopPaths    []PathStat `json:"top_paths"`
+}
+
+// TransitionMatrix - переходы между секторами: Counts[i][j] - сколько раз покупатели
+// перешли из Sectors[i] в Sectors[j]. Entries и Exits - сколько путей начались и закончились в секторе
+type TransitionMatrix struct {
+    Day     time.Time   `json:"day"`
+    Sectors []SectorRef `json:"sectors"`
+    Counts  [][]int     `json:"counts"`
+    Entries []int       `json:"entries"`
+    Exits   []int       `json:"exits"`
+}
+
+// FunnelStep - сколько посещений дошло до сектора, пройдя все предыдущие шаги в том же порядке
+type FunnelStep struct {
+    Sector     SectorRef `json:"sector"`
+    Journeys   int       `json:"journeys"`
+    DropOff    int       `json:"drop_off"`   // Сколько не дошло до этого шага с предыдущего
+    Conversion float64   `json:"conversion"` // Доля от всех посещений
+}
+
+type JourneyService struct {
+    db *gorm.DB
+}
+
+func NewJourneyService(db *gorm.DB) *JourneyService {
+    return &JourneyService{db: db}
+}
+
+// StartOfDay возвращает начало суток по местному времени сервера
+func StartOfDay(t time.Time) time.Time {
+    y, m, d := t.In(time.Local).Date()
+    return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// BuildDue строит посещения за завершенные сутки, которые еще не построены. Возвращает количество суток
+func (s *JourneyService) BuildDue(now time.Time) (int, error) {
+    var storeIDs []uint
+    if err := s.db.Model(&models.PositionFix{}).Distinct("store_id").Pluck("store_id", &storeIDs).Error; err != nil {
+        return 0, err
+    }
+    today := StartOfDay(now)
+
+    built := 0
+    for _, storeID := range storeIDs {
+        var last models.JourneyDay
+        err := s.db.Where("store_id = ?", storeID).Order("day DESC").First(&last).Error
+        var day time.Time
+        switch {
+        case err == nil:
+            day = StartOfDay(last.Day).AddDate(0, 0, 1)
+        case errors.Is(err, gorm.ErrRecordNotFound):
+            var first models.PositionFix
+            if err := s.db.Where("store_id = ?", storeID).Order("created_at").First(&first).Error; err != nil {
+                return built, err
+            }
+            day = StartOfDay(first.CreatedAt)
+        default:
+            return built, err
+        }
+
+        for i := 0; i < maxJourneyDays && day.Before(today); i++ {
+            if err := s.BuildDay(storeID, day); err != nil {
+                return built, err
+            }
+            built++
+            day = day.AddDate(0, 0, 1)
+        }
+    }
+    return built, nil
+}
+
+// BuildDay заново строит посещения магазина за сутки по точкам позиционирования.
+// Посещение, продолжающееся после полуночи, обрезается границей суток
+func (s *JourneyService) BuildDay(storeID uint, day time.Time) error {
+    day = StartOfDay(day)
+    var fixes []models.PositionFix
+    if err := s.db.Where("store_id = ? AND created_at >= ? AND created_at < ?", storeID, day, day.AddDate(0, 0, 1)).
+        Order("device_id, created_at, id").Find(&fixes).Error; err != nil {
+        return err
+    }
+
+    var journeys []models.CustomerJourney
+    start := 0
+    for i := 1; i <= len(fixes); i++ {
+        if i < len(fixes) && fixes[i].DeviceID == fixes[i-1].DeviceID &&
+            fixes[i].CreatedAt.Sub(fixes[i-1].CreatedAt) <= PresenceTimeout {
+            continue
+        }
+        session := fixes[start:i]
+        start = i
+        if path := sessionPath(session); len(path) > 0 {
+            journeys = append(journeys, models.CustomerJourney{
+                StoreID:   storeID,
+                Day:       day,
+                DeviceID:  session[0].DeviceID,
+                StartedAt: session[0].CreatedAt,
+                EndedAt:   session[len(session)-1].CreatedAt,
+                Path:      joinPath(path),
+            })
+        }
+    }
+
+    return s.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("store_id = ? AND day = ?", storeID, day).Delete(&models.CustomerJourney{}).Error; err != nil {
+            return err
+        }
+        if err := tx.Where("store_id = ? AND day = ?", storeID, day).Delete(&models.JourneyDay{}).Error; err != nil {
+            return err
+        }
+        if len(journeys) > 0 {
+            if err := tx.CreateInBatches(&journeys, 500).Error; err != nil {
+                return err
+            }
+        }
+        return tx.Create(&models.JourneyDay{StoreID: storeID, Day: day, Journeys: len(journeys)}).Error
+    })
+}
+
+// Summary возвращает статистику посещений за сутки и limit самых частых путей.
+// Если заданы fromSector и toSector, учитывается только участок пути от первого входа в fromSector
+// до следующего за ним входа в toSector (например, от входной зоны до касс)
+func (s *JourneyService) Summary(q JourneyQuery, limit int, fromSector, toSector uint) (*JourneySummary, error) {
+    journeys, sectors, err := s.load(q)
+    if err != nil {
+        return nil, err
+    }
+    summary := &JourneySummary{Day: StartOfDay(q.Day), TopPaths: []PathStat{}}
+
+    counts := make(map[string]int)
+    var withPath int
+    var duration, length float64
+    for _, j := range journeys {
+        path := sectors.path(j.Path, q.Level)
+        duration += j.EndedAt.Sub(j.StartedAt).Seconds()
+        length += float64(len(path))
+        if fromSector != 0 || toSector != 0 {
+            path = pathSegment(path, sectors.atLevel(fromSector, q.Level), sectors.atLevel(toSector, q.Level))
+        }
+        if len(path) == 0 {
+            continue
+        }
+        counts[joinPath(path)]++
+        withPath++
+    }
+    summary.Journeys = len(journeys)
+    if len(journeys) > 0 {
+        summary.AvgDuration = round3(duration / float64(len(journeys)))
+        summary.AvgSectors = round3(length / float64(len(journeys)))
+    }
+
+    keys := make([]string, 0, len(counts))
+    for key := range counts {
+        keys = append(keys, key)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        if counts[keys[i]] != counts[keys[j]] {
+            return counts[keys[i]] > counts[keys[j]]
+        }
+        return keys[i] < keys[j]
+    })
+    if limit < 1 {
+        limit = 10
+    }
+    if len(keys) > limit {
+        keys = keys[:limit]
+    }
+    for _, key := range keys {
+        stat := PathStat{Count: counts[key], Share: round3(float64(counts[key]) / float64(withPath))}
+        for _, id := range splitPath(key) {
+            stat.Sectors = append(stat.Sectors, sectors.ref(id))
+        }
+        summary.TopPaths = append(summary.TopPaths, stat)
+    }
+    return summary, nil
+}
+
+// Transitions возвращает матрицу переходов между секторами уровня q.Level за сутки
+func (s *JourneyService) Transitions(q JourneyQuery) (*TransitionMatrix, error) {
+    journeys, sectors, err := s.load(q)
+    if err != nil {
+        return nil, err
+    }
+    matrix := &TransitionMatrix{Day: StartOfDay(q.Day), Sectors: []SectorRef{}}
+    index := make(map[uint]int)
+    for _, sector := range sectors.ordered {
+        if sectors.atLevel(sector.ID, q.Level) == sector.ID {
+            index[sector.ID] = len(matrix.Sectors)
+            matrix.Sectors = append(matrix.Sectors, SectorRef{ID: sector.ID, Name: sector.Name})
+        }
+    }
+    n := len(matrix.Sectors)
+    matrix.Counts = make([][]int, n)
+    for i := range matrix.Counts {
+        matrix.Counts[i] = make([]int, n)
+    }
+    matrix.Entries, matrix.Exits = make([]int, n), make([]int, n)
+
+    for _, j := range journeys {
+        path := sectors.path(j.Path, q.Level)
+        if len(path) == 0 {
+            continue
+        }
+        matrix.Entries[index[path[0]]]++
+        matrix.Exits[index[path[len(path)-1]]]++
+        for k := 1; k < len(path); k++ {
+            matrix.Counts[index[path[k-1]]][index[path[k]]]++
+        }
+    }
+    return matrix, nil
+}
+
+// Funnel считает, сколько посещений прошло через сектора steps в заданном порядке
+// (не обязательно подряд) и сколько отсеялось перед каждым шагом
+func (s *JourneyService) Funnel(q JourneyQuery, steps []uint) ([]FunnelStep, error) {
+    journeys, sectors, err := s.load(q)
+    if err != nil {
+        return nil, err
+    }
+    steps = append([]uint(nil), steps...)
+    for i, id := range steps {
+        if _, ok := sectors.byID[id]; !ok {
+            return nil, ErrSectorNotInStore
+        }
+        steps[i] = sectors.atLevel(id, q.Level)
+    }
+
+    reached := make([]int, len(steps))
+    for _, j := range journeys {
+        step := 0
+        for _, id := range sectors.path(j.Path, q.Level) {
+            if step < len(steps) && id == steps[step] {
+                reached[step]++
+                step++
+            }
+        }
+    }
+
+    funnel := make([]FunnelStep, len(steps))
+    previous := len(journeys)
+    for i, id := range steps {
+        funnel[i] = FunnelStep{Sector: sectors.ref(id), Journeys: reached[i], DropOff: previous - reached[i]}
+        if len(journeys) > 0 {
+            funnel[i].Conversion = round3(float64(reached[i]) / float64(len(journeys)))
+        }
+        previous = reached[i]
+    }
+    return funnel, nil
+}
+
+// load загружает посещения за сутки, при необходимости строя их: текущие сутки строятся при каждом запросе
+func (s *JourneyService) load(q JourneyQuery) ([]models.CustomerJourney, *sectorIndex, error) {
+    day := StartOfDay(q.Day)
+    var built int64
+    if err := s.db.Model(&models.JourneyDay{}).Where("store_id = ? AND day = ?", q.StoreID, day).Count(&built).Error; err != nil {
+        return nil, nil, err
+    }
+    if built == 0 || !day.Before(StartOfDay(time.Now())) {
+        if err := s.BuildDay(q.StoreID, day); err != nil {
+            return nil, nil, err
+        }
+    }
+
+    var journeys []models.CustomerJourney
+    if err := s.db.Where("store_id = ? AND day = ?", q.StoreID, day).Order("started_at, id").Find(&journeys).Error; err != nil {
+        return nil, nil, err
+    }
+    var sectors []models.Sector
+    if err := s.db.Where("store_id = ?", q.StoreID).Order("level, id").Find(&sectors).Error; err != nil {
+        return nil, nil, err
+    }
+    index := &sectorIndex{ordered: sectors, byID: make(map[uint]models.Sector, len(sectors))}
+    for _, sector := range sectors {
+        index.byID[sector.ID] = sector
+    }
+    return journeys, index, nil
+}
+
+// sectorIndex укрупняет пути до нужного уровня вложенности секторов
+type sectorIndex struct {
+    ordered []models.Sector
+    byID    map[uint]models.Sector
+}
+
+// atLevel возвращает предка сектора на уровне level (или сам сектор, если он не глубже)
+func (x *sectorIndex) atLevel(id uint, level int) uint {
+    for {
+        sector, ok := x.byID[id]
+        if !ok || sector.Level <= level || sector.ParentID == nil {
+            return id
+        }
+        if _, ok := x.byID[*sector.ParentID]; !ok {
+            return id // Родитель удален
+        }
+        id = *sector.ParentID
+    }
+}
+
+// path разбирает сохраненный путь, укрупняет его до уровня level и убирает повторы подряд.
+// Удаленные секторы пропускаются
+func (x *sectorIndex) path(stored string, level int) []uint {
+    var path []uint
+    for _, id := range splitPath(stored) {
+        if _, ok := x.byID[id]; !ok {
+            continue
+        }
+        id = x.atLevel(id, level)
+        if len(path) == 0 || path[len(path)-1] != id {
+            path = append(path, id)
+        }
+    }
+    return path
+}
+
+func (x *sectorIndex) ref(id uint) SectorRef {
+    return SectorRef{ID: id, Name: x.byID[id].Name}
+}
+
+// sessionPath превращает точки одного посещения в последовательность секторов без коротких заходов
+func sessionPath(fixes []models.PositionFix) []uint {
+    type visit struct {
+        sector uint
+        stay   time.Duration
+    }
+    var visits []visit
+    for i, fix := range fixes {
+        if fix.SectorID == nil {
+            continue
+        }
+        var stay time.Duration
+        if i+1 < len(fixes) {
+            stay = fixes[i+1].CreatedAt.Sub(fix.CreatedAt)
+            if stay > maxFixInterval {
+                stay = maxFixInterval
+            }
+        }
+        if n := len(visits); n > 0 && visits[n-1].sector == *fix.SectorID {
+            visits[n-1].stay += stay
+        } else {
+            visits = append(visits, visit{sector: *fix.SectorID, stay: stay})
+        }
+    }
+
+    var path []uint
+    for _, v := range visits {
+        if v.stay < journeyMinStay {
+            continue
+        }
+        if len(path) == 0 || path[len(path)-1] != v.sector {
+            path = append(path, v.sector)
+        }
+    }
+    return path
+}
+
+// pathSegment вырезает участок пути от первого from до следующего за ним to; 0 - от начала или до конца
+func pathSegment(path []uint, from, to uint) []uint {
+    start := 0
+    if from != 0 {
+        start = -1
+        for i, id := range path {
+            if id == from {
+                start = i
+                break
+            }
+        }
+        if start < 0 {
+            return nil
+        }
+    }
+    if to == 0 {
+        return path[start:]
+    }
+    for i := start; i < len(path); i++ {
+        if path[i] == to {
+            return path[start : i+1]
+        }
+    }
+    return nil
+}
+
+func joinPath(path []uint) string {
+    parts := make([]string, len(path))
+    for i, id := range path {
+        parts[i] = strconv.FormatUint(uint64(id), 10)
+    }
+    return strings.Join(parts, ",")
+}
+
+func splitPath(s string) []uint {
+    var path []uint
+    for _, part := range strings.Split(s, ",") {
+        if id, err := strconv.ParseUint(part, 10, 64); err == nil {
+            path = append(path, uint(id))
+        }
+    }
+    return path
+}
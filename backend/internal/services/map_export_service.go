@@ -0,0 +1,656 @@
+package services
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "hash/crc32"
+    "image"
+    "image/color"
+    "image/draw"
+    "image/png"
+    "io"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/go-pdf/fpdf"
+    "golang.org/x/image/font"
+    "golang.org/x/image/font/gofont/gobold"
+    "golang.org/x/image/font/gofont/goregular"
+    "golang.org/x/image/font/opentype"
+    "golang.org/x/image/math/fixed"
+    "golang.org/x/image/vector"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+var ErrImageTooLarge = errors.New("requested image is too large")
+
+const (
+    DefaultPNGDPI = 96
+    MinPNGDPI     = 36
+    MaxPNGDPI     = 600
+    maxPNGPixels  = 64 << 20
+)
+
+// mapPainter - поверхность для рисования карты, координаты задаются в метрах магазина
+type mapPainter interface {
+    Polygon(points []utils.Point, fill, stroke string, strokeWidth float64)
+    Polyline(points []utils.Point, stroke string, width float64)
+    Circle(center utils.Point, radius float64, fill string)
+    Text(at utils.Point, size float64, color, text string, centered bool)
+}
+
+// paintScene рисует сцену в том же порядке и теми же цветами, что и RenderSVG
+func paintScene(p mapPainter, scene *MapScene) {
+    var paintSectors func(list []models.Sector)
+    paintSectors = func(list []models.Sector) {
+        for _, sector := range list {
+            stroke, strokeWidth := sectorStroke(scene, sector)
+            p.Polygon(utils.RectCorners(sector.PositionX, sector.PositionY, sector.Width, sector.Height, 0),
+                SectorFill(sector), stroke, strokeWidth)
+            if sector.Name != "" {
+                p.Text(utils.Point{X: sector.PositionX + 0.2, Y: sector.PositionY + 0.6},
+                    0.5/float64(sector.Level+1), "#0d47a1", sector.Name, false)
+            }
+            paintSectors(sector.SubSectors)
+        }
+    }
+    paintSectors(scene.Sectors)
+
+    for _, e := range scene.Elements {
+        p.Polygon(utils.RectCorners(e.PositionX, e.PositionY, e.Width, e.Height, e.Rotation), ElementColor(e), "#616161", 0.03)
+        if e.Name != "" {
+            p.Text(utils.Point{X: e.PositionX + e.Width/2, Y: e.PositionY + e.Height/2 + 0.12}, 0.35, "#212121", e.Name, true)
+        }
+    }
+
+    for _, f := range scene.Fixtures {
+        p.Polygon(utils.RectCorners(f.PositionX, f.PositionY, f.Width, f.Depth, f.Rotation), fixtureColor, "#8d6e63", 0.02)
+    }
+
+    for _, wall := range scene.Walls {
+        thickness := wall.Thickness
+        if thickness <= 0 {
+            thickness = 0.1
+        }
+        p.Polyline([]utils.Point{{X: wall.StartX, Y: wall.StartY}, {X: wall.EndX, Y: wall.EndY}}, wallColor, thickness)
+    }
+
+    if plan := scene.Evacuation; plan != nil {
+        for _, band := range plan.bands() {
+            p.Polygon(band.points, band.color, "", 0)
+        }
+        for _, route := range plan.Routes {
+            p.Polyline(route.Points, evacuationRouteColor, 0.15)
+        }
+        for _, exit := range plan.Exits {
+            p.Circle(exit.Point, 0.5, evacuationRouteColor)
+            p.Text(utils.Point{X: exit.Point.X, Y: exit.Point.Y - 0.7}, 0.45, evacuationRouteColor, evacuationExitLabel(exit), true)
+        }
+    }
+
+    if coverage := scene.Coverage; coverage != nil {
+        for _, band := range coverage.bands() {
+            p.Polygon(band.points, band.color, "", 0)
+        }
+        for _, beacon := range coverage.Beacons {
+            p.Circle(beacon.Point, 0.35, coverageBeaconColor)
+        }
+        for i, suggestion := range coverage.Suggestions {
+            p.Circle(suggestion.Point, 0.35, coverageSuggestionColor)
+            p.Text(utils.Point{X: suggestion.Point.X, Y: suggestion.Point.Y - 0.55}, 0.45, coverageSuggestionColor, fmt.Sprintf("+%d", i+1), true)
+        }
+    }
+
+    for _, closure := range scene.Closures {
+        p.Polygon(closurePolygon(closure), closureColor, closureStroke, 0.05)
+    }
+
+    if len(scene.Route) > 1 {
+        p.Polyline(scene.Route, routeColor, 0.25)
+        p.Circle(scene.Route[0], 0.35, "#388e3c")
+        p.Circle(scene.Route[len(scene.Route)-1], 0.35, routeColor)
+    }
+
+    if h := scene.Highlight; h != nil {
+        p.Circle(h.Point, 0.55, "#ffffff")
+        p.Circle(h.Point, 0.45, highlightColor)
+        p.Text(utils.Point{X: h.Point.X, Y: h.Point.Y - 0.7}, 0.5, highlightColor, h.Label, true)
+    }
+}
+
+// ParseColor разбирает цвет вида #rgb, #rrggbb или #rrggbbaa
+func ParseColor(s string) color.NRGBA {
+    hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+    if len(hex) == 3 {
+        hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+    }
+    if len(hex) == 6 {
+        hex += "ff"
+    }
+    v, err := strconv.ParseUint(hex, 16, 32)
+    if len(hex) != 8 || err != nil {
+        return color.NRGBA{R: 0x9e, G: 0x9e, B: 0x9e, A: 0xff}
+    }
+    return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+}
+
+var (
+    fontsOnce    sync.Once
+    regularFont  *opentype.Font
+    fontsLoadErr error
+)
+
+// loadFonts разбирает встроенный шрифт Go (содержит кириллицу)
+func loadFonts() (*opentype.Font, error) {
+    fontsOnce.Do(func() {
+        regularFont, fontsLoadErr = opentype.Parse(goregular.TTF)
+    })
+    return regularFont, fontsLoadErr
+}
+
+// rasterPainter рисует карту в изображение с антиалиасингом
+type rasterPainter struct {
+    img   *image.RGBA
+    t     MapTransform
+    font  *opentype.Font
+    faces map[int]font.Face
+    z     vector.Rasterizer
+}
+
+func (r *rasterPainter) toPixels(points []utils.Point) []utils.Point {
+    out := make([]utils.Point, len(points))
+    for i, p := range points {
+        out[i].X, out[i].Y = r.t.ToPixels(p.X, p.Y)
+    }
+    return out
+}
+
+// fill закрашивает многоугольник, заданный в пикселях
+func (r *rasterPainter) fill(points []utils.Point, c color.NRGBA) {
+    if len(points) < 3 || c.A == 0 {
+        return
+    }
+    minX, minY := math.Inf(1), math.Inf(1)
+    maxX, maxY := math.Inf(-1), math.Inf(-1)
+    for _, p := range points {
+        minX, minY = math.Min(minX, p.X), math.Min(minY, p.Y)
+        maxX, maxY = math.Max(maxX, p.X), math.Max(maxY, p.Y)
+    }
+
+    // Растеризуем только в габаритах фигуры, обрезанных по изображению
+    area := image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX))+1, int(math.Ceil(maxY))+1).
+        Intersect(r.img.Bounds())
+    if area.Empty() {
+        return
+    }
+    r.z.Reset(area.Dx(), area.Dy())
+    ox, oy := float32(area.Min.X), float32(area.Min.Y)
+    r.z.MoveTo(float32(points[0].X)-ox, float32(points[0].Y)-oy)
+    for _, p := range points[1:] {
+        r.z.LineTo(float32(p.X)-ox, float32(p.Y)-oy)
+    }
+    r.z.ClosePath()
+    r.z.Draw(r.img, area, image.NewUniform(c), image.Point{})
+}
+
+// strokeSegment закрашивает отрезок заданной толщины (в пикселях)
+func (r *rasterPainter) strokeSegment(a, b utils.Point, width float64, c color.NRGBA) {
+    length := math.Hypot(b.X-a.X, b.Y-a.Y)
+    if length == 0 {
+        return
+    }
+    nx, ny := -(b.Y-a.Y)/length*width/2, (b.X-a.X)/length*width/2
+    r.fill([]utils.Point{{X: a.X + nx, Y: a.Y + ny}, {X: b.X + nx, Y: b.Y + ny}, {X: b.X - nx, Y: b.Y - ny}, {X: a.X - nx, Y: a.Y - ny}}, c)
+}
+
+func (r *rasterPainter) fillCircle(center utils.Point, radius float64, c color.NRGBA) {
+    const segments = 24
+    points := make([]utils.Point, segments)
+    for i := range points {
+        sin, cos := math.Sincos(2 * math.Pi * float64(i) / segments)
+        points[i] = utils.Point{X: center.X + radius*cos, Y: center.Y + radius*sin}
+    }
+    r.fill(points, c)
+}
+
+func (r *rasterPainter) Polygon(points []utils.Point, fill, stroke string, strokeWidth float64) {
+    px := r.toPixels(points)
+    if fill != "" {
+        r.fill(px, ParseColor(fill))
+    }
+    if stroke != "" {
+        c := ParseColor(stroke)
+        for i := range px {
+            r.strokeSegment(px[i], px[(i+1)%len(px)], strokeWidth*r.t.Scale, c)
+        }
+    }
+}
+
+func (r *rasterPainter) Polyline(points []utils.Point, stroke string, width float64) {
+    px := r.toPixels(points)
+    c := ParseColor(stroke)
+    w := math.Max(width*r.t.Scale, 1)
+    for i := 1; i < len(px); i++ {
+        r.strokeSegment(px[i-1], px[i], w, c)
+    }
+    // Скругленные соединения маршрута
+    for i := 1; i < len(px)-1; i++ {
+        r.fillCircle(px[i], w/2, c)
+    }
+}
+
+func (r *rasterPainter) Circle(center utils.Point, radius float64, fill string) {
+    x, y := r.t.ToPixels(center.X, center.Y)
+    r.fillCircle(utils.Point{X: x, Y: y}, radius*r.t.Scale, ParseColor(fill))
+}
+
+func (r *rasterPainter) Text(at utils.Point, size float64, textColor, text string, centered bool) {
+    px := int(math.Round(size * r.t.Scale))
+    if px < 5 || r.font == nil {
+        return // Слишком мелкий текст не читается
+    }
+    face, ok := r.faces[px]
+    if !ok {
+        var err error
+        face, err = opentype.NewFace(r.font, &opentype.FaceOptions{Size: float64(px), DPI: 72, Hinting: font.HintingFull})
+        if err != nil {
+            return
+        }
+        r.faces[px] = face
+    }
+
+    x, y := r.t.ToPixels(at.X, at.Y)
+    d := font.Drawer{Dst: r.img, Src: image.NewUniform(ParseColor(textColor)), Face: face}
+    if centered {
+        x -= float64(d.MeasureString(text)) / 64 / 2
+    }
+    d.Dot = fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(y * 64)}
+    d.DrawString(text)
+}
+
+// pngSize округляет размер холста до пикселей. Размер проверяется до перевода в int,
+// чтобы огромные и нечисловые размеры не переполнили произведение
+func pngSize(width, height float64) (int, int, error) {
+    w, h := math.Ceil(width), math.Ceil(height)
+    if !(w > 0 && h > 0) || math.IsInf(w, 0) || math.IsInf(h, 0) || w*h > maxPNGPixels {
+        return 0, 0, ErrImageTooLarge
+    }
+    return int(w), int(h), nil
+}
+
+// RenderPNG выводит карту в PNG. Размер холста SVG считается заданным при 96 DPI
+// и масштабируется под запрошенное разрешение
+func RenderPNG(w io.Writer, scene *MapScene, dpi int) error {
+    width, height, t := scene.Canvas()
+    k := float64(dpi) / 96
+    iw, ih, err := pngSize(width*k, height*k)
+    if err != nil {
+        return err
+    }
+    t.Scale *= k
+    t.OriginX *= k
+    t.OriginY *= k
+
+    fnt, err := loadFonts()
+    if err != nil {
+        return err
+    }
+
+    img := image.NewRGBA(image.Rect(0, 0, iw, ih))
+    draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+    painter := &rasterPainter{img: img, t: t, font: fnt, faces: make(map[int]font.Face)}
+    paintScene(painter, scene)
+    for _, face := range painter.faces {
+        face.Close()
+    }
+
+    var buf bytes.Buffer
+    if err := png.Encode(&buf, img); err != nil {
+        return err
+    }
+    return writePNGWithDPI(w, buf.Bytes(), dpi)
+}
+
+// writePNGWithDPI добавляет после IHDR блок pHYs с физическим разрешением,
+// чтобы при печати сохранялся масштаб
+func writePNGWithDPI(w io.Writer, data []byte, dpi int) error {
+    const ihdrEnd = 8 + 4 + 4 + 13 + 4 // Сигнатура + длина, тип, данные и CRC блока IHDR
+    if len(data) < ihdrEnd {
+        _, err := w.Write(data)
+        return err
+    }
+
+    ppm := uint32(math.Round(float64(dpi) / 0.0254))
+    chunk := make([]byte, 4+4+9+4)
+    binary.BigEndian.PutUint32(chunk[0:], 9)
+    copy(chunk[4:], "pHYs")
+    binary.BigEndian.PutUint32(chunk[8:], ppm)
+    binary.BigEndian.PutUint32(chunk[12:], ppm)
+    chunk[16] = 1 // Единица измерения - метр
+    binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+
+    for _, part := range [][]byte{data[:ihdrEnd], chunk, data[ihdrEnd:]} {
+        if _, err := w.Write(part); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// pdfPainter рисует карту на странице PDF, координаты страницы в миллиметрах
+type pdfPainter struct {
+    pdf *fpdf.Fpdf
+    t   MapTransform
+}
+
+// fill заливает фигуру цветом c. Прозрачность в PDF общая для заливки и линий,
+// поэтому после полупрозрачной заливки она сразу восстанавливается
+func (p *pdfPainter) fill(c string, draw func()) {
+    rgba := ParseColor(c)
+    p.pdf.SetFillColor(int(rgba.R), int(rgba.G), int(rgba.B))
+    // Полупрозрачные заливки (закрытия, план эвакуации) не должны скрывать карту
+    p.pdf.SetAlpha(float64(rgba.A)/255, "Normal")
+    draw()
+    p.pdf.SetAlpha(1, "Normal")
+}
+
+func (p *pdfPainter) setDraw(c string) {
+    rgba := ParseColor(c)
+    p.pdf.SetDrawColor(int(rgba.R), int(rgba.G), int(rgba.B))
+}
+
+func (p *pdfPainter) Polygon(points []utils.Point, fill, stroke string, strokeWidth float64) {
+    pts := make([]fpdf.PointType, len(points))
+    for i, pt := range points {
+        pts[i].X, pts[i].Y = p.t.ToPixels(pt.X, pt.Y)
+    }
+    if fill != "" {
+        p.fill(fill, func() { p.pdf.Polygon(pts, "F") })
+    }
+    if stroke != "" {
+        p.setDraw(stroke)
+        p.pdf.SetLineWidth(strokeWidth * p.t.Scale)
+        p.pdf.Polygon(pts, "D")
+    }
+}
+
+func (p *pdfPainter) Polyline(points []utils.Point, stroke string, width float64) {
+    p.setDraw(stroke)
+    p.pdf.SetLineWidth(width * p.t.Scale)
+    p.pdf.SetLineCapStyle("round")
+    for i := 1; i < len(points); i++ {
+        x1, y1 := p.t.ToPixels(points[i-1].X, points[i-1].Y)
+        x2, y2 := p.t.ToPixels(points[i].X, points[i].Y)
+        p.pdf.Line(x1, y1, x2, y2)
+    }
+    p.pdf.SetLineCapStyle("butt")
+}
+
+func (p *pdfPainter) Circle(center utils.Point, radius float64, fill string) {
+    x, y := p.t.ToPixels(center.X, center.Y)
+    p.fill(fill, func() { p.pdf.Circle(x, y, radius*p.t.Scale, "F") })
+}
+
+func (p *pdfPainter) Text(at utils.Point, size float64, textColor, text string, centered bool) {
+    pt := size * p.t.Scale * 72 / 25.4
+    if pt < 2 {
+        return
+    }
+    rgba := ParseColor(textColor)
+    p.pdf.SetTextColor(int(rgba.R), int(rgba.G), int(rgba.B))
+    p.pdf.SetFont(pdfFontFamily, "", pt)
+    x, y := p.t.ToPixels(at.X, at.Y)
+    if centered {
+        x -= p.pdf.GetStringWidth(text) / 2
+    }
+    p.pdf.Text(x, y, text)
+}
+
+const pdfFontFamily = "Go"
+
+// PDFOptions - параметры печатной карты
+type PDFOptions struct {
+    PageSize    string // A4 или A3
+    Orientation string // portrait, landscape или пусто - по пропорциям карты
+}
+
+// legendItem - строка легенды печатной карты
+type legendItem struct {
+    Label string
+    Color string
+    Line  bool // Линия вместо заливки
+}
+
+func buildLegend(scene *MapScene) []legendItem {
+    var items []legendItem
+    levels := map[int]bool{}
+    zones := map[string]bool{}
+    WalkSectors(scene.Sectors, func(sector models.Sector, path []string) {
+        if _, ok := sectorZoneColors[sector.TemperatureZone]; ok {
+            zones[sector.TemperatureZone] = true
+            return
+        }
+        levels[len(path)-1] = true
+    })
+    for depth := 0; depth < len(sectorLevelColors); depth++ {
+        if !levels[depth] {
+            continue
+        }
+        label := "Сектор"
+        if depth > 0 {
+            label = fmt.Sprintf("Подсектор %d уровня", depth)
+        }
+        items = append(items, legendItem{Label: label, Color: SectorColor(depth)})
+    }
+    for _, zone := range []string{models.TemperatureChilled, models.TemperatureFrozen} {
+        if zones[zone] {
+            items = append(items, legendItem{Label: sectorZoneLabels[zone], Color: sectorZoneColors[zone]})
+        }
+    }
+
+    types := map[string]string{}
+    for _, e := range scene.Elements {
+        label, ok := elementTypeLabels[e.Type]
+        if !ok {
+            label = e.Type
+        }
+        if _, seen := types[label]; !seen {
+            types[label] = ElementColor(e)
+        }
+    }
+    labels := make([]string, 0, len(types))
+    for label := range types {
+        labels = append(labels, label)
+    }
+    sort.Strings(labels)
+    for _, label := range labels {
+        items = append(items, legendItem{Label: label, Color: types[label]})
+    }
+
+    if len(scene.Walls) > 0 {
+        items = append(items, legendItem{Label: "Стены", Color: wallColor, Line: true})
+    }
+    if len(scene.Closures) > 0 {
+        items = append(items, legendItem{Label: "Закрыто", Color: closureColor})
+    }
+    if plan := scene.Evacuation; plan != nil {
+        items = append(items,
+            legendItem{Label: fmt.Sprintf("До выхода не более %g м", plan.MaxDistance/2), Color: evacuationNearColor},
+            legendItem{Label: fmt.Sprintf("До выхода не более %g м", plan.MaxDistance), Color: evacuationFarColor},
+            legendItem{Label: fmt.Sprintf("До выхода более %g м", plan.MaxDistance), Color: evacuationViolationColor},
+            legendItem{Label: "Путь эвакуации", Color: evacuationRouteColor, Line: true})
+        if plan.Farthest < 0 {
+            items = append(items, legendItem{Label: "Нет пути к выходу", Color: evacuationUnreachableColor})
+        }
+    }
+    if coverage := scene.Coverage; coverage != nil {
+        items = append(items,
+            legendItem{Label: fmt.Sprintf("Видно %d и более маячков", coverage.MinBeacons), Color: coverageGoodColor},
+            legendItem{Label: fmt.Sprintf("Видно 1-%d маячка", coverage.MinBeacons-1), Color: coveragePartialColor},
+            legendItem{Label: "Нет сигнала маячков", Color: coverageNoneColor},
+            legendItem{Label: "Маячок", Color: coverageBeaconColor})
+        if len(coverage.Suggestions) > 0 {
+            items = append(items, legendItem{Label: "Предлагаемый маячок", Color: coverageSuggestionColor})
+        }
+    }
+    if len(scene.Route) > 1 {
+        items = append(items, legendItem{Label: "Маршрут", Color: routeColor, Line: true})
+    }
+    if scene.Highlight != nil {
+        items = append(items, legendItem{Label: scene.Highlight.Label, Color: highlightColor})
+    }
+    return items
+}
+
+// RenderPDF выводит печатную карту: шапка с названием и адресом магазина,
+// карта в масштабе, легенда и указатель товаров по секторам
+func RenderPDF(w io.Writer, scene *MapScene, index []SectorProducts, opts PDFOptions) error {
+    const margin = 10.0
+    bounds := scene.Bounds().Expand(0.5)
+
+    size := strings.ToUpper(opts.PageSize)
+    if size != "A3" {
+        size = "A4"
+    }
+    orientation := "P"
+    switch opts.Orientation {
+    case "landscape":
+        orientation = "L"
+    case "":
+        if bounds.MaxX-bounds.MinX > bounds.MaxY-bounds.MinY {
+            orientation = "L"
+        }
+    }
+
+    pdf := fpdf.New(orientation, "mm", size, "")
+    pdf.SetTitle(scene.Store.Name, true)
+    pdf.AddUTF8FontFromBytes(pdfFontFamily, "", goregular.TTF)
+    pdf.AddUTF8FontFromBytes(pdfFontFamily, "B", gobold.TTF)
+    pdf.SetMargins(margin, margin, margin)
+    pdf.SetAutoPageBreak(false, margin)
+    pdf.AddPage()
+    pageW, pageH := pdf.GetPageSize()
+
+    // Шапка
+    pdf.SetTextColor(33, 33, 33)
+    pdf.SetFont(pdfFontFamily, "B", 16)
+    pdf.Text(margin, margin+6, scene.Store.Name)
+    pdf.SetFont(pdfFontFamily, "", 10)
+    pdf.Text(margin, margin+12, scene.Store.Address)
+
+    // Раскладка легенды: считаем число строк заранее, чтобы отдать остальное карте
+    legend := buildLegend(scene)
+    const swatch, rowHeight, gap, legendFontSize = 4.0, 6.0, 6.0, 9.0
+    // Ширина подписей считается тем же шрифтом, которым легенда выводится
+    pdf.SetFont(pdfFontFamily, "", legendFontSize)
+    rows, x := 1, margin
+    for _, item := range legend {
+        itemWidth := swatch + 2 + pdf.GetStringWidth(item.Label) + gap
+        if x+itemWidth > pageW-margin && x > margin {
+            rows++
+            x = margin
+        }
+        x += itemWidth
+    }
+    legendHeight := float64(rows)*rowHeight + 2
+
+    boxX, boxY := margin, margin+16
+    boxW, boxH := pageW-2*margin, pageH-boxY-margin-legendHeight
+    // Легенда, которая заняла бы больше половины места под карту, не выводится
+    if boxH < (pageH-boxY-margin)/2 {
+        legend = nil
+        boxH = pageH - boxY - margin
+    }
+    mmPerMeter := math.Min(boxW/(bounds.MaxX-bounds.MinX), boxH/(bounds.MaxY-bounds.MinY))
+    t := MapTransform{
+        Scale:   mmPerMeter,
+        OriginX: boxX + (boxW-(bounds.MaxX-bounds.MinX)*mmPerMeter)/2 - bounds.MinX*mmPerMeter,
+        OriginY: boxY + (boxH-(bounds.MaxY-bounds.MinY)*mmPerMeter)/2 - bounds.MinY*mmPerMeter,
+    }
+
+    pdf.SetFont(pdfFontFamily, "", 9)
+    info := fmt.Sprintf("Масштаб 1:%d · %s", int(math.Round(1000/mmPerMeter)), time.Now().Format("02.01.2006"))
+    pdf.Text(pageW-margin-pdf.GetStringWidth(info), margin+12, info)
+
+    pdf.ClipRect(boxX, boxY, boxW, boxH, false)
+    paintScene(&pdfPainter{pdf: pdf, t: t}, scene)
+    pdf.ClipEnd()
+    pdf.SetDrawColor(158, 158, 158)
+    pdf.SetLineWidth(0.2)
+    pdf.Rect(boxX, boxY, boxW, boxH, "D")
+
+    // Легенда
+    pdf.SetFont(pdfFontFamily, "", legendFontSize)
+    pdf.SetTextColor(33, 33, 33)
+    x, y := margin, boxY+boxH+4
+    for _, item := range legend {
+        itemWidth := swatch + 2 + pdf.GetStringWidth(item.Label) + gap
+        if x+itemWidth > pageW-margin && x > margin {
+            x, y = margin, y+rowHeight
+        }
+        rgba := ParseColor(item.Color)
+        if item.Line {
+            pdf.SetDrawColor(int(rgba.R), int(rgba.G), int(rgba.B))
+            pdf.SetLineWidth(1)
+            pdf.Line(x, y+swatch/2, x+swatch, y+swatch/2)
+        } else {
+            pdf.SetFillColor(int(rgba.R), int(rgba.G), int(rgba.B))
+            pdf.SetDrawColor(97, 97, 97)
+            pdf.SetLineWidth(0.1)
+            pdf.Rect(x, y, swatch, swatch, "FD")
+        }
+        pdf.Text(x+swatch+2, y+swatch-0.5, item.Label)
+        x += itemWidth
+    }
+
+    writeProductIndex(pdf, index)
+
+    if err := pdf.Error(); err != nil {
+        return err
+    }
+    return pdf.Output(w)
+}
+
+// writeProductIndex добавляет страницы с перечнем товаров по секторам
+func writeProductIndex(pdf *fpdf.Fpdf, index []SectorProducts) {
+    hasProducts := false
+    for _, entry := range index {
+        hasProducts = hasProducts || len(entry.Products) > 0
+    }
+    if !hasProducts {
+        return
+    }
+
+    left, _, right, bottom := pdf.GetMargins()
+    pdf.SetAutoPageBreak(true, bottom)
+    pdf.AddPage()
+    pageW, _ := pdf.GetPageSize()
+    width := pageW - left - right
+
+    pdf.SetTextColor(33, 33, 33)
+    pdf.SetFont(pdfFontFamily, "B", 14)
+    pdf.CellFormat(width, 10, "Указатель товаров", "", 1, "L", false, 0, "")
+
+    for _, entry := range index {
+        if len(entry.Products) == 0 {
+            continue
+        }
+        pdf.Ln(2)
+        pdf.SetFont(pdfFontFamily, "B", 11)
+        pdf.SetFillColor(227, 242, 253)
+        pdf.CellFormat(width, 7, strings.Join(entry.Path, " / "), "", 1, "L", true, 0, "")
+        pdf.SetFont(pdfFontFamily, "", 10)
+        for _, product := range entry.Products {
+            pdf.CellFormat(width-35, 5.5, product.Name, "B", 0, "L", false, 0, "")
+            pdf.CellFormat(35, 5.5, fmt.Sprintf("%.2f руб.", product.Price), "B", 1, "R", false, 0, "")
+        }
+    }
+}
@@ -0,0 +1,493 @@
+package services
+
+import (
+    "bufio"
+    "fmt"
+    "html"
+    "io"
+    "math"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+// Цвета секторов по уровню вложенности
+var sectorLevelColors = []string{"#e3f2fd", "#bbdefb", "#90caf9", "#64b5f6"}
+
+// Заливка, обводка и подписи в легенде секторов с температурным режимом
+var sectorZoneColors = map[string]string{
+    models.TemperatureChilled: "#b2ebf2",
+    models.TemperatureFrozen:  "#c5cae9",
+}
+
+var sectorZoneStrokes = map[string]string{
+    models.TemperatureChilled: "#00838f",
+    models.TemperatureFrozen:  "#283593",
+}
+
+var sectorZoneLabels = map[string]string{
+    models.TemperatureChilled: "Охлаждаемая зона",
+    models.TemperatureFrozen:  "Зона заморозки",
+}
+
+// Цвета и подписи элементов карты по типу (как в редакторе карты админки)
+var elementTypeColors = map[string]string{
+    "sector":   "#4CAF50",
+    "wall":     "#795548",
+    "cashier":  "#FF9800",
+    "beacon":   "#2196F3",
+    "entrance": "#8BC34A",
+    "exit":     "#F44336",
+    "passage":  "#9E9E9E",
+    "promo":    "#E91E63",
+}
+
+var elementTypeLabels = map[string]string{
+    "sector":   "Сектор",
+    "wall":     "Стена",
+    "cashier":  "Касса",
+    "beacon":   "Маячок",
+    "entrance": "Вход",
+    "exit":     "Выход",
+    "passage":  "Проход",
+    "promo":    "Акция",
+}
+
+const (
+    routeColor     = "#d32f2f"
+    highlightColor = "#ff6f00"
+    wallColor      = "#424242"
+    fixtureColor   = "#d7ccc8"
+    closureColor   = "#e5393580"
+    closureStroke  = "#c62828"
+)
+
+// MapHighlight - выделенное место на карте (например, расположение товара)
+type MapHighlight struct {
+    Label    string      `json:"label"`
+    Point    utils.Point `json:"point"`
+    SectorID uint        `json:"sector_id"`
+}
+
+// MapScene - данные магазина, необходимые для отрисовки карты
+type MapScene struct {
+    Store     models.Store
+    Config    models.StoreMapConfig
+    FloorID   *uint // Этаж сцены, nil - все этажи
+    Sectors   []models.Sector // Корневые секторы с вложенными SubSectors
+    Walls     []models.Wall
+    Elements  []models.MapElement
+    Fixtures  []models.Fixture
+    Closures  []models.Closure // Действующие временные закрытия
+    Evacuation *EvacuationPlan // План эвакуации поверх карты
+    Coverage   *CoverageMap    // Карта покрытия маячками поверх карты
+    Route     []utils.Point
+    Highlight *MapHighlight
+}
+
+type MapRenderService struct {
+    db *gorm.DB
+}
+
+func NewMapRenderService(db *gorm.DB) *MapRenderService {
+    return &MapRenderService{db: db}
+}
+
+// LoadScene загружает геометрию магазина для отрисовки. floorID ограничивает сцену одним этажом,
+// nil - все объекты магазина
+func (s *MapRenderService) LoadScene(storeID uint, floorID *uint) (*MapScene, error) {
+    scene := &MapScene{FloorID: floorID}
+    if err := s.db.First(&scene.Store, storeID).Error; err != nil {
+        return nil, err
+    }
+    floor, err := onFloor(s.db, storeID, floorID)
+    if err != nil {
+        return nil, err
+    }
+
+    // Конфигурация не обязательна - без нее используется масштаб по умолчанию
+    scene.Config, _ = storeMapConfig(s.db, storeID, floorID)
+
+    var sectors []models.Sector
+    if err := s.db.Scopes(floor).Where("store_id = ?", storeID).Order("level, id").Find(&sectors).Error; err != nil {
+        return nil, err
+    }
+    scene.Sectors = BuildSectorTree(sectors)
+
+    if err := s.db.Scopes(floor).Where("store_id = ?", storeID).Find(&scene.Walls).Error; err != nil {
+        return nil, err
+    }
+    if err := s.db.Scopes(VisibleElements(time.Now()), floor).Where("store_id = ?", storeID).Find(&scene.Elements).Error; err != nil {
+        return nil, err
+    }
+    // Стеллажи относятся к этажу своего сектора
+    fixtures := s.db.Where("store_id = ?", storeID)
+    if floorID != nil {
+        ids := make([]uint, len(sectors))
+        for i, sector := range sectors {
+            ids[i] = sector.ID
+        }
+        fixtures = fixtures.Where("sector_id IN ?", append(ids, 0))
+    }
+    if err := fixtures.Find(&scene.Fixtures).Error; err != nil {
+        return nil, err
+    }
+    if scene.Closures, err = activeClosures(s.db, storeID, floorID, time.Now()); err != nil {
+        return nil, err
+    }
+    return scene, nil
+}
+
+// HighlightProduct отмечает на карте место товара: полку по планограмме или сектор
+func (s *MapRenderService) HighlightProduct(scene *MapScene, productID uint) error {
+    var product models.Product
+    if err := s.db.First(&product, productID).Error; err != nil {
+        return err
+    }
+    var sector models.Sector
+    if err := s.db.Where("id = ? AND store_id = ?", product.SectorID, scene.Store.ID).First(&sector).Error; err != nil {
+        return err
+    }
+    location, err := locateProduct(s.db, &product)
+    if err != nil {
+        return err
+    }
+
+    scene.Highlight = &MapHighlight{
+        Label:    product.Name,
+        Point:    location.Point,
+        SectorID: sector.ID,
+    }
+    return nil
+}
+
+// BuildSectorTree собирает плоский список секторов в дерево по ParentID
+func BuildSectorTree(sectors []models.Sector) []models.Sector {
+    children := make(map[uint][]models.Sector)
+    known := make(map[uint]bool, len(sectors))
+    for _, sector := range sectors {
+        known[sector.ID] = true
+    }
+
+    var roots []models.Sector
+    for _, sector := range sectors {
+        if sector.ParentID == nil || !known[*sector.ParentID] {
+            roots = append(roots, sector)
+        } else {
+            children[*sector.ParentID] = append(children[*sector.ParentID], sector)
+        }
+    }
+
+    var attach func(list []models.Sector) []models.Sector
+    attach = func(list []models.Sector) []models.Sector {
+        for i := range list {
+            list[i].SubSectors = attach(children[list[i].ID])
+        }
+        return list
+    }
+    return attach(roots)
+}
+
+// WalkSectors обходит дерево секторов в глубину, передавая путь из названий от корня
+func WalkSectors(roots []models.Sector, fn func(sector models.Sector, path []string)) {
+    var walk func(list []models.Sector, parent []string)
+    walk = func(list []models.Sector, parent []string) {
+        for _, sector := range list {
+            path := append(append([]string(nil), parent...), sector.Name)
+            fn(sector, path)
+            walk(sector.SubSectors, path)
+        }
+    }
+    walk(roots, nil)
+}
+
+// SectorProducts - товары сектора для указателя на печатной карте
+type SectorProducts struct {
+    SectorID uint             `json:"sector_id"`
+    Path     []string         `json:"path"`
+    Products []models.Product `json:"products"`
+}
+
+// LoadProductIndex загружает товары всех секторов сцены в порядке обхода дерева
+func (s *MapRenderService) LoadProductIndex(scene *MapScene) ([]SectorProducts, error) {
+    var index []SectorProducts
+    WalkSectors(scene.Sectors, func(sector models.Sector, path []string) {
+        index = append(index, SectorProducts{SectorID: sector.ID, Path: path})
+    })
+    if len(index) == 0 {
+        return nil, nil
+    }
+
+    ids := make([]uint, len(index))
+    for i, entry := range index {
+        ids[i] = entry.SectorID
+    }
+    var products []models.Product
+    if err := s.db.Where("sector_id IN ?", ids).Order("name").Find(&products).Error; err != nil {
+        return nil, err
+    }
+
+    bySector := make(map[uint][]models.Product)
+    for _, product := range products {
+        bySector[product.SectorID] = append(bySector[product.SectorID], product)
+    }
+    for i := range index {
+        index[i].Products = bySector[index[i].SectorID]
+    }
+    return index, nil
+}
+
+// Bounds возвращает габариты всех объектов карты в метрах
+func (scene *MapScene) Bounds() utils.Rect {
+    bounds := utils.Rect{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+    add := func(r utils.Rect) {
+        bounds.MinX = math.Min(bounds.MinX, r.MinX)
+        bounds.MinY = math.Min(bounds.MinY, r.MinY)
+        bounds.MaxX = math.Max(bounds.MaxX, r.MaxX)
+        bounds.MaxY = math.Max(bounds.MaxY, r.MaxY)
+    }
+
+    var addSectors func(list []models.Sector)
+    addSectors = func(list []models.Sector) {
+        for _, sector := range list {
+            add(utils.Rect{MinX: sector.PositionX, MinY: sector.PositionY, MaxX: sector.PositionX + sector.Width, MaxY: sector.PositionY + sector.Height})
+            addSectors(sector.SubSectors)
+        }
+    }
+    addSectors(scene.Sectors)
+
+    for _, w := range scene.Walls {
+        add(utils.Rect{MinX: math.Min(w.StartX, w.EndX), MinY: math.Min(w.StartY, w.EndY), MaxX: math.Max(w.StartX, w.EndX), MaxY: math.Max(w.StartY, w.EndY)})
+    }
+    for _, e := range scene.Elements {
+        add(utils.RotatedBounds(e.PositionX, e.PositionY, e.Width, e.Height, e.Rotation))
+    }
+    for _, f := range scene.Fixtures {
+        add(utils.RotatedBounds(f.PositionX, f.PositionY, f.Width, f.Depth, f.Rotation))
+    }
+    for _, p := range scene.Route {
+        add(utils.Rect{MinX: p.X, MinY: p.Y, MaxX: p.X, MaxY: p.Y})
+    }
+
+    if math.IsInf(bounds.MinX, 1) {
+        return utils.Rect{MaxX: 50, MaxY: 30} // Пустой магазин - размеры по умолчанию
+    }
+    return bounds
+}
+
+// Canvas возвращает размер холста в пикселях и преобразование координат.
+// Если карта не откалибрована, холст подбирается по габаритам объектов
+func (scene *MapScene) Canvas() (float64, float64, MapTransform) {
+    transform := NewMapTransform(scene.Config)
+    if scene.Config.MapWidth > 0 && scene.Config.MapHeight > 0 {
+        return scene.Config.MapWidth, scene.Config.MapHeight, transform
+    }
+
+    const margin = 1.0 // Поля вокруг объектов в метрах
+    bounds := scene.Bounds().Expand(margin)
+    transform.Rotation = 0
+    transform.OriginX = -bounds.MinX * transform.Scale
+    transform.OriginY = -bounds.MinY * transform.Scale
+    return (bounds.MaxX - bounds.MinX) * transform.Scale, (bounds.MaxY - bounds.MinY) * transform.Scale, transform
+}
+
+// SectorColor возвращает цвет заливки сектора по уровню вложенности
+func SectorColor(level int) string {
+    if level < 0 {
+        level = 0
+    }
+    if level >= len(sectorLevelColors) {
+        level = len(sectorLevelColors) - 1
+    }
+    return sectorLevelColors[level]
+}
+
+// SectorFill возвращает заливку сектора: цвет температурной зоны или цвет уровня вложенности
+func SectorFill(sector models.Sector) string {
+    if color, ok := sectorZoneColors[sector.TemperatureZone]; ok {
+        return color
+    }
+    return SectorColor(sector.Level)
+}
+
+// sectorStroke возвращает обводку сектора: выделенного, с температурной зоной или обычного
+func sectorStroke(scene *MapScene, sector models.Sector) (string, float64) {
+    if scene.Highlight != nil && scene.Highlight.SectorID == sector.ID {
+        return highlightColor, 0.15
+    }
+    if color, ok := sectorZoneStrokes[sector.TemperatureZone]; ok {
+        return color, 0.1
+    }
+    return "#1976d2", 0.05
+}
+
+// ElementColor возвращает цвет элемента карты
+func ElementColor(e models.MapElement) string {
+    if e.Color != "" {
+        return e.Color
+    }
+    if color, ok := elementTypeColors[e.Type]; ok {
+        return color
+    }
+    return "#4CAF50"
+}
+
+// RenderSVG выводит карту магазина в формате SVG. Геометрия задается в метрах,
+// перевод в пиксели выполняется матрицей преобразования группы
+func RenderSVG(w io.Writer, scene *MapScene) error {
+    out := bufio.NewWriter(w)
+    width, height, t := scene.Canvas()
+
+    sin, cos := math.Sincos(t.Rotation * math.Pi / 180)
+    fmt.Fprintf(out, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+    fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.2f %.2f" font-family="sans-serif">`+"\n",
+        width, height, width, height)
+    fmt.Fprintf(out, "<title>%s</title>\n", html.EscapeString(scene.Store.Name))
+    fmt.Fprintf(out, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+    fmt.Fprintf(out, `<g transform="matrix(%.6f %.6f %.6f %.6f %.4f %.4f)">`+"\n",
+        t.Scale*cos, t.Scale*sin, -t.Scale*sin, t.Scale*cos, t.OriginX, t.OriginY)
+
+    // Секторы: родитель рисуется первым, подсекторы - поверх него
+    var drawSectors func(list []models.Sector)
+    drawSectors = func(list []models.Sector) {
+        for _, sector := range list {
+            stroke, strokeWidth := sectorStroke(scene, sector)
+            class := fmt.Sprintf("sector level-%d", sector.Level)
+            if _, ok := sectorZoneColors[sector.TemperatureZone]; ok {
+                class += " zone-" + sector.TemperatureZone
+            }
+            fmt.Fprintf(out, `<g class="%s" data-id="%d">`+"\n", class, sector.ID)
+            fmt.Fprintf(out, `<rect x="%.3f" y="%.3f" width="%.3f" height="%.3f" fill="%s" stroke="%s" stroke-width="%.2f"/>`+"\n",
+                sector.PositionX, sector.PositionY, sector.Width, sector.Height, SectorFill(sector), stroke, strokeWidth)
+            if sector.Name != "" {
+                fmt.Fprintf(out, `<text x="%.3f" y="%.3f" font-size="%.2f" fill="#0d47a1">%s</text>`+"\n",
+                    sector.PositionX+0.2, sector.PositionY+0.6, 0.5/float64(sector.Level+1), html.EscapeString(sector.Name))
+            }
+            drawSectors(sector.SubSectors)
+            fmt.Fprintf(out, "</g>\n")
+        }
+    }
+    fmt.Fprintf(out, `<g id="sectors">`+"\n")
+    drawSectors(scene.Sectors)
+    fmt.Fprintf(out, "</g>\n")
+
+    fmt.Fprintf(out, `<g id="elements">`+"\n")
+    for _, e := range scene.Elements {
+        cx, cy := e.PositionX+e.Width/2, e.PositionY+e.Height/2
+        fmt.Fprintf(out, `<rect class="element %s" x="%.3f" y="%.3f" width="%.3f" height="%.3f" fill="%s" stroke="#616161" stroke-width="0.03" transform="rotate(%.2f %.3f %.3f)"/>`+"\n",
+            html.EscapeString(e.Type), e.PositionX, e.PositionY, e.Width, e.Height, html.EscapeString(ElementColor(e)), e.Rotation, cx, cy)
+        if e.Name != "" {
+            fmt.Fprintf(out, `<text x="%.3f" y="%.3f" font-size="0.35" text-anchor="middle" fill="#212121">%s</text>`+"\n",
+                cx, cy+0.12, html.EscapeString(e.Name))
+        }
+    }
+    fmt.Fprintf(out, "</g>\n")
+
+    fmt.Fprintf(out, `<g id="fixtures">`+"\n")
+    for _, f := range scene.Fixtures {
+        cx, cy := f.PositionX+f.Width/2, f.PositionY+f.Depth/2
+        fmt.Fprintf(out, `<rect class="fixture %s" data-id="%d" x="%.3f" y="%.3f" width="%.3f" height="%.3f" fill="%s" stroke="#8d6e63" stroke-width="0.02" transform="rotate(%.2f %.3f %.3f)"/>`+"\n",
+            html.EscapeString(f.Type), f.ID, f.PositionX, f.PositionY, f.Width, f.Depth, fixtureColor, f.Rotation, cx, cy)
+    }
+    fmt.Fprintf(out, "</g>\n")
+
+    fmt.Fprintf(out, `<g id="walls" stroke="%s" stroke-linecap="square">`+"\n", wallColor)
+    for _, wall := range scene.Walls {
+        thickness := wall.Thickness
+        if thickness <= 0 {
+            thickness = 0.1
+        }
+        fmt.Fprintf(out, `<line x1="%.3f" y1="%.3f" x2="%.3f" y2="%.3f" stroke-width="%.3f"/>`+"\n",
+            wall.StartX, wall.StartY, wall.EndX, wall.EndY, thickness)
+    }
+    fmt.Fprintf(out, "</g>\n")
+
+    if plan := scene.Evacuation; plan != nil {
+        fmt.Fprintf(out, `<g id="evacuation">`+"\n")
+        for _, band := range plan.bands() {
+            p := band.points
+            fmt.Fprintf(out, `<rect x="%.3f" y="%.3f" width="%.3f" height="%.3f" fill="%s"/>`+"\n",
+                p[0].X, p[0].Y, p[1].X-p[0].X, p[2].Y-p[0].Y, band.color)
+        }
+        fmt.Fprintf(out, `<defs><marker id="evacuation-arrow" viewBox="0 0 10 10" refX="8" refY="5" markerWidth="4" markerHeight="4" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="%s"/></marker></defs>`+"\n", evacuationRouteColor)
+        for _, route := range plan.Routes {
+            fmt.Fprintf(out, `<polyline fill="none" stroke="%s" stroke-width="0.15" stroke-linejoin="round" marker-end="url(#evacuation-arrow)" points="`, evacuationRouteColor)
+            for i, p := range route.Points {
+                if i > 0 {
+                    fmt.Fprint(out, " ")
+                }
+                fmt.Fprintf(out, "%.3f,%.3f", p.X, p.Y)
+            }
+            fmt.Fprintf(out, `"/>`+"\n")
+        }
+        for _, exit := range plan.Exits {
+            fmt.Fprintf(out, `<circle cx="%.3f" cy="%.3f" r="0.5" fill="%s"/>`+"\n", exit.Point.X, exit.Point.Y, evacuationRouteColor)
+            fmt.Fprintf(out, `<text x="%.3f" y="%.3f" font-size="0.45" text-anchor="middle" font-weight="bold" fill="%s">%s</text>`+"\n",
+                exit.Point.X, exit.Point.Y-0.7, evacuationRouteColor, html.EscapeString(evacuationExitLabel(exit)))
+        }
+        fmt.Fprintf(out, "</g>\n")
+    }
+
+    if coverage := scene.Coverage; coverage != nil {
+        fmt.Fprintf(out, `<g id="coverage">`+"\n")
+        for _, band := range coverage.bands() {
+            p := band.points
+            fmt.Fprintf(out, `<rect x="%.3f" y="%.3f" width="%.3f" height="%.3f" fill="%s"/>`+"\n",
+                p[0].X, p[0].Y, p[1].X-p[0].X, p[2].Y-p[0].Y, band.color)
+        }
+        for _, beacon := range coverage.Beacons {
+            fmt.Fprintf(out, `<circle class="beacon" data-id="%d" cx="%.3f" cy="%.3f" r="0.35" fill="%s"/>`+"\n",
+                beacon.ID, beacon.Point.X, beacon.Point.Y, coverageBeaconColor)
+        }
+        for i, suggestion := range coverage.Suggestions {
+            fmt.Fprintf(out, `<circle class="suggestion" cx="%.3f" cy="%.3f" r="0.35" fill="#ffffff" stroke="%s" stroke-width="0.1" stroke-dasharray="0.15 0.1"/>`+"\n",
+                suggestion.Point.X, suggestion.Point.Y, coverageSuggestionColor)
+            fmt.Fprintf(out, `<text x="%.3f" y="%.3f" font-size="0.45" text-anchor="middle" font-weight="bold" fill="%s">+%d</text>`+"\n",
+                suggestion.Point.X, suggestion.Point.Y-0.55, coverageSuggestionColor, i+1)
+        }
+        fmt.Fprintf(out, "</g>\n")
+    }
+
+    if len(scene.Closures) > 0 {
+        fmt.Fprintf(out, `<g id="closures" fill="%s" stroke="%s" stroke-width="0.05" stroke-dasharray="0.2 0.1">`+"\n", closureColor, closureStroke)
+        for _, closure := range scene.Closures {
+            fmt.Fprintf(out, `<polygon class="closure %s" data-id="%d" points="`, html.EscapeString(closure.Reason), closure.ID)
+            for i, p := range closure.Points {
+                if i > 0 {
+                    fmt.Fprint(out, " ")
+                }
+                fmt.Fprintf(out, "%.3f,%.3f", p.X, p.Y)
+            }
+            fmt.Fprintf(out, `"/>`+"\n")
+        }
+        fmt.Fprintf(out, "</g>\n")
+    }
+
+    if len(scene.Route) > 1 {
+        fmt.Fprintf(out, `<g id="route"><polyline fill="none" stroke="%s" stroke-width="0.25" stroke-linejoin="round" stroke-linecap="round" points="`, routeColor)
+        for i, p := range scene.Route {
+            if i > 0 {
+                fmt.Fprint(out, " ")
+            }
+            fmt.Fprintf(out, "%.3f,%.3f", p.X, p.Y)
+        }
+        start, end := scene.Route[0], scene.Route[len(scene.Route)-1]
+        fmt.Fprintf(out, `"/>`+"\n")
+        fmt.Fprintf(out, `<circle cx="%.3f" cy="%.3f" r="0.35" fill="#388e3c"/>`+"\n", start.X, start.Y)
+        fmt.Fprintf(out, `<circle cx="%.3f" cy="%.3f" r="0.35" fill="%s"/>`+"\n", end.X, end.Y, routeColor)
+        fmt.Fprintf(out, "</g>\n")
+    }
+
+    if h := scene.Highlight; h != nil {
+        fmt.Fprintf(out, `<g id="highlight"><circle cx="%.3f" cy="%.3f" r="0.45" fill="%s" stroke="#ffffff" stroke-width="0.1"/>`+"\n",
+            h.Point.X, h.Point.Y, highlightColor)
+        fmt.Fprintf(out, `<text x="%.3f" y="%.3f" font-size="0.5" text-anchor="middle" font-weight="bold" fill="%s">%s</text></g>`+"\n",
+            h.Point.X, h.Point.Y-0.7, highlightColor, html.EscapeString(h.Label))
+    }
+
+    fmt.Fprintf(out, "</g>\n</svg>\n")
+    return out.Flush()
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+// Слои карты, которые можно запросить в области просмотра
+const (
+    LayerSectors  = "sectors"
+    LayerWalls    = "walls"
+    LayerElements = "elements"
+    LayerBeacons  = "beacons"
+    LayerClosures = "closures"
+)
+
+var AllMapLayers = []string{LayerSectors, LayerWalls, LayerElements, LayerBeacons, LayerClosures}
+
+type MapService struct {
+    db *gorm.DB
+}
+
+func NewMapService(db *gorm.DB) *MapService {
+    return &MapService{db: db}
+}
+
+// ViewportQuery - параметры выборки объектов карты в прямоугольной области
+type ViewportQuery struct {
+    StoreID uint
+    FloorID *uint // Этаж, nil - все этажи
+    Area    utils.Rect
+    Types   []string // Фильтр по MapElement.Type, пустой - все типы
+    Layers  []string // Запрошенные слои, пустой - все слои
+}
+
+// Viewport - объекты карты, пересекающие область просмотра
+type Viewport struct {
+    Area     utils.Rect          `json:"area"`
+    Sectors  []models.Sector     `json:"sectors,omitempty"`
+    Walls    []models.Wall       `json:"walls,omitempty"`
+    Elements []models.MapElement `json:"elements,omitempty"`
+    Beacons  []models.Beacon     `json:"beacons,omitempty"`
+    Closures []models.Closure    `json:"closures,omitempty"`
+}
+
+// SplitList разбирает список значений через запятую из параметра запроса
+func SplitList(s string) []string {
+    var items []string
+    for _, item := range strings.Split(s, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
+
+func (q ViewportQuery) hasLayer(layer string) bool {
+    if len(q.Layers) == 0 {
+        return true
+    }
+    for _, l := range q.Layers {
+        if l == layer {
+            return true
+        }
+    }
+    return false
+}
+
+// GetViewport возвращает секторы, стены, элементы карты и маячки магазина,
+// пересекающие заданную область
+func (ms *MapService) GetViewport(q ViewportQuery) (*Viewport, error) {
+    vp := &Viewport{Area: q.Area}
+    floor, err := onFloor(ms.db, q.StoreID, q.FloorID)
+    if err != nil {
+        return nil, err
+    }
+
+    if q.hasLayer(LayerSectors) {
+        if err := ms.db.Scopes(floor).Where("store_id = ? AND position_x <= ? AND position_x + width >= ? AND position_y <= ? AND position_y + height >= ?",
+            q.StoreID, q.Area.MaxX, q.Area.MinX, q.Area.MaxY, q.Area.MinY).
+            Order("level, id").Find(&vp.Sectors).Error; err != nil {
+            return nil, err
+        }
+    }
+
+    if q.hasLayer(LayerWalls) {
+        var walls []models.Wall
+        if err := ms.db.Scopes(floor).Where("store_id = ?", q.StoreID).Find(&walls).Error; err != nil {
+            return nil, err
+        }
+        for _, w := range walls {
+            if utils.SegmentIntersectsRect(w.StartX, w.StartY, w.EndX, w.EndY, q.Area.Expand(w.Thickness/2)) {
+                vp.Walls = append(vp.Walls, w)
+            }
+        }
+    }
+
+    if q.hasLayer(LayerElements) {
+        elements, err := filterElements(ms.db.Scopes(VisibleElements(time.Now()), floor), q.StoreID, &q.Area, q.Types)
+        if err != nil {
+            return nil, err
+        }
+        vp.Elements = elements
+    }
+
+    if q.hasLayer(LayerBeacons) {
+        if err := ms.db.Scopes(floor).Where("store_id = ? AND position_x BETWEEN ? AND ? AND position_y BETWEEN ? AND ?",
+            q.StoreID, q.Area.MinX, q.Area.MaxX, q.Area.MinY, q.Area.MaxY).
+            Find(&vp.Beacons).Error; err != nil {
+            return nil, err
+        }
+    }
+
+    if q.hasLayer(LayerClosures) {
+        closures, err := activeClosures(ms.db, q.StoreID, q.FloorID, time.Now())
+        if err != nil {
+            return nil, err
+        }
+        for _, closure := range closures {
+            if utils.PolygonBounds(closurePolygon(closure)).Intersects(q.Area) {
+                vp.Closures = append(vp.Closures, closure)
+            }
+        }
+    }
+
+    return vp, nil
+}
+
+// FilterElements возвращает элементы карты магазина с учетом типа и,
+// если задана, области (с учетом поворота элемента)
+func (ms *MapService) FilterElements(storeID uint, area *utils.Rect, types []string) ([]models.MapElement, error) {
+    return filterElements(ms.db, storeID, area, types)
+}
+
+// VisibleElements оставляет элементы карты, которые покупатель видит в момент now
+func VisibleElements(now time.Time) func(*gorm.DB) *gorm.DB {
+    return func(db *gorm.DB) *gorm.DB {
+        return db.Where("(visible_from IS NULL OR visible_from <= ?) AND (visible_to IS NULL OR visible_to > ?)", now, now)
+    }
+}
+
+func filterElements(db *gorm.DB, storeID uint, area *utils.Rect, types []string) ([]models.MapElement, error) {
+    query := db.Where("store_id = ?", storeID)
+    if len(types) > 0 {
+        query = query.Where("type IN ?", types)
+    }
+
+    var elements []models.MapElement
+    if err := query.Find(&elements).Error; err != nil {
+        return nil, err
+    }
+    if area == nil {
+        return elements, nil
+    }
+
+    filtered := make([]models.MapElement, 0, len(elements))
+    for _, e := range elements {
+        if utils.RotatedBounds(e.PositionX, e.PositionY, e.Width, e.Height, e.Rotation).Intersects(*area) {
+            filtered = append(filtered, e)
+        }
+    }
+    return filtered, nil
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+)
+
+var (
+    ErrOrderNotFound     = errors.New("order not found")
+    ErrOrderInPicking    = errors.New("order is already being picked")
+    ErrPickingNotFound   = errors.New("picking batch not found")
+    ErrPickingClosed     = errors.New("picking batch is completed")
+    ErrOrderLineNotFound = errors.New("order line not found in picking batch")
+)
+
+// OrderValidationError перечисляет ошибки в заказе, сборке или отметке строки
+type OrderValidationError struct {
+    Errors []string
+}
+
+func (e *OrderValidationError) Error() string {
+    return "invalid order data: " + strings.Join(e.Errors, "; ")
+}
+
+// PickLine - строка заказа в остановке сборки
+type PickLine struct {
+    LineID         uint   `json:"line_id"`
+    OrderID        uint   `json:"order_id"`
+    OrderNumber    string `json:"order_number"`
+    Quantity       int    `json:"quantity"`
+    PickedQuantity int    `json:"picked_quantity"`
+    Status         string `json:"status"`
+}
+
+// PickItem - остановка обхода: товар и строки всех заказов сборки с ним
+type PickItem struct {
+    Sequence    int             `json:"sequence"` // Порядковый номер в обходе, с 1; 0 - товар не входит в обход
+    ProductID   uint            `json:"product_id"`
+    ProductName string          `json:"product_name"`
+    Zone        string          `json:"zone"` // Температурная зона
+    Heavy       bool            `json:"heavy"`
+    Fragile     bool            `json:"fragile"`
+    Bulky       bool            `json:"bulky"`
+    Location    ProductLocation `json:"location"`
+    Quantity    int             `json:"quantity"` // Всего по заказам
+    Lines       []PickLine      `json:"lines"`
+    Done        bool            `json:"done"`      // Все строки отмечены
+    Reachable   bool            `json:"reachable"` // К товару построен маршрут
+}
+
+// PickList - лист сборки: товары в порядке обхода и маршрут от старта через все товары и обратно
+type PickList struct {
+    Batch    models.PickingBatch `json:"batch"`
+    Orders   []models.Order      `json:"orders"`
+    Start    RouteEndpoint       `json:"start"`
+    Items    []PickItem          `json:"items"`
+    Legs     []RouteLeg          `json:"legs"`
+    Distance float64             `json:"distance"` // В метрах
+    Duration float64             `json:"duration"` // В секундах, без времени на снятие товара с полки
+}
+
+type PickingService struct {
+    db *gorm.DB
+}
+
+func NewPickingService(db *gorm.DB) *PickingService {
+    return &PickingService{db: db}
+}
+
+// CreateOrder сохраняет новый заказ. Товары должны продаваться в магазине заказа
+func (s *PickingService) CreateOrder(order *models.Order) error {
+    order.Number = strings.TrimSpace(order.Number)
+    order.Status = models.OrderNew
+    order.PickingBatchID = nil
+
+    var errs []string
+    if len(order.Lines) == 0 {
+        errs = append(errs, "at least one line is required")
+    }
+    for i := range order.Lines {
+        line := &order.Lines[i]
+        line.ID, line.PickedQuantity, line.Status = 0, 0, models.OrderLinePending
+        if line.Quantity <= 0 {
+            errs = append(errs, fmt.Sprintf("line %d: quantity must be positive", i+1))
+        }
+        var product models.Product
+        err := s.db.Joins("JOIN sectors ON sectors.id = products.sector_id").
+            Where("products.id = ? AND sectors.store_id = ?", line.ProductID, order.StoreID).First(&product).Error
+        switch {
+        case errors.Is(err, gorm.ErrRecordNotFound):
+            errs = append(errs, fmt.Sprintf("line %d: product %d is not sold in the store", i+1, line.ProductID))
+        case err != nil:
+            return err
+        default:
+            line.ProductName = product.Name
+        }
+    }
+    if len(errs) > 0 {
+        return &OrderValidationError{Errors: errs}
+    }
+    return s.db.Create(order).Error
+}
+
+// ListOrders возвращает заказы магазина, status - фильтр по статусу (пустой - все)
+func (s *PickingService) ListOrders(storeID uint, status string) ([]models.Order, error) {
+    query := s.db.Preload("Lines").Where("store_id = ?", storeID)
+    if status != "" {
+        query = query.Where("status = ?", status)
+    }
+    var orders []models.Order
+    err := query.Order("created_at, id").Find(&orders).Error
+    return orders, err
+}
+
+func (s *PickingService) GetOrder(id uint) (*models.Order, error) {
+    var order models.Order
+    if err := s.db.Preload("Lines").First(&order, id).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrOrderNotFound
+        }
+        return nil, err
+    }
+    return &order, nil
+}
+
+// CancelOrder отменяет заказ, который еще не включен в сборку
+func (s *PickingService) CancelOrder(id uint) (*models.Order, error) {
+    order, err := s.GetOrder(id)
+    if err != nil {
+        return nil, err
+    }
+    if order.Status != models.OrderNew {
+        return nil, ErrOrderInPicking
+    }
+    order.Status = models.OrderCancelled
+    if err := s.db.Model(order).Update("status", order.Status).Error; err != nil {
+        return nil, err
+    }
+    return order, nil
+}
+
+// CreateBatch объединяет новые заказы магазина в одну сборку
+func (s *PickingService) CreateBatch(storeID uint, orderIDs []uint, picker string) (*models.PickingBatch, error) {
+    var errs []string
+    if len(orderIDs) == 0 {
+        errs = append(errs, "order_ids must not be empty")
+    }
+    var orders []models.Order
+    if err := s.db.Where("id IN ?", orderIDs).Find(&orders).Error; err != nil {
+        return nil, err
+    }
+    found := make(map[uint]models.Order, len(orders))
+    for _, order := range orders {
+        found[order.ID] = order
+    }
+    for _, id := range orderIDs {
+        order, ok := found[id]
+        switch {
+        case !ok || order.StoreID != storeID:
+            errs = append(errs, fmt.Sprintf("order %d not found in the store", id))
+        case order.Status != models.OrderNew:
+            errs = append(errs, fmt.Sprintf("order %d is %s", id, order.Status))
+        }
+    }
+    if len(errs) > 0 {
+        return nil, &OrderValidationError{Errors: errs}
+    }
+
+    batch := &models.PickingBatch{StoreID: storeID, Picker: strings.TrimSpace(picker), Status: models.PickingOpen}
+    err := s.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Create(batch).Error; err != nil {
+            return err
+        }
+        // Заказ могли взять в другую сборку или отменить после проверки - тогда сборка не создается
+        result := tx.Model(&models.Order{}).Where("id IN ? AND status = ?", orderIDs, models.OrderNew).
+            Updates(map[string]interface{}{"status": models.OrderPicking, "picking_batch_id": batch.ID})
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected != int64(len(found)) {
+            return &OrderValidationError{Errors: []string{"orders changed while creating the batch, all orders must be new"}}
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return batch, nil
+}
+
+func (s *PickingService) GetBatch(id uint) (*models.PickingBatch, error) {
+    var batch models.PickingBatch
+    if err := s.db.First(&batch, id).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrPickingNotFound
+        }
+        return nil, err
+    }
+    return &batch, nil
+}
+
+// PickList составляет лист сборки: одинаковые товары разных заказов объединяются, обход идет
+// от start (nil - первый вход магазина) к ближайшему следующему товару внутри этапа (см. walkStage),
+// в конце - возврат к старту
+func (s *PickingService) PickList(batchID uint, start *RouteEndpoint) (*PickList, error) {
+    batch, err := s.GetBatch(batchID)
+    if err != nil {
+        return nil, err
+    }
+    list := &PickList{Batch: *batch, Items: []PickItem{}, Legs: []RouteLeg{}}
+    if err := s.db.Preload("Lines").Where("picking_batch_id = ?", batch.ID).Order("id").Find(&list.Orders).Error; err != nil {
+        return nil, err
+    }
+
+    byProduct := make(map[uint]int)
+    for _, order := range list.Orders {
+        for _, line := range order.Lines {
+            i, ok := byProduct[line.ProductID]
+            if !ok {
+                i = len(list.Items)
+                byProduct[line.ProductID] = i
+                list.Items = append(list.Items, PickItem{ProductID: line.ProductID, ProductName: line.ProductName,
+                    Zone: models.TemperatureAmbient, Lines: []PickLine{}, Done: true})
+            }
+            item := &list.Items[i]
+            item.Quantity += line.Quantity
+            item.Done = item.Done && line.Status != models.OrderLinePending
+            item.Lines = append(item.Lines, PickLine{LineID: line.ID, OrderID: order.ID, OrderNumber: order.Number,
+                Quantity: line.Quantity, PickedQuantity: line.PickedQuantity, Status: line.Status})
+        }
+    }
+
+    // В обход попадают несобранные товары, найденные на карте. Собранные товары и товары,
+    // которые удалены или не размещены, остаются в листе без маршрута, чтобы их строки можно было отметить
+    var pending, skipped []PickItem
+    for _, item := range list.Items {
+        var product models.Product
+        err := s.db.Unscoped().First(&product, item.ProductID).Error
+        if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, err
+        }
+        var location *ProductLocation
+        if err == nil {
+            location, _ = locateProduct(s.db, &product)
+        }
+        if location != nil {
+            if item.Zone, err = productZone(s.db, location); err != nil {
+                return nil, err
+            }
+            item.Location = *location
+            item.Heavy, item.Fragile, item.Bulky = product.Heavy, product.Fragile, product.Bulky
+        }
+        if location == nil || item.Done {
+            skipped = append(skipped, item)
+            continue
+        }
+        pending = append(pending, item)
+    }
+    list.Items = list.Items[:0]
+
+    if start == nil {
+        if start, err = storeEntrance(s.db, batch.StoreID); err != nil {
+            return nil, err
+        }
+    }
+    if start == nil && len(pending) > 0 {
+        start = &RouteEndpoint{Point: pending[0].Location.AccessPoint, FloorID: pending[0].Location.FloorID}
+    }
+    if start == nil {
+        list.Items = append(list.Items, skipped...)
+        return list, nil
+    }
+    list.Start = *start
+
+    // Тяжелые товары - первыми, замороженные - последними; сборщик возвращается к месту старта (пункту выдачи)
+    stops := make([]walkStop, len(pending))
+    for i, item := range pending {
+        stops[i] = walkStop{
+            endpoint: RouteEndpoint{Point: item.Location.AccessPoint, FloorID: item.Location.FloorID, Label: item.ProductName},
+            stage:    walkStage(item.Zone, item.Heavy),
+        }
+    }
+    walk, err := planStopWalk(s.db, batch.StoreID, list.Start, stops, []RouteEndpoint{list.Start}, RouteProfiles[RouteProfileDefault])
+    if err != nil {
+        return nil, err
+    }
+    for i, index := range walk.order {
+        item := pending[index]
+        item.Sequence = i + 1
+        item.Reachable = walk.reachable[index]
+        list.Items = append(list.Items, item)
+    }
+    list.Items = append(list.Items, skipped...)
+    list.Legs, list.Distance, list.Duration = walk.legs, walk.distance, walk.duration
+    return list, nil
+}
+
+// MarkLine отмечает строку заказа в сборке: picked - собрана полностью, out_of_stock - товара
+// не хватило (pickedQuantity - сколько удалось собрать), pending - отмена отметки.
+// Заказ, все строки которого отмечены, становится собранным; сборка завершается вместе с последним заказом
+func (s *PickingService) MarkLine(batchID, lineID uint, status string, pickedQuantity *int) (*models.Order, error) {
+    batch, err := s.GetBatch(batchID)
+    if err != nil {
+        return nil, err
+    }
+    if batch.Status != models.PickingOpen {
+        return nil, ErrPickingClosed
+    }
+    var line models.OrderLine
+    err = s.db.Joins("JOIN orders ON orders.id = order_lines.order_id").
+        Where("order_lines.id = ? AND orders.picking_batch_id = ?", lineID, batch.ID).First(&line).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, ErrOrderLineNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    picked := 0
+    switch status {
+    case models.OrderLinePicked:
+        picked = line.Quantity
+    case models.OrderLineOutOfStock, models.OrderLinePending:
+    default:
+        return nil, &OrderValidationError{Errors: []string{"status must be one of picked, out_of_stock, pending"}}
+    }
+    if pickedQuantity != nil && status != models.OrderLinePending {
+        picked = *pickedQuantity
+    }
+    switch {
+    case status == models.OrderLinePicked && picked != line.Quantity:
+        return nil, &OrderValidationError{Errors: []string{"picked_quantity must equal quantity, use out_of_stock for partial picks"}}
+    case status == models.OrderLineOutOfStock && (picked < 0 || picked >= line.Quantity):
+        return nil, &OrderValidationError{Errors: []string{"picked_quantity must be between 0 and quantity - 1"}}
+    }
+
+    err = s.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Model(&line).Updates(map[string]interface{}{"status": status, "picked_quantity": picked}).Error; err != nil {
+            return err
+        }
+        var pending int64
+        if err := tx.Model(&models.OrderLine{}).Where("order_id = ? AND status = ?", line.OrderID, models.OrderLinePending).
+            Count(&pending).Error; err != nil {
+            return err
+        }
+        orderStatus := models.OrderReady
+        if pending > 0 {
+            orderStatus = models.OrderPicking
+        }
+        if err := tx.Model(&models.Order{}).Where("id = ?", line.OrderID).Update("status", orderStatus).Error; err != nil {
+            return err
+        }
+
+        var unfinished int64
+        if err := tx.Model(&models.Order{}).Where("picking_batch_id = ? AND status <> ?", batch.ID, models.OrderReady).
+            Count(&unfinished).Error; err != nil {
+            return err
+        }
+        if unfinished == 0 {
+            now := time.Now()
+            return tx.Model(batch).Updates(map[string]interface{}{"status": models.PickingDone, "completed_at": &now}).Error
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return s.GetOrder(line.OrderID)
+}
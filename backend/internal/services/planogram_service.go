@@ -0,0 +1,305 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+// aisleOffset - расстояние от лицевой стороны оборудования до точки, где стоит покупатель
+const aisleOffset = 0.6
+
+var ErrFixtureNotFound = errors.New("fixture not found")
+
+// PlanogramValidationError перечисляет ошибки в оборудовании или планограмме
+type PlanogramValidationError struct {
+    Errors []string
+}
+
+func (e *PlanogramValidationError) Error() string {
+    return "invalid planogram: " + strings.Join(e.Errors, "; ")
+}
+
+// ProductLocation - точное место товара в магазине. Без планограммы - центр сектора
+type ProductLocation struct {
+    ProductID   uint        `json:"product_id"`
+    SectorID    uint        `json:"sector_id"`
+    FloorID     *uint       `json:"floor_id"`     // Этаж сектора, nil - нижний этаж
+    Point       utils.Point `json:"point"`        // Место на полке, в метрах
+    AccessPoint utils.Point `json:"access_point"` // Точка в проходе перед товаром, для построения маршрута
+    ShelfHeight *float64    `json:"shelf_height"` // Высота полки в метрах
+    FixtureID   *uint       `json:"fixture_id"`
+    FixtureCode string      `json:"fixture_code,omitempty"`
+    Side        string      `json:"side,omitempty"`
+    Bay         int         `json:"bay,omitempty"`
+    Shelf       int         `json:"shelf,omitempty"`
+    Precise     bool        `json:"precise"` // true, если место определено по планограмме
+}
+
+type PlanogramService struct {
+    db *gorm.DB
+}
+
+func NewPlanogramService(db *gorm.DB) *PlanogramService {
+    return &PlanogramService{db: db}
+}
+
+func (s *PlanogramService) ListFixtures(storeID uint) ([]models.Fixture, error) {
+    var fixtures []models.Fixture
+    err := s.db.Where("store_id = ?", storeID).Order("code, id").Find(&fixtures).Error
+    return fixtures, err
+}
+
+func (s *PlanogramService) GetFixture(id uint) (*models.Fixture, error) {
+    var fixture models.Fixture
+    err := s.db.First(&fixture, id).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, ErrFixtureNotFound
+    }
+    return &fixture, err
+}
+
+// SaveFixture создает оборудование (ID = 0) или обновляет существующее
+func (s *PlanogramService) SaveFixture(fixture *models.Fixture) error {
+    var problems []string
+    if fixture.Width <= 0 || fixture.Depth <= 0 {
+        problems = append(problems, "width and depth must be positive")
+    }
+    if fixture.BayCount < 1 {
+        fixture.BayCount = 1
+    }
+    if fixture.ShelfCount < 1 {
+        fixture.ShelfCount = 1
+    }
+    if fixture.ShelfSpacing <= 0 {
+        fixture.ShelfSpacing = 0.35
+    }
+    if fixture.BaseHeight < 0 {
+        problems = append(problems, "base_height must not be negative")
+    }
+    var sectors int64
+    if err := s.db.Model(&models.Sector{}).Where("id = ? AND store_id = ?", fixture.SectorID, fixture.StoreID).Count(&sectors).Error; err != nil {
+        return err
+    }
+    if sectors == 0 {
+        problems = append(problems, "sector does not belong to the store")
+    }
+    if len(problems) > 0 {
+        return &PlanogramValidationError{Errors: problems}
+    }
+    return s.db.Save(fixture).Error
+}
+
+// DeleteFixture удаляет оборудование вместе с его планограммой
+func (s *PlanogramService) DeleteFixture(id uint) error {
+    if _, err := s.GetFixture(id); err != nil {
+        return err
+    }
+    return s.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("fixture_id = ?", id).Delete(&models.ProductPlacement{}).Error; err != nil {
+            return err
+        }
+        return tx.Delete(&models.Fixture{}, id).Error
+    })
+}
+
+// DeleteSectors удаляет секторы вместе с их стеллажами, товарами и выкладкой в одной транзакции.
+// Цены, участие в акциях и строки заказов удаленных товаров удаляются так же, как при удалении магазина
+func DeleteSectors(db *gorm.DB, ids []uint) error {
+    if len(ids) == 0 {
+        return nil
+    }
+    return db.Transaction(func(tx *gorm.DB) error {
+        fixtures := tx.Model(&models.Fixture{}).Select("id").Where("sector_id IN ?", ids)
+        products := tx.Model(&models.Product{}).Select("id").Where("sector_id IN ?", ids)
+        if err := tx.Where("fixture_id IN (?) OR product_id IN (?)", fixtures, products).Delete(&models.ProductPlacement{}).Error; err != nil {
+            return err
+        }
+        for _, model := range []interface{}{&models.PromotionProduct{}, &models.ProductPrice{}, &models.OrderLine{}} {
+            if err := tx.Where("product_id IN (?)", products).Delete(model).Error; err != nil {
+                return err
+            }
+        }
+        if err := tx.Where("sector_id IN ?", ids).Delete(&models.Fixture{}).Error; err != nil {
+            return err
+        }
+        if err := tx.Where("sector_id IN ?", ids).Delete(&models.Product{}).Error; err != nil {
+            return err
+        }
+        return tx.Delete(&models.Sector{}, ids).Error
+    })
+}
+
+func (s *PlanogramService) Planogram(fixtureID uint) ([]models.ProductPlacement, error) {
+    if _, err := s.GetFixture(fixtureID); err != nil {
+        return nil, err
+    }
+    var placements []models.ProductPlacement
+    err := s.db.Where("fixture_id = ?", fixtureID).Order("side, bay, shelf, slot").Find(&placements).Error
+    return placements, err
+}
+
+// SetPlanogram заменяет всю выкладку оборудования
+func (s *PlanogramService) SetPlanogram(fixtureID uint, placements []models.ProductPlacement) ([]models.ProductPlacement, error) {
+    fixture, err := s.GetFixture(fixtureID)
+    if err != nil {
+        return nil, err
+    }
+
+    var storeProducts []uint
+    if err := s.db.Model(&models.Product{}).Joins("JOIN sectors ON sectors.id = products.sector_id").
+        Where("sectors.store_id = ?", fixture.StoreID).Pluck("products.id", &storeProducts).Error; err != nil {
+        return nil, err
+    }
+    inStore := make(map[uint]bool, len(storeProducts))
+    for _, id := range storeProducts {
+        inStore[id] = true
+    }
+
+    var problems []string
+    for i := range placements {
+        p := &placements[i]
+        p.ID = 0
+        p.FixtureID = fixture.ID
+        if p.Side == "" {
+            p.Side = models.FixtureSideFront
+        }
+        if p.Facings < 1 {
+            p.Facings = 1
+        }
+        item := fmt.Sprintf("placement %d: ", i+1)
+        switch {
+        case !inStore[p.ProductID]:
+            problems = append(problems, item+"product is not in this store")
+        case p.Side != models.FixtureSideFront && p.Side != models.FixtureSideBack:
+            problems = append(problems, item+"side must be front or back")
+        case p.Side == models.FixtureSideBack && !fixture.DoubleSided:
+            problems = append(problems, item+"fixture is not double sided")
+        case p.Bay < 1 || p.Bay > fixture.BayCount:
+            problems = append(problems, fmt.Sprintf("%sbay must be between 1 and %d", item, fixture.BayCount))
+        case p.Shelf < 1 || p.Shelf > fixture.ShelfCount:
+            problems = append(problems, fmt.Sprintf("%sshelf must be between 1 and %d", item, fixture.ShelfCount))
+        }
+    }
+    if len(problems) > 0 {
+        return nil, &PlanogramValidationError{Errors: problems}
+    }
+
+    err = s.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("fixture_id = ?", fixture.ID).Delete(&models.ProductPlacement{}).Error; err != nil {
+            return err
+        }
+        if len(placements) == 0 {
+            return nil
+        }
+        return tx.Create(&placements).Error
+    })
+    if err != nil {
+        return nil, err
+    }
+    return placements, nil
+}
+
+// LocateProduct определяет место товара по планограмме
+func (s *PlanogramService) LocateProduct(storeID, productID uint) (*ProductLocation, error) {
+    var product models.Product
+    err := s.db.Joins("JOIN sectors ON sectors.id = products.sector_id").
+        Where("products.id = ? AND sectors.store_id = ?", productID, storeID).First(&product).Error
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrProductNotInStore
+        }
+        return nil, err
+    }
+    return locateProduct(s.db, &product)
+}
+
+// locateProduct возвращает место товара на полке, а если товара нет на планограмме - центр его сектора.
+// При нескольких местах выкладки используется первое
+func locateProduct(db *gorm.DB, product *models.Product) (*ProductLocation, error) {
+    var sector models.Sector
+    if err := db.First(&sector, product.SectorID).Error; err != nil {
+        return nil, err
+    }
+    location := &ProductLocation{ProductID: product.ID, SectorID: product.SectorID, FloorID: sector.FloorID}
+
+    var placement models.ProductPlacement
+    err := db.Where("product_id = ?", product.ID).Order("id").First(&placement).Error
+    if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, err
+    }
+    var fixture models.Fixture
+    if err == nil {
+        err = db.First(&fixture, placement.FixtureID).Error
+        if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, err
+        }
+    }
+    if err != nil {
+        center := utils.Point{X: sector.PositionX + sector.Width/2, Y: sector.PositionY + sector.Height/2}
+        location.Point, location.AccessPoint = center, center
+        return location, nil
+    }
+
+    // Позиция на полке пропорциональна фейсингам товаров, стоящих левее
+    var neighbours []models.ProductPlacement
+    if err := db.Where("fixture_id = ? AND side = ? AND bay = ? AND shelf = ?",
+        fixture.ID, placement.Side, placement.Bay, placement.Shelf).Find(&neighbours).Error; err != nil {
+        return nil, err
+    }
+    sort.Slice(neighbours, func(i, j int) bool {
+        if neighbours[i].Slot != neighbours[j].Slot {
+            return neighbours[i].Slot < neighbours[j].Slot
+        }
+        return neighbours[i].ID < neighbours[j].ID
+    })
+    before, total := 0, 0
+    for _, n := range neighbours {
+        if n.ID == placement.ID {
+            before = total
+        }
+        total += n.Facings
+    }
+    bayWidth := fixture.Width / float64(fixture.BayCount)
+    offset := bayWidth / 2
+    if total > 0 {
+        offset = (float64(before) + float64(placement.Facings)/2) / float64(total) * bayWidth
+    }
+    x := float64(placement.Bay-1)*bayWidth + offset
+
+    // Локальные координаты: x вдоль лицевой стороны, y в глубину; обратная сторона зеркальна
+    face, access := utils.Point{X: x, Y: fixture.Depth}, utils.Point{X: x, Y: fixture.Depth + aisleOffset}
+    if placement.Side == models.FixtureSideBack {
+        face, access = utils.Point{X: fixture.Width - x, Y: 0}, utils.Point{X: fixture.Width - x, Y: -aisleOffset}
+    }
+    height := fixture.BaseHeight + float64(placement.Shelf-1)*fixture.ShelfSpacing
+
+    location.SectorID = fixture.SectorID
+    location.Point = fixtureToStore(fixture, face)
+    location.AccessPoint = fixtureToStore(fixture, access)
+    location.ShelfHeight = &height
+    location.FixtureID = &fixture.ID
+    location.FixtureCode = fixture.Code
+    location.Side = placement.Side
+    location.Bay = placement.Bay
+    location.Shelf = placement.Shelf
+    location.Precise = true
+    return location, nil
+}
+
+// fixtureToStore переводит локальную точку оборудования в координаты магазина с учетом поворота вокруг центра
+func fixtureToStore(f models.Fixture, p utils.Point) utils.Point {
+    sin, cos := math.Sincos(f.Rotation * math.Pi / 180)
+    dx, dy := p.X-f.Width/2, p.Y-f.Depth/2
+    return utils.Point{
+        X: f.PositionX + f.Width/2 + dx*cos - dy*sin,
+        Y: f.PositionY + f.Depth/2 + dx*sin + dy*cos,
+    }
+}
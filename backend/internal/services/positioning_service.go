@@ -0,0 +1,187 @@
+package services
+
+import (
+    "errors"
+    "math"
+    "sort"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+// pathLossExponent - показатель затухания сигнала в помещении для оценки расстояния по RSSI
+const pathLossExponent = 2.0
+
+// defaultTxPower - RSSI на расстоянии 1 м, если у маячка не задан TxPower
+const defaultTxPower = -59
+
+var (
+    ErrNoKnownBeacons     = errors.New("no known beacons in readings")
+    ErrPositionOutsideMap = errors.New("position is outside the store map")
+)
+
+// BeaconReading - сигнал маячка, принятый устройством. Маячок определяется по MAC или по UUID, Major и Minor
+type BeaconReading struct {
+    MAC   string `json:"mac"`
+    UUID  string `json:"uuid"`
+    Major uint16 `json:"major"`
+    Minor uint16 `json:"minor"`
+    RSSI  int    `json:"rssi"`
+}
+
+// PositionReport - данные от устройства: сигналы маячков или уже вычисленные координаты
+type PositionReport struct {
+    DeviceID string          `json:"device_id"`
+    Readings []BeaconReading `json:"readings"`
+    X        *float64        `json:"x"`
+    Y        *float64        `json:"y"`
+    FloorID  *uint           `json:"floor_id"` // Этаж для переданных координат, nil - нижний этаж
+}
+
+type PositioningService struct {
+    db *gorm.DB
+}
+
+func NewPositioningService(db *gorm.DB) *PositioningService {
+    return &PositioningService{db: db}
+}
+
+// Locate оценивает положение и этаж по сигналам маячков магазина: взвешенный центр маячков
+// с весами, обратными квадрату расстояния, оцененного по RSSI
+func (s *PositioningService) Locate(storeID uint, readings []BeaconReading) (utils.Point, *uint, float64, error) {
+    var beacons []models.Beacon
+    if err := s.db.Where("store_id = ? AND is_active = ?", storeID, true).Find(&beacons).Error; err != nil {
+        return utils.Point{}, nil, 0, err
+    }
+    return locateByBeacons(beacons, readings)
+}
+
+// Record сохраняет местоположение устройства и определяет секторы, в которых оно находится
+func (s *PositioningService) Record(storeID uint, report PositionReport, now time.Time) (*models.PositionFix, []models.Sector, error) {
+    fix := &models.PositionFix{StoreID: storeID, DeviceID: report.DeviceID, CreatedAt: now}
+    if report.X != nil && report.Y != nil {
+        fix.X, fix.Y, fix.FloorID = *report.X, *report.Y, report.FloorID
+        if err := s.checkOnMap(storeID, fix.FloorID, fix.X, fix.Y); err != nil {
+            return nil, nil, err
+        }
+    } else {
+        point, floorID, accuracy, err := s.Locate(storeID, report.Readings)
+        if err != nil {
+            return nil, nil, err
+        }
+        fix.X, fix.Y, fix.FloorID, fix.Accuracy = point.X, point.Y, floorID, accuracy
+    }
+
+    sectors, err := sectorsAt(s.db, storeID, fix.FloorID, utils.Point{X: fix.X, Y: fix.Y})
+    if err != nil {
+        return nil, nil, err
+    }
+    if len(sectors) > 0 {
+        fix.SectorID = &sectors[len(sectors)-1].ID
+    }
+    if err := s.db.Create(fix).Error; err != nil {
+        return nil, nil, err
+    }
+    return fix, sectors, nil
+}
+
+// checkOnMap проверяет, что координаты от устройства лежат в пределах этажа (nil - нижний этаж)
+func (s *PositioningService) checkOnMap(storeID uint, floorID *uint, x, y float64) error {
+    if math.IsNaN(x) || math.IsInf(x, 0) || math.IsNaN(y) || math.IsInf(y, 0) {
+        return ErrPositionOutsideMap
+    }
+    if floorID == nil {
+        lowest, err := defaultFloor(s.db, storeID)
+        if err != nil {
+            return err
+        }
+        if lowest != nil {
+            floorID = &lowest.ID
+        }
+    }
+    extents, ok, err := floorExtents(s.db, storeID, floorID)
+    if err != nil {
+        return err
+    }
+    if ok && !extents.Contains(x, y) {
+        return ErrPositionOutsideMap
+    }
+    return nil
+}
+
+// locateByBeacons сопоставляет сигналы с маячками и возвращает точку, этаж ближайшего маячка
+// и оценку погрешности в метрах
+func locateByBeacons(beacons []models.Beacon, readings []BeaconReading) (utils.Point, *uint, float64, error) {
+    type estimate struct {
+        beacon   models.Beacon
+        distance float64
+    }
+    var estimates []estimate
+    for _, r := range readings {
+        for _, b := range beacons {
+            matched := r.MAC != "" && strings.EqualFold(r.MAC, b.MAC) ||
+                r.UUID != "" && strings.EqualFold(r.UUID, b.UUID) && r.Major == b.Major && r.Minor == b.Minor
+            if !matched || r.RSSI >= 0 {
+                continue
+            }
+            txPower := float64(b.TxPower)
+            if txPower == 0 {
+                txPower = defaultTxPower
+            }
+            distance := math.Pow(10, (txPower-float64(r.RSSI))/(10*pathLossExponent))
+            estimates = append(estimates, estimate{beacon: b, distance: math.Max(distance, 0.1)})
+            break
+        }
+    }
+    if len(estimates) == 0 {
+        return utils.Point{}, nil, 0, ErrNoKnownBeacons
+    }
+
+    // Дальние маячки дают большую ошибку, используем не больше четырех ближайших
+    // и только с этажа ближайшего маячка
+    sort.Slice(estimates, func(i, j int) bool { return estimates[i].distance < estimates[j].distance })
+    floorID := estimates[0].beacon.FloorID
+    sameFloor := estimates[:0]
+    for _, e := range estimates {
+        if e.beacon.FloorID == nil && floorID == nil || e.beacon.FloorID != nil && floorID != nil && *e.beacon.FloorID == *floorID {
+            sameFloor = append(sameFloor, e)
+        }
+    }
+    estimates = sameFloor
+    if len(estimates) > 4 {
+        estimates = estimates[:4]
+    }
+    var x, y, total float64
+    for _, e := range estimates {
+        w := 1 / (e.distance * e.distance)
+        x += e.beacon.PositionX * w
+        y += e.beacon.PositionY * w
+        total += w
+    }
+    return utils.Point{X: round3(x / total), Y: round3(y / total)}, floorID, round3(estimates[0].distance), nil
+}
+
+// sectorsAt возвращает секторы этажа магазина, содержащие точку, от внешнего к самому вложенному
+func sectorsAt(db *gorm.DB, storeID uint, floorID *uint, p utils.Point) ([]models.Sector, error) {
+    if floorID == nil {
+        lowest, err := defaultFloor(db, storeID)
+        if err != nil {
+            return nil, err
+        }
+        if lowest != nil {
+            floorID = &lowest.ID
+        }
+    }
+    floor, err := onFloor(db, storeID, floorID)
+    if err != nil {
+        return nil, err
+    }
+    var sectors []models.Sector
+    err = db.Scopes(floor).Where("store_id = ? AND position_x <= ? AND position_x + width >= ? AND position_y <= ? AND position_y + height >= ?",
+        storeID, p.X, p.X, p.Y, p.Y).Order("level, id").Find(&sectors).Error
+    return sectors, err
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+    "errors"
+    "math"
+    "testing"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+func TestLocateByBeacons(t *testing.T) {
+    ground, upper := uint(1), uint(2)
+    beacons := []models.Beacon{
+        {ID: 1, MAC: "AA:00:00:00:00:01", PositionX: 0, PositionY: 0, FloorID: &ground},
+        {ID: 2, MAC: "AA:00:00:00:00:02", PositionX: 10, PositionY: 0, FloorID: &ground},
+        {ID: 3, UUID: "F7826DA6-4FA2-4E98-8024-BC5B71E0893E", Major: 1, Minor: 7, PositionX: 0, PositionY: 10, TxPower: -65, FloorID: &ground},
+        {ID: 4, MAC: "AA:00:00:00:00:04", PositionX: 5, PositionY: 5, FloorID: &upper},
+    }
+    // rssi возвращает уровень сигнала маячка с мощностью по умолчанию на расстоянии distance метров
+    rssi := func(distance float64) int {
+        return int(math.Round(defaultTxPower - 10*pathLossExponent*math.Log10(distance)))
+    }
+
+    tests := []struct {
+        name         string
+        readings     []BeaconReading
+        want         utils.Point
+        wantFloor    *uint
+        wantAccuracy float64
+        wantErr      error
+    }{
+        {"single beacon", []BeaconReading{{MAC: "aa:00:00:00:00:02", RSSI: rssi(1)}}, utils.Point{X: 10, Y: 0}, &ground, 1, nil},
+        {"midpoint of equal signals", []BeaconReading{
+            {MAC: "AA:00:00:00:00:01", RSSI: rssi(5)},
+            {MAC: "AA:00:00:00:00:02", RSSI: rssi(5)},
+        }, utils.Point{X: 5, Y: 0}, &ground, 5.012, nil},
+        {"closer beacon weighs more", []BeaconReading{
+            {MAC: "AA:00:00:00:00:01", RSSI: -59},
+            {MAC: "AA:00:00:00:00:02", RSSI: -65},
+        }, utils.Point{X: 2.008, Y: 0}, &ground, 1, nil},
+        {"ibeacon ids and own tx power", []BeaconReading{{UUID: "f7826da6-4fa2-4e98-8024-bc5b71e0893e", Major: 1, Minor: 7, RSSI: -65}},
+            utils.Point{X: 0, Y: 10}, &ground, 1, nil},
+        {"floor of the nearest beacon", []BeaconReading{
+            {MAC: "AA:00:00:00:00:01", RSSI: -80},
+            {MAC: "AA:00:00:00:00:04", RSSI: -60},
+        }, utils.Point{X: 5, Y: 5}, &upper, 1.122, nil},
+        {"unknown and invalid readings", []BeaconReading{
+            {MAC: "BB:00:00:00:00:01", RSSI: -60},
+            {MAC: "AA:00:00:00:00:01", RSSI: 0},
+        }, utils.Point{}, nil, 0, ErrNoKnownBeacons},
+        {"no readings", nil, utils.Point{}, nil, 0, ErrNoKnownBeacons},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            point, floorID, accuracy, err := locateByBeacons(beacons, tt.readings)
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("locateByBeacons() error = %v, want %v", err, tt.wantErr)
+            }
+            if err != nil {
+                return
+            }
+            if point != tt.want || accuracy != tt.wantAccuracy {
+                t.Errorf("locateByBeacons() = %v, accuracy %v, want %v, accuracy %v", point, accuracy, tt.want, tt.wantAccuracy)
+            }
+            if floorID == nil || *floorID != *tt.wantFloor {
+                t.Errorf("locateByBeacons() floor = %v, want %d", floorID, *tt.wantFloor)
+            }
+        })
+    }
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+    "errors"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+)
+
+// PriceHistoryDays - глубина истории цен в ответе API
+const PriceHistoryDays = 90
+
+var (
+    ErrProductNotFound     = errors.New("product not found")
+    ErrPriceNotFound       = errors.New("price not found")
+    ErrPriceNotCancellable = errors.New("price is already in effect")
+)
+
+// PriceValidationError перечисляет ошибки в запланированной цене
+type PriceValidationError struct {
+    Errors []string
+}
+
+func (e *PriceValidationError) Error() string {
+    return "invalid price: " + strings.Join(e.Errors, "; ")
+}
+
+// PriceScheduleInput - будущая обычная цена или акционная цена на период
+type PriceScheduleInput struct {
+    Kind      string     `json:"kind"`
+    Price     float64    `json:"price"`
+    ValidFrom time.Time  `json:"valid_from"`
+    ValidTo   *time.Time `json:"valid_to"`
+}
+
+// EffectivePrice - цена, действующая в данный момент
+type EffectivePrice struct {
+    Price        float64              `json:"price"`
+    RegularPrice float64              `json:"regular_price"`
+    Promo        *models.ProductPrice `json:"promo"` // Действующая акция, если есть
+}
+
+// PriceInfo - текущая цена, запланированные изменения и история за PriceHistoryDays дней
+type PriceInfo struct {
+    ProductID uint                  `json:"product_id"`
+    Current   EffectivePrice        `json:"current"`
+    Scheduled []models.ProductPrice `json:"scheduled"`
+    History   []models.ProductPrice `json:"history"`
+}
+
+type PriceService struct {
+    db *gorm.DB
+}
+
+func NewPriceService(db *gorm.DB) *PriceService {
+    return &PriceService{db: db}
+}
+
+func (s *PriceService) Info(productID uint, now time.Time) (*PriceInfo, error) {
+    var product models.Product
+    if err := s.db.First(&product, productID).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrProductNotFound
+        }
+        return nil, err
+    }
+
+    current, err := effectivePrice(s.db, &product, now)
+    if err != nil {
+        return nil, err
+    }
+    info := &PriceInfo{ProductID: product.ID, Current: *current, Scheduled: []models.ProductPrice{}, History: []models.ProductPrice{}}
+
+    if err := s.db.Where("product_id = ? AND status = ?", product.ID, models.PriceStatusScheduled).
+        Order("valid_from, id").Find(&info.Scheduled).Error; err != nil {
+        return nil, err
+    }
+
+    // История начинается с обычной цены, действовавшей в начале периода
+    since := now.AddDate(0, 0, -PriceHistoryDays)
+    var initial models.ProductPrice
+    err = s.db.Where("product_id = ? AND kind = ? AND valid_from <= ? AND status <> ?",
+        product.ID, models.PriceKindRegular, since, models.PriceStatusScheduled).
+        Order("valid_from DESC, id DESC").First(&initial).Error
+    if err == nil {
+        info.History = append(info.History, initial)
+    } else if !errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, err
+    }
+    var recent []models.ProductPrice
+    if err := s.db.Where("product_id = ? AND valid_from > ? AND valid_from <= ? AND status <> ?",
+        product.ID, since, now, models.PriceStatusScheduled).Order("valid_from, id").Find(&recent).Error; err != nil {
+        return nil, err
+    }
+    info.History = append(info.History, recent...)
+    return info, nil
+}
+
+// Schedule добавляет обычную цену с даты ValidFrom или акционную цену на период
+func (s *PriceService) Schedule(productID uint, input PriceScheduleInput, now time.Time) (*models.ProductPrice, error) {
+    var product models.Product
+    if err := s.db.First(&product, productID).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrProductNotFound
+        }
+        return nil, err
+    }
+
+    var problems []string
+    if input.Kind == "" {
+        input.Kind = models.PriceKindRegular
+    }
+    if input.Kind != models.PriceKindRegular && input.Kind != models.PriceKindPromo {
+        problems = append(problems, "kind must be regular or promo")
+    }
+    if input.Price < 0 {
+        problems = append(problems, "price must not be negative")
+    }
+    if input.ValidFrom.IsZero() {
+        problems = append(problems, "valid_from is required")
+    } else if input.ValidFrom.Before(now.Add(-time.Minute)) {
+        problems = append(problems, "valid_from must not be in the past")
+    }
+    if input.Kind == models.PriceKindPromo {
+        if input.ValidTo == nil || !input.ValidTo.After(input.ValidFrom) {
+            problems = append(problems, "promo price requires valid_to after valid_from")
+        }
+    } else {
+        input.ValidTo = nil
+    }
+    if len(problems) > 0 {
+        return nil, &PriceValidationError{Errors: problems}
+    }
+
+    price := &models.ProductPrice{
+        ProductID: product.ID,
+        Kind:      input.Kind,
+        Price:     input.Price,
+        ValidFrom: input.ValidFrom,
+        ValidTo:   input.ValidTo,
+        Status:    models.PriceStatusScheduled,
+        Source:    "schedule",
+    }
+    err := s.db.Transaction(func(tx *gorm.DB) error {
+        if err := ensurePriceBaseline(tx, &product, product.Price); err != nil {
+            return err
+        }
+        if err := tx.Create(price).Error; err != nil {
+            return err
+        }
+        if !price.ValidFrom.After(now) {
+            return activatePrice(tx, price, now)
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return price, nil
+}
+
+// Cancel отменяет запланированную цену или досрочно завершает действующую акцию
+func (s *PriceService) Cancel(priceID uint, now time.Time) error {
+    var price models.ProductPrice
+    if err := s.db.First(&price, priceID).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return ErrPriceNotFound
+        }
+        return err
+    }
+
+    switch {
+    case price.Status == models.PriceStatusScheduled:
+        return s.db.Delete(&price).Error
+    case price.Kind == models.PriceKindPromo && price.Status == models.PriceStatusActive:
+        return s.db.Transaction(func(tx *gorm.DB) error {
+            if err := tx.Model(&price).Updates(map[string]interface{}{"valid_to": now, "status": models.PriceStatusExpired}).Error; err != nil {
+                return err
+            }
+            return refreshProductPrice(tx, price.ProductID, now)
+        })
+    default:
+        return ErrPriceNotCancellable
+    }
+}
+
+// ApplyDue вводит в действие наступившие цены и завершает истекшие акции, обновляя Product.Price.
+// Возвращает количество затронутых товаров
+func (s *PriceService) ApplyDue(now time.Time) (int, error) {
+    products := make(map[uint]bool)
+    err := s.db.Transaction(func(tx *gorm.DB) error {
+        var due []models.ProductPrice
+        if err := tx.Where("status = ? AND valid_from <= ?", models.PriceStatusScheduled, now).
+            Order("valid_from, id").Find(&due).Error; err != nil {
+            return err
+        }
+        for i := range due {
+            if err := activatePrice(tx, &due[i], now); err != nil {
+                return err
+            }
+            products[due[i].ProductID] = true
+        }
+
+        var ended []models.ProductPrice
+        if err := tx.Where("kind = ? AND status = ? AND valid_to <= ?", models.PriceKindPromo, models.PriceStatusActive, now).
+            Find(&ended).Error; err != nil {
+            return err
+        }
+        for _, promo := range ended {
+            if err := tx.Model(&promo).Update("status", models.PriceStatusExpired).Error; err != nil {
+                return err
+            }
+            if err := refreshProductPrice(tx, promo.ProductID, now); err != nil {
+                return err
+            }
+            products[promo.ProductID] = true
+        }
+        return nil
+    })
+    return len(products), err
+}
+
+// Current возвращает цену товара, действующую на момент now
+func (s *PriceService) Current(product *models.Product, now time.Time) (*EffectivePrice, error) {
+    return effectivePrice(s.db, product, now)
+}
+
+// RecordChange записывает в историю обычную цену, заданную вручную; previous - прежняя обычная цена,
+// nil для нового товара
+func (s *PriceService) RecordChange(product *models.Product, previous *float64) error {
+    return s.db.Transaction(func(tx *gorm.DB) error {
+        return recordPriceChange(tx, product, previous, "manual", time.Now())
+    })
+}
+
+// recordPriceChange сохраняет новую обычную цену товара, если она изменилась, и пересчитывает действующую цену.
+// product.Price - обычная цена; после вызова в нем действующая цена с учетом акций
+func recordPriceChange(tx *gorm.DB, product *models.Product, previous *float64, source string, now time.Time) error {
+    if previous != nil {
+        if *previous == product.Price {
+            // Товар мог быть сохранен с обычной ценой во время акции, возвращаем действующую
+            if err := refreshProductPrice(tx, product.ID, now); err != nil {
+                return err
+            }
+            return tx.Select("price").First(product, product.ID).Error
+        }
+        if err := ensurePriceBaseline(tx, product, *previous); err != nil {
+            return err
+        }
+    }
+    price := &models.ProductPrice{
+        ProductID: product.ID,
+        Kind:      models.PriceKindRegular,
+        Price:     product.Price,
+        ValidFrom: now,
+        Status:    models.PriceStatusScheduled,
+        Source:    source,
+    }
+    if err := tx.Create(price).Error; err != nil {
+        return err
+    }
+    if err := activatePrice(tx, price, now); err != nil {
+        return err
+    }
+    return tx.Select("price").First(product, product.ID).Error
+}
+
+// activatePrice вводит цену в действие; предыдущие обычные цены товара становятся истекшими
+func activatePrice(tx *gorm.DB, price *models.ProductPrice, now time.Time) error {
+    if price.Kind == models.PriceKindRegular {
+        if err := tx.Model(&models.ProductPrice{}).
+            Where("product_id = ? AND kind = ? AND status = ? AND id <> ?", price.ProductID, models.PriceKindRegular, models.PriceStatusActive, price.ID).
+            Update("status", models.PriceStatusExpired).Error; err != nil {
+            return err
+        }
+    }
+    price.Status = models.PriceStatusActive
+    if err := tx.Model(price).Update("status", price.Status).Error; err != nil {
+        return err
+    }
+    return refreshProductPrice(tx, price.ProductID, now)
+}
+
+// ensurePriceBaseline сохраняет price как исходную цену, если у товара еще нет истории,
+// чтобы после окончания акции было к чему вернуться
+func ensurePriceBaseline(tx *gorm.DB, product *models.Product, price float64) error {
+    var count int64
+    if err := tx.Model(&models.ProductPrice{}).Where("product_id = ?", product.ID).Count(&count).Error; err != nil {
+        return err
+    }
+    if count > 0 {
+        return nil
+    }
+    return tx.Create(&models.ProductPrice{
+        ProductID: product.ID,
+        Kind:      models.PriceKindRegular,
+        Price:     price,
+        ValidFrom: product.CreatedAt,
+        Status:    models.PriceStatusActive,
+        Source:    "initial",
+    }).Error
+}
+
+// effectivePrice вычисляет цену на момент now: самая низкая действующая акция или последняя обычная цена
+func effectivePrice(db *gorm.DB, product *models.Product, now time.Time) (*EffectivePrice, error) {
+    prices, err := effectivePrices(db, []models.Product{*product}, now)
+    if err != nil {
+        return nil, err
+    }
+    return prices[product.ID], nil
+}
+
+// effectivePrices вычисляет цены товаров на момент now одним запросом к истории
+func effectivePrices(db *gorm.DB, products []models.Product, now time.Time) (map[uint]*EffectivePrice, error) {
+    result := make(map[uint]*EffectivePrice, len(products))
+    if len(products) == 0 {
+        return result, nil
+    }
+    ids := make([]uint, len(products))
+    for i, product := range products {
+        ids[i] = product.ID
+    }
+    // Из обычных цен читается только последняя по дате начала, из акций - действующие
+    var prices []models.ProductPrice
+    if err := db.Where("product_id IN ? AND valid_from <= ? AND (kind = ? AND valid_from = (SELECT MAX(r.valid_from) FROM product_prices r "+
+        "WHERE r.product_id = product_prices.product_id AND r.kind = ? AND r.valid_from <= ?) OR kind = ? AND status <> ? AND valid_to > ?)",
+        ids, now, models.PriceKindRegular, models.PriceKindRegular, now, models.PriceKindPromo, models.PriceStatusExpired, now).
+        Find(&prices).Error; err != nil {
+        return nil, err
+    }
+    byProduct := make(map[uint][]models.ProductPrice)
+    for _, price := range prices {
+        byProduct[price.ProductID] = append(byProduct[price.ProductID], price)
+    }
+    for _, product := range products {
+        result[product.ID] = selectEffectivePrice(product.Price, byProduct[product.ID], now)
+    }
+    return result, nil
+}
+
+// selectEffectivePrice выбирает из цен товара действующую на момент now; base - цена товара без истории
+func selectEffectivePrice(base float64, prices []models.ProductPrice, now time.Time) *EffectivePrice {
+    result := &EffectivePrice{Price: base, RegularPrice: base}
+    var regular, promo *models.ProductPrice
+    for i := range prices {
+        p := &prices[i]
+        if p.ValidFrom.After(now) {
+            continue
+        }
+        switch p.Kind {
+        case models.PriceKindRegular:
+            // Последняя по дате начала, при равенстве - последняя созданная
+            if regular == nil || p.ValidFrom.After(regular.ValidFrom) || p.ValidFrom.Equal(regular.ValidFrom) && p.ID > regular.ID {
+                regular = p
+            }
+        case models.PriceKindPromo:
+            if p.Status == models.PriceStatusExpired || p.ValidTo == nil || !p.ValidTo.After(now) {
+                continue
+            }
+            if promo == nil || p.Price < promo.Price || p.Price == promo.Price && p.ID < promo.ID {
+                promo = p
+            }
+        }
+    }
+    if regular != nil {
+        result.RegularPrice = regular.Price
+        result.Price = regular.Price
+    }
+    if promo != nil {
+        result.Promo = promo
+        result.Price = promo.Price
+    }
+    return result
+}
+
+// refreshProductPrice записывает действующую цену в Product.Price
+func refreshProductPrice(tx *gorm.DB, productID uint, now time.Time) error {
+    var product models.Product
+    if err := tx.First(&product, productID).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil // Товар удален, история остается
+        }
+        return err
+    }
+    current, err := effectivePrice(tx, &product, now)
+    if err != nil {
+        return err
+    }
+    if current.Price == product.Price {
+        return nil
+    }
+    return tx.Model(&product).Update("price", current.Price).Error
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+    "testing"
+    "time"
+
+    "store-navigator/internal/models"
+)
+
+func TestEffectivePrice(t *testing.T) {
+    now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+    day := 24 * time.Hour
+    at := func(d time.Duration) *time.Time {
+        v := now.Add(d)
+        return &v
+    }
+    regular := func(id uint, price float64, from time.Duration) models.ProductPrice {
+        return models.ProductPrice{ID: id, Kind: models.PriceKindRegular, Price: price, ValidFrom: now.Add(from), Status: models.PriceStatusActive}
+    }
+    promo := func(id uint, price float64, from, to time.Duration, status string) models.ProductPrice {
+        return models.ProductPrice{ID: id, Kind: models.PriceKindPromo, Price: price, ValidFrom: now.Add(from), ValidTo: at(to), Status: status}
+    }
+
+    tests := []struct {
+        name        string
+        prices      []models.ProductPrice
+        wantPrice   float64
+        wantRegular float64
+        wantPromo   uint
+    }{
+        {"no history", nil, 100, 100, 0},
+        {"latest regular", []models.ProductPrice{regular(1, 90, -10 * day), regular(2, 95, -day)}, 95, 95, 0},
+        {"future regular ignored", []models.ProductPrice{regular(1, 90, -day), regular(2, 120, day)}, 90, 90, 0},
+        {"same start, later id wins", []models.ProductPrice{regular(2, 97, -day), regular(1, 90, -day)}, 97, 97, 0},
+        {"promo", []models.ProductPrice{regular(1, 90, -day), promo(2, 70, -day, day, models.PriceStatusActive)}, 70, 90, 2},
+        {"lowest promo", []models.ProductPrice{
+            promo(1, 80, -day, day, models.PriceStatusActive),
+            promo(2, 60, -day, day, models.PriceStatusScheduled),
+            promo(3, 60, -day, day, models.PriceStatusActive),
+        }, 60, 100, 2},
+        {"promo ended", []models.ProductPrice{promo(1, 70, -2 * day, 0, models.PriceStatusActive)}, 100, 100, 0},
+        {"promo not started", []models.ProductPrice{promo(1, 70, time.Hour, day, models.PriceStatusScheduled)}, 100, 100, 0},
+        {"expired promo", []models.ProductPrice{promo(1, 70, -day, day, models.PriceStatusExpired)}, 100, 100, 0},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := selectEffectivePrice(100, tt.prices, now)
+            var promoID uint
+            if got.Promo != nil {
+                promoID = got.Promo.ID
+            }
+            if got.Price != tt.wantPrice || got.RegularPrice != tt.wantRegular || promoID != tt.wantPromo {
+                t.Errorf("selectEffectivePrice() = {Price: %v, RegularPrice: %v, Promo: %d}, want {Price: %v, RegularPrice: %v, Promo: %d}",
+                    got.Price, got.RegularPrice, promoID, tt.wantPrice, tt.wantRegular, tt.wantPromo)
+            }
+        })
+    }
+}
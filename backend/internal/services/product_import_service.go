@@ -0,0 +1,459 @@
+package services
+
+import (
+    "bytes"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/xuri/excelize/v2"
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+)
+
+// Форматы файлов товаров
+const (
+    ProductFileCSV  = "csv"
+    ProductFileXLSX = "xlsx"
+)
+
+// MaxProductFileSize - ограничение на размер загружаемого файла товаров
+const MaxProductFileSize = 20 << 20
+
+// SectorPathSeparator разделяет уровни в пути сектора: "Молочные продукты/Йогурты и десерты"
+const SectorPathSeparator = "/"
+
+var ErrInvalidProductFile = errors.New("invalid product file, expected CSV or XLSX")
+
+// productColumnAliases - допустимые заголовки колонок, в том числе из русскоязычных выгрузок
+var productColumnAliases = map[string]string{
+    "sku":          "sku",
+    "артикул":      "sku",
+    "name":         "name",
+    "название":     "name",
+    "наименование": "name",
+    "description":  "description",
+    "описание":     "description",
+    "price":        "price",
+    "цена":         "price",
+    "sector":       "sector",
+    "sector_path":  "sector",
+    "сектор":       "sector",
+    "раздел":       "sector",
+}
+
+// productExportColumns - колонки выгрузки, совпадают с форматом загрузки
+var productExportColumns = []string{"sku", "name", "description", "price", "sector"}
+
+// ProductRowError - ошибка в строке файла (нумерация строк как в таблице, заголовок - строка 1)
+type ProductRowError struct {
+    Row     int    `json:"row"`
+    SKU     string `json:"sku,omitempty"`
+    Message string `json:"message"`
+}
+
+// ProductImportResult - итог загрузки; строки с ошибками пропускаются, остальные сохраняются
+type ProductImportResult struct {
+    Rows           int               `json:"rows"`
+    Created        int               `json:"created"`
+    Updated        int               `json:"updated"`
+    SectorsCreated int               `json:"sectors_created"`
+    Errors         []ProductRowError `json:"errors"`
+}
+
+type ProductImportService struct {
+    db *gorm.DB
+}
+
+func NewProductImportService(db *gorm.DB) *ProductImportService {
+    return &ProductImportService{db: db}
+}
+
+// Import загружает товары магазина из CSV или XLSX с обновлением по артикулу.
+// Артикулы из единого каталога связываются с ним. Отсутствующие секторы из пути создаются, колонки, которых нет в файле, у существующих товаров не меняются
+func (s *ProductImportService) Import(storeID uint, r io.Reader) (*ProductImportResult, error) {
+    data, err := io.ReadAll(io.LimitReader(r, MaxProductFileSize+1))
+    if err != nil {
+        return nil, err
+    }
+    if len(data) > MaxProductFileSize {
+        return nil, ErrFileTooLarge
+    }
+    rows, err := readProductRows(data)
+    if err != nil {
+        return nil, err
+    }
+
+    result := &ProductImportResult{Errors: []ProductRowError{}}
+    if len(rows) == 0 {
+        result.Errors = append(result.Errors, ProductRowError{Row: 1, Message: "file is empty"})
+        return result, nil
+    }
+
+    columns := make(map[string]int)
+    for i, title := range rows[0] {
+        if key, ok := productColumnAliases[strings.ToLower(strings.TrimSpace(title))]; ok {
+            if _, dup := columns[key]; !dup {
+                columns[key] = i
+            }
+        }
+    }
+    for _, required := range []string{"sku", "name"} {
+        if _, ok := columns[required]; !ok {
+            result.Errors = append(result.Errors, ProductRowError{Row: 1, Message: "missing column " + required})
+        }
+    }
+    if len(result.Errors) > 0 {
+        return result, nil
+    }
+
+    err = s.db.Transaction(func(tx *gorm.DB) error {
+        var existing []models.Product
+        if err := tx.Joins("JOIN sectors ON sectors.id = products.sector_id").
+            Where("sectors.store_id = ? AND products.sku <> ''", storeID).Find(&existing).Error; err != nil {
+            return err
+        }
+        bySKU := make(map[string]*models.Product, len(existing))
+        for i := range existing {
+            bySKU[existing[i].SKU] = &existing[i]
+        }
+        // Файл содержит обычные цены, акционные в Product.Price с ними не сравниваются
+        now := time.Now()
+        current, err := effectivePrices(tx, existing, now)
+        if err != nil {
+            return err
+        }
+
+        // Товары с артикулом из единого каталога привязываются к нему
+        var catalog []models.CatalogItem
+        if err := tx.Select("id", "sku").Find(&catalog).Error; err != nil {
+            return err
+        }
+        catalogIDs := make(map[string]uint, len(catalog))
+        for _, item := range catalog {
+            catalogIDs[item.SKU] = item.ID
+        }
+
+        resolver, err := newSectorResolver(tx, storeID)
+        if err != nil {
+            return err
+        }
+
+        seen := make(map[string]int)
+        for i, row := range rows[1:] {
+            rowNum := i + 2
+            cell := func(key string) (string, bool) {
+                idx, ok := columns[key]
+                if !ok {
+                    return "", false
+                }
+                if idx >= len(row) {
+                    return "", true
+                }
+                return strings.TrimSpace(row[idx]), true
+            }
+            if isBlankRow(row) {
+                continue
+            }
+            result.Rows++
+
+            sku, _ := cell("sku")
+            rowErr := func(message string) {
+                result.Errors = append(result.Errors, ProductRowError{Row: rowNum, SKU: sku, Message: message})
+            }
+            if sku == "" {
+                rowErr("sku is required")
+                continue
+            }
+            if first, dup := seen[sku]; dup {
+                rowErr(fmt.Sprintf("duplicate sku, already in row %d", first))
+                continue
+            }
+            seen[sku] = rowNum
+
+            name, _ := cell("name")
+            if name == "" {
+                rowErr("name is required")
+                continue
+            }
+            priceText, hasPrice := cell("price")
+            var price float64
+            if hasPrice && priceText != "" {
+                if price, err = parsePrice(priceText); err != nil {
+                    rowErr(err.Error())
+                    continue
+                }
+            }
+            sectorPath, _ := cell("sector")
+            product, exists := bySKU[sku]
+            if !exists && sectorPath == "" {
+                rowErr("sector is required for new products")
+                continue
+            }
+
+            var previous *float64
+            if exists {
+                regular := current[product.ID].RegularPrice
+                previous = &regular
+                product.Price = regular
+            } else {
+                product = &models.Product{SKU: sku}
+            }
+            if id, ok := catalogIDs[sku]; ok {
+                product.CatalogItemID = &id
+            }
+            product.Name = name
+            if description, ok := cell("description"); ok {
+                product.Description = description
+            }
+            if hasPrice && priceText != "" {
+                product.Price = price
+            }
+            if sectorPath != "" {
+                sectorID, created, err := resolver.resolve(sectorPath)
+                if err != nil {
+                    return err
+                }
+                if sectorID == 0 {
+                    rowErr("invalid sector path")
+                    continue
+                }
+                result.SectorsCreated += created
+                product.SectorID = sectorID
+            }
+
+            if err := tx.Save(product).Error; err != nil {
+                return err
+            }
+            if err := recordPriceChange(tx, product, previous, "import", now); err != nil {
+                return err
+            }
+            if exists {
+                result.Updated++
+            } else {
+                result.Created++
+                bySKU[sku] = product
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result, nil
+}
+
+// Export выгружает товары магазина в том же формате, что принимает Import
+func (s *ProductImportService) Export(storeID uint, format string, w io.Writer) error {
+    var sectors []models.Sector
+    if err := s.db.Where("store_id = ?", storeID).Find(&sectors).Error; err != nil {
+        return err
+    }
+    paths := make(map[uint]string)
+    var order []uint
+    WalkSectors(BuildSectorTree(sectors), func(sector models.Sector, path []string) {
+        paths[sector.ID] = strings.Join(path, SectorPathSeparator)
+        order = append(order, sector.ID)
+    })
+
+    var products []models.Product
+    if len(order) > 0 {
+        if err := s.db.Where("sector_id IN ?", order).Order("sku, name").Find(&products).Error; err != nil {
+            return err
+        }
+    }
+    bySector := make(map[uint][]models.Product)
+    for _, product := range products {
+        bySector[product.SectorID] = append(bySector[product.SectorID], product)
+    }
+
+    // Выгружается обычная цена, чтобы повторный импорт не превратил акционную цену в обычную
+    prices, err := effectivePrices(s.db, products, time.Now())
+    if err != nil {
+        return err
+    }
+
+    rows := [][]string{productExportColumns}
+    for _, id := range order {
+        for _, p := range bySector[id] {
+            rows = append(rows, []string{p.SKU, p.Name, p.Description, strconv.FormatFloat(prices[p.ID].RegularPrice, 'f', 2, 64), paths[id]})
+        }
+    }
+
+    if format == ProductFileXLSX {
+        return writeProductXLSX(w, rows)
+    }
+    // BOM нужен, чтобы Excel открыл UTF-8 с кириллицей без искажений
+    if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+        return err
+    }
+    cw := csv.NewWriter(w)
+    if err := cw.WriteAll(rows); err != nil {
+        return err
+    }
+    return cw.Error()
+}
+
+// readProductRows читает строки таблицы, формат определяется по содержимому
+func readProductRows(data []byte) ([][]string, error) {
+    if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+        f, err := excelize.OpenReader(bytes.NewReader(data))
+        if err != nil {
+            return nil, ErrInvalidProductFile
+        }
+        defer f.Close()
+        sheets := f.GetSheetList()
+        if len(sheets) == 0 {
+            return nil, nil
+        }
+        rows, err := f.GetRows(sheets[0])
+        if err != nil {
+            return nil, ErrInvalidProductFile
+        }
+        return rows, nil
+    }
+
+    data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+    cr := csv.NewReader(bytes.NewReader(data))
+    cr.Comma = detectCSVDelimiter(data)
+    cr.FieldsPerRecord = -1
+    cr.LazyQuotes = true
+    rows, err := cr.ReadAll()
+    if err != nil {
+        return nil, ErrInvalidProductFile
+    }
+    return rows, nil
+}
+
+// detectCSVDelimiter выбирает между запятой и точкой с запятой (русский Excel сохраняет CSV с ";")
+func detectCSVDelimiter(data []byte) rune {
+    header := data
+    if i := bytes.IndexByte(data, '\n'); i >= 0 {
+        header = data[:i]
+    }
+    if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+        return ';'
+    }
+    return ','
+}
+
+func writeProductXLSX(w io.Writer, rows [][]string) error {
+    f := excelize.NewFile()
+    defer f.Close()
+    sheet := "Товары"
+    if err := f.SetSheetName("Sheet1", sheet); err != nil {
+        return err
+    }
+    sw, err := f.NewStreamWriter(sheet)
+    if err != nil {
+        return err
+    }
+    for i, row := range rows {
+        values := make([]interface{}, len(row))
+        for j, v := range row {
+            values[j] = v
+        }
+        // Цена записывается числом, чтобы с ней можно было считать в Excel
+        if i > 0 {
+            if price, err := strconv.ParseFloat(row[3], 64); err == nil {
+                values[3] = price
+            }
+        }
+        cellName, _ := excelize.CoordinatesToCellName(1, i+1)
+        if err := sw.SetRow(cellName, values); err != nil {
+            return err
+        }
+    }
+    if err := sw.Flush(); err != nil {
+        return err
+    }
+    return f.Write(w)
+}
+
+// parsePrice разбирает цену в форматах "89.90", "89,90" и "1 299,00"
+func parsePrice(s string) (float64, error) {
+    s = strings.NewReplacer(" ", "", " ", "", ",", ".").Replace(s)
+    price, err := strconv.ParseFloat(s, 64)
+    if err != nil {
+        return 0, errors.New("invalid price")
+    }
+    if price < 0 {
+        return 0, errors.New("price must not be negative")
+    }
+    return price, nil
+}
+
+func isBlankRow(row []string) bool {
+    for _, v := range row {
+        if strings.TrimSpace(v) != "" {
+            return false
+        }
+    }
+    return true
+}
+
+// sectorResolver находит секторы по пути из названий и создает недостающие
+type sectorResolver struct {
+    tx      *gorm.DB
+    storeID uint
+    byName  map[string]uint // Ключ: id родителя + название в нижнем регистре
+}
+
+func newSectorResolver(tx *gorm.DB, storeID uint) (*sectorResolver, error) {
+    var sectors []models.Sector
+    if err := tx.Where("store_id = ?", storeID).Order("id").Find(&sectors).Error; err != nil {
+        return nil, err
+    }
+    resolver := &sectorResolver{tx: tx, storeID: storeID, byName: make(map[string]uint)}
+    for _, sector := range sectors {
+        var parentID uint
+        if sector.ParentID != nil {
+            parentID = *sector.ParentID
+        }
+        key := sectorKey(parentID, sector.Name)
+        if _, ok := resolver.byName[key]; !ok {
+            resolver.byName[key] = sector.ID
+        }
+    }
+    return resolver, nil
+}
+
+func sectorKey(parentID uint, name string) string {
+    return strconv.FormatUint(uint64(parentID), 10) + "/" + strings.ToLower(name)
+}
+
+// resolve возвращает id сектора по пути и количество созданных секторов; 0 - путь пустой
+func (r *sectorResolver) resolve(path string) (uint, int, error) {
+    var parentID uint
+    created := 0
+    level := 0
+    for _, part := range strings.Split(path, SectorPathSeparator) {
+        name := strings.TrimSpace(part)
+        if name == "" {
+            continue
+        }
+        key := sectorKey(parentID, name)
+        id, ok := r.byName[key]
+        if !ok {
+            sector := models.Sector{StoreID: r.storeID, Name: name, Level: level}
+            if parentID != 0 {
+                parent := parentID
+                sector.ParentID = &parent
+            }
+            if err := r.tx.Create(&sector).Error; err != nil {
+                return 0, created, err
+            }
+            id = sector.ID
+            r.byName[key] = id
+            created++
+        }
+        parentID = id
+        level++
+    }
+    return parentID, created, nil
+}
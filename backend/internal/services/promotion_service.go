@@ -0,0 +1,303 @@
+package services
+
+import (
+    "errors"
+    "math"
+    "sort"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+// PromoZoneType - тип элемента карты для промо-зоны
+const PromoZoneType = "promo"
+
+var ErrPromotionNotFound = errors.New("promotion not found")
+
+// PromotionValidationError перечисляет ошибки в описании акции
+type PromotionValidationError struct {
+    Errors []string
+}
+
+func (e *PromotionValidationError) Error() string {
+    return "invalid promotion: " + strings.Join(e.Errors, "; ")
+}
+
+// NearbyPromotion - действующая акция и расстояние до ближайшего ее места: промо-зоны или товара
+type NearbyPromotion struct {
+    Promotion models.Promotion `json:"promotion"`
+    Distance  float64          `json:"distance"` // В метрах, 0 - покупатель в промо-зоне
+    Point     utils.Point      `json:"point"`    // Ближайшая точка акции
+}
+
+type PromotionService struct {
+    db *gorm.DB
+}
+
+func NewPromotionService(db *gorm.DB) *PromotionService {
+    return &PromotionService{db: db}
+}
+
+// List возвращает все акции магазина, включая прошедшие и будущие
+func (s *PromotionService) List(storeID uint) ([]models.Promotion, error) {
+    var promotions []models.Promotion
+    if err := s.db.Where("store_id = ?", storeID).Order("valid_from DESC, id").Find(&promotions).Error; err != nil {
+        return nil, err
+    }
+    return promotions, s.loadProducts(promotions, false)
+}
+
+// Active возвращает акции магазина, действующие в момент now, вместе с товарами
+func (s *PromotionService) Active(storeID uint, now time.Time) ([]models.Promotion, error) {
+    var promotions []models.Promotion
+    if err := s.db.Where("store_id = ? AND valid_from <= ? AND valid_to > ?", storeID, now, now).
+        Order("valid_to, id").Find(&promotions).Error; err != nil {
+        return nil, err
+    }
+    return promotions, s.loadProducts(promotions, true)
+}
+
+func (s *PromotionService) Get(id uint) (*models.Promotion, error) {
+    var promotion models.Promotion
+    if err := s.db.First(&promotion, id).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrPromotionNotFound
+        }
+        return nil, err
+    }
+    promotions := []models.Promotion{promotion}
+    if err := s.loadProducts(promotions, true); err != nil {
+        return nil, err
+    }
+    return &promotions[0], nil
+}
+
+// Save создает акцию (ID = 0) или обновляет существующую, заменяя список товаров.
+// Период показа промо-зоны совпадает с периодом акции
+func (s *PromotionService) Save(promotion *models.Promotion) error {
+    if promotion.ID != 0 {
+        existing, err := s.Get(promotion.ID)
+        if err != nil {
+            return err
+        }
+        promotion.CreatedAt = existing.CreatedAt
+    }
+    if err := s.validate(promotion); err != nil {
+        return err
+    }
+    err := s.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Save(promotion).Error; err != nil {
+            return err
+        }
+        if err := tx.Where("promotion_id = ?", promotion.ID).Delete(&models.PromotionProduct{}).Error; err != nil {
+            return err
+        }
+        links := make([]models.PromotionProduct, 0, len(promotion.ProductIDs))
+        for _, id := range promotion.ProductIDs {
+            links = append(links, models.PromotionProduct{PromotionID: promotion.ID, ProductID: id})
+        }
+        if len(links) > 0 {
+            if err := tx.Create(&links).Error; err != nil {
+                return err
+            }
+        }
+        if promotion.ZoneID == nil {
+            return nil
+        }
+        return tx.Model(&models.MapElement{}).Where("id = ?", *promotion.ZoneID).
+            Updates(map[string]interface{}{"visible_from": promotion.ValidFrom, "visible_to": promotion.ValidTo}).Error
+    })
+    if err != nil {
+        return err
+    }
+    saved, err := s.Get(promotion.ID)
+    if err != nil {
+        return err
+    }
+    *promotion = *saved
+    return nil
+}
+
+// Delete удаляет акцию; ее промо-зона сразу скрывается с карты
+func (s *PromotionService) Delete(id uint) error {
+    promotion, err := s.Get(id)
+    if err != nil {
+        return err
+    }
+    return s.db.Transaction(func(tx *gorm.DB) error {
+        if promotion.ZoneID != nil {
+            if err := tx.Model(&models.MapElement{}).Where("id = ? AND type = ?", *promotion.ZoneID, PromoZoneType).
+                Update("visible_to", time.Now()).Error; err != nil {
+                return err
+            }
+        }
+        if err := tx.Where("promotion_id = ?", id).Delete(&models.PromotionProduct{}).Error; err != nil {
+            return err
+        }
+        return tx.Delete(&models.Promotion{}, id).Error
+    })
+}
+
+// Nearby возвращает действующие акции, промо-зона или товары которых находятся в радиусе radius метров
+// от точки покупателя, начиная с ближайших
+func (s *PromotionService) Nearby(storeID uint, point utils.Point, radius float64, now time.Time) ([]NearbyPromotion, error) {
+    promotions, err := s.Active(storeID, now)
+    if err != nil {
+        return nil, err
+    }
+
+    result := []NearbyPromotion{}
+    for _, promotion := range promotions {
+        best := NearbyPromotion{Promotion: promotion, Distance: math.Inf(1)}
+
+        if promotion.ZoneID != nil {
+            var zone models.MapElement
+            err := s.db.First(&zone, *promotion.ZoneID).Error
+            if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+                return nil, err
+            }
+            if err == nil {
+                best.Distance = utils.DistanceToRect(point, zone.PositionX, zone.PositionY, zone.Width, zone.Height, zone.Rotation)
+                best.Point = utils.Point{X: zone.PositionX + zone.Width/2, Y: zone.PositionY + zone.Height/2}
+            }
+        }
+
+        for i := range promotion.Products {
+            location, err := locateProduct(s.db, &promotion.Products[i])
+            if err != nil {
+                return nil, err
+            }
+            if d := math.Hypot(location.AccessPoint.X-point.X, location.AccessPoint.Y-point.Y); d < best.Distance {
+                best.Distance, best.Point = d, location.AccessPoint
+            }
+        }
+
+        if best.Distance <= radius {
+            best.Distance = round3(best.Distance)
+            result = append(result, best)
+        }
+    }
+    sort.SliceStable(result, func(i, j int) bool { return result[i].Distance < result[j].Distance })
+    return result, nil
+}
+
+// loadProducts заполняет ProductIDs и, если withProducts, сами товары акций
+func (s *PromotionService) loadProducts(promotions []models.Promotion, withProducts bool) error {
+    if len(promotions) == 0 {
+        return nil
+    }
+    ids := make([]uint, len(promotions))
+    index := make(map[uint]int, len(promotions))
+    for i := range promotions {
+        ids[i] = promotions[i].ID
+        index[promotions[i].ID] = i
+        promotions[i].ProductIDs = []uint{}
+    }
+
+    var links []models.PromotionProduct
+    if err := s.db.Where("promotion_id IN ?", ids).Order("id").Find(&links).Error; err != nil {
+        return err
+    }
+    productIDs := make([]uint, 0, len(links))
+    for _, link := range links {
+        p := &promotions[index[link.PromotionID]]
+        p.ProductIDs = append(p.ProductIDs, link.ProductID)
+        productIDs = append(productIDs, link.ProductID)
+    }
+    if !withProducts || len(productIDs) == 0 {
+        return nil
+    }
+
+    var products []models.Product
+    if err := s.db.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+        return err
+    }
+    byID := make(map[uint]models.Product, len(products))
+    for _, product := range products {
+        byID[product.ID] = product
+    }
+    for i := range promotions {
+        for _, id := range promotions[i].ProductIDs {
+            if product, ok := byID[id]; ok {
+                promotions[i].Products = append(promotions[i].Products, product)
+            }
+        }
+    }
+    return nil
+}
+
+// validate проверяет условия акции, период и принадлежность товаров и промо-зоны магазину
+func (s *PromotionService) validate(promotion *models.Promotion) error {
+    var problems []string
+    promotion.Title = strings.TrimSpace(promotion.Title)
+    if promotion.Title == "" {
+        problems = append(problems, "title is required")
+    }
+    switch promotion.Type {
+    case models.PromotionTypeDiscount:
+        if promotion.DiscountPercent <= 0 || promotion.DiscountPercent >= 100 {
+            problems = append(problems, "discount_percent must be between 0 and 100")
+        }
+        promotion.BundleQuantity, promotion.BundlePrice = 0, 0
+    case models.PromotionTypeBundle:
+        if promotion.BundleQuantity < 2 {
+            problems = append(problems, "bundle_quantity must be at least 2")
+        }
+        if promotion.BundlePrice <= 0 {
+            problems = append(problems, "bundle_price must be positive")
+        }
+        promotion.DiscountPercent = 0
+    default:
+        problems = append(problems, "type must be discount or bundle")
+    }
+    if promotion.ValidFrom.IsZero() || promotion.ValidTo.IsZero() {
+        problems = append(problems, "valid_from and valid_to are required")
+    } else if !promotion.ValidTo.After(promotion.ValidFrom) {
+        problems = append(problems, "valid_to must be after valid_from")
+    }
+
+    seen := make(map[uint]bool)
+    unique := promotion.ProductIDs[:0]
+    for _, id := range promotion.ProductIDs {
+        if !seen[id] {
+            seen[id] = true
+            unique = append(unique, id)
+        }
+    }
+    promotion.ProductIDs = unique
+    if len(unique) > 0 {
+        var count int64
+        if err := s.db.Model(&models.Product{}).Joins("JOIN sectors ON sectors.id = products.sector_id").
+            Where("products.id IN ? AND sectors.store_id = ?", unique, promotion.StoreID).Count(&count).Error; err != nil {
+            return err
+        }
+        if int(count) != len(unique) {
+            problems = append(problems, "all products must belong to the store")
+        }
+    }
+    if len(unique) == 0 && promotion.ZoneID == nil {
+        problems = append(problems, "promotion needs products or a promo zone")
+    }
+
+    if promotion.ZoneID != nil {
+        var zone models.MapElement
+        err := s.db.Where("id = ? AND store_id = ?", *promotion.ZoneID, promotion.StoreID).First(&zone).Error
+        switch {
+        case errors.Is(err, gorm.ErrRecordNotFound):
+            problems = append(problems, "zone must be a map element of the store")
+        case err != nil:
+            return err
+        case zone.Type != PromoZoneType:
+            problems = append(problems, "zone must be a map element of type promo")
+        }
+    }
+
+    if len(problems) > 0 {
+        return &PromotionValidationError{Errors: problems}
+    }
+    return nil
+}
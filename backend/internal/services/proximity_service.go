@@ -0,0 +1,361 @@
+package services
+
+import (
+    "errors"
+    "math"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+)
+
+const (
+    // PresenceTimeout - после такого перерыва в данных устройство считается покинувшим секторы
+    PresenceTimeout = 5 * time.Minute
+    // DwellEventInterval - период событий dwell при нахождении в секторе
+    DwellEventInterval = 30 * time.Second
+    // MaxOffersPerHour - ограничение количества предложений на одно устройство
+    MaxOffersPerHour = 3
+    // defaultOfferCooldown - повтор одного предложения устройству, если у правила не задан Cooldown
+    defaultOfferCooldown = 24 * time.Hour
+)
+
+var (
+    ErrDeviceRequired    = errors.New("device_id is required")
+    ErrOfferRuleNotFound = errors.New("offer rule not found")
+)
+
+// OfferRuleValidationError перечисляет ошибки в правиле показа предложения
+type OfferRuleValidationError struct {
+    Errors []string
+}
+
+func (e *OfferRuleValidationError) Error() string {
+    return "invalid offer rule: " + strings.Join(e.Errors, "; ")
+}
+
+// Offer - предложение, которое клиент показывает покупателю
+type Offer struct {
+    ImpressionID uint   `json:"impression_id"`
+    RuleID       uint   `json:"rule_id"`
+    SectorID     uint   `json:"sector_id"`
+    Trigger      string `json:"trigger"`
+    Title        string `json:"title"`
+    Message      string `json:"message"`
+    ProductID    *uint  `json:"product_id"`
+    PromotionID  *uint  `json:"promotion_id"`
+}
+
+// ProximityResult - положение устройства, события геозон и предложения по итогам одного отчета
+type ProximityResult struct {
+    Position  models.PositionFix     `json:"position"`
+    SectorIDs []uint                 `json:"sector_ids"` // Секторы, содержащие точку, от внешнего к вложенному
+    Events    []models.GeofenceEvent `json:"events"`
+    Offers    []Offer                `json:"offers"`
+}
+
+// ImpressionQuery - фильтр журнала показанных предложений
+type ImpressionQuery struct {
+    DeviceID string
+    RuleID   uint
+    From     *time.Time
+    To       *time.Time
+    Limit    int
+}
+
+type ProximityService struct {
+    db          *gorm.DB
+    positioning *PositioningService
+}
+
+func NewProximityService(db *gorm.DB) *ProximityService {
+    return &ProximityService{db: db, positioning: NewPositioningService(db)}
+}
+
+// Report обрабатывает положение устройства: определяет вход, выход и задержку в секторах
+// и подбирает предложения по правилам с учетом ограничений частоты
+func (s *ProximityService) Report(storeID uint, report PositionReport, now time.Time) (*ProximityResult, error) {
+    report.DeviceID = strings.TrimSpace(report.DeviceID)
+    if report.DeviceID == "" {
+        return nil, ErrDeviceRequired
+    }
+    fix, sectors, err := s.positioning.Record(storeID, report, now)
+    if err != nil {
+        return nil, err
+    }
+
+    result := &ProximityResult{Position: *fix, SectorIDs: []uint{}, Events: []models.GeofenceEvent{}, Offers: []Offer{}}
+    inside := make(map[uint]bool, len(sectors))
+    for _, sector := range sectors {
+        inside[sector.ID] = true
+        result.SectorIDs = append(result.SectorIDs, sector.ID)
+    }
+
+    err = s.db.Transaction(func(tx *gorm.DB) error {
+        var presences []models.DevicePresence
+        if err := tx.Where("store_id = ? AND device_id = ?", storeID, report.DeviceID).Find(&presences).Error; err != nil {
+            return err
+        }
+
+        emit := func(sectorID uint, kind string, dwell float64, at time.Time, notify bool) error {
+            event := models.GeofenceEvent{StoreID: storeID, DeviceID: report.DeviceID, SectorID: sectorID,
+                Type: kind, Dwell: round3(dwell), CreatedAt: at}
+            if err := tx.Create(&event).Error; err != nil {
+                return err
+            }
+            result.Events = append(result.Events, event)
+            if !notify {
+                return nil
+            }
+            offers, err := s.evaluate(tx, event, now)
+            if err != nil {
+                return err
+            }
+            result.Offers = append(result.Offers, offers...)
+            return nil
+        }
+
+        present := make(map[uint]bool, len(presences))
+        for i := range presences {
+            p := &presences[i]
+            stale := now.Sub(p.LastSeenAt) > PresenceTimeout
+            if stale || !inside[p.SectorID] {
+                // После долгого перерыва выход фиксируется временем последнего сигнала, без предложений
+                at := now
+                if stale {
+                    at = p.LastSeenAt
+                }
+                if err := emit(p.SectorID, models.GeofenceExit, at.Sub(p.EnteredAt).Seconds(), at, !stale); err != nil {
+                    return err
+                }
+                if err := tx.Delete(p).Error; err != nil {
+                    return err
+                }
+                continue
+            }
+
+            present[p.SectorID] = true
+            dwell := now.Sub(p.EnteredAt).Seconds()
+            crossed, err := s.dwellThresholdCrossed(tx, p, dwell)
+            if err != nil {
+                return err
+            }
+            if crossed {
+                if err := emit(p.SectorID, models.GeofenceDwell, dwell, now, true); err != nil {
+                    return err
+                }
+                p.DwellHandled = dwell
+            }
+            p.LastSeenAt = now
+            if err := tx.Save(p).Error; err != nil {
+                return err
+            }
+        }
+
+        for _, sector := range sectors {
+            if present[sector.ID] {
+                continue
+            }
+            presence := models.DevicePresence{StoreID: storeID, DeviceID: report.DeviceID, SectorID: sector.ID, EnteredAt: now, LastSeenAt: now}
+            if err := tx.Create(&presence).Error; err != nil {
+                return err
+            }
+            if err := emit(sector.ID, models.GeofenceEnter, 0, now, true); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result, nil
+}
+
+// dwellThresholdCrossed проверяет, прошло ли время в секторе очередной интервал DwellEventInterval
+// или порог одного из правил dwell с момента прошлой проверки
+func (s *ProximityService) dwellThresholdCrossed(tx *gorm.DB, p *models.DevicePresence, dwell float64) (bool, error) {
+    interval := DwellEventInterval.Seconds()
+    if math.Floor(dwell/interval) > math.Floor(p.DwellHandled/interval) {
+        return true, nil
+    }
+    var rules int64
+    err := tx.Model(&models.OfferRule{}).Where("store_id = ? AND sector_id = ? AND trigger_type = ? AND min_dwell > ? AND min_dwell <= ?",
+        p.StoreID, p.SectorID, models.GeofenceDwell, p.DwellHandled, dwell).Count(&rules).Error
+    return rules > 0, err
+}
+
+// evaluate подбирает правила для события и записывает показы в журнал.
+// Правило dwell срабатывает один раз за посещение - когда время в секторе впервые превышает MinDwell
+func (s *ProximityService) evaluate(tx *gorm.DB, event models.GeofenceEvent, now time.Time) ([]Offer, error) {
+    query := tx.Where("store_id = ? AND sector_id = ? AND trigger_type = ? AND is_active = ?", event.StoreID, event.SectorID, event.Type, true).
+        Where("(valid_from IS NULL OR valid_from <= ?) AND (valid_to IS NULL OR valid_to > ?)", now, now)
+    switch event.Type {
+    case models.GeofenceDwell:
+        var previous float64
+        var last models.GeofenceEvent
+        err := tx.Where("store_id = ? AND device_id = ? AND sector_id = ? AND id < ?", event.StoreID, event.DeviceID, event.SectorID, event.ID).
+            Order("id DESC").First(&last).Error
+        if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, err
+        }
+        if err == nil && last.Type == models.GeofenceDwell {
+            previous = last.Dwell
+        }
+        query = query.Where("min_dwell > ? AND min_dwell <= ?", previous, event.Dwell)
+    case models.GeofenceExit:
+        query = query.Where("min_dwell <= ?", event.Dwell)
+    }
+    var rules []models.OfferRule
+    if err := query.Order("id").Find(&rules).Error; err != nil {
+        return nil, err
+    }
+
+    offers := []Offer{}
+    for _, rule := range rules {
+        var shown int64
+        if err := tx.Model(&models.OfferImpression{}).Where("store_id = ? AND device_id = ? AND created_at > ?",
+            event.StoreID, event.DeviceID, now.Add(-time.Hour)).Count(&shown).Error; err != nil {
+            return nil, err
+        }
+        if shown >= MaxOffersPerHour {
+            break
+        }
+
+        cooldown := time.Duration(rule.Cooldown) * time.Second
+        if cooldown <= 0 {
+            cooldown = defaultOfferCooldown
+        }
+        var repeated int64
+        if err := tx.Model(&models.OfferImpression{}).Where("rule_id = ? AND device_id = ? AND created_at > ?",
+            rule.ID, event.DeviceID, now.Add(-cooldown)).Count(&repeated).Error; err != nil {
+            return nil, err
+        }
+        if repeated > 0 {
+            continue
+        }
+
+        impression := models.OfferImpression{StoreID: event.StoreID, RuleID: rule.ID, DeviceID: event.DeviceID, EventID: event.ID, CreatedAt: now}
+        if err := tx.Create(&impression).Error; err != nil {
+            return nil, err
+        }
+        offers = append(offers, Offer{
+            ImpressionID: impression.ID,
+            RuleID:       rule.ID,
+            SectorID:     rule.SectorID,
+            Trigger:      rule.Trigger,
+            Title:        rule.Title,
+            Message:      rule.Message,
+            ProductID:    rule.ProductID,
+            PromotionID:  rule.PromotionID,
+        })
+    }
+    return offers, nil
+}
+
+func (s *ProximityService) ListRules(storeID uint) ([]models.OfferRule, error) {
+    var rules []models.OfferRule
+    err := s.db.Where("store_id = ?", storeID).Order("sector_id, id").Find(&rules).Error
+    return rules, err
+}
+
+func (s *ProximityService) GetRule(id uint) (*models.OfferRule, error) {
+    var rule models.OfferRule
+    err := s.db.First(&rule, id).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, ErrOfferRuleNotFound
+    }
+    return &rule, err
+}
+
+// SaveRule создает правило (ID = 0) или обновляет существующее
+func (s *ProximityService) SaveRule(rule *models.OfferRule) error {
+    var problems []string
+    rule.Title = strings.TrimSpace(rule.Title)
+    if rule.Title == "" {
+        problems = append(problems, "title is required")
+    }
+    switch rule.Trigger {
+    case models.GeofenceEnter:
+        rule.MinDwell = 0
+    case models.GeofenceDwell:
+        if rule.MinDwell <= 0 {
+            problems = append(problems, "min_dwell must be positive for dwell rules")
+        }
+    case models.GeofenceExit:
+        if rule.MinDwell < 0 {
+            problems = append(problems, "min_dwell must not be negative")
+        }
+    default:
+        problems = append(problems, "trigger must be enter, exit or dwell")
+    }
+    if rule.Cooldown < 0 {
+        problems = append(problems, "cooldown must not be negative")
+    }
+    if rule.ValidFrom != nil && rule.ValidTo != nil && !rule.ValidTo.After(*rule.ValidFrom) {
+        problems = append(problems, "valid_to must be after valid_from")
+    }
+
+    var count int64
+    if err := s.db.Model(&models.Sector{}).Where("id = ? AND store_id = ?", rule.SectorID, rule.StoreID).Count(&count).Error; err != nil {
+        return err
+    }
+    if count == 0 {
+        problems = append(problems, "sector does not belong to the store")
+    }
+    if rule.ProductID != nil {
+        if err := s.db.Model(&models.Product{}).Joins("JOIN sectors ON sectors.id = products.sector_id").
+            Where("products.id = ? AND sectors.store_id = ?", *rule.ProductID, rule.StoreID).Count(&count).Error; err != nil {
+            return err
+        }
+        if count == 0 {
+            problems = append(problems, "product is not in this store")
+        }
+    }
+    if rule.PromotionID != nil {
+        if err := s.db.Model(&models.Promotion{}).Where("id = ? AND store_id = ?", *rule.PromotionID, rule.StoreID).Count(&count).Error; err != nil {
+            return err
+        }
+        if count == 0 {
+            problems = append(problems, "promotion does not belong to the store")
+        }
+    }
+
+    if len(problems) > 0 {
+        return &OfferRuleValidationError{Errors: problems}
+    }
+    return s.db.Save(rule).Error
+}
+
+// DeleteRule удаляет правило; журнал показов сохраняется
+func (s *ProximityService) DeleteRule(id uint) error {
+    if _, err := s.GetRule(id); err != nil {
+        return err
+    }
+    return s.db.Delete(&models.OfferRule{}, id).Error
+}
+
+// Impressions возвращает журнал показанных предложений, начиная с последних
+func (s *ProximityService) Impressions(storeID uint, q ImpressionQuery) ([]models.OfferImpression, error) {
+    if q.Limit < 1 || q.Limit > 1000 {
+        q.Limit = 200
+    }
+    query := s.db.Where("store_id = ?", storeID)
+    if q.DeviceID != "" {
+        query = query.Where("device_id = ?", q.DeviceID)
+    }
+    if q.RuleID != 0 {
+        query = query.Where("rule_id = ?", q.RuleID)
+    }
+    if q.From != nil {
+        query = query.Where("created_at >= ?", *q.From)
+    }
+    if q.To != nil {
+        query = query.Where("created_at < ?", *q.To)
+    }
+    var impressions []models.OfferImpression
+    err := query.Order("created_at DESC, id DESC").Limit(q.Limit).Find(&impressions).Error
+    return impressions, err
+}
@@ -4,6 +4,8 @@ import (
     "context"
     "encoding/json"
     "fmt"
+    "strconv"
+    "strings"
     "time"
     
     "github.com/redis/go-redis/v9"
@@ -14,12 +16,16 @@ type QueueService struct {
 }
 
 func NewQueueService() *QueueService {
-    client := redis.NewClient(&redis.Options{
+    return &QueueService{redisClient: newRedisClient()}
+}
+
+// newRedisClient подключается к локальному Redis, общему для очередей и кэшей
+func newRedisClient() *redis.Client {
+    return redis.NewClient(&redis.Options{
         Addr:     "localhost:6379",
         Password: "",
         DB:       0,
     })
-    return &QueueService{redisClient: client}
 }
 
 func (qs *QueueService) UpdateQueue(storeID uint, checkoutNumber int, peopleCount int) error {
@@ -36,12 +42,32 @@ func (qs *QueueService) UpdateQueue(storeID uint, checkoutNumber int, peopleCoun
     return qs.redisClient.Set(ctx, key, jsonData, 10*time.Minute).Err()
 }
 
+// GetQueues возвращает число людей в очереди по номеру кассы; устаревшие данные истекают в Redis
 func (qs *QueueService) GetQueues(storeID uint) (map[int]int, error) {
-    // Пока заглушка с тестовыми данными
-    queues := map[int]int{
-        1: 3,
-        2: 5,
-        3: 1,
+    return queueLengths(qs.redisClient, storeID)
+}
+
+// queueLengths читает длины очередей касс магазина из Redis
+func queueLengths(client *redis.Client, storeID uint) (map[int]int, error) {
+    ctx := context.Background()
+    prefix := fmt.Sprintf("store:%d:queue:", storeID)
+    queues := make(map[int]int)
+    iter := client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+    for iter.Next(ctx) {
+        checkoutNumber, err := strconv.Atoi(strings.TrimPrefix(iter.Val(), prefix))
+        if err != nil {
+            continue
+        }
+        data, err := client.Get(ctx, iter.Val()).Bytes()
+        if err != nil {
+            continue // Ключ истек между SCAN и GET
+        }
+        var queue struct {
+            PeopleCount int `json:"people_count"`
+        }
+        if err := json.Unmarshal(data, &queue); err == nil {
+            queues[checkoutNumber] = queue.PeopleCount
+        }
     }
-    return queues, nil
+    return queues, iter.Err()
 }
\ No newline at end of file
@@ -0,0 +1,401 @@
+package services
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+// Действия в пошаговых подсказках
+const (
+    DirectionWalk      = "walk"
+    DirectionConnector = "connector"
+    DirectionArrive    = "arrive"
+)
+
+// Повороты в конце шага
+const (
+    TurnLeft        = "left"
+    TurnRight       = "right"
+    TurnSlightLeft  = "slight_left"
+    TurnSlightRight = "slight_right"
+    TurnAround      = "around"
+)
+
+const (
+    directionStraightAngle = 25.0 // Меньший поворот считается движением прямо
+    directionSlightAngle   = 60.0
+    directionAroundAngle   = 150.0
+    directionMinSegment    = 0.5 // Более короткие отрезки маршрута не дают отдельных шагов
+    landmarkRadius         = 3.0 // Насколько далеко от поворота ищется ориентир
+    sectorRadius           = 2.0 // Насколько далеко от точки упоминается сектор
+)
+
+var ErrUnknownLanguage = errors.New("unknown directions language")
+
+// DirectionStep - шаг подсказки: пройти Distance метров и, если задан Turn, повернуть
+type DirectionStep struct {
+    Action   string      `json:"action"`
+    Text     string      `json:"text"`
+    Distance float64     `json:"distance,omitempty"` // В метрах
+    Turn     string      `json:"turn,omitempty"`
+    Landmark string      `json:"landmark,omitempty"` // Ориентир у поворота
+    Sector   *SectorRef  `json:"sector,omitempty"`   // Сектор рядом с концом шага
+    Side     string      `json:"side,omitempty"`     // Где сектор: left, right, ahead, inside
+    FloorID  *uint       `json:"floor_id"`
+    Point    utils.Point `json:"point"` // Конец шага
+}
+
+// directionPhrases - формулировки подсказок на одном языке
+type directionPhrases struct {
+    walk      string // %d - метры
+    straight  string
+    turns     map[string]string
+    at        string            // %s - ориентир
+    sector    map[string]string // %s - название сектора, по стороне
+    up, down  string
+    transport map[string]string // %s - up или down, %s - этаж
+    arrive    string
+    arriveAt  string            // %s - товар или сектор
+    landmarks map[string]string // Ориентиры без названия по типу
+    quote     string            // %s - название
+}
+
+var directionLanguages = map[string]directionPhrases{
+    "ru": {
+        walk:     "пройдите %d м",
+        straight: " прямо",
+        turns: map[string]string{
+            TurnLeft: "поверните налево", TurnRight: "поверните направо",
+            TurnSlightLeft: "держитесь левее", TurnSlightRight: "держитесь правее", TurnAround: "развернитесь",
+        },
+        at: " у %s",
+        sector: map[string]string{
+            "left": "сектор %s слева", "right": "сектор %s справа", "ahead": "сектор %s впереди", "inside": "вы в секторе %s",
+        },
+        up:   "поднимитесь",
+        down: "спуститесь",
+        transport: map[string]string{
+            models.ConnectorStairs:     "%s по лестнице на этаж %s",
+            models.ConnectorEscalator:  "%s на эскалаторе на этаж %s",
+            models.ConnectorElevator:   "%s на лифте на этаж %s",
+            models.ConnectorTravelator: "%s на траволаторе на этаж %s",
+        },
+        arrive:   "вы на месте",
+        arriveAt: "вы на месте: %s",
+        landmarks: map[string]string{
+            "column": "колонны", "cashier": "кассы", "entrance": "входа", "exit": "выхода", "stairs": "лестницы",
+        },
+        quote: "«%s»",
+    },
+    "en": {
+        walk:     "walk %d m",
+        straight: " straight ahead",
+        turns: map[string]string{
+            TurnLeft: "turn left", TurnRight: "turn right",
+            TurnSlightLeft: "bear left", TurnSlightRight: "bear right", TurnAround: "turn around",
+        },
+        at: " at %s",
+        sector: map[string]string{
+            "left": "%s section on your left", "right": "%s section on your right", "ahead": "%s section ahead", "inside": "you are in the %s section",
+        },
+        up:   "up",
+        down: "down",
+        transport: map[string]string{
+            models.ConnectorStairs:     "take the stairs %s to floor %s",
+            models.ConnectorEscalator:  "take the escalator %s to floor %s",
+            models.ConnectorElevator:   "take the elevator %s to floor %s",
+            models.ConnectorTravelator: "take the travelator %s to floor %s",
+        },
+        arrive:   "you have arrived",
+        arriveAt: "you have arrived at %s",
+        landmarks: map[string]string{
+            "column": "the column", "cashier": "the checkout", "entrance": "the entrance", "exit": "the exit", "stairs": "the stairs",
+        },
+        quote: "\"%s\"",
+    },
+}
+
+// navLandmark - именованный объект карты, у которого можно повернуть
+type navLandmark struct {
+    label                string
+    x, y, w, h, rotation float64
+}
+
+// floorFeatures - секторы и ориентиры этажа
+type floorFeatures struct {
+    sectors   []models.Sector
+    landmarks []navLandmark
+}
+
+// Directions переводит маршрут в пошаговые подсказки на языке lang (ru или en)
+// с ориентирами из элементов карты, конструктивных элементов и секторов
+func (s *RouteService) Directions(storeID uint, route *Route, lang string) ([]DirectionStep, error) {
+    if lang == "" {
+        lang = "ru"
+    }
+    phrases, ok := directionLanguages[lang]
+    if !ok {
+        return nil, ErrUnknownLanguage
+    }
+
+    var floors []models.Floor
+    if err := s.db.Where("store_id = ?", storeID).Find(&floors).Error; err != nil {
+        return nil, err
+    }
+    floorByID := make(map[uint]models.Floor, len(floors))
+    for _, floor := range floors {
+        floorByID[floor.ID] = floor
+    }
+
+    features := make(map[uint]*floorFeatures)
+    steps := []DirectionStep{}
+    for i, leg := range route.Legs {
+        key := uint(0)
+        if leg.FloorID != nil {
+            key = *leg.FloorID
+        }
+        if features[key] == nil {
+            loaded, err := loadFloorFeatures(s.db, storeID, leg.FloorID, phrases)
+            if err != nil {
+                return nil, err
+            }
+            features[key] = loaded
+        }
+        steps = append(steps, legDirections(leg, features[key], phrases)...)
+
+        if leg.Connector != nil && i+1 < len(route.Legs) {
+            from, to := floorByID[key], floorByID[leg.Connector.ToFloorID]
+            verb := phrases.up
+            if to.Number < from.Number {
+                verb = phrases.down
+            }
+            text := fmt.Sprintf(phrases.transport[leg.Connector.Type], verb, fmt.Sprintf(phrases.quote, to.Name))
+            last := leg.Points[len(leg.Points)-1]
+            steps = append(steps, DirectionStep{Action: DirectionConnector, Text: capitalize(text), FloorID: leg.FloorID, Point: last})
+        }
+    }
+
+    arrive := phrases.arrive
+    if route.To.Label != "" {
+        arrive = fmt.Sprintf(phrases.arriveAt, fmt.Sprintf(phrases.quote, route.To.Label))
+    }
+    last := route.Legs[len(route.Legs)-1]
+    steps = append(steps, DirectionStep{Action: DirectionArrive, Text: capitalize(arrive), FloorID: last.FloorID, Point: route.To.Point})
+    return steps, nil
+}
+
+// FormatDirections собирает подсказки в нумерованный текст для печати
+func FormatDirections(steps []DirectionStep) string {
+    var b strings.Builder
+    for i, step := range steps {
+        fmt.Fprintf(&b, "%d. %s\n", i+1, step.Text)
+    }
+    return b.String()
+}
+
+func loadFloorFeatures(db *gorm.DB, storeID uint, floorID *uint, phrases directionPhrases) (*floorFeatures, error) {
+    scope, err := onFloor(db, storeID, floorID)
+    if err != nil {
+        return nil, err
+    }
+    features := &floorFeatures{}
+    if err := db.Scopes(scope).Where("store_id = ?", storeID).Order("level DESC, id").Find(&features.sectors).Error; err != nil {
+        return nil, err
+    }
+
+    var elements []models.MapElement
+    if err := db.Scopes(scope, VisibleElements(time.Now())).Where("store_id = ? AND type NOT IN ?", storeID, []string{"beacon", "wall", "sector"}).
+        Find(&elements).Error; err != nil {
+        return nil, err
+    }
+    for _, e := range elements {
+        label := phrases.landmarks[e.Type]
+        if name := strings.TrimSpace(e.Name); name != "" {
+            label = fmt.Sprintf(phrases.quote, name)
+        }
+        if label != "" {
+            features.landmarks = append(features.landmarks, navLandmark{label: label, x: e.PositionX, y: e.PositionY, w: e.Width, h: e.Height, rotation: e.Rotation})
+        }
+    }
+
+    var structural []models.StructuralElement
+    if err := db.Scopes(scope).Where("layout_id IN (?)", db.Model(&models.StoreLayout{}).Select("id").Where("store_id = ?", storeID)).
+        Find(&structural).Error; err != nil {
+        return nil, err
+    }
+    for _, e := range structural {
+        label := phrases.landmarks[e.Type]
+        if name, ok := parseMetadataName(e.Metadata); ok {
+            label = fmt.Sprintf(phrases.quote, name)
+        }
+        if label == "" || e.EndX != 0 || e.EndY != 0 {
+            continue
+        }
+        features.landmarks = append(features.landmarks, navLandmark{label: label, x: e.StartX, y: e.StartY, w: e.Width, h: e.Height, rotation: e.Rotation})
+    }
+    return features, nil
+}
+
+// parseMetadataName возвращает атрибут name из метаданных конструктивного элемента
+func parseMetadataName(metadata string) (string, bool) {
+    var attrs struct {
+        Name string `json:"name"`
+    }
+    if metadata == "" || json.Unmarshal([]byte(metadata), &attrs) != nil {
+        return "", false
+    }
+    name := strings.TrimSpace(attrs.Name)
+    return name, name != ""
+}
+
+// legDirections делит участок маршрута на шаги по поворотам
+func legDirections(leg RouteLeg, features *floorFeatures, phrases directionPhrases) []DirectionStep {
+    points := simplifyPath(leg.Points)
+    var steps []DirectionStep
+    var distance float64
+    var lastSector uint
+    for i := 1; i < len(points); i++ {
+        distance += math.Hypot(points[i].X-points[i-1].X, points[i].Y-points[i-1].Y)
+        turn := ""
+        if i+1 < len(points) {
+            turn = turnType(points[i-1], points[i], points[i+1])
+            if turn == "" {
+                continue
+            }
+        }
+
+        step := DirectionStep{Action: DirectionWalk, Distance: round3(distance), Turn: turn, FloorID: leg.FloorID, Point: points[i]}
+        text := fmt.Sprintf(phrases.walk, max(int(math.Round(distance)), 1))
+        if len(steps) > 0 {
+            text += phrases.straight
+        }
+        if turn != "" {
+            text += ", " + phrases.turns[turn]
+            if landmark := nearestLandmark(points[i], features.landmarks); landmark != "" {
+                step.Landmark = landmark
+                text += fmt.Sprintf(phrases.at, landmark)
+            }
+        }
+        if sector, side := sectorBeside(points[i-1], points[i], features.sectors); sector != nil && sector.ID != lastSector {
+            step.Sector, step.Side, lastSector = &SectorRef{ID: sector.ID, Name: sector.Name}, side, sector.ID
+            text += ", " + fmt.Sprintf(phrases.sector[side], fmt.Sprintf(phrases.quote, sector.Name))
+        }
+        step.Text = capitalize(text)
+        steps = append(steps, step)
+        distance = 0
+    }
+    return steps
+}
+
+// simplifyPath убирает точки, образующие слишком короткие отрезки
+func simplifyPath(points []utils.Point) []utils.Point {
+    if len(points) <= 2 {
+        return points
+    }
+    result := []utils.Point{points[0]}
+    for _, p := range points[1 : len(points)-1] {
+        last := result[len(result)-1]
+        if math.Hypot(p.X-last.X, p.Y-last.Y) >= directionMinSegment {
+            result = append(result, p)
+        }
+    }
+    end := points[len(points)-1]
+    if last := result[len(result)-1]; len(result) > 1 && math.Hypot(end.X-last.X, end.Y-last.Y) < directionMinSegment {
+        result = result[:len(result)-1]
+    }
+    return append(result, end)
+}
+
+// turnType определяет поворот в точке b при движении a -> b -> c.
+// Ось Y направлена вниз, поэтому положительный угол - поворот направо
+func turnType(a, b, c utils.Point) string {
+    angle := (math.Atan2(c.Y-b.Y, c.X-b.X) - math.Atan2(b.Y-a.Y, b.X-a.X)) * 180 / math.Pi
+    for angle > 180 {
+        angle -= 360
+    }
+    for angle <= -180 {
+        angle += 360
+    }
+    switch abs := math.Abs(angle); {
+    case abs < directionStraightAngle:
+        return ""
+    case abs >= directionAroundAngle:
+        return TurnAround
+    case abs < directionSlightAngle && angle > 0:
+        return TurnSlightRight
+    case abs < directionSlightAngle:
+        return TurnSlightLeft
+    case angle > 0:
+        return TurnRight
+    default:
+        return TurnLeft
+    }
+}
+
+func nearestLandmark(p utils.Point, landmarks []navLandmark) string {
+    best, bestDistance := "", landmarkRadius
+    for _, l := range landmarks {
+        if d := utils.DistanceToRect(p, l.x, l.y, l.w, l.h, l.rotation); d <= bestDistance {
+            best, bestDistance = l.label, d
+        }
+    }
+    return best
+}
+
+// sectorBeside возвращает самый вложенный сектор рядом с точкой b и его сторону
+// относительно направления движения a -> b. Секторы отсортированы по убыванию уровня
+func sectorBeside(a, b utils.Point, sectors []models.Sector) (*models.Sector, string) {
+    var best *models.Sector
+    bestDistance, bestLevel := sectorRadius, -1
+    var nearest utils.Point
+    for i := range sectors {
+        sector := &sectors[i]
+        if best != nil && sector.Level < bestLevel {
+            break
+        }
+        closest := utils.Point{
+            X: math.Max(sector.PositionX, math.Min(b.X, sector.PositionX+sector.Width)),
+            Y: math.Max(sector.PositionY, math.Min(b.Y, sector.PositionY+sector.Height)),
+        }
+        if d := math.Hypot(closest.X-b.X, closest.Y-b.Y); d <= bestDistance {
+            best, bestDistance, bestLevel, nearest = sector, d, sector.Level, closest
+        }
+    }
+    if best == nil {
+        return nil, ""
+    }
+    if bestDistance == 0 {
+        return best, "inside"
+    }
+
+    dx, dy := b.X-a.X, b.Y-a.Y
+    vx, vy := nearest.X-b.X, nearest.Y-b.Y
+    angle := math.Atan2(dx*vy-dy*vx, dx*vx+dy*vy) * 180 / math.Pi
+    switch {
+    case math.Abs(angle) < 30:
+        return best, "ahead"
+    case math.Abs(angle) > 150:
+        return nil, ""
+    case angle > 0:
+        return best, "right"
+    default:
+        return best, "left"
+    }
+}
+
+// capitalize делает первую букву заглавной
+func capitalize(s string) string {
+    for i, r := range s {
+        return strings.ToUpper(string(r)) + s[i+len(string(r)):]
+    }
+    return s
+}
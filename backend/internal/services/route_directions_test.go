@@ -0,0 +1,34 @@
+package services
+
+import (
+    "testing"
+
+    "store-navigator/internal/utils"
+)
+
+func TestTurnType(t *testing.T) {
+    // Ось Y направлена вниз: из (0,0) через (10,0) в (10,10) - поворот направо
+    a, b := utils.Point{X: 0, Y: 0}, utils.Point{X: 10, Y: 0}
+    tests := []struct {
+        name string
+        c    utils.Point
+        want string
+    }{
+        {"straight", utils.Point{X: 20, Y: 0}, ""},
+        {"almost straight", utils.Point{X: 20, Y: 2}, ""},
+        {"right", utils.Point{X: 10, Y: 10}, TurnRight},
+        {"left", utils.Point{X: 10, Y: -10}, TurnLeft},
+        {"slight right", utils.Point{X: 20, Y: 8}, TurnSlightRight},
+        {"slight left", utils.Point{X: 20, Y: -8}, TurnSlightLeft},
+        {"sharp right", utils.Point{X: 5, Y: 10}, TurnRight},
+        {"around", utils.Point{X: 0, Y: 1}, TurnAround},
+        {"around from the left", utils.Point{X: 0, Y: -1}, TurnAround},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := turnType(a, b, tt.c); got != tt.want {
+                t.Errorf("turnType(%v, %v, %v) = %q, want %q", a, b, tt.c, got, tt.want)
+            }
+        })
+    }
+}
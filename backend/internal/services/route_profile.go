@@ -0,0 +1,219 @@
+package services
+
+import (
+    "encoding/json"
+    "errors"
+    "math"
+    "time"
+
+    "github.com/redis/go-redis/v9"
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+// Профили маршрута
+const (
+    RouteProfileDefault    = "default"
+    RouteProfileWheelchair = "wheelchair"
+    RouteProfileStroller   = "stroller"
+    RouteProfileFast       = "fast"
+)
+
+const (
+    crowdDensity = 0.5 // Покупателей на квадратный метр, при которой сектор считается переполненным
+    crowdPenalty = 2.0 // Насколько дольше идти через переполненный сектор (множитель 1 + crowdPenalty)
+    queueReach   = 2.0 // На сколько метров вокруг кассы очередь занимает проход
+)
+
+var ErrUnknownRouteProfile = errors.New("unknown route profile")
+
+// RouteProfile - ограничения маршрута для группы покупателей
+type RouteProfile struct {
+    Name       string
+    Speed      float64 // Скорость в м/с
+    Clearance  float64 // Зазор до препятствий: проходы уже 2*Clearance недоступны
+    MinWidth   float64 // Минимальная ширина прохода (атрибут width элемента passage) в метрах
+    StepFree   bool    // Маршрут без лестниц и ступеней
+    Accessible bool    // Объекты с "accessible": false в метаданных недоступны
+    // Множитель времени перехода между этажами по типу; типа нет в списке - переход недоступен
+    Connectors map[string]float64
+}
+
+var RouteProfiles = map[string]RouteProfile{
+    RouteProfileDefault: {
+        Name: RouteProfileDefault, Speed: WalkingSpeed, Clearance: navClearance, MinWidth: 0.6,
+        Connectors: map[string]float64{
+            models.ConnectorStairs: 1, models.ConnectorEscalator: 1, models.ConnectorElevator: 1, models.ConnectorTravelator: 1,
+        },
+    },
+    // Только лифты, проходы не уже 0,9 м
+    RouteProfileWheelchair: {
+        Name: RouteProfileWheelchair, Speed: 0.9, Clearance: 0.45, MinWidth: 0.9, StepFree: true, Accessible: true,
+        Connectors: map[string]float64{models.ConnectorElevator: 1},
+    },
+    // Лифты, траволаторы - если лифт далеко
+    RouteProfileStroller: {
+        Name: RouteProfileStroller, Speed: 1.0, Clearance: 0.4, MinWidth: 0.8, StepFree: true,
+        Connectors: map[string]float64{models.ConnectorElevator: 1, models.ConnectorTravelator: 1.5},
+    },
+    // Быстрый шаг, по эскалатору и траволатору идут, а не стоят
+    RouteProfileFast: {
+        Name: RouteProfileFast, Speed: 1.5, Clearance: navClearance, MinWidth: 0.6,
+        Connectors: map[string]float64{
+            models.ConnectorStairs: 0.8, models.ConnectorEscalator: 0.6, models.ConnectorElevator: 1, models.ConnectorTravelator: 0.6,
+        },
+    },
+}
+
+// RouteOptions - параметры построения маршрута
+type RouteOptions struct {
+    Profile     string // Пустой - RouteProfileDefault
+    AvoidCrowds bool   // Обходить секторы, где сейчас много покупателей
+}
+
+// GetRouteProfile возвращает профиль по названию; пустое название - профиль по умолчанию
+func GetRouteProfile(name string) (RouteProfile, error) {
+    if name == "" {
+        name = RouteProfileDefault
+    }
+    profile, ok := RouteProfiles[name]
+    if !ok {
+        return RouteProfile{}, ErrUnknownRouteProfile
+    }
+    return profile, nil
+}
+
+// navAttributes - атрибуты проходимости из метаданных объекта карты, например
+// {"width": 0.7, "steps": true, "accessible": false}
+type navAttributes struct {
+    Width      *float64 `json:"width"`      // Ширина прохода в метрах
+    Steps      bool     `json:"steps"`      // Ступени или порог
+    Accessible *bool    `json:"accessible"` // Доступно для кресла-коляски
+}
+
+func parseNavAttributes(metadata string) navAttributes {
+    var attrs navAttributes
+    if metadata != "" {
+        json.Unmarshal([]byte(metadata), &attrs)
+    }
+    return attrs
+}
+
+// blocks проверяет, закрыт ли для профиля объект карты типа kind
+func (p RouteProfile) blocks(kind string, attrs navAttributes) bool {
+    if p.StepFree && (kind == "stairs" || attrs.Steps) {
+        return true
+    }
+    return p.Accessible && attrs.Accessible != nil && !*attrs.Accessible
+}
+
+// tooNarrow проверяет ширину прохода по атрибуту width; без атрибута ширина ограничена
+// только зазором профиля до стен и препятствий
+func (p RouteProfile) tooNarrow(attrs navAttributes) bool {
+    return attrs.Width != nil && *attrs.Width < p.MinWidth
+}
+
+// applyCrowds увеличивает время прохода через секторы этажа пропорционально числу покупателей,
+// которые находятся в них сейчас (по данным позиционирования), и через проход у касс - пропорционально
+// длине очереди. Номер кассы - порядковый номер элемента cashier магазина по id, начиная с 1.
+// Без Redis учитываются только данные позиционирования
+func applyCrowds(db *gorm.DB, queues *redis.Client, storeID uint, nav *navFloor, now time.Time) error {
+    var floorID *uint
+    if nav.id != 0 {
+        floorID = &nav.id
+    }
+    scope, err := onFloor(db, storeID, floorID)
+    if err != nil {
+        return err
+    }
+
+    var counts []struct {
+        SectorID uint
+        Devices  int
+    }
+    if err := db.Model(&models.DevicePresence{}).Select("sector_id, COUNT(*) AS devices").
+        Where("store_id = ? AND last_seen_at >= ?", storeID, now.Add(-PresenceTimeout)).
+        Group("sector_id").Scan(&counts).Error; err != nil {
+        return err
+    }
+    var crowds []crowdArea
+    if len(counts) > 0 {
+        ids := make([]uint, len(counts))
+        devices := make(map[uint]int, len(counts))
+        for i, c := range counts {
+            ids[i], devices[c.SectorID] = c.SectorID, c.Devices
+        }
+        var sectors []models.Sector
+        if err := db.Scopes(scope).Where("store_id = ? AND id IN ?", storeID, ids).Find(&sectors).Error; err != nil {
+            return err
+        }
+        for _, sector := range sectors {
+            crowds = append(crowds, crowdArea{
+                bounds: utils.Rect{MinX: sector.PositionX, MinY: sector.PositionY, MaxX: sector.PositionX + sector.Width, MaxY: sector.PositionY + sector.Height},
+                people: devices[sector.ID],
+            })
+        }
+    }
+
+    if lengths, err := queueLengths(queues, storeID); err == nil && len(lengths) > 0 {
+        var cashiers []models.MapElement
+        if err := db.Where("store_id = ? AND type = ?", storeID, "cashier").Order("id").Find(&cashiers).Error; err != nil {
+            return err
+        }
+        var onThisFloor []uint
+        if err := db.Model(&models.MapElement{}).Scopes(scope).Where("store_id = ? AND type = ?", storeID, "cashier").
+            Pluck("id", &onThisFloor).Error; err != nil {
+            return err
+        }
+        floorCashiers := make(map[uint]bool, len(onThisFloor))
+        for _, id := range onThisFloor {
+            floorCashiers[id] = true
+        }
+        for i, cashier := range cashiers {
+            if people := lengths[i+1]; people > 0 && floorCashiers[cashier.ID] {
+                crowds = append(crowds, crowdArea{
+                    bounds: utils.RotatedBounds(cashier.PositionX, cashier.PositionY, cashier.Width, cashier.Height, cashier.Rotation).Expand(queueReach),
+                    people: people,
+                })
+            }
+        }
+    }
+
+    for _, crowd := range crowds {
+        area := (crowd.bounds.MaxX - crowd.bounds.MinX) * (crowd.bounds.MaxY - crowd.bounds.MinY)
+        if area <= 0 {
+            continue
+        }
+        factor := 1 + crowdPenalty*math.Min(float64(crowd.people)/area/crowdDensity, 1)
+        // Множители округляются, чтобы сглаживание не дробило маршрут на мелкие участки
+        factor = math.Round(factor*10) / 10
+        if factor <= 1 {
+            continue
+        }
+        if nav.factor == nil {
+            nav.factor = make([]float64, len(nav.blocked))
+            for i := range nav.factor {
+                nav.factor[i] = 1
+            }
+        }
+        minCol := max(int(math.Ceil((crowd.bounds.MinX-nav.origin.X)/nav.cell-0.5)), 0)
+        minRow := max(int(math.Ceil((crowd.bounds.MinY-nav.origin.Y)/nav.cell-0.5)), 0)
+        maxCol := min(int(math.Floor((crowd.bounds.MaxX-nav.origin.X)/nav.cell-0.5)), nav.cols-1)
+        maxRow := min(int(math.Floor((crowd.bounds.MaxY-nav.origin.Y)/nav.cell-0.5)), nav.rows-1)
+        for row := minRow; row <= maxRow; row++ {
+            for col := minCol; col <= maxCol; col++ {
+                i := row*nav.cols + col
+                nav.factor[i] = math.Max(nav.factor[i], factor)
+            }
+        }
+    }
+    return nil
+}
+
+// crowdArea - участок карты и число людей на нем
+type crowdArea struct {
+    bounds utils.Rect
+    people int
+}
@@ -0,0 +1,933 @@
+package services
+
+import (
+    "container/heap"
+    "crypto/sha1"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "math"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/redis/go-redis/v9"
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+const (
+    NavCellSize  = 0.5 // Шаг сетки навигации в метрах
+    WalkingSpeed = 1.2 // Скорость покупателя в м/с (профиль по умолчанию)
+
+    navClearance  = 0.3     // Зазор до препятствий в метрах для профиля по умолчанию
+    navMargin     = 1.0     // Поле вокруг объектов, если размеры этажа не заданы
+    navSnapRadius = 5.0     // Насколько далеко ищется свободная ячейка рядом с точкой маршрута
+    navMaxCells   = 1000000 // При большем числе ячеек на этаже шаг сетки увеличивается
+)
+
+// Время перехода на соседний этаж в секундах, если у перехода не задан Cost
+var defaultConnectorCost = map[string]float64{
+    models.ConnectorStairs:     30,
+    models.ConnectorEscalator:  25,
+    models.ConnectorElevator:   10,
+    models.ConnectorTravelator: 20,
+}
+
+// Типы объектов карты, через которые нельзя пройти
+var navObstacleTypes = map[string]bool{"wall": true, "cashier": true, "column": true, "obstacle": true}
+
+// Типы элементов карты, открывающих проход сквозь стены
+var navOpeningTypes = map[string]bool{"passage": true, "entrance": true, "exit": true}
+
+var (
+    ErrNoRoute         = errors.New("no route between points")
+    ErrPointOutsideMap = errors.New("point is not in a walkable area")
+)
+
+// RouteEndpoint - точка маршрута на этаже. FloorID = nil - нижний этаж
+type RouteEndpoint struct {
+    Point   utils.Point `json:"point"`
+    FloorID *uint       `json:"floor_id"`
+    Label   string      `json:"label,omitempty"` // Название товара или сектора для подсказок
+}
+
+// RouteConnector - переход на другой этаж в конце участка маршрута
+type RouteConnector struct {
+    ID        uint    `json:"id"`
+    Type      string  `json:"type"`
+    Name      string  `json:"name"`
+    ToFloorID uint    `json:"to_floor_id"`
+    Duration  float64 `json:"duration"` // С учетом ожидания, в секундах
+}
+
+// RouteLeg - участок маршрута по одному этажу
+type RouteLeg struct {
+    FloorID   *uint           `json:"floor_id"`
+    Points    []utils.Point   `json:"points"`
+    Distance  float64         `json:"distance"` // В метрах
+    Connector *RouteConnector `json:"connector,omitempty"`
+}
+
+// Route - маршрут по магазину; на каждом этаже свой участок
+type Route struct {
+    Profile  string        `json:"profile"`
+    From     RouteEndpoint `json:"from"`
+    To       RouteEndpoint `json:"to"`
+    Distance float64       `json:"distance"` // Пешком, в метрах
+    Duration float64       `json:"duration"` // С учетом переходов между этажами, в секундах
+    Legs     []RouteLeg    `json:"legs"`
+    // Пошаговые подсказки, заполняются по запросу (RouteService.Directions)
+    Directions []DirectionStep `json:"directions,omitempty"`
+}
+
+type RouteService struct {
+    db     *gorm.DB
+    queues *redis.Client // Длины очередей касс для обхода скоплений
+}
+
+func NewRouteService(db *gorm.DB) *RouteService {
+    return &RouteService{db: db, queues: newRedisClient()}
+}
+
+// ProductEndpoint возвращает точку в проходе перед товаром магазина
+func (s *RouteService) ProductEndpoint(storeID, productID uint) (*RouteEndpoint, error) {
+    var product models.Product
+    if err := s.db.Joins("JOIN sectors ON sectors.id = products.sector_id").
+        Where("products.id = ? AND sectors.store_id = ?", productID, storeID).First(&product).Error; err != nil {
+        return nil, err
+    }
+    location, err := locateProduct(s.db, &product)
+    if err != nil {
+        return nil, err
+    }
+    return &RouteEndpoint{Point: location.AccessPoint, FloorID: location.FloorID, Label: product.Name}, nil
+}
+
+// SectorEndpoint возвращает центр сектора магазина
+func (s *RouteService) SectorEndpoint(storeID, sectorID uint) (*RouteEndpoint, error) {
+    var sector models.Sector
+    if err := s.db.Where("id = ? AND store_id = ?", sectorID, storeID).First(&sector).Error; err != nil {
+        return nil, err
+    }
+    center := utils.Point{X: sector.PositionX + sector.Width/2, Y: sector.PositionY + sector.Height/2}
+    return &RouteEndpoint{Point: center, FloorID: sector.FloorID, Label: sector.Name}, nil
+}
+
+// Route строит кратчайший по времени маршрут между точками, в том числе на разных этажах,
+// с учетом ограничений профиля
+func (s *RouteService) Route(storeID uint, from, to RouteEndpoint, options RouteOptions) (*Route, error) {
+    profile, err := GetRouteProfile(options.Profile)
+    if err != nil {
+        return nil, err
+    }
+    now := time.Now()
+    graph, err := cachedNavGraph(s.db, storeID, []RouteEndpoint{from, to}, profile, now)
+    if err != nil {
+        return nil, err
+    }
+    if options.AvoidCrowds {
+        graph = graph.withOwnCosts()
+        for _, nav := range graph.floors {
+            if err := applyCrowds(s.db, s.queues, storeID, nav, now); err != nil {
+                return nil, err
+            }
+        }
+    }
+    return graph.route(from, to)
+}
+
+// navObstacle - отрезок с полутолщиной radius, прямоугольник (x, y - левый верхний угол)
+// или многоугольник (закрытый участок)
+type navObstacle struct {
+    segment    bool
+    wall       bool // Стены прерываются проходами
+    a, b       utils.Point
+    radius     float64
+    x, y, w, h float64
+    rotation   float64
+    polygon    []utils.Point
+}
+
+func (o navObstacle) bounds() utils.Rect {
+    if o.polygon != nil {
+        return utils.PolygonBounds(o.polygon)
+    }
+    if o.segment {
+        return utils.Rect{MinX: math.Min(o.a.X, o.b.X), MinY: math.Min(o.a.Y, o.b.Y),
+            MaxX: math.Max(o.a.X, o.b.X), MaxY: math.Max(o.a.Y, o.b.Y)}.Expand(o.radius)
+    }
+    return utils.RotatedBounds(o.x, o.y, o.w, o.h, o.rotation)
+}
+
+// nearest возвращает ближайшую к p точку препятствия
+func (o navObstacle) nearest(p utils.Point) utils.Point {
+    if o.segment {
+        dx, dy := o.b.X-o.a.X, o.b.Y-o.a.Y
+        lengthSq := dx*dx + dy*dy
+        if lengthSq == 0 {
+            return o.a
+        }
+        t := math.Max(0, math.Min(1, ((p.X-o.a.X)*dx+(p.Y-o.a.Y)*dy)/lengthSq))
+        return utils.Point{X: o.a.X + t*dx, Y: o.a.Y + t*dy}
+    }
+    sin, cos := math.Sincos(o.rotation * math.Pi / 180)
+    cx, cy := o.x+o.w/2, o.y+o.h/2
+    dx, dy := p.X-cx, p.Y-cy
+    lx := math.Max(-o.w/2, math.Min(o.w/2, dx*cos+dy*sin))
+    ly := math.Max(-o.h/2, math.Min(o.h/2, -dx*sin+dy*cos))
+    return utils.Point{X: cx + lx*cos - ly*sin, Y: cy + lx*sin + ly*cos}
+}
+
+func (o navObstacle) distance(p utils.Point) float64 {
+    if o.polygon != nil {
+        return utils.DistanceToPolygon(p, o.polygon)
+    }
+    if o.segment {
+        return utils.DistanceToSegment(p, o.a, o.b) - o.radius
+    }
+    return utils.DistanceToRect(p, o.x, o.y, o.w, o.h, o.rotation)
+}
+
+// navFloor - сетка проходимости одного этажа
+type navFloor struct {
+    id         uint // ID этажа, 0 - в магазине не заведены этажи
+    number     int
+    origin     utils.Point
+    cell       float64
+    cols, rows int
+    blocked    []bool
+    factor     []float64 // Множитель времени прохода ячейки, nil - везде 1
+}
+
+func (f *navFloor) floorID() *uint {
+    if f.id == 0 {
+        return nil
+    }
+    id := f.id
+    return &id
+}
+
+func (f *navFloor) bounds() utils.Rect {
+    return utils.Rect{MinX: f.origin.X, MinY: f.origin.Y,
+        MaxX: f.origin.X + float64(f.cols)*f.cell, MaxY: f.origin.Y + float64(f.rows)*f.cell}
+}
+
+func (f *navFloor) index(p utils.Point) (int, bool) {
+    col := int(math.Floor((p.X - f.origin.X) / f.cell))
+    row := int(math.Floor((p.Y - f.origin.Y) / f.cell))
+    if col < 0 || row < 0 || col >= f.cols || row >= f.rows {
+        return 0, false
+    }
+    return row*f.cols + col, true
+}
+
+func (f *navFloor) center(i int) utils.Point {
+    return utils.Point{
+        X: f.origin.X + (float64(i%f.cols)+0.5)*f.cell,
+        Y: f.origin.Y + (float64(i/f.cols)+0.5)*f.cell,
+    }
+}
+
+func (f *navFloor) cost(i int) float64 {
+    if f.factor == nil {
+        return 1
+    }
+    return f.factor[i]
+}
+
+// snap возвращает ближайшую к точке свободную ячейку в пределах navSnapRadius
+func (f *navFloor) snap(p utils.Point) (int, bool) {
+    col := int(math.Floor((p.X - f.origin.X) / f.cell))
+    row := int(math.Floor((p.Y - f.origin.Y) / f.cell))
+    best, bestDistance := -1, math.Inf(1)
+    radius := int(math.Ceil(navSnapRadius / f.cell))
+    for r := max(row-radius, 0); r <= min(row+radius, f.rows-1); r++ {
+        for c := max(col-radius, 0); c <= min(col+radius, f.cols-1); c++ {
+            i := r*f.cols + c
+            if f.blocked[i] {
+                continue
+            }
+            center := f.center(i)
+            if d := math.Hypot(center.X-p.X, center.Y-p.Y); d < bestDistance && d <= navSnapRadius {
+                best, bestDistance = i, d
+            }
+        }
+    }
+    return best, best >= 0
+}
+
+// visible проверяет, что отрезок a-b не проходит через занятые ячейки и участки с другим множителем
+func (f *navFloor) visible(a, b utils.Point) bool {
+    from, ok := f.index(a)
+    if !ok {
+        return false
+    }
+    base := f.cost(from)
+    steps := int(math.Ceil(math.Hypot(b.X-a.X, b.Y-a.Y)/(f.cell/4))) + 1
+    for k := 0; k <= steps; k++ {
+        t := float64(k) / float64(steps)
+        i, ok := f.index(utils.Point{X: a.X + (b.X-a.X)*t, Y: a.Y + (b.Y-a.Y)*t})
+        if !ok || f.blocked[i] || f.cost(i) != base {
+            return false
+        }
+    }
+    return true
+}
+
+// navEdge - переход между узлами графа с временем в секундах
+type navEdge struct {
+    to   int
+    cost float64
+}
+
+// navStop - узел "внутри" вертикального перехода на остановке
+type navStop struct {
+    connector *models.VerticalConnector
+    floor     int // Индекс этажа в navGraph.floors
+    cell      int
+    point     utils.Point
+}
+
+// navGraph - сетки всех этажей магазина, связанные вертикальными переходами.
+// Узлы: ячейки этажей подряд (со смещениями offsets), затем остановки переходов
+type navGraph struct {
+    profile RouteProfile
+    floors  []*navFloor
+    offsets []int
+    cells   int
+    stops   []navStop
+    extra   map[int][]navEdge
+}
+
+// loadNavGraph строит сетки этажей магазина по планировке. at - момент для временных закрытий,
+// нулевой - только постоянная планировка
+func loadNavGraph(db *gorm.DB, storeID uint, profile RouteProfile, at time.Time) (*navGraph, error) {
+    var floors []models.Floor
+    if err := db.Where("store_id = ?", storeID).Order("number, id").Find(&floors).Error; err != nil {
+        return nil, err
+    }
+    if len(floors) == 0 {
+        floors = []models.Floor{{}}
+    }
+
+    var connectors []models.VerticalConnector
+    if floors[0].ID != 0 {
+        if err := db.Preload("Stops").Where("store_id = ? AND is_active = ?", storeID, true).Find(&connectors).Error; err != nil {
+            return nil, err
+        }
+    }
+
+    graph := &navGraph{profile: profile, extra: make(map[int][]navEdge)}
+    for _, floor := range floors {
+        var extra []utils.Point
+        for _, connector := range connectors {
+            for _, stop := range connector.Stops {
+                if stop.FloorID == floor.ID {
+                    extra = append(extra, utils.Point{X: stop.X, Y: stop.Y})
+                }
+            }
+        }
+        nav, err := loadNavFloor(db, storeID, floor, extra, profile, at)
+        if err != nil {
+            return nil, err
+        }
+        graph.floors = append(graph.floors, nav)
+        graph.offsets = append(graph.offsets, graph.cells)
+        graph.cells += nav.cols * nav.rows
+    }
+
+    for i := range connectors {
+        // Переходы, недоступные для профиля (лестницы для кресел-колясок), не попадают в граф
+        if _, ok := profile.Connectors[connectors[i].Type]; ok {
+            graph.addConnector(&connectors[i])
+        }
+    }
+    return graph, nil
+}
+
+// Граф из кэша используется не дольше navGraphTTL, чтобы подхватывались изменения планировки,
+// сделанные другими экземплярами сервиса; в кэше не больше navGraphCacheSize графов
+const (
+    navGraphTTL       = 5 * time.Minute
+    navGraphCacheSize = 32
+)
+
+// navGraphCache хранит построенные графы магазинов по профилям. Версия увеличивается при каждом
+// изменении планировки (DropNavGraphs); построенный граф только читается и общий для запросов
+var navGraphCache = struct {
+    sync.Mutex
+    version uint64
+    entries map[navGraphKey]*navGraphEntry
+}{entries: make(map[navGraphKey]*navGraphEntry)}
+
+type navGraphKey struct {
+    storeID uint
+    profile string
+}
+
+type navGraphEntry struct {
+    version  uint64
+    closures string // Отпечаток действующих закрытий
+    built    time.Time
+    used     time.Time
+    graph    *navGraph
+}
+
+// cachedNavGraph возвращает граф магазина из кэша, а если планировка или закрытия изменились - строит
+// и кэширует его заново. Точки points должны лежать на карте своих этажей
+func cachedNavGraph(db *gorm.DB, storeID uint, points []RouteEndpoint, profile RouteProfile, at time.Time) (*navGraph, error) {
+    closures, err := activeClosures(db, storeID, nil, at)
+    if err != nil {
+        return nil, err
+    }
+    data, err := json.Marshal(closures)
+    if err != nil {
+        return nil, err
+    }
+    sum := sha1.Sum(data)
+    stamp := hex.EncodeToString(sum[:])
+
+    key := navGraphKey{storeID: storeID, profile: profile.Name}
+    now := time.Now()
+    navGraphCache.Lock()
+    version := navGraphCache.version
+    entry, ok := navGraphCache.entries[key]
+    if ok && entry.version == version && entry.closures == stamp && now.Sub(entry.built) < navGraphTTL {
+        entry.used = now
+    } else {
+        entry = nil
+    }
+    navGraphCache.Unlock()
+
+    if entry == nil {
+        graph, err := loadNavGraph(db, storeID, profile, at)
+        if err != nil {
+            return nil, err
+        }
+        // Граф, построенный до смены версии, сохраняется со старой версией и будет перестроен
+        entry = &navGraphEntry{version: version, closures: stamp, built: now, used: now, graph: graph}
+        navGraphCache.Lock()
+        if _, ok := navGraphCache.entries[key]; !ok && len(navGraphCache.entries) >= navGraphCacheSize {
+            evictNavGraph()
+        }
+        navGraphCache.entries[key] = entry
+        navGraphCache.Unlock()
+    }
+    if err := entry.graph.check(points); err != nil {
+        return nil, err
+    }
+    return entry.graph, nil
+}
+
+// evictNavGraph удаляет из кэша граф, который дольше всех не запрашивался. Вызывается под блокировкой
+func evictNavGraph() {
+    var oldest navGraphKey
+    var oldestUsed time.Time
+    for key, entry := range navGraphCache.entries {
+        if oldestUsed.IsZero() || entry.used.Before(oldestUsed) {
+            oldest, oldestUsed = key, entry.used
+        }
+    }
+    delete(navGraphCache.entries, oldest)
+}
+
+// DropNavGraphs сбрасывает графы всех магазинов после изменения планировки
+func DropNavGraphs() {
+    navGraphCache.Lock()
+    defer navGraphCache.Unlock()
+    navGraphCache.version++
+    navGraphCache.entries = make(map[navGraphKey]*navGraphEntry)
+}
+
+// check проверяет, что точки лежат на сетках своих этажей или рядом с ними, в пределах navSnapRadius
+func (g *navGraph) check(points []RouteEndpoint) error {
+    for _, p := range points {
+        floor, err := g.floorIndex(p.FloorID)
+        if err != nil {
+            return err
+        }
+        if !g.floors[floor].bounds().Expand(navSnapRadius).Contains(p.Point.X, p.Point.Y) {
+            return ErrPointOutsideMap
+        }
+    }
+    return nil
+}
+
+// withOwnCosts возвращает копию графа, множители ячеек которой можно менять, не затрагивая кэш
+func (g *navGraph) withOwnCosts() *navGraph {
+    clone := *g
+    clone.floors = make([]*navFloor, len(g.floors))
+    for i, f := range g.floors {
+        floor := *f
+        if f.factor != nil {
+            floor.factor = append([]float64(nil), f.factor...)
+        }
+        clone.floors[i] = &floor
+    }
+    return &clone
+}
+
+// loadNavFloor размечает занятые ячейки этажа: стены, стеллажи, кассы, колонны, прочие препятствия,
+// объекты, закрытые для профиля (узкие проходы, ступени), и действующие временные закрытия
+func loadNavFloor(db *gorm.DB, storeID uint, floor models.Floor, extra []utils.Point, profile RouteProfile, at time.Time) (*navFloor, error) {
+    var floorID *uint
+    if floor.ID != 0 {
+        floorID = &floor.ID
+    }
+    scope, err := onFloor(db, storeID, floorID)
+    if err != nil {
+        return nil, err
+    }
+
+    var obstacles []navObstacle
+    var openings []models.MapElement
+    var bounds []utils.Rect
+
+    var walls []models.Wall
+    if err := db.Scopes(scope).Where("store_id = ?", storeID).Find(&walls).Error; err != nil {
+        return nil, err
+    }
+    for _, w := range walls {
+        obstacles = append(obstacles, navObstacle{segment: true, wall: true,
+            a: utils.Point{X: w.StartX, Y: w.StartY}, b: utils.Point{X: w.EndX, Y: w.EndY}, radius: w.Thickness / 2})
+    }
+
+    var closures []models.Closure
+    if !at.IsZero() {
+        if closures, err = activeClosures(db, storeID, floorID, at); err != nil {
+            return nil, err
+        }
+    }
+    closed := make(map[uint]bool)
+    for _, closure := range closures {
+        if closure.ElementID != nil {
+            closed[*closure.ElementID] = true
+        }
+        if len(closure.Points) >= 3 {
+            obstacles = append(obstacles, navObstacle{polygon: closurePolygon(closure)})
+        }
+    }
+
+    var elements []models.MapElement
+    if err := db.Scopes(scope).Where("store_id = ?", storeID).Find(&elements).Error; err != nil {
+        return nil, err
+    }
+    for _, e := range elements {
+        attrs := parseNavAttributes(e.Metadata)
+        switch {
+        case closed[e.ID]:
+            continue
+        case navObstacleTypes[e.Type]:
+            obstacles = append(obstacles, navObstacle{wall: e.Type == "wall", x: e.PositionX, y: e.PositionY, w: e.Width, h: e.Height, rotation: e.Rotation})
+        case profile.blocks(e.Type, attrs) || navOpeningTypes[e.Type] && profile.tooNarrow(attrs):
+            obstacles = append(obstacles, navObstacle{x: e.PositionX, y: e.PositionY, w: e.Width, h: e.Height, rotation: e.Rotation})
+        case navOpeningTypes[e.Type]:
+            openings = append(openings, e)
+        default:
+            bounds = append(bounds, utils.RotatedBounds(e.PositionX, e.PositionY, e.Width, e.Height, e.Rotation))
+        }
+    }
+
+    var structural []models.StructuralElement
+    if err := db.Scopes(scope).Where("layout_id IN (?)", db.Model(&models.StoreLayout{}).Select("id").Where("store_id = ?", storeID)).
+        Find(&structural).Error; err != nil {
+        return nil, err
+    }
+    for _, e := range structural {
+        if !navObstacleTypes[e.Type] && !profile.blocks(e.Type, parseNavAttributes(e.Metadata)) {
+            continue
+        }
+        if e.Type == "wall" || e.EndX != 0 || e.EndY != 0 {
+            obstacles = append(obstacles, navObstacle{segment: true, wall: e.Type == "wall",
+                a: utils.Point{X: e.StartX, Y: e.StartY}, b: utils.Point{X: e.EndX, Y: e.EndY}, radius: e.Width / 2})
+        } else {
+            obstacles = append(obstacles, navObstacle{x: e.StartX, y: e.StartY, w: e.Width, h: e.Height, rotation: e.Rotation})
+        }
+    }
+
+    var sectors []models.Sector
+    if err := db.Scopes(scope).Where("store_id = ?", storeID).Find(&sectors).Error; err != nil {
+        return nil, err
+    }
+    sectorIDs := []uint{0}
+    for _, sector := range sectors {
+        sectorIDs = append(sectorIDs, sector.ID)
+        bounds = append(bounds, utils.Rect{MinX: sector.PositionX, MinY: sector.PositionY,
+            MaxX: sector.PositionX + sector.Width, MaxY: sector.PositionY + sector.Height})
+    }
+    var fixtures []models.Fixture
+    if err := db.Where("store_id = ? AND sector_id IN ?", storeID, sectorIDs).Find(&fixtures).Error; err != nil {
+        return nil, err
+    }
+    for _, f := range fixtures {
+        obstacles = append(obstacles, navObstacle{x: f.PositionX, y: f.PositionY, w: f.Width, h: f.Depth, rotation: f.Rotation})
+    }
+
+    // Сетка покрывает размеры этажа из конфигурации карты и все объекты; без конфигурации - с полем navMargin
+    for _, o := range obstacles {
+        bounds = append(bounds, o.bounds())
+    }
+    for _, p := range extra {
+        bounds = append(bounds, utils.Rect{MinX: p.X, MinY: p.Y, MaxX: p.X, MaxY: p.Y})
+    }
+    config, err := storeMapConfig(db, storeID, floorID)
+    hasConfig := err == nil && config.RealWidth > 0 && config.RealHeight > 0
+    if hasConfig {
+        bounds = append(bounds, utils.Rect{MaxX: config.RealWidth, MaxY: config.RealHeight})
+    }
+    // Нечисловые координаты растянули бы сетку до бесконечности
+    finite := bounds[:0]
+    for _, b := range bounds {
+        if !math.IsInf(b.MinX+b.MinY+b.MaxX+b.MaxY, 0) && !math.IsNaN(b.MinX+b.MinY+b.MaxX+b.MaxY) {
+            finite = append(finite, b)
+        }
+    }
+    bounds = finite
+    if len(bounds) == 0 {
+        return nil, ErrPointOutsideMap
+    }
+    area := bounds[0]
+    for _, b := range bounds[1:] {
+        area = utils.Rect{MinX: math.Min(area.MinX, b.MinX), MinY: math.Min(area.MinY, b.MinY),
+            MaxX: math.Max(area.MaxX, b.MaxX), MaxY: math.Max(area.MaxY, b.MaxY)}
+    }
+    if !hasConfig {
+        area = area.Expand(navMargin)
+    }
+
+    nav := &navFloor{id: floor.ID, number: floor.Number, cell: NavCellSize}
+    if cells := (area.MaxX - area.MinX) * (area.MaxY - area.MinY) / (nav.cell * nav.cell); cells > navMaxCells {
+        nav.cell *= math.Sqrt(cells / navMaxCells)
+    }
+    // Узлы сетки кратны шагу, чтобы сетка не зависела от расположения объектов.
+    // Из-за округления к узлам ячеек может оказаться больше navMaxCells - тогда шаг увеличивается
+    for {
+        nav.origin = utils.Point{X: math.Floor(area.MinX/nav.cell) * nav.cell, Y: math.Floor(area.MinY/nav.cell) * nav.cell}
+        cols := math.Max(math.Ceil((area.MaxX-nav.origin.X)/nav.cell), 1)
+        rows := math.Max(math.Ceil((area.MaxY-nav.origin.Y)/nav.cell), 1)
+        if cols*rows <= navMaxCells {
+            nav.cols, nav.rows = int(cols), int(rows)
+            break
+        }
+        nav.cell *= 2
+    }
+    nav.blocked = make([]bool, nav.cols*nav.rows)
+
+    for _, o := range obstacles {
+        b := o.bounds().Expand(profile.Clearance)
+        minCol, minRow := int(math.Floor((b.MinX-nav.origin.X)/nav.cell)), int(math.Floor((b.MinY-nav.origin.Y)/nav.cell))
+        maxCol, maxRow := int(math.Floor((b.MaxX-nav.origin.X)/nav.cell)), int(math.Floor((b.MaxY-nav.origin.Y)/nav.cell))
+        for row := max(minRow, 0); row <= min(maxRow, nav.rows-1); row++ {
+            for col := max(minCol, 0); col <= min(maxCol, nav.cols-1); col++ {
+                i := row*nav.cols + col
+                center := nav.center(i)
+                if nav.blocked[i] || o.distance(center) >= profile.Clearance {
+                    continue
+                }
+                // Проход прерывает стену: ближайшая к ячейке точка стены попадает в проход
+                if o.wall && insideAny(o.nearest(center), openings) {
+                    continue
+                }
+                nav.blocked[i] = true
+            }
+        }
+    }
+    return nav, nil
+}
+
+// insideAny проверяет, лежит ли точка внутри одного из элементов карты
+func insideAny(p utils.Point, elements []models.MapElement) bool {
+    for _, e := range elements {
+        if utils.DistanceToRect(p, e.PositionX, e.PositionY, e.Width, e.Height, e.Rotation) == 0 {
+            return true
+        }
+    }
+    return false
+}
+
+func (g *navGraph) floorIndex(floorID *uint) (int, error) {
+    if floorID == nil {
+        return 0, nil
+    }
+    for i, f := range g.floors {
+        if f.id == *floorID {
+            return i, nil
+        }
+    }
+    return 0, ErrFloorNotFound
+}
+
+// addConnector связывает остановки перехода: вход с ожиданием WaitTime, проезд между
+// соседними остановками (время пропорционально разнице номеров этажей) и выход
+func (g *navGraph) addConnector(connector *models.VerticalConnector) {
+    type stopNode struct {
+        node   int
+        number int
+    }
+    var nodes []stopNode
+    for _, stop := range connector.Stops {
+        floor, err := g.floorIndex(&stop.FloorID)
+        if err != nil {
+            continue
+        }
+        cell, ok := g.floors[floor].snap(utils.Point{X: stop.X, Y: stop.Y})
+        if !ok {
+            continue
+        }
+        node := g.cells + len(g.stops)
+        g.stops = append(g.stops, navStop{connector: connector, floor: floor, cell: cell, point: utils.Point{X: stop.X, Y: stop.Y}})
+        cellNode := g.offsets[floor] + cell
+        g.extra[cellNode] = append(g.extra[cellNode], navEdge{to: node, cost: connector.WaitTime})
+        g.extra[node] = append(g.extra[node], navEdge{to: cellNode})
+        nodes = append(nodes, stopNode{node: node, number: g.floors[floor].number})
+    }
+
+    cost := connector.Cost
+    if cost <= 0 {
+        cost = defaultConnectorCost[connector.Type]
+    }
+    cost *= g.profile.Connectors[connector.Type]
+    sort.Slice(nodes, func(i, j int) bool { return nodes[i].number < nodes[j].number })
+    for i := 1; i < len(nodes); i++ {
+        lower, upper := nodes[i-1], nodes[i]
+        travel := cost * float64(upper.number-lower.number)
+        if connector.Direction != models.ConnectorDown {
+            g.extra[lower.node] = append(g.extra[lower.node], navEdge{to: upper.node, cost: travel})
+        }
+        if connector.Direction != models.ConnectorUp {
+            g.extra[upper.node] = append(g.extra[upper.node], navEdge{to: lower.node, cost: travel})
+        }
+    }
+}
+
+// locate переводит узел графа в этаж и ячейку; для остановки перехода floor = -1
+func (g *navGraph) locate(node int) (floor, cell int) {
+    if node >= g.cells {
+        return -1, node - g.cells
+    }
+    floor = sort.Search(len(g.offsets), func(i int) bool { return g.offsets[i] > node }) - 1
+    return floor, node - g.offsets[floor]
+}
+
+var navMoves = [8][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+
+// neighbours перебирает соседние узлы: восемь соседних ячеек (без срезания углов) и переходы
+func (g *navGraph) neighbours(node int, fn func(to int, cost float64)) {
+    for _, e := range g.extra[node] {
+        fn(e.to, e.cost)
+    }
+    floorIndex, cell := g.locate(node)
+    if floorIndex < 0 {
+        return
+    }
+    f := g.floors[floorIndex]
+    col, row := cell%f.cols, cell/f.cols
+    for _, m := range navMoves {
+        c, r := col+m[0], row+m[1]
+        if c < 0 || r < 0 || c >= f.cols || r >= f.rows || f.blocked[r*f.cols+c] {
+            continue
+        }
+        if m[0] != 0 && m[1] != 0 && (f.blocked[row*f.cols+c] || f.blocked[r*f.cols+col]) {
+            continue
+        }
+        next := r*f.cols + c
+        step := f.cell * math.Hypot(float64(m[0]), float64(m[1]))
+        fn(g.offsets[floorIndex]+next, step*(f.cost(cell)+f.cost(next))/2/g.profile.Speed)
+    }
+}
+
+// search находит кратчайший по времени путь алгоритмом Дейкстры.
+// Возвращает узлы пути и время от начала до каждого узла
+func (g *navGraph) search(from, to int) ([]int, []float64) {
+    dist, prev := g.shortest(from, to)
+    return g.path(from, to, dist, prev), dist
+}
+
+// shortest вычисляет время от узла from до остальных узлов; поиск останавливается на узле to,
+// to < 0 - до всех достижимых узлов
+func (g *navGraph) shortest(from, to int) ([]float64, []int32) {
+    nodes := g.cells + len(g.stops)
+    dist := make([]float64, nodes)
+    prev := make([]int32, nodes)
+    for i := range dist {
+        dist[i] = math.Inf(1)
+    }
+    dist[from] = 0
+    queue := &navQueue{{node: from}}
+    for queue.Len() > 0 {
+        item := heap.Pop(queue).(navItem)
+        if item.dist > dist[item.node] {
+            continue
+        }
+        if item.node == to {
+            break
+        }
+        g.neighbours(item.node, func(next int, cost float64) {
+            if d := item.dist + cost; d < dist[next] {
+                dist[next], prev[next] = d, int32(item.node)
+                heap.Push(queue, navItem{node: next, dist: d})
+            }
+        })
+    }
+    return dist, prev
+}
+
+// path восстанавливает путь от from до to по результату shortest; nil - узел недостижим
+func (g *navGraph) path(from, to int, dist []float64, prev []int32) []int {
+    if math.IsInf(dist[to], 1) {
+        return nil
+    }
+    path := []int{to}
+    for node := to; node != from; {
+        node = int(prev[node])
+        path = append(path, node)
+    }
+    for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+        path[i], path[j] = path[j], path[i]
+    }
+    return path
+}
+
+// node возвращает узел графа - ближайшую к точке свободную ячейку ее этажа
+func (g *navGraph) node(p RouteEndpoint) (int, error) {
+    floor, err := g.floorIndex(p.FloorID)
+    if err != nil {
+        return 0, err
+    }
+    cell, ok := g.floors[floor].snap(p.Point)
+    if !ok {
+        return 0, ErrPointOutsideMap
+    }
+    return g.offsets[floor] + cell, nil
+}
+
+func (g *navGraph) route(from, to RouteEndpoint) (*Route, error) {
+    ends := make([]int, 2)
+    for i, p := range []RouteEndpoint{from, to} {
+        node, err := g.node(p)
+        if err != nil {
+            return nil, err
+        }
+        ends[i] = node
+    }
+
+    path, dist := g.search(ends[0], ends[1])
+    if path == nil {
+        return nil, ErrNoRoute
+    }
+    return g.build(from, to, path, dist), nil
+}
+
+// build собирает маршрут по найденному пути: участки по этажам, переходы, длину и время
+func (g *navGraph) build(from, to RouteEndpoint, path []int, dist []float64) *Route {
+    ends := []int{path[0], path[len(path)-1]}
+    route := &Route{Profile: g.profile.Name, From: from, To: to, Legs: []RouteLeg{}}
+    fromFloor, _ := g.locate(ends[0])
+    leg := RouteLeg{FloorID: g.floors[fromFloor].floorID(), Points: []utils.Point{from.Point}}
+    var legCells []int
+    var boardedAt int
+    for k, node := range path {
+        floor, cell := g.locate(node)
+        if floor >= 0 {
+            legCells = append(legCells, cell)
+            continue
+        }
+        stop := g.stops[cell]
+        if k > 0 && path[k-1] < g.cells {
+            // Вход в переход: завершаем участок на текущем этаже
+            points := append(leg.Points, cellCenters(g.floors[stop.floor], legCells)...)
+            leg.Points = g.floors[stop.floor].smooth(append(points, stop.point))
+            boardedAt, legCells = k-1, nil
+            continue
+        }
+        if k+1 < len(path) && path[k+1] < g.cells {
+            // Выход из перехода на другом этаже
+            if stop.floor == g.stopFloor(path[boardedAt+1]) {
+                // Зашли и вышли на том же этаже - переход не используется
+                continue
+            }
+            leg.Connector = &RouteConnector{
+                ID:        stop.connector.ID,
+                Type:      stop.connector.Type,
+                Name:      stop.connector.Name,
+                ToFloorID: g.floors[stop.floor].id,
+                Duration:  round3(dist[path[k+1]] - dist[path[boardedAt]]),
+            }
+            route.Legs = append(route.Legs, leg)
+            leg = RouteLeg{FloorID: g.floors[stop.floor].floorID(), Points: []utils.Point{stop.point}}
+        }
+    }
+    toFloor, _ := g.locate(ends[1])
+    f := g.floors[toFloor]
+    points := append(leg.Points, cellCenters(f, legCells)...)
+    leg.Points = f.smooth(append(points, to.Point))
+    route.Legs = append(route.Legs, leg)
+
+    for i := range route.Legs {
+        leg := &route.Legs[i]
+        for j := 1; j < len(leg.Points); j++ {
+            leg.Distance += math.Hypot(leg.Points[j].X-leg.Points[j-1].X, leg.Points[j].Y-leg.Points[j-1].Y)
+        }
+        leg.Distance = round3(leg.Distance)
+        route.Distance += leg.Distance
+        route.Duration += leg.Distance / g.profile.Speed
+        if leg.Connector != nil {
+            route.Duration += leg.Connector.Duration
+        }
+    }
+    route.Distance, route.Duration = round3(route.Distance), round3(route.Duration)
+    return route
+}
+
+func (g *navGraph) stopFloor(node int) int {
+    return g.stops[node-g.cells].floor
+}
+
+func cellCenters(f *navFloor, cells []int) []utils.Point {
+    points := make([]utils.Point, len(cells))
+    for i, cell := range cells {
+        points[i] = f.center(cell)
+    }
+    return points
+}
+
+// smooth убирает промежуточные точки, между которыми есть прямая видимость
+func (f *navFloor) smooth(points []utils.Point) []utils.Point {
+    if len(points) <= 2 {
+        return points
+    }
+    result := []utils.Point{points[0]}
+    anchor := 0
+    for i := 2; i < len(points); i++ {
+        if !f.visible(points[anchor], points[i]) {
+            anchor = i - 1
+            result = append(result, points[anchor])
+        }
+    }
+    result = append(result, points[len(points)-1])
+    for i := range result {
+        result[i] = utils.Point{X: round3(result[i].X), Y: round3(result[i].Y)}
+    }
+    return result
+}
+
+type navItem struct {
+    node int
+    dist float64
+}
+
+type navQueue []navItem
+
+func (q navQueue) Len() int            { return len(q) }
+func (q navQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q navQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *navQueue) Push(x interface{}) { *q = append(*q, x.(navItem)) }
+func (q *navQueue) Pop() interface{} {
+    old := *q
+    item := old[len(old)-1]
+    *q = old[:len(old)-1]
+    return item
+}
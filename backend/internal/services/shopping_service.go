@@ -0,0 +1,347 @@
+package services
+
+import (
+    "errors"
+    "math"
+    "sort"
+    "time"
+
+    "gorm.io/gorm"
+
+    "store-navigator/internal/models"
+    "store-navigator/internal/utils"
+)
+
+// MaxShoppingListSize - наибольшее число товаров в списке покупок: каждый товар - отдельный поиск по сетке
+const MaxShoppingListSize = 100
+
+var (
+    ErrEmptyShoppingList   = errors.New("shopping list is empty")
+    ErrShoppingListTooLong = errors.New("shopping list is too long")
+)
+
+// ShoppingItem - товар списка покупок в порядке обхода
+type ShoppingItem struct {
+    Sequence  int             `json:"sequence"` // Порядковый номер в обходе, с 1
+    Product   models.Product  `json:"product"`
+    Zone      string          `json:"zone"` // Температурная зона
+    Location  ProductLocation `json:"location"`
+    Reachable bool            `json:"reachable"` // К товару построен маршрут
+}
+
+// ShoppingRoute - обход магазина по списку покупок: от входа через все товары к ближайшей кассе
+type ShoppingRoute struct {
+    Profile  string         `json:"profile"`
+    Start    RouteEndpoint  `json:"start"`
+    Checkout *RouteEndpoint `json:"checkout"` // Касса в конце маршрута, nil - кассы недостижимы или не заданы
+    Items    []ShoppingItem `json:"items"`
+    Missing  []uint         `json:"missing"` // Товары, которых нет в магазине
+    Legs     []RouteLeg     `json:"legs"`
+    Distance float64        `json:"distance"` // В метрах
+    Duration float64        `json:"duration"` // В секундах
+}
+
+type ShoppingService struct {
+    db *gorm.DB
+}
+
+func NewShoppingService(db *gorm.DB) *ShoppingService {
+    return &ShoppingService{db: db}
+}
+
+// Plan упорядочивает список покупок: тяжелые товары - первыми, замороженные - последними,
+// внутри этапа - ближайший следующий товар. start nil - первый вход магазина
+func (s *ShoppingService) Plan(storeID uint, productIDs []uint, start *RouteEndpoint, profileName string) (*ShoppingRoute, error) {
+    profile, err := GetRouteProfile(profileName)
+    if err != nil {
+        return nil, err
+    }
+    if len(productIDs) == 0 {
+        return nil, ErrEmptyShoppingList
+    }
+    if len(productIDs) > MaxShoppingListSize {
+        return nil, ErrShoppingListTooLong
+    }
+
+    var products []models.Product
+    if err := s.db.Joins("JOIN sectors ON sectors.id = products.sector_id").
+        Where("products.id IN ? AND sectors.store_id = ?", productIDs, storeID).Find(&products).Error; err != nil {
+        return nil, err
+    }
+    found := make(map[uint]models.Product, len(products))
+    for _, product := range products {
+        found[product.ID] = product
+    }
+
+    result := &ShoppingRoute{Profile: profile.Name, Items: []ShoppingItem{}, Missing: []uint{}, Legs: []RouteLeg{}}
+    var items []ShoppingItem
+    seen := make(map[uint]bool)
+    for _, id := range productIDs {
+        product, ok := found[id]
+        if seen[id] {
+            continue
+        }
+        seen[id] = true
+        if !ok {
+            result.Missing = append(result.Missing, id)
+            continue
+        }
+        location, err := locateProduct(s.db, &product)
+        if err != nil {
+            result.Missing = append(result.Missing, id)
+            continue
+        }
+        zone, err := productZone(s.db, location)
+        if err != nil {
+            return nil, err
+        }
+        items = append(items, ShoppingItem{Product: product, Zone: zone, Location: *location})
+    }
+
+    if start == nil {
+        if start, err = storeEntrance(s.db, storeID); err != nil {
+            return nil, err
+        }
+    }
+    if start == nil && len(items) > 0 {
+        start = &RouteEndpoint{Point: items[0].Location.AccessPoint, FloorID: items[0].Location.FloorID}
+    }
+    if start == nil {
+        return result, nil
+    }
+    result.Start = *start
+
+    checkouts, err := storeCheckouts(s.db, storeID)
+    if err != nil {
+        return nil, err
+    }
+    stops := make([]walkStop, len(items))
+    for i, item := range items {
+        stops[i] = walkStop{
+            endpoint: RouteEndpoint{Point: item.Location.AccessPoint, FloorID: item.Location.FloorID, Label: item.Product.Name},
+            stage:    walkStage(item.Zone, item.Product.Heavy),
+        }
+    }
+    walk, err := planStopWalk(s.db, storeID, *start, stops, checkouts, profile)
+    if err != nil {
+        return nil, err
+    }
+    for i, index := range walk.order {
+        item := items[index]
+        item.Sequence = i + 1
+        item.Reachable = walk.reachable[index]
+        result.Items = append(result.Items, item)
+    }
+    if walk.end >= 0 {
+        result.Checkout = &checkouts[walk.end]
+    }
+    result.Legs, result.Distance, result.Duration = walk.legs, walk.distance, walk.duration
+    return result, nil
+}
+
+// IsTemperatureZone проверяет значение температурной зоны сектора
+func IsTemperatureZone(zone string) bool {
+    switch zone {
+    case models.TemperatureAmbient, models.TemperatureChilled, models.TemperatureFrozen:
+        return true
+    }
+    return false
+}
+
+// productZone возвращает температурную зону места товара: холодильник или морозильник
+// определяет зону сам, иначе она берется из сектора
+func productZone(db *gorm.DB, location *ProductLocation) (string, error) {
+    if location.FixtureID != nil {
+        var fixture models.Fixture
+        err := db.First(&fixture, *location.FixtureID).Error
+        if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+            return "", err
+        }
+        switch fixture.Type {
+        case "freezer":
+            return models.TemperatureFrozen, nil
+        case "fridge":
+            return models.TemperatureChilled, nil
+        }
+    }
+    var sector models.Sector
+    err := db.First(&sector, location.SectorID).Error
+    if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+        return "", err
+    }
+    if IsTemperatureZone(sector.TemperatureZone) {
+        return sector.TemperatureZone, nil
+    }
+    return models.TemperatureAmbient, nil
+}
+
+// walkStage возвращает этап обхода: тяжелые товары собираются первыми, чтобы лежать на дне корзины,
+// замороженные - последними, чтобы не успеть оттаять (тяжелые из них - первыми среди замороженных)
+func walkStage(zone string, heavy bool) int {
+    switch {
+    case zone == models.TemperatureFrozen && heavy:
+        return 3
+    case zone == models.TemperatureFrozen:
+        return 4
+    case heavy:
+        return 0
+    case zone == models.TemperatureChilled:
+        return 2
+    }
+    return 1
+}
+
+// storeEntrance возвращает первый вход магазина на нижнем этаже, nil - входов нет
+func storeEntrance(db *gorm.DB, storeID uint) (*RouteEndpoint, error) {
+    lowest, err := defaultFloor(db, storeID)
+    if err != nil {
+        return nil, err
+    }
+    var floorID *uint
+    if lowest != nil {
+        floorID = &lowest.ID
+    }
+    scope, err := onFloor(db, storeID, floorID)
+    if err != nil {
+        return nil, err
+    }
+    var entrance models.MapElement
+    err = db.Scopes(scope).Where("store_id = ? AND type = ?", storeID, "entrance").Order("id").First(&entrance).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &RouteEndpoint{Point: utils.Point{X: entrance.PositionX + entrance.Width/2, Y: entrance.PositionY + entrance.Height/2},
+        FloorID: entrance.FloorID, Label: entrance.Name}, nil
+}
+
+// storeCheckouts возвращает кассы магазина на всех этажах
+func storeCheckouts(db *gorm.DB, storeID uint) ([]RouteEndpoint, error) {
+    var cashiers []models.MapElement
+    if err := db.Where("store_id = ? AND type = ?", storeID, "cashier").Order("id").Find(&cashiers).Error; err != nil {
+        return nil, err
+    }
+    endpoints := make([]RouteEndpoint, len(cashiers))
+    for i, e := range cashiers {
+        endpoints[i] = RouteEndpoint{Point: utils.Point{X: e.PositionX + e.Width/2, Y: e.PositionY + e.Height/2}, FloorID: e.FloorID, Label: e.Name}
+    }
+    return endpoints, nil
+}
+
+// walkStop - точка обхода и его этап
+type walkStop struct {
+    endpoint RouteEndpoint
+    stage    int
+}
+
+// stopWalk - упорядоченный обход точек
+type stopWalk struct {
+    order     []int  // Индексы точек в порядке обхода
+    reachable []bool // По индексу точки: к ней построен маршрут
+    end       int    // Индекс конечной точки, -1 - не достигнута
+    legs      []RouteLeg
+    distance  float64
+    duration  float64
+}
+
+// planStopWalk обходит точки от start по этапам в порядке возрастания, внутри этапа - к ближайшей
+// по времени следующей точке, и завершает обход в ближайшей из ends. Недостижимые точки идут
+// в конце своего этапа без маршрута. Граф берется из кэша с учетом действующих закрытий
+func planStopWalk(db *gorm.DB, storeID uint, start RouteEndpoint, stops []walkStop, ends []RouteEndpoint, profile RouteProfile) (*stopWalk, error) {
+    walk := &stopWalk{reachable: make([]bool, len(stops)), end: -1, legs: []RouteLeg{}}
+    if len(stops) == 0 {
+        return walk, nil
+    }
+    endpoints := []RouteEndpoint{start}
+    for _, stop := range stops {
+        endpoints = append(endpoints, stop.endpoint)
+    }
+    endpoints = append(endpoints, ends...)
+    // Остановки и концы лежат на объектах магазина, а значит и на сетке - проверяется только начало
+    graph, err := cachedNavGraph(db, storeID, []RouteEndpoint{start}, profile, time.Now())
+    if err != nil {
+        return nil, err
+    }
+    nodes := make([]int, len(endpoints))
+    for i, endpoint := range endpoints {
+        if nodes[i], err = graph.node(endpoint); err != nil {
+            nodes[i] = -1
+        }
+    }
+
+    current := 0
+    var dist []float64
+    var prev []int32
+    if nodes[0] >= 0 {
+        dist, prev = graph.shortest(nodes[0], -1)
+    }
+    // nearest возвращает ближайшую достижимую точку из candidates (индексы endpoints), -1 - таких нет
+    nearest := func(candidates []int) int {
+        next, best := -1, math.Inf(1)
+        for _, i := range candidates {
+            if nodes[i] < 0 || dist == nil {
+                continue
+            }
+            if d := dist[nodes[i]]; d < best {
+                next, best = i, d
+            }
+        }
+        return next
+    }
+    moveTo := func(to int) {
+        path := graph.path(nodes[current], nodes[to], dist, prev)
+        route := graph.build(endpoints[current], endpoints[to], path, dist)
+        walk.legs = append(walk.legs, route.Legs...)
+        walk.distance += route.Distance
+        walk.duration += route.Duration
+        current = to
+        dist, prev = graph.shortest(nodes[current], -1)
+    }
+
+    stages := make(map[int][]int)
+    var order []int
+    for i, stop := range stops {
+        if _, ok := stages[stop.stage]; !ok {
+            order = append(order, stop.stage)
+        }
+        stages[stop.stage] = append(stages[stop.stage], i+1)
+    }
+    sort.Ints(order)
+    for _, stage := range order {
+        remaining := stages[stage]
+        for len(remaining) > 0 {
+            next := nearest(remaining)
+            if next < 0 {
+                break
+            }
+            walk.order = append(walk.order, next-1)
+            walk.reachable[next-1] = true
+            moveTo(next)
+            for i, candidate := range remaining {
+                if candidate == next {
+                    remaining = append(remaining[:i], remaining[i+1:]...)
+                    break
+                }
+            }
+        }
+        for _, unreachable := range remaining {
+            walk.order = append(walk.order, unreachable-1)
+        }
+    }
+
+    // Если ни одна точка не достигнута, обход не начинался
+    if len(ends) > 0 && current != 0 {
+        candidates := make([]int, len(ends))
+        for i := range ends {
+            candidates[i] = 1 + len(stops) + i
+        }
+        if end := nearest(candidates); end >= 0 {
+            moveTo(end)
+            walk.end = end - 1 - len(stops)
+        }
+    }
+    walk.distance, walk.duration = round3(walk.distance), round3(walk.duration)
+    return walk, nil
+}
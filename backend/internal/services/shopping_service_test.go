@@ -0,0 +1,28 @@
+package services
+
+import (
+    "testing"
+
+    "store-navigator/internal/models"
+)
+
+func TestWalkStage(t *testing.T) {
+    tests := []struct {
+        zone  string
+        heavy bool
+        want  int
+    }{
+        {models.TemperatureAmbient, true, 0},
+        {models.TemperatureChilled, true, 0},
+        {models.TemperatureAmbient, false, 1},
+        {"", false, 1},
+        {models.TemperatureChilled, false, 2},
+        {models.TemperatureFrozen, true, 3},
+        {models.TemperatureFrozen, false, 4},
+    }
+    for _, tt := range tests {
+        if got := walkStage(tt.zone, tt.heavy); got != tt.want {
+            t.Errorf("walkStage(%q, %v) = %d, want %d", tt.zone, tt.heavy, got, tt.want)
+        }
+    }
+}
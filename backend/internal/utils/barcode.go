@@ -0,0 +1,55 @@
+package utils
+
+import "strings"
+
+// Форматы штрихкодов товаров
+const (
+    BarcodeEAN13 = "EAN-13"
+    BarcodeEAN8  = "EAN-8"
+    BarcodeUPCA  = "UPC-A"
+)
+
+// gtinCheckDigit вычисляет контрольную цифру GTIN (EAN-8, UPC-A, EAN-13) для цифр без нее
+func gtinCheckDigit(digits string) byte {
+    sum := 0
+    // Веса 3 и 1 чередуются справа налево, начиная с 3 у последней цифры
+    for i := len(digits) - 1; i >= 0; i -= 2 {
+        sum += int(digits[i]-'0') * 3
+    }
+    for i := len(digits) - 2; i >= 0; i -= 2 {
+        sum += int(digits[i] - '0')
+    }
+    return byte((10-sum%10)%10) + '0'
+}
+
+func isDigits(s string) bool {
+    if s == "" {
+        return false
+    }
+    for i := 0; i < len(s); i++ {
+        if s[i] < '0' || s[i] > '9' {
+            return false
+        }
+    }
+    return true
+}
+
+// NormalizeBarcode проверяет контрольную цифру EAN-13, EAN-8 или UPC-A и дополняет код нулями слева
+// до 13 цифр (GTIN-13), в таком виде штрихкоды хранятся в каталоге
+func NormalizeBarcode(code string) (gtin string, format string, ok bool) {
+    code = strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+    switch len(code) {
+    case 8:
+        format = BarcodeEAN8
+    case 12:
+        format = BarcodeUPCA
+    case 13:
+        format = BarcodeEAN13
+    default:
+        return "", "", false
+    }
+    if !isDigits(code) || gtinCheckDigit(code[:len(code)-1]) != code[len(code)-1] {
+        return "", "", false
+    }
+    return strings.Repeat("0", 13-len(code)) + code, format, true
+}
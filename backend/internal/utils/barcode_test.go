@@ -0,0 +1,31 @@
+package utils
+
+import "testing"
+
+func TestNormalizeBarcode(t *testing.T) {
+    tests := []struct {
+        name       string
+        code       string
+        wantGTIN   string
+        wantFormat string
+        wantOK     bool
+    }{
+        {"ean-13", "4006381333931", "4006381333931", BarcodeEAN13, true},
+        {"ean-13 with spaces and dashes", " 400-6381 333931 ", "4006381333931", BarcodeEAN13, true},
+        {"ean-8", "96385074", "0000096385074", BarcodeEAN8, true},
+        {"upc-a", "036000291452", "0036000291452", BarcodeUPCA, true},
+        {"wrong check digit", "4006381333932", "", "", false},
+        {"letters", "40063813339A1", "", "", false},
+        {"unsupported length", "123456789", "", "", false},
+        {"empty", "", "", "", false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            gtin, format, ok := NormalizeBarcode(tt.code)
+            if gtin != tt.wantGTIN || format != tt.wantFormat || ok != tt.wantOK {
+                t.Errorf("NormalizeBarcode(%q) = (%q, %q, %v), want (%q, %q, %v)",
+                    tt.code, gtin, format, ok, tt.wantGTIN, tt.wantFormat, tt.wantOK)
+            }
+        })
+    }
+}
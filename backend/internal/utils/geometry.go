@@ -0,0 +1,232 @@
+package utils
+
+import (
+    "errors"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// Rect описывает прямоугольную область карты в метрах
+type Rect struct {
+    MinX float64 `json:"min_x"`
+    MinY float64 `json:"min_y"`
+    MaxX float64 `json:"max_x"`
+    MaxY float64 `json:"max_y"`
+}
+
+// ParseRect разбирает границы области из параметров запроса
+func ParseRect(minX, minY, maxX, maxY string) (Rect, error) {
+    var r Rect
+    values := []*float64{&r.MinX, &r.MinY, &r.MaxX, &r.MaxY}
+    for i, s := range []string{minX, minY, maxX, maxY} {
+        v, err := strconv.ParseFloat(s, 64)
+        if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+            return Rect{}, errors.New("invalid bounding box coordinate")
+        }
+        *values[i] = v
+    }
+    if r.MinX > r.MaxX || r.MinY > r.MaxY {
+        return Rect{}, errors.New("bounding box min must not exceed max")
+    }
+    return r, nil
+}
+
+// Intersects проверяет пересечение двух областей (касание считается пересечением)
+func (r Rect) Intersects(o Rect) bool {
+    return r.MinX <= o.MaxX && r.MaxX >= o.MinX && r.MinY <= o.MaxY && r.MaxY >= o.MinY
+}
+
+// Contains проверяет, лежит ли точка внутри области
+func (r Rect) Contains(x, y float64) bool {
+    return x >= r.MinX && x <= r.MaxX && y >= r.MinY && y <= r.MaxY
+}
+
+// Expand расширяет область на d метров во все стороны
+func (r Rect) Expand(d float64) Rect {
+    return Rect{MinX: r.MinX - d, MinY: r.MinY - d, MaxX: r.MaxX + d, MaxY: r.MaxY + d}
+}
+
+// RotatedBounds возвращает габариты прямоугольника (x, y - левый верхний угол),
+// повернутого на rotation градусов вокруг своего центра
+func RotatedBounds(x, y, width, height, rotation float64) Rect {
+    if math.Mod(rotation, 360) == 0 {
+        return Rect{MinX: x, MinY: y, MaxX: x + width, MaxY: y + height}
+    }
+    rad := rotation * math.Pi / 180
+    cos, sin := math.Abs(math.Cos(rad)), math.Abs(math.Sin(rad))
+    halfW := (width*cos + height*sin) / 2
+    halfH := (width*sin + height*cos) / 2
+    cx, cy := x+width/2, y+height/2
+    return Rect{MinX: cx - halfW, MinY: cy - halfH, MaxX: cx + halfW, MaxY: cy + halfH}
+}
+
+// SegmentIntersectsRect проверяет пересечение отрезка с областью (алгоритм Лианга-Барски)
+func SegmentIntersectsRect(x1, y1, x2, y2 float64, r Rect) bool {
+    dx, dy := x2-x1, y2-y1
+    t0, t1 := 0.0, 1.0
+    clip := func(p, q float64) bool {
+        if p == 0 {
+            return q >= 0
+        }
+        t := q / p
+        if p < 0 {
+            if t > t1 {
+                return false
+            }
+            if t > t0 {
+                t0 = t
+            }
+        } else {
+            if t < t0 {
+                return false
+            }
+            if t < t1 {
+                t1 = t
+            }
+        }
+        return true
+    }
+    return clip(-dx, x1-r.MinX) && clip(dx, r.MaxX-x1) &&
+        clip(-dy, y1-r.MinY) && clip(dy, r.MaxY-y1)
+}
+
+// Point - точка на карте магазина в метрах
+type Point struct {
+    X float64 `json:"x"`
+    Y float64 `json:"y"`
+}
+
+// ParsePoints разбирает список точек вида "x1,y1;x2,y2;..."
+func ParsePoints(s string) ([]Point, error) {
+    var points []Point
+    for _, pair := range strings.Split(s, ";") {
+        if strings.TrimSpace(pair) == "" {
+            continue
+        }
+        coords := strings.Split(pair, ",")
+        if len(coords) != 2 {
+            return nil, errors.New("point must be in x,y format")
+        }
+        x, errX := strconv.ParseFloat(strings.TrimSpace(coords[0]), 64)
+        y, errY := strconv.ParseFloat(strings.TrimSpace(coords[1]), 64)
+        if errX != nil || errY != nil || math.IsNaN(x) || math.IsInf(x, 0) || math.IsNaN(y) || math.IsInf(y, 0) {
+            return nil, errors.New("invalid point coordinate")
+        }
+        points = append(points, Point{X: x, Y: y})
+    }
+    return points, nil
+}
+
+// RectCorners возвращает углы прямоугольника (x, y - левый верхний угол),
+// повернутого на rotation градусов вокруг своего центра
+func RectCorners(x, y, width, height, rotation float64) []Point {
+    cx, cy := x+width/2, y+height/2
+    sin, cos := math.Sincos(rotation * math.Pi / 180)
+    corners := []Point{{-width / 2, -height / 2}, {width / 2, -height / 2}, {width / 2, height / 2}, {-width / 2, height / 2}}
+    for i, c := range corners {
+        corners[i] = Point{X: cx + c.X*cos - c.Y*sin, Y: cy + c.X*sin + c.Y*cos}
+    }
+    return corners
+}
+
+// RectFromCorners восстанавливает прямоугольник по углам в порядке RectCorners.
+// Если точки не образуют прямоугольник, возвращаются габариты без поворота
+func RectFromCorners(points []Point) (x, y, width, height, rotation float64) {
+    if len(points) == 5 && points[0] == points[4] {
+        points = points[:4]
+    }
+
+    if len(points) == 4 {
+        ax, ay := points[1].X-points[0].X, points[1].Y-points[0].Y
+        bx, by := points[2].X-points[1].X, points[2].Y-points[1].Y
+        cx, cy := points[3].X-points[2].X, points[3].Y-points[2].Y
+        width, height = math.Hypot(ax, ay), math.Hypot(bx, by)
+        if width > 1e-6 && height > 1e-6 && math.Abs(ax*bx+ay*by) < 1e-3*width*height &&
+            math.Abs(ax+cx) < 1e-3 && math.Abs(ay+cy) < 1e-3 {
+            rotation = math.Atan2(ay, ax) * 180 / math.Pi
+            centerX := (points[0].X + points[2].X) / 2
+            centerY := (points[0].Y + points[2].Y) / 2
+            return centerX - width/2, centerY - height/2, width, height, rotation
+        }
+    }
+
+    bounds := Rect{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+    for _, p := range points {
+        bounds.MinX, bounds.MinY = math.Min(bounds.MinX, p.X), math.Min(bounds.MinY, p.Y)
+        bounds.MaxX, bounds.MaxY = math.Max(bounds.MaxX, p.X), math.Max(bounds.MaxY, p.Y)
+    }
+    if len(points) == 0 {
+        return 0, 0, 0, 0, 0
+    }
+    return bounds.MinX, bounds.MinY, bounds.MaxX - bounds.MinX, bounds.MaxY - bounds.MinY, 0
+}
+
+// DistanceToRect возвращает расстояние от точки до прямоугольника (x, y - левый верхний угол),
+// повернутого на rotation градусов вокруг центра; 0, если точка внутри
+func DistanceToRect(p Point, x, y, width, height, rotation float64) float64 {
+    sin, cos := math.Sincos(rotation * math.Pi / 180)
+    dx, dy := p.X-(x+width/2), p.Y-(y+height/2)
+    // Переводим точку в систему координат прямоугольника
+    lx, ly := dx*cos+dy*sin, -dx*sin+dy*cos
+    ox := math.Max(math.Abs(lx)-width/2, 0)
+    oy := math.Max(math.Abs(ly)-height/2, 0)
+    return math.Hypot(ox, oy)
+}
+
+// DistanceToSegment возвращает расстояние от точки до отрезка a-b
+func DistanceToSegment(p, a, b Point) float64 {
+    dx, dy := b.X-a.X, b.Y-a.Y
+    lengthSq := dx*dx + dy*dy
+    if lengthSq == 0 {
+        return math.Hypot(p.X-a.X, p.Y-a.Y)
+    }
+    t := math.Max(0, math.Min(1, ((p.X-a.X)*dx+(p.Y-a.Y)*dy)/lengthSq))
+    return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
+
+// SegmentsIntersect проверяет, пересекаются ли отрезки ab и cd
+func SegmentsIntersect(a, b, c, d Point) bool {
+    cross := func(o, p, q Point) float64 {
+        return (p.X-o.X)*(q.Y-o.Y) - (p.Y-o.Y)*(q.X-o.X)
+    }
+    d1, d2 := cross(c, d, a), cross(c, d, b)
+    d3, d4 := cross(a, b, c), cross(a, b, d)
+    return (d1 > 0) != (d2 > 0) && d1 != 0 && d2 != 0 && (d3 > 0) != (d4 > 0) && d3 != 0 && d4 != 0
+}
+
+// PointInPolygon проверяет, лежит ли точка внутри многоугольника (метод лучей)
+func PointInPolygon(p Point, polygon []Point) bool {
+    inside := false
+    for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+        a, b := polygon[i], polygon[j]
+        if (a.Y > p.Y) != (b.Y > p.Y) && p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+            inside = !inside
+        }
+    }
+    return inside
+}
+
+// DistanceToPolygon возвращает расстояние от точки до многоугольника; 0, если точка внутри
+func DistanceToPolygon(p Point, polygon []Point) float64 {
+    if PointInPolygon(p, polygon) {
+        return 0
+    }
+    distance := math.Inf(1)
+    for i := range polygon {
+        distance = math.Min(distance, DistanceToSegment(p, polygon[i], polygon[(i+1)%len(polygon)]))
+    }
+    return distance
+}
+
+// PolygonBounds возвращает описанный прямоугольник многоугольника
+func PolygonBounds(polygon []Point) Rect {
+    if len(polygon) == 0 {
+        return Rect{}
+    }
+    b := Rect{MinX: polygon[0].X, MinY: polygon[0].Y, MaxX: polygon[0].X, MaxY: polygon[0].Y}
+    for _, p := range polygon[1:] {
+        b = Rect{MinX: math.Min(b.MinX, p.X), MinY: math.Min(b.MinY, p.Y), MaxX: math.Max(b.MaxX, p.X), MaxY: math.Max(b.MaxY, p.Y)}
+    }
+    return b
+}
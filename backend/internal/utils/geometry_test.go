@@ -0,0 +1,30 @@
+package utils
+
+import "testing"
+
+func TestSegmentsIntersect(t *testing.T) {
+    tests := []struct {
+        name       string
+        a, b, c, d Point
+        want       bool
+    }{
+        {"crossing", Point{0, 0}, Point{2, 2}, Point{0, 2}, Point{2, 0}, true},
+        {"perpendicular", Point{0, 1}, Point{4, 1}, Point{2, 0}, Point{2, 3}, true},
+        {"parallel", Point{0, 0}, Point{4, 0}, Point{0, 1}, Point{4, 1}, false},
+        {"collinear overlapping", Point{0, 0}, Point{4, 0}, Point{2, 0}, Point{6, 0}, false},
+        {"disjoint", Point{0, 0}, Point{1, 1}, Point{2, 0}, Point{3, -1}, false},
+        {"would cross if extended", Point{0, 0}, Point{1, 0}, Point{2, -1}, Point{2, 1}, false},
+        {"touching endpoint", Point{0, 0}, Point{2, 0}, Point{2, 0}, Point{2, 2}, false},
+        {"endpoint on segment", Point{0, 0}, Point{4, 0}, Point{2, 0}, Point{2, 3}, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := SegmentsIntersect(tt.a, tt.b, tt.c, tt.d); got != tt.want {
+                t.Errorf("SegmentsIntersect(%v, %v, %v, %v) = %v, want %v", tt.a, tt.b, tt.c, tt.d, got, tt.want)
+            }
+            if got := SegmentsIntersect(tt.c, tt.d, tt.a, tt.b); got != tt.want {
+                t.Errorf("SegmentsIntersect(%v, %v, %v, %v) = %v, want %v", tt.c, tt.d, tt.a, tt.b, got, tt.want)
+            }
+        })
+    }
+}